@@ -0,0 +1,94 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+// Act returns the action of the policy for the observation by "act" of the
+// model, which is declared as `def act(self, observation)`. The
+// observation is redacted in the same way as Predict.
+func (s *State) Act(ctx *core.Context, observation data.Value) (data.Value, error) {
+	called := time.Now()
+	if err := s.authorize(ctx, ActionPredict); err != nil {
+		return nil, err
+	}
+	s.lockForPredict(called)
+	defer s.rwm.RUnlock()
+	if err := s.predictLimiter.checkRate("predicts"); err != nil {
+		return nil, err
+	}
+	obs, err := s.redact(observation)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := s.callPython(callPredict, "act", obs)
+	end := time.Now()
+	s.metrics.observePredict(end, end.Sub(start), err)
+	return res, err
+}
+
+// Observe buffers the transition, which is a map such as {"observation",
+// "action", "reward", "next_observation", "done"}, and passes buffered
+// transitions as an array to "observe" of the model, which is declared as
+// `def observe(self, transitions)`, when the buffer has
+// experience_batch_size transitions. The transition is redacted in the same
+// way as Write. Buffered transitions are discarded by Flush.
+func (s *State) Observe(ctx *core.Context, transition data.Value) error {
+	if err := s.authorize(ctx, ActionTrain); err != nil {
+		return err
+	}
+	if transition.Type() != data.TypeMap {
+		return fmt.Errorf("a transition must be a map: %v", transition.Type())
+	}
+	t, err := s.redact(transition)
+	if err != nil {
+		return err
+	}
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return err
+	}
+	s.experiences = append(s.experiences, t)
+	size := s.params.ExperienceBatchSize
+	if size <= 0 {
+		size = s.params.BatchSize
+	}
+	if len(s.experiences) < size {
+		return nil
+	}
+
+	batch := s.experiences
+	s.experiences = nil
+	defer s.predictCache.invalidate()
+	if _, err := s.callPython(callTrain, "observe", batch); err != nil {
+		return fmt.Errorf("cannot observe %v transitions: %v", len(batch), err)
+	}
+	return nil
+}
+
+// Act returns the action of the policy of the state for the observation.
+// See State.Act for details.
+func Act(ctx *core.Context, stateName string, observation data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.Act(ctx, observation)
+}
+
+// Observe gives the transition to the policy of the state. See
+// State.Observe for details. A return value is always nil.
+func Observe(ctx *core.Context, stateName string, transition data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.Observe(ctx, transition)
+}
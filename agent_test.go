@@ -0,0 +1,71 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestAgent(t *testing.T) {
+	Convey("Given a state hosting a policy", t, func() {
+		ctx := core.NewContext(nil)
+		var observed []data.Value
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				switch funcName {
+				case "act":
+					return data.String("left"), nil
+				case "observe":
+					observed = dt
+				}
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 10, ExperienceBatchSize: 2}}
+		So(s.setUpParams(), ShouldBeNil)
+		transition := func(r int) data.Value {
+			return data.Map{"observation": data.Int(r), "action": data.String("left"), "reward": data.Int(r)}
+		}
+
+		Convey("When an action is requested", func() {
+			a, err := s.Act(ctx, data.Map{"x": data.Int(1)})
+
+			Convey("Then it should return the action of the policy", func() {
+				So(err, ShouldBeNil)
+				So(a, ShouldEqual, data.String("left"))
+			})
+		})
+
+		Convey("When transitions are observed", func() {
+			So(s.Observe(ctx, transition(1)), ShouldBeNil)
+
+			Convey("Then they should be buffered until the batch is full", func() {
+				So(b.calls, ShouldBeEmpty)
+				So(s.Status()["buffered_experiences"], ShouldEqual, data.Int(1))
+			})
+
+			Convey("Then the batch should be passed to observe", func() {
+				So(s.Observe(ctx, transition(2)), ShouldBeNil)
+				So(b.calls, ShouldResemble, []string{"observe"})
+				So(observed, ShouldResemble, []data.Value{data.Array{transition(1), transition(2)}})
+				So(s.experiences, ShouldBeEmpty)
+			})
+
+			Convey("Then they should be discarded by Flush", func() {
+				ctx.SharedStates.Add("agent", "pymlstate", s)
+				_, err := Flush(ctx, "agent")
+				So(err, ShouldBeNil)
+				So(s.experiences, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a transition isn't a map", func() {
+			err := s.Observe(ctx, data.Int(1))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,131 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// alertErrorRateWindow is the window of the error rate compared with
+	// alert_error_rate.
+	alertErrorRateWindow = time.Minute
+
+	// alertMinCalls is the min number of calls in alertErrorRateWindow to
+	// evaluate the error rate, so that a few errors don't raise an alert.
+	alertMinCalls = 10
+)
+
+// alerter raises alerts when the loss stays above alert_loss for
+// alert_loss_for or when the error rate of fit and predict calls in the
+// last minute exceeds alert_error_rate. EventAlert is emitted when an alert
+// starts firing and EventAlertResolved is emitted when it stops.
+type alerter struct {
+	lossThreshold      float64
+	lossFor            time.Duration
+	errorRateThreshold float64
+
+	mu        sync.Mutex
+	lossSince time.Time
+	firing    map[string]bool
+}
+
+func newAlerter(p *MLParams) *alerter {
+	a := &alerter{
+		firing: map[string]bool{},
+	}
+	a.setThresholds(p)
+	return a
+}
+
+// setThresholds updates thresholds. States of alerts are kept.
+func (a *alerter) setThresholds(p *MLParams) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lossThreshold = p.AlertLoss
+	a.lossFor = p.AlertLossFor
+	a.errorRateThreshold = p.AlertErrorRate
+}
+
+// check evaluates rules with the result of fit, which is nil for predict
+// calls, and returns events of alerts changing their states. It returns nil
+// when a is nil.
+func (a *alerter) check(now time.Time, res *FitResult, m *rollingMetrics) []Event {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var events []Event
+	if a.lossThreshold > 0 && res != nil && res.Loss != nil {
+		loss := *res.Loss
+		if loss <= a.lossThreshold {
+			a.lossSince = time.Time{}
+		} else if a.lossSince.IsZero() {
+			a.lossSince = now
+		}
+		above := !a.lossSince.IsZero() && now.Sub(a.lossSince) >= a.lossFor
+		if e, ok := a.set(now, "loss", above, loss, a.lossThreshold); ok {
+			e.Details["for"] = data.String(a.lossFor.String())
+			events = append(events, e)
+		}
+	}
+
+	if a.errorRateThreshold > 0 {
+		agg := m.aggregate(now, alertErrorRateWindow)
+		if calls := agg.fits + agg.predicts; calls >= alertMinCalls {
+			rate := float64(agg.fitErrors+agg.predictErrors) / float64(calls)
+			if e, ok := a.set(now, "error_rate", rate > a.errorRateThreshold, rate, a.errorRateThreshold); ok {
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
+
+// set updates the state of the rule and returns an event when it changes.
+func (a *alerter) set(now time.Time, rule string, firing bool, value, threshold float64) (Event, bool) {
+	if a.firing[rule] == firing {
+		return Event{}, false
+	}
+	a.firing[rule] = firing
+	t := EventAlert
+	if !firing {
+		t = EventAlertResolved
+	}
+	return Event{
+		Type: t,
+		Time: now,
+		Details: data.Map{
+			"rule":      data.String(rule),
+			"value":     data.Float(value),
+			"threshold": data.Float(threshold),
+		},
+	}, true
+}
+
+// status returns names of firing rules.
+func (a *alerter) status() data.Array {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rules := []string{}
+	for r, f := range a.firing {
+		if f {
+			rules = append(rules, r)
+		}
+	}
+	sort.Strings(rules)
+	res := make(data.Array, len(rules))
+	for i, r := range rules {
+		res[i] = data.String(r)
+	}
+	return res
+}
+
+// checkAlerts emits events of alerts.
+func (s *State) checkAlerts(now time.Time, res *FitResult) {
+	for _, e := range s.alerter.check(now, res, &s.metrics) {
+		s.hooks.emit(e)
+	}
+}
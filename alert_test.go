@@ -0,0 +1,82 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestAlerter(t *testing.T) {
+	Convey("Given an alerter of the loss", t, func() {
+		a := newAlerter(&MLParams{AlertLoss: 1, AlertLossFor: time.Minute})
+		var m rollingMetrics
+		now := time.Unix(1000000, 0)
+		loss := func(x float64) *FitResult { return &FitResult{Loss: &x} }
+
+		Convey("When the loss stays above the threshold", func() {
+			e1 := a.check(now, loss(2), &m)
+			e2 := a.check(now.Add(30*time.Second), loss(3), &m)
+			e3 := a.check(now.Add(time.Minute), loss(2), &m)
+
+			Convey("Then an alert should fire after the duration", func() {
+				So(e1, ShouldBeEmpty)
+				So(e2, ShouldBeEmpty)
+				So(len(e3), ShouldEqual, 1)
+				So(e3[0].Type, ShouldEqual, EventAlert)
+				So(e3[0].Details["rule"], ShouldEqual, data.String("loss"))
+				So(e3[0].Details["value"], ShouldEqual, data.Float(2))
+				So(a.status(), ShouldResemble, data.Array{data.String("loss")})
+			})
+
+			Convey("And the loss falls below the threshold", func() {
+				e := a.check(now.Add(2*time.Minute), loss(0.5), &m)
+
+				Convey("Then the alert should be resolved", func() {
+					So(len(e), ShouldEqual, 1)
+					So(e[0].Type, ShouldEqual, EventAlertResolved)
+					So(a.status(), ShouldBeEmpty)
+				})
+			})
+		})
+
+		Convey("When the loss falls below the threshold before the duration", func() {
+			a.check(now, loss(2), &m)
+			a.check(now.Add(30*time.Second), loss(0.5), &m)
+			e := a.check(now.Add(time.Minute), loss(2), &m)
+
+			Convey("Then no alert should fire", func() {
+				So(e, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a state alerting on the error rate", t, func() {
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return nil, errors.New("failed")
+			},
+		}
+		s := &State{base: b, params: MLParams{AlertErrorRate: 0.5}}
+		So(s.setUpParams(), ShouldBeNil)
+		events := []Event{}
+		s.OnEvent(func(e Event) {
+			if e.Type == EventAlert {
+				events = append(events, e)
+			}
+		})
+
+		Convey("When predictions keep failing", func() {
+			for i := 0; i < alertMinCalls; i++ {
+				s.Predict(nil, data.Map{"x": data.Int(i)})
+			}
+
+			Convey("Then an alert should fire once", func() {
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Details["rule"], ShouldEqual, data.String("error_rate"))
+				So(s.Status()["alerts"], ShouldResemble, data.Array{data.String("error_rate")})
+			})
+		})
+	})
+}
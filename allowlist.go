@@ -0,0 +1,118 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"sync"
+)
+
+var (
+	featureAllowlistMutex sync.RWMutex
+	featureAllowlist      allowlistNode
+)
+
+// allowlistNode is a tree of allowed keys. A nil child allows the whole
+// value of the key.
+type allowlistNode map[string]allowlistNode
+
+// SetFeatureAllowlist restricts fields of records which any pymlstate state
+// of the process passes to Python to the paths. A path is keys of maps
+// joined by "." such as "user.age", and allows the whole value at it. Other
+// fields are removed from records given by Write, Fit, and Predict before
+// other preprocessors, regardless of parameters of states. The allowlist is
+// removed when paths is nil.
+//
+// It's a deployment-level configuration, which should be set by the program
+// embedding SensorBee before any state is created.
+func SetFeatureAllowlist(paths []string) error {
+	var root allowlistNode
+	if paths != nil {
+		root = allowlistNode{}
+		for _, p := range paths {
+			if err := root.add(p); err != nil {
+				return err
+			}
+		}
+	}
+	featureAllowlistMutex.Lock()
+	defer featureAllowlistMutex.Unlock()
+	featureAllowlist = root
+	return nil
+}
+
+func (n allowlistNode) add(path string) error {
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" || strings.ContainsAny(k, "[]\"") {
+			return fmt.Errorf("invalid feature allowlist path '%v': it must be keys of maps joined by '.'", path)
+		}
+	}
+	for i, k := range keys {
+		child, ok := n[k]
+		if ok && child == nil {
+			// The parent is already allowed as a whole.
+			return nil
+		}
+		if i == len(keys)-1 {
+			n[k] = nil
+			return nil
+		}
+		if !ok {
+			child = allowlistNode{}
+			n[k] = child
+		}
+		n = child
+	}
+	return nil
+}
+
+// filter returns a copy of the map having only allowed fields.
+func (n allowlistNode) filter(m data.Map) data.Map {
+	res := make(data.Map, len(n))
+	for k, child := range n {
+		v, ok := m[k]
+		if !ok {
+			continue
+		}
+		if child == nil {
+			res[k] = v
+			continue
+		}
+		if sub, err := data.AsMap(v); err == nil {
+			res[k] = child.filter(sub)
+		}
+	}
+	return res
+}
+
+func currentFeatureAllowlist() allowlistNode {
+	featureAllowlistMutex.RLock()
+	defer featureAllowlistMutex.RUnlock()
+	return featureAllowlist
+}
+
+// applyFeatureAllowlist removes fields not in the feature allowlist from
+// records in v.
+func applyFeatureAllowlist(v data.Value) (data.Value, error) {
+	n := currentFeatureAllowlist()
+	if n == nil {
+		return v, nil
+	}
+	return mapRecords(v, func(m data.Map) (data.Map, error) {
+		return n.filter(m), nil
+	})
+}
+
+// allowTupleFeatures returns a copy of the tuple whose records have only
+// fields in the feature allowlist.
+func allowTupleFeatures(t *core.Tuple) (*core.Tuple, error) {
+	n := currentFeatureAllowlist()
+	if n == nil {
+		return t, nil
+	}
+	return mapTupleRecords(t, func(m data.Map) (data.Map, error) {
+		return n.filter(m), nil
+	})
+}
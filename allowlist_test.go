@@ -0,0 +1,84 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestFeatureAllowlist(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a feature allowlist", t, func() {
+		So(SetFeatureAllowlist([]string{"x", "user.age", "user.address.city"}), ShouldBeNil)
+		Reset(func() {
+			SetFeatureAllowlist(nil)
+		})
+		rec := data.Map{
+			"x":     data.Int(1),
+			"email": data.String("a@example.com"),
+			"user": data.Map{
+				"age":     data.Int(20),
+				"name":    data.String("a"),
+				"address": data.Map{"city": data.String("Tokyo"), "street": data.String("1-2-3")},
+			},
+		}
+
+		Convey("When records are filtered", func() {
+			v, err := applyFeatureAllowlist(data.Array{rec})
+
+			Convey("Then only allowed fields should remain", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{data.Map{
+					"x": data.Int(1),
+					"user": data.Map{
+						"age":     data.Int(20),
+						"address": data.Map{"city": data.String("Tokyo")},
+					},
+				}})
+				So(rec, ShouldContainKey, "email")
+			})
+		})
+
+		Convey("When a state predicts the record", func() {
+			var got data.Value
+			b := &fakeBackend{
+				call: func(funcName string, dt ...data.Value) (data.Value, error) {
+					got = dt[0]
+					return data.Null{}, nil
+				},
+			}
+			s := &State{base: b}
+			_, err := s.Predict(ctx, rec)
+
+			Convey("Then Python should receive only allowed fields", func() {
+				So(err, ShouldBeNil)
+				m, _ := data.AsMap(got)
+				So(m, ShouldNotContainKey, "email")
+				So(m["user"], ShouldNotContainKey, "name")
+				So(s.Status()["feature_allowlist"], ShouldEqual, data.Bool(true))
+			})
+		})
+
+		Convey("When a tuple is written", func() {
+			tu := &core.Tuple{Data: data.Map{"data": rec}}
+			res, err := allowTupleFeatures(tu)
+
+			Convey("Then the copy should have only allowed fields", func() {
+				So(err, ShouldBeNil)
+				So(res.Data["data"], ShouldNotContainKey, "email")
+				So(tu.Data["data"], ShouldContainKey, "email")
+			})
+		})
+	})
+
+	Convey("Given a path having an index", t, func() {
+		err := SetFeatureAllowlist([]string{"xs[0]"})
+
+		Convey("Then it should be rejected", func() {
+			So(err, ShouldNotBeNil)
+			So(currentFeatureAllowlist(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,282 @@
+package pymlstate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sort"
+)
+
+// encodeArrow encodes records as an Arrow IPC stream having a record batch.
+// Each record must be a map of numeric values. A column is created for each
+// key appearing in any record in ascending order of keys, and all values are
+// stored as nullable float64. Missing keys and nulls become nulls.
+//
+// Python can read the stream without copying values by
+// pyarrow.ipc.open_stream(blob).read_all(), which can be converted to a
+// pandas DataFrame by to_pandas().
+func encodeArrow(records data.Array) ([]byte, error) {
+	names, cols, valid, err := arrowColumns(records)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	nodes := make([][2]int64, len(cols))
+	buffers := make([][2]int64, 0, 2*len(cols))
+	for i, c := range cols {
+		nulls := 0
+		for _, ok := range valid[i] {
+			if !ok {
+				nulls++
+			}
+		}
+		nodes[i] = [2]int64{int64(len(records)), int64(nulls)}
+		validity := int64(len(body))
+		if nulls > 0 {
+			bitmap := make([]byte, (len(records)+7)/8)
+			for j, ok := range valid[i] {
+				if ok {
+					bitmap[j/8] |= 1 << uint(j%8)
+				}
+			}
+			body = append(body, bitmap...)
+			buffers = append(buffers, [2]int64{validity, int64(len(bitmap))})
+			body = padTo8(body)
+		} else {
+			buffers = append(buffers, [2]int64{validity, 0})
+		}
+		values := int64(len(body))
+		for _, v := range c {
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+			body = append(body, b[:]...)
+		}
+		buffers = append(buffers, [2]int64{values, int64(len(body)) - values})
+	}
+
+	w := &bytes.Buffer{}
+	writeArrowMessage(w, arrowHeaderSchema, nil, func(b *fbBuilder, ref int) {
+		// Schema: endianness (omitted, little), fields.
+		s := b.table(ref, []fbSlot{{}, {size: 4}})
+		fields := b.offsetVector(s[1], len(names))
+		for i, name := range names {
+			// Field: name, nullable, type_type, type, dictionary, children.
+			f := b.table(fields[i], []fbSlot{{size: 4}, {size: 1, val: 1},
+				{size: 1, val: arrowTypeFloatingPoint}, {size: 4}, {}, {size: 4}})
+			b.string(f[0], name)
+			b.table(f[3], []fbSlot{{size: 2, val: arrowPrecisionDouble}})
+			b.offsetVector(f[5], 0)
+		}
+	})
+	writeArrowMessage(w, arrowHeaderRecordBatch, body, func(b *fbBuilder, ref int) {
+		// RecordBatch: length, nodes, buffers.
+		rb := b.table(ref, []fbSlot{{size: 8, val: uint64(len(records))}, {size: 4}, {size: 4}})
+		b.structVector(rb[1], nodes)
+		b.structVector(rb[2], buffers)
+	})
+	// The end-of-stream marker.
+	w.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	return w.Bytes(), nil
+}
+
+// arrowColumns converts records to columns. valid tells whether each value
+// of columns isn't null.
+func arrowColumns(records data.Array) ([]string, [][]float64, [][]bool, error) {
+	keys := map[string]struct{}{}
+	for _, r := range records {
+		m, err := data.AsMap(r)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("wire_format 'arrow' requires records to be maps: %v", err)
+		}
+		for k := range m {
+			keys[k] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	cols := make([][]float64, len(names))
+	valid := make([][]bool, len(names))
+	for i, name := range names {
+		c := make([]float64, len(records))
+		valid[i] = make([]bool, len(records))
+		for j, r := range records {
+			v, ok := r.(data.Map)[name]
+			switch {
+			case !ok || v.Type() == data.TypeNull:
+			case v.Type() == data.TypeInt || v.Type() == data.TypeFloat:
+				c[j], _ = data.ToFloat(v)
+				valid[i][j] = true
+			default:
+				return nil, nil, nil, fmt.Errorf("wire_format 'arrow' requires '%v' to be a number: %v", name, v)
+			}
+		}
+		cols[i] = c
+	}
+	return names, cols, valid, nil
+}
+
+const (
+	arrowMetadataV5        = 4
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+	arrowTypeFloatingPoint = 3
+	arrowPrecisionDouble   = 2
+)
+
+// writeArrowMessage writes an encapsulated Arrow IPC message: the
+// continuation marker, the size of the metadata, the Message flatbuffer
+// padded to 8 bytes, and the body. header writes the header table of the
+// message referred by ref.
+func writeArrowMessage(w *bytes.Buffer, headerType byte, body []byte, header func(b *fbBuilder, ref int)) {
+	b := &fbBuilder{}
+	b.putUint32(0) // The offset to the root table.
+	// Message: version, header_type, header, bodyLength.
+	m := b.table(0, []fbSlot{{size: 2, val: arrowMetadataV5}, {size: 1, val: uint64(headerType)},
+		{size: 4}, {size: 8, val: uint64(len(body))}})
+	header(b, m[2])
+	b.buf = padTo8(b.buf)
+
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:4], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(b.buf)))
+	w.Write(prefix[:])
+	w.Write(b.buf)
+	w.Write(body)
+}
+
+func padTo8(b []byte) []byte {
+	for len(b)%8 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// fbBuilder builds a FlatBuffers buffer from front to back. Because offsets
+// of FlatBuffers must point forward, an object referring to other objects is
+// written first with zero offsets, which are patched when the referred
+// objects are written.
+type fbBuilder struct {
+	buf []byte
+}
+
+// fbSlot is a field of a table. size is 1, 2, 4, or 8, and a field whose size
+// is 0 is absent. An offset is a 4-byte field patched after the table is
+// written.
+type fbSlot struct {
+	size int
+	val  uint64
+}
+
+func (b *fbBuilder) align(n, rem int) {
+	for len(b.buf)%n != rem {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) putUint32(v uint32) {
+	var p [4]byte
+	binary.LittleEndian.PutUint32(p[:], v)
+	b.buf = append(b.buf, p[:]...)
+}
+
+// patch sets the offset at ref to the current position.
+func (b *fbBuilder) patch(ref int) {
+	binary.LittleEndian.PutUint32(b.buf[ref:], uint32(len(b.buf)-ref))
+}
+
+// table writes a vtable and a table referred by the offset at ref. It returns
+// positions of fields in the buffer, which are used to patch offsets. Fields
+// are laid out in descending order of their sizes after the table starting
+// at 4 mod 8 so that all of them are aligned.
+func (b *fbBuilder) table(ref int, slots []fbSlot) []int {
+	order := make([]int, len(slots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return slots[order[i]].size > slots[order[j]].size })
+	offs := make([]int, len(slots))
+	size := 4
+	for _, i := range order {
+		if slots[i].size == 0 {
+			continue
+		}
+		offs[i] = size
+		size += slots[i].size
+	}
+
+	b.align(2, 0)
+	vt := len(b.buf)
+	vtable := make([]byte, 4+2*len(slots))
+	binary.LittleEndian.PutUint16(vtable, uint16(len(vtable)))
+	binary.LittleEndian.PutUint16(vtable[2:], uint16(size))
+	for i, o := range offs {
+		binary.LittleEndian.PutUint16(vtable[4+2*i:], uint16(o))
+	}
+	b.buf = append(b.buf, vtable...)
+
+	b.align(8, 4)
+	t := len(b.buf)
+	b.patch(ref)
+	b.putUint32(uint32(t - vt))
+	b.buf = append(b.buf, make([]byte, size-4)...)
+	pos := make([]int, len(slots))
+	for i, s := range slots {
+		p := t + offs[i]
+		pos[i] = p
+		switch s.size {
+		case 1:
+			b.buf[p] = byte(s.val)
+		case 2:
+			binary.LittleEndian.PutUint16(b.buf[p:], uint16(s.val))
+		case 4:
+			binary.LittleEndian.PutUint32(b.buf[p:], uint32(s.val))
+		case 8:
+			binary.LittleEndian.PutUint64(b.buf[p:], s.val)
+		}
+	}
+	return pos
+}
+
+// offsetVector writes a vector of n offsets referred by ref and returns their
+// positions.
+func (b *fbBuilder) offsetVector(ref, n int) []int {
+	b.align(4, 0)
+	b.patch(ref)
+	b.putUint32(uint32(n))
+	pos := make([]int, n)
+	for i := range pos {
+		pos[i] = len(b.buf)
+		b.putUint32(0)
+	}
+	return pos
+}
+
+// structVector writes a vector of structs having two longs, which are
+// FieldNode and Buffer of Arrow, referred by ref.
+func (b *fbBuilder) structVector(ref int, vs [][2]int64) {
+	b.align(8, 4)
+	b.patch(ref)
+	b.putUint32(uint32(len(vs)))
+	for _, v := range vs {
+		var p [16]byte
+		binary.LittleEndian.PutUint64(p[:8], uint64(v[0]))
+		binary.LittleEndian.PutUint64(p[8:], uint64(v[1]))
+		b.buf = append(b.buf, p[:]...)
+	}
+}
+
+// string writes a null-terminated string referred by ref.
+func (b *fbBuilder) string(ref int, s string) {
+	b.align(4, 0)
+	b.patch(ref)
+	b.putUint32(uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+}
@@ -0,0 +1,179 @@
+package pymlstate
+
+import (
+	"encoding/binary"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"testing"
+)
+
+// fbTable reads a table of a FlatBuffers buffer for tests.
+type fbTable struct {
+	buf []byte
+	pos int
+}
+
+func fbRoot(buf []byte) fbTable {
+	return fbTable{buf, int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field returns the position of the field or -1 when it's absent.
+func (t fbTable) field(i int) int {
+	vt := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	if 4+2*i >= int(binary.LittleEndian.Uint16(t.buf[vt:])) {
+		return -1
+	}
+	o := int(binary.LittleEndian.Uint16(t.buf[vt+4+2*i:]))
+	if o == 0 {
+		return -1
+	}
+	return t.pos + o
+}
+
+func (t fbTable) deref(i int) int {
+	p := t.field(i)
+	return p + int(binary.LittleEndian.Uint32(t.buf[p:]))
+}
+
+func (t fbTable) table(i int) fbTable {
+	return fbTable{t.buf, t.deref(i)}
+}
+
+func (t fbTable) uint(i, size int) uint64 {
+	p := t.field(i)
+	switch size {
+	case 1:
+		return uint64(t.buf[p])
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(t.buf[p:]))
+	default:
+		return binary.LittleEndian.Uint64(t.buf[p:])
+	}
+}
+
+// readArrowMessage returns the Message table, the body, and the rest of the
+// stream.
+func readArrowMessage(b []byte) (fbTable, []byte, []byte) {
+	So(binary.LittleEndian.Uint32(b), ShouldEqual, 0xffffffff)
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	So(n%8, ShouldEqual, 0)
+	m := fbRoot(b[8 : 8+n])
+	So(m.uint(0, 2), ShouldEqual, arrowMetadataV5)
+	bodyLen := int(m.uint(3, 8))
+	So(bodyLen%8, ShouldEqual, 0)
+	return m, b[8+n : 8+n+bodyLen], b[8+n+bodyLen:]
+}
+
+func TestEncodeArrow(t *testing.T) {
+	Convey("Given records of numbers", t, func() {
+		records := data.Array{
+			data.Map{"x": data.Float(1.5), "y": data.Int(2)},
+			data.Map{"x": data.Float(-3), "z": data.Null{}},
+			data.Map{"x": data.Float(0.25), "y": data.Int(4)},
+		}
+
+		Convey("When they're encoded as an Arrow stream", func() {
+			b, err := encodeArrow(records)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have a schema of float64 columns", func() {
+				m, body, _ := readArrowMessage(b)
+				So(m.uint(1, 1), ShouldEqual, arrowHeaderSchema)
+				So(body, ShouldBeEmpty)
+
+				s := m.table(2)
+				fields := s.deref(1)
+				So(binary.LittleEndian.Uint32(s.buf[fields:]), ShouldEqual, 3)
+				names := []string{}
+				for i := 0; i < 3; i++ {
+					p := fields + 4 + 4*i
+					f := fbTable{s.buf, p + int(binary.LittleEndian.Uint32(s.buf[p:]))}
+					name := f.deref(0)
+					l := int(binary.LittleEndian.Uint32(s.buf[name:]))
+					names = append(names, string(s.buf[name+4:name+4+l]))
+					So(f.uint(1, 1), ShouldEqual, 1)
+					So(f.uint(2, 1), ShouldEqual, arrowTypeFloatingPoint)
+					So(f.table(3).uint(0, 2), ShouldEqual, arrowPrecisionDouble)
+					So(f.deref(5)%4, ShouldEqual, 0)
+				}
+				So(names, ShouldResemble, []string{"x", "y", "z"})
+			})
+
+			Convey("Then it should have a record batch of the values", func() {
+				_, _, rest := readArrowMessage(b)
+				m, body, rest := readArrowMessage(rest)
+				So(m.uint(1, 1), ShouldEqual, arrowHeaderRecordBatch)
+				So(rest, ShouldResemble, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+
+				rb := m.table(2)
+				So(rb.uint(0, 8), ShouldEqual, 3)
+				long := func(p int) int64 { return int64(binary.LittleEndian.Uint64(rb.buf[p:])) }
+				nodes := rb.deref(1)
+				So((nodes+4)%8, ShouldEqual, 0)
+				So(binary.LittleEndian.Uint32(rb.buf[nodes:]), ShouldEqual, 3)
+				nullCounts := []int64{}
+				for i := 0; i < 3; i++ {
+					So(long(nodes+4+16*i), ShouldEqual, 3)
+					nullCounts = append(nullCounts, long(nodes+12+16*i))
+				}
+				So(nullCounts, ShouldResemble, []int64{0, 1, 3})
+
+				buffers := rb.deref(2)
+				So(binary.LittleEndian.Uint32(rb.buf[buffers:]), ShouldEqual, 6)
+				buffer := func(i int) []byte {
+					off, l := long(buffers+4+16*i), long(buffers+12+16*i)
+					So(off%8, ShouldEqual, 0)
+					return body[off : off+l]
+				}
+				column := func(i int) []float64 {
+					b := buffer(i)
+					res := []float64{}
+					for j := 0; j < len(b); j += 8 {
+						res = append(res, math.Float64frombits(binary.LittleEndian.Uint64(b[j:])))
+					}
+					return res
+				}
+				So(buffer(0), ShouldBeEmpty)
+				So(column(1), ShouldResemble, []float64{1.5, -3, 0.25})
+				So(buffer(2), ShouldResemble, []byte{0x05})
+				So(column(3), ShouldResemble, []float64{2, 0, 4})
+				So(buffer(4), ShouldResemble, []byte{0x00})
+				So(len(buffer(5)), ShouldEqual, 24)
+			})
+		})
+
+		Convey("When they're passed to fit with the arrow wire format", func() {
+			s := &State{params: MLParams{WireFormat: "arrow"}}
+			args, err := s.encodeWire(callTrain, []data.Value{records, data.String("key")})
+
+			Convey("Then the bucket should be an Arrow stream", func() {
+				So(err, ShouldBeNil)
+				b, _ := encodeArrow(records)
+				So(args, ShouldResemble, []data.Value{data.Blob(b), data.String("key")})
+			})
+		})
+
+		Convey("When they're passed to predict with the arrow wire format", func() {
+			s := &State{params: MLParams{WireFormat: "arrow"}}
+			args, err := s.encodeWire(callPredict, []data.Value{records})
+
+			Convey("Then they should be passed as they are", func() {
+				So(err, ShouldBeNil)
+				So(args, ShouldResemble, []data.Value{records})
+			})
+		})
+	})
+
+	Convey("Given records having a non-numeric value", t, func() {
+		records := data.Array{data.Map{"x": data.String("a")}}
+
+		Convey("When they're encoded as an Arrow stream", func() {
+			_, err := encodeArrow(records)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
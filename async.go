@@ -0,0 +1,192 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// asyncPredictions runs predictions requested by PredictAsync in the
+// background and keeps their results by handles until they're retrieved by
+// PredictResult. Results which aren't retrieved within ttl after they're
+// finished are removed.
+type asyncPredictions struct {
+	mu         sync.Mutex
+	sem        chan struct{}
+	ttl        time.Duration
+	maxPending int
+	handles    map[string]*asyncPrediction
+	// pending is the number of predictions which haven't finished.
+	pending int
+}
+
+type asyncPrediction struct {
+	done     bool
+	finished time.Time
+	result   data.Value
+	err      error
+}
+
+func newAsyncPredictions(p *MLParams) *asyncPredictions {
+	a := &asyncPredictions{handles: map[string]*asyncPrediction{}}
+	a.configure(p)
+	return a
+}
+
+// configure updates parameters. Running predictions keep the concurrency
+// given when they started.
+func (a *asyncPredictions) configure(p *MLParams) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := p.AsyncPredictConcurrency
+	if n <= 0 {
+		n = 1
+	}
+	if a.sem == nil || cap(a.sem) != n {
+		a.sem = make(chan struct{}, n)
+	}
+	a.ttl = p.AsyncResultTTL
+	a.maxPending = p.AsyncMaxPending
+}
+
+// start runs predict in the background and returns the handle of its
+// result.
+func (a *asyncPredictions) start(predict func() (data.Value, error)) (string, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(time.Now())
+	if a.maxPending > 0 && a.pending >= a.maxPending {
+		return "", fmt.Errorf("too many pending async predictions: %v", a.pending)
+	}
+	p := &asyncPrediction{}
+	a.handles[id] = p
+	a.pending++
+
+	sem := a.sem
+	go func() {
+		sem <- struct{}{}
+		res, err := predict()
+		<-sem
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		p.done, p.finished, p.result, p.err = true, time.Now(), res, err
+		a.pending--
+	}()
+	return id, nil
+}
+
+// result returns the result of the prediction of the handle. done is false
+// when the prediction hasn't finished. The result is removed once it's
+// returned.
+func (a *asyncPredictions) result(handle string) (res data.Value, done bool, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(time.Now())
+	p, ok := a.handles[handle]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown async prediction: %v", handle)
+	}
+	if !p.done {
+		return nil, false, nil
+	}
+	delete(a.handles, handle)
+	return p.result, true, p.err
+}
+
+// expire removes results which have been finished for ttl. It must be
+// called while a.mu is locked.
+func (a *asyncPredictions) expire(now time.Time) {
+	if a.ttl <= 0 {
+		return
+	}
+	for h, p := range a.handles {
+		if p.done && now.Sub(p.finished) > a.ttl {
+			delete(a.handles, h)
+		}
+	}
+}
+
+func (a *asyncPredictions) toMap() data.Map {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return data.Map{
+		"pending":  data.Int(a.pending),
+		"finished": data.Int(len(a.handles) - a.pending),
+	}
+}
+
+// PredictAsync starts the prediction of the data in the background and
+// returns its handle so that long-running predictions don't block the
+// caller. The prediction is the same as Predict and its result is retrieved
+// by PredictResult with the handle. At most async_predict_concurrency
+// predictions run at a time.
+func (s *State) PredictAsync(ctx *core.Context, dt data.Value) (string, error) {
+	if err := s.authorize(ctx, ActionPredict); err != nil {
+		return "", err
+	}
+	s.rwm.RLock()
+	a := s.asyncPredictions
+	s.rwm.RUnlock()
+	if a == nil {
+		return "", fmt.Errorf("the state doesn't support async predictions")
+	}
+	return a.start(func() (data.Value, error) {
+		return s.Predict(ctx, dt)
+	})
+}
+
+// PredictResult returns the result of the prediction started by
+// PredictAsync. It returns a map having "done", which is false while the
+// prediction is running, and "result" when the prediction has finished.
+// It returns the error of the prediction when it has failed. A finished
+// result can only be retrieved once.
+func (s *State) PredictResult(ctx *core.Context, handle string) (data.Value, error) {
+	if err := s.authorize(ctx, ActionPredict); err != nil {
+		return nil, err
+	}
+	s.rwm.RLock()
+	a := s.asyncPredictions
+	s.rwm.RUnlock()
+	if a == nil {
+		return nil, fmt.Errorf("the state doesn't support async predictions")
+	}
+	res, done, err := a.result(handle)
+	if err != nil {
+		return nil, err
+	}
+	if !done {
+		return data.Map{"done": data.Bool(false)}, nil
+	}
+	return data.Map{"done": data.Bool(true), "result": res}, nil
+}
+
+// PredictAsync starts the prediction of the data by the state in the
+// background and returns its handle. See State.PredictAsync for details.
+func PredictAsync(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	h, err := s.PredictAsync(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+	return data.String(h), nil
+}
+
+// PredictResult returns the result of the prediction of the handle returned
+// by PredictAsync. See State.PredictResult for details.
+func PredictResult(ctx *core.Context, stateName string, handle string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.PredictResult(ctx, handle)
+}
@@ -0,0 +1,96 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestPredictAsync(t *testing.T) {
+	Convey("Given a state having a slow model", t, func() {
+		ctx := core.NewContext(nil)
+		release := make(chan struct{})
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				<-release
+				m, _ := data.AsMap(dt[0])
+				if m["fail"] != nil {
+					return nil, errors.New("prediction failed")
+				}
+				return data.Float(0.5), nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1, AsyncMaxPending: 2}}
+		So(s.setUpParams(), ShouldBeNil)
+		wait := func(h string) data.Map {
+			for i := 0; i < 100; i++ {
+				res, err := s.PredictResult(ctx, h)
+				So(err, ShouldBeNil)
+				m, _ := data.AsMap(res)
+				if m["done"] == data.Bool(true) {
+					return m
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			return nil
+		}
+
+		Convey("When a prediction is started", func() {
+			h, err := s.PredictAsync(ctx, data.Map{"x": data.Int(1)})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should be pending until the model returns", func() {
+				res, err := s.PredictResult(ctx, h)
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{"done": data.Bool(false)})
+				close(release)
+			})
+
+			Convey("Then its result should be retrieved once", func() {
+				close(release)
+				So(wait(h), ShouldResemble, data.Map{"done": data.Bool(true), "result": data.Float(0.5)})
+				_, err := s.PredictResult(ctx, h)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then too many pending predictions should be refused", func() {
+				_, err := s.PredictAsync(ctx, data.Map{"x": data.Int(2)})
+				So(err, ShouldBeNil)
+				_, err = s.PredictAsync(ctx, data.Map{"x": data.Int(3)})
+				So(err, ShouldNotBeNil)
+				close(release)
+			})
+		})
+
+		Convey("When a prediction fails", func() {
+			close(release)
+			h, err := s.PredictAsync(ctx, data.Map{"fail": data.Bool(true)})
+			So(err, ShouldBeNil)
+
+			Convey("Then its result should be the error", func() {
+				var err error
+				for i := 0; i < 100; i++ {
+					var res data.Value
+					res, err = s.PredictResult(ctx, h)
+					if err != nil {
+						break
+					}
+					time.Sleep(10 * time.Millisecond)
+					So(res, ShouldResemble, data.Map{"done": data.Bool(false)})
+				}
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a handle is unknown", func() {
+			_, err := s.PredictResult(ctx, "unknown")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,147 @@
+package pymlstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditEntry is a line of the audit log.
+type auditEntry struct {
+	Timestamp    time.Time  `json:"timestamp"`
+	ModelVersion string     `json:"model_version,omitempty"`
+	RequestID    string     `json:"request_id,omitempty"`
+	Input        data.Value `json:"input,omitempty"`
+	InputHash    string     `json:"input_hash,omitempty"`
+	Output       data.Value `json:"output"`
+}
+
+// auditLogger writes predictions to a JSON lines file, which is rotated when
+// its size exceeds maxBytes. "stdout" and "stderr" write to the streams
+// without rotation. The file is opened when the first entry is written.
+type auditLogger struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	fullInput  bool
+	sampleRate float64
+
+	mu   sync.Mutex
+	rnd  *rand.Rand
+	w    io.Writer
+	f    *os.File
+	size int64
+}
+
+func newAuditLogger(p *MLParams) *auditLogger {
+	return &auditLogger{
+		path:       p.AuditLog,
+		maxBytes:   p.AuditLogMaxBytes,
+		maxBackups: p.AuditLogMaxBackups,
+		fullInput:  p.AuditFullInput,
+		sampleRate: p.AuditSampleRate,
+		rnd:        newRand(p, "audit"),
+	}
+}
+
+// record writes the prediction when it's sampled. in is the input given to
+// Predict after redaction.
+func (a *auditLogger) record(modelVersion, requestID string, in, out data.Value) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sampleRate < 1 && a.rnd.Float64() >= a.sampleRate {
+		return nil
+	}
+
+	e := &auditEntry{
+		Timestamp:    time.Now().UTC(),
+		ModelVersion: modelVersion,
+		RequestID:    requestID,
+		Output:       out,
+	}
+	if a.fullInput {
+		e.Input = in
+	} else {
+		sum := sha256.Sum256([]byte(valueKey(in)))
+		e.InputHash = hex.EncodeToString(sum[:])
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("cannot encode an audit log entry: %v", err)
+	}
+	b = append(b, '\n')
+
+	if err := a.prepare(int64(len(b))); err != nil {
+		return err
+	}
+	n, err := a.w.Write(b)
+	a.size += int64(n)
+	return err
+}
+
+// prepare opens the file or rotates it when n more bytes exceed maxBytes.
+func (a *auditLogger) prepare(n int64) error {
+	switch a.path {
+	case "stdout":
+		a.w = os.Stdout
+		return nil
+	case "stderr":
+		a.w = os.Stderr
+		return nil
+	}
+
+	if a.f != nil && a.maxBytes > 0 && a.size > 0 && a.size+n > a.maxBytes {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	if a.f == nil {
+		f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("cannot open the audit log: %v", err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		a.f, a.w, a.size = f, f, fi.Size()
+	}
+	return nil
+}
+
+// rotate renames the current file to path.1 after shifting older backups.
+// Backups more than maxBackups are removed.
+func (a *auditLogger) rotate() error {
+	if err := a.f.Close(); err != nil {
+		return err
+	}
+	a.f, a.w = nil, nil
+
+	if a.maxBackups <= 0 {
+		return os.Remove(a.path)
+	}
+	os.Remove(fmt.Sprintf("%v.%v", a.path, a.maxBackups))
+	for i := a.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%v.%v", a.path, i), fmt.Sprintf("%v.%v", a.path, i+1))
+	}
+	return os.Rename(a.path, a.path+".1")
+}
+
+func (a *auditLogger) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f, a.w = nil, nil
+	return err
+}
@@ -0,0 +1,93 @@
+package pymlstate
+
+import (
+	"bufio"
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readAuditEntries(path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	So(err, ShouldBeNil)
+	defer f.Close()
+	var res []map[string]interface{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var m map[string]interface{}
+		So(json.Unmarshal(sc.Bytes(), &m), ShouldBeNil)
+		res = append(res, m)
+	}
+	return res
+}
+
+func TestAuditLogger(t *testing.T) {
+	Convey("Given an audit logger", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_audit")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "audit.log")
+		a := newAuditLogger(&MLParams{
+			AuditLog:           path,
+			AuditLogMaxBackups: 1,
+			AuditSampleRate:    1,
+		})
+		Reset(func() {
+			a.close()
+		})
+
+		Convey("When a prediction is recorded", func() {
+			So(a.record("mnist:3", "", data.Map{"x": data.Int(1)}, data.String("a")), ShouldBeNil)
+
+			Convey("Then the entry should have the hash of the input", func() {
+				es := readAuditEntries(path)
+				So(len(es), ShouldEqual, 1)
+				So(es[0]["model_version"], ShouldEqual, "mnist:3")
+				So(es[0]["input_hash"], ShouldHaveLength, 64)
+				So(es[0], ShouldNotContainKey, "input")
+				So(es[0]["output"], ShouldEqual, "a")
+			})
+		})
+
+		Convey("When the full input is recorded", func() {
+			a.fullInput = true
+			So(a.record("", "", data.Map{"x": data.Int(1)}, data.String("a")), ShouldBeNil)
+
+			Convey("Then the entry should have the input", func() {
+				es := readAuditEntries(path)
+				So(es[0]["input"], ShouldResemble, map[string]interface{}{"x": 1.0})
+				So(es[0], ShouldNotContainKey, "input_hash")
+			})
+		})
+
+		Convey("When entries exceed the max size", func() {
+			a.maxBytes = 1
+			for i := 0; i < 3; i++ {
+				So(a.record("", "", data.Int(i), data.Int(i)), ShouldBeNil)
+			}
+
+			Convey("Then the file should be rotated keeping max backups", func() {
+				So(readAuditEntries(path), ShouldHaveLength, 1)
+				So(readAuditEntries(path+".1"), ShouldHaveLength, 1)
+				_, err := os.Stat(path + ".2")
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When predictions aren't sampled", func() {
+			a.sampleRate = 0
+			So(a.record("", "", data.Int(1), data.Int(1)), ShouldBeNil)
+
+			Convey("Then nothing should be recorded", func() {
+				_, err := os.Stat(path)
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+	})
+}
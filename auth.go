@@ -0,0 +1,110 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"sync"
+)
+
+// Action is an operation on a state checked by an Authorizer.
+type Action string
+
+const (
+	// ActionTrain is training the model by Write, WriteReplay, Fit, Flush,
+	// RetrainFrom, and FitFromReader.
+	ActionTrain Action = "train"
+
+	// ActionPredict is applying the model by Predict.
+	ActionPredict Action = "predict"
+
+	// ActionLoad is replacing the model by Load, DeployFromRegistry,
+	// ReloadModule, LoadShadow, and PromoteShadow.
+	ActionLoad Action = "load"
+
+	// ActionSave is saving the model by Save.
+	ActionSave Action = "save"
+
+	// ActionRead is reading the status of the state by Status.
+	ActionRead Action = "read"
+)
+
+// AuthRequest is an operation to be authorized.
+type AuthRequest struct {
+	// Action is the operation.
+	Action Action
+
+	// Caller is the identity of the caller returned by the function set by
+	// SetCallerResolver. It's empty when the function isn't set.
+	Caller string
+}
+
+// Authorizer decides whether a caller may operate a state. A state uses the
+// authorizer registered with the name given by the authorizer parameter.
+type Authorizer interface {
+	// Authorize returns an error when the request isn't allowed.
+	Authorize(ctx *core.Context, req *AuthRequest) error
+}
+
+var (
+	authMutex      sync.RWMutex
+	authorizers    = map[string]Authorizer{}
+	callerResolver func(ctx *core.Context) string
+)
+
+// RegisterAuthorizer registers an authorizer with a name so that states can
+// use it by the authorizer parameter.
+func RegisterAuthorizer(name string, a Authorizer) error {
+	authMutex.Lock()
+	defer authMutex.Unlock()
+	if _, ok := authorizers[name]; ok {
+		return fmt.Errorf("authorizer '%v' is already registered", name)
+	}
+	authorizers[name] = a
+	return nil
+}
+
+// SetCallerResolver sets the function returning the identity of the caller
+// from the context. The application embedding SensorBee supplies it, for
+// example, by mapping contexts of topologies to their owners.
+func SetCallerResolver(f func(ctx *core.Context) string) {
+	authMutex.Lock()
+	defer authMutex.Unlock()
+	callerResolver = f
+}
+
+// authorize checks the action with the authorizer of the state. It allows all
+// actions when the state doesn't have an authorizer, and it denies all
+// actions when the authorizer isn't registered. Training is always denied
+// on a read-only state.
+func (s *State) authorize(ctx *core.Context, action Action) error {
+	if s.readOnly && action == ActionTrain {
+		return errReadOnly
+	}
+	s.rwm.RLock()
+	name := s.params.Authorizer
+	s.rwm.RUnlock()
+	return authorizeBy(ctx, name, action)
+}
+
+// authorizeBy checks the action with the authorizer registered as name.
+func authorizeBy(ctx *core.Context, name string, action Action) error {
+	if name == "" {
+		return nil
+	}
+
+	authMutex.RLock()
+	a, ok := authorizers[name]
+	resolve := callerResolver
+	authMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("authorizer '%v' isn't registered", name)
+	}
+	req := &AuthRequest{Action: action}
+	if resolve != nil {
+		req.Caller = resolve(ctx)
+	}
+	if err := a.Authorize(ctx, req); err != nil {
+		return fmt.Errorf("%v isn't allowed: %v", action, err)
+	}
+	return nil
+}
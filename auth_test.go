@@ -0,0 +1,94 @@
+package pymlstate
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"testing"
+)
+
+type readOnlyAuthorizer struct {
+	requests []*AuthRequest
+}
+
+func (a *readOnlyAuthorizer) Authorize(ctx *core.Context, req *AuthRequest) error {
+	a.requests = append(a.requests, req)
+	if req.Caller == "admin" || req.Action == ActionPredict || req.Action == ActionRead {
+		return nil
+	}
+	return fmt.Errorf("%v can only query the model", req.Caller)
+}
+
+func TestAuthorize(t *testing.T) {
+	Convey("Given a state with a registered authorizer", t, func() {
+		a := &readOnlyAuthorizer{}
+		So(RegisterAuthorizer("test_read_only", a), ShouldBeNil)
+		caller := "analyst"
+		SetCallerResolver(func(ctx *core.Context) string {
+			return caller
+		})
+		Reset(func() {
+			authMutex.Lock()
+			delete(authorizers, "test_read_only")
+			callerResolver = nil
+			authMutex.Unlock()
+		})
+		s := &State{params: MLParams{Authorizer: "test_read_only"}}
+
+		Convey("When a caller predicts", func() {
+			err := s.authorize(nil, ActionPredict)
+
+			Convey("Then it should be allowed with the identity of the caller", func() {
+				So(err, ShouldBeNil)
+				So(a.requests, ShouldResemble, []*AuthRequest{{Action: ActionPredict, Caller: "analyst"}})
+			})
+		})
+
+		Convey("When a caller trains", func() {
+			err := s.authorize(nil, ActionTrain)
+
+			Convey("Then it should be denied", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When an admin trains", func() {
+			caller = "admin"
+			err := s.authorize(nil, ActionTrain)
+
+			Convey("Then it should be allowed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the same name is registered again", func() {
+			err := RegisterAuthorizer("test_read_only", a)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state with an unregistered authorizer", t, func() {
+		s := &State{params: MLParams{Authorizer: "test_unknown"}}
+
+		Convey("When a caller predicts", func() {
+			err := s.authorize(nil, ActionPredict)
+
+			Convey("Then it should be denied", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state without an authorizer", t, func() {
+		s := &State{}
+
+		Convey("When a caller trains", func() {
+			Convey("Then it should be allowed", func() {
+				So(s.authorize(nil, ActionTrain), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,92 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+)
+
+// Backend is a runtime running an instance of the Python model. Its
+// methods have the same semantics as those of pystate.Base, which runs the
+// instance in the embedded interpreter and is the default backend.
+type Backend interface {
+	// Call calls the method of the instance with the arguments.
+	Call(funcName string, dt ...data.Value) (data.Value, error)
+
+	// CheckTermination returns an error when the instance is terminated.
+	CheckTermination() error
+
+	// Save writes the instance to w.
+	Save(ctx *core.Context, w io.Writer, params data.Map) error
+
+	// Load replaces the instance with one read from r.
+	Load(ctx *core.Context, r io.Reader, params data.Map) error
+
+	// Terminate terminates the instance.
+	Terminate(ctx *core.Context) error
+}
+
+var _ Backend = (*pystate.Base)(nil)
+
+// newBackend creates a new instance of the Python class. The instance runs
+// in a dedicated process when isolation is "process". Dependencies are
+// checked by required_modules before the instance is created and by
+// check_dependencies after it's created. thread_limit is passed to the
+// constructor when thread_limit_param is set.
+func newBackend(baseParams *pystate.BaseParams, p *MLParams, params data.Map) (Backend, error) {
+	params = withThreadLimitParam(p, params)
+	var b Backend
+	if p.Isolation == "process" {
+		pb, err := newProcessBackend(baseParams, p, params)
+		if err != nil {
+			return nil, err
+		}
+		b = pb
+	} else {
+		if err := checkRequiredModules(p); err != nil {
+			return nil, err
+		}
+		pb, err := pystate.NewBase(baseParams, params)
+		if err != nil {
+			return nil, err
+		}
+		b = pb
+	}
+	if err := checkDependencies(b, p); err != nil {
+		b.Terminate(nil)
+		return nil, err
+	}
+	return b, nil
+}
+
+// loadBackend creates an instance from data written by Backend.Save of the
+// backend selected by isolation of p. Dependencies are checked in the same
+// way as newBackend.
+func loadBackend(ctx *core.Context, r io.Reader, p *MLParams, params data.Map) (Backend, error) {
+	params = withThreadLimitParam(p, params)
+	var b Backend
+	if p.Isolation == "process" {
+		pb, err := loadProcessBackend(ctx, r, p, params)
+		if err != nil {
+			return nil, err
+		}
+		b = pb
+	} else {
+		if err := checkRequiredModules(p); err != nil {
+			return nil, err
+		}
+		pb, err := pystate.LoadBase(ctx, r, params)
+		if err != nil {
+			return nil, err
+		}
+		b = pb
+	}
+	if err := checkDependencies(b, p); err != nil {
+		if err := b.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Warn("cannot terminate the instance of pymlstate")
+		}
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,69 @@
+package pymlstate
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"testing"
+)
+
+// fakeBackend records calls and returns results of a function instead of
+// running Python.
+type fakeBackend struct {
+	calls      []string
+	call       func(funcName string, dt ...data.Value) (data.Value, error)
+	loaded     bool
+	terminated bool
+}
+
+func (b *fakeBackend) Call(funcName string, dt ...data.Value) (data.Value, error) {
+	b.calls = append(b.calls, funcName)
+	if b.call == nil {
+		return data.Null{}, nil
+	}
+	return b.call(funcName, dt...)
+}
+
+func (b *fakeBackend) CheckTermination() error {
+	if b.terminated {
+		return fmt.Errorf("the instance is terminated")
+	}
+	return nil
+}
+
+func (b *fakeBackend) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	return nil
+}
+
+func (b *fakeBackend) Load(ctx *core.Context, r io.Reader, params data.Map) error {
+	b.loaded = true
+	return nil
+}
+
+func (b *fakeBackend) Terminate(ctx *core.Context) error {
+	b.terminated = true
+	return nil
+}
+
+func TestBackend(t *testing.T) {
+	Convey("Given a state with a fake backend", t, func() {
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.String(funcName), nil
+			},
+		}
+		s := &State{base: b}
+
+		Convey("When Python is called", func() {
+			res, err := s.callPython(callPredict, "predict", data.Int(1))
+
+			Convey("Then the call should be made to the backend", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.String("predict"))
+				So(b.calls, ShouldResemble, []string{"predict"})
+			})
+		})
+	})
+}
@@ -0,0 +1,181 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// decision is an arm chosen by Choose which waits for its reward.
+type decision struct {
+	context data.Value
+	arm     data.Value
+}
+
+// decisions keeps the latest max decisions by their IDs so that rewards can
+// be correlated with them. The oldest decisions are forgotten when the
+// number of decisions exceeds max.
+type decisions struct {
+	max int
+
+	mu        sync.Mutex
+	decisions map[string]*decision
+	order     []string
+	// expired is the number of decisions forgotten before their rewards.
+	expired int64
+}
+
+func newDecisions(max int) *decisions {
+	return &decisions{
+		max:       max,
+		decisions: map[string]*decision{},
+	}
+}
+
+func (d *decisions) add(id string, dec *decision) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.decisions[id] = dec
+	d.order = append(d.order, id)
+	for len(d.order) > d.max {
+		delete(d.decisions, d.order[0])
+		d.order = d.order[1:]
+		d.expired++
+	}
+}
+
+// take returns the decision and forgets it so that it isn't rewarded twice.
+func (d *decisions) take(id string) (*decision, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dec, ok := d.decisions[id]
+	if !ok {
+		return nil, false
+	}
+	delete(d.decisions, id)
+	for i, x := range d.order {
+		if x == id {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+	return dec, true
+}
+
+func (d *decisions) toMap() data.Map {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return data.Map{
+		"pending": data.Int(len(d.decisions)),
+		"expired": data.Int(d.expired),
+	}
+}
+
+// Choose chooses one of arms for the context by "choose" of the model,
+// which is declared as `def choose(self, context, arms)` and returns the
+// index of the chosen arm. The context and arms are redacted in the same
+// way as Predict. It returns a map having "decision_id", "arm", and
+// "index". The decision is kept by bandit_decision_window until Reward is
+// called with its ID.
+func (s *State) Choose(ctx *core.Context, context data.Value, arms data.Array) (data.Value, error) {
+	called := time.Now()
+	if err := s.authorize(ctx, ActionPredict); err != nil {
+		return nil, err
+	}
+	if len(arms) == 0 {
+		return nil, fmt.Errorf("arms must not be empty")
+	}
+	s.lockForPredict(called)
+	defer s.rwm.RUnlock()
+	if s.decisions == nil {
+		return nil, fmt.Errorf("the state doesn't keep decisions because bandit_decision_window is 0")
+	}
+	if err := s.predictLimiter.checkRate("predicts"); err != nil {
+		return nil, err
+	}
+	c, err := s.redact(context)
+	if err != nil {
+		return nil, err
+	}
+	as, err := s.redact(arms)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := s.callPython(callPredict, "choose", c, as)
+	end := time.Now()
+	s.metrics.observePredict(end, end.Sub(start), err)
+	if err != nil {
+		return nil, err
+	}
+	i, err := data.AsInt(res)
+	if err != nil {
+		return nil, fmt.Errorf("choose must return the index of an arm: %v", err)
+	}
+	if i < 0 || i >= int64(len(arms)) {
+		return nil, fmt.Errorf("choose returned an index out of arms: %v", i)
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	arm, _ := data.AsArray(as)
+	s.decisions.add(id, &decision{context: c, arm: arm[i]})
+	return data.Map{
+		"decision_id": data.String(id),
+		"arm":         arms[i],
+		"index":       data.Int(i),
+	}, nil
+}
+
+// Reward gives the reward of the decision made by Choose to "reward" of the
+// model, which is declared as `def reward(self, context, arm, reward)`.
+// The context and the arm are the redacted ones passed to "choose". It
+// fails when the decision is unknown or it has already been rewarded or
+// forgotten.
+func (s *State) Reward(ctx *core.Context, decisionID string, reward data.Value) error {
+	if err := s.authorize(ctx, ActionTrain); err != nil {
+		return err
+	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return err
+	}
+	if s.decisions == nil {
+		return fmt.Errorf("the state doesn't keep decisions because bandit_decision_window is 0")
+	}
+	dec, ok := s.decisions.take(decisionID)
+	if !ok {
+		return fmt.Errorf("unknown decision: %v", decisionID)
+	}
+	defer s.predictCache.invalidate()
+	if _, err := s.callPython(callTrain, "reward", dec.context, dec.arm, reward); err != nil {
+		return fmt.Errorf("cannot reward the decision '%v': %v", decisionID, err)
+	}
+	return nil
+}
+
+// Choose chooses one of arms for the context by the model of the state. See
+// State.Choose for details.
+func Choose(ctx *core.Context, stateName string, context data.Value, arms data.Array) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.Choose(ctx, context, arms)
+}
+
+// Reward gives the reward of the decision to the model of the state. See
+// State.Reward for details. A return value is always nil.
+func Reward(ctx *core.Context, stateName string, decisionID string, reward data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.Reward(ctx, decisionID, reward)
+}
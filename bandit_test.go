@@ -0,0 +1,80 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestBandit(t *testing.T) {
+	Convey("Given a state making decisions", t, func() {
+		ctx := core.NewContext(nil)
+		var rewarded []data.Value
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				switch funcName {
+				case "choose":
+					return data.Int(1), nil
+				case "reward":
+					rewarded = dt
+				}
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1, BanditDecisionWindow: 2}}
+		So(s.setUpParams(), ShouldBeNil)
+		user := data.Map{"user": data.String("alice")}
+		arms := data.Array{data.String("a"), data.String("b")}
+
+		Convey("When an arm is chosen", func() {
+			res, err := s.Choose(ctx, user, arms)
+			So(err, ShouldBeNil)
+			m, _ := data.AsMap(res)
+			id, _ := data.AsString(m["decision_id"])
+
+			Convey("Then it should return the chosen arm with a decision ID", func() {
+				So(m["arm"], ShouldEqual, data.String("b"))
+				So(m["index"], ShouldEqual, data.Int(1))
+				So(id, ShouldNotBeBlank)
+				So(s.Status()["decisions"], ShouldResemble, data.Map{"pending": data.Int(1), "expired": data.Int(0)})
+			})
+
+			Convey("Then its reward should be passed with the context and the arm", func() {
+				So(s.Reward(ctx, id, data.Float(1)), ShouldBeNil)
+				So(rewarded, ShouldResemble, []data.Value{user, data.String("b"), data.Float(1)})
+			})
+
+			Convey("Then it shouldn't be rewarded twice", func() {
+				So(s.Reward(ctx, id, data.Float(1)), ShouldBeNil)
+				So(s.Reward(ctx, id, data.Float(1)), ShouldNotBeNil)
+			})
+
+			Convey("Then it should be forgotten after newer decisions", func() {
+				_, err := s.Choose(ctx, user, arms)
+				So(err, ShouldBeNil)
+				_, err = s.Choose(ctx, user, arms)
+				So(err, ShouldBeNil)
+				So(s.Reward(ctx, id, data.Float(1)), ShouldNotBeNil)
+				So(s.Status()["decisions"], ShouldResemble, data.Map{"pending": data.Int(2), "expired": data.Int(1)})
+			})
+		})
+
+		Convey("When the model returns an index out of arms", func() {
+			_, err := s.Choose(ctx, user, data.Array{data.String("a")})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a reward of an unknown decision is given", func() {
+			err := s.Reward(ctx, "unknown", data.Float(1))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(b.calls, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package pymlstate
+
+import (
+	"encoding/base64"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// binaryConverter converts values at binary paths to data.Blob so that
+// Python receives them as raw bytes instead of strings or lists of ints.
+type binaryConverter struct {
+	names []string
+	paths []data.Path
+}
+
+var _ preprocessor = &binaryConverter{}
+
+func newBinaryConverter(paths []string) (*binaryConverter, error) {
+	ps, err := compilePaths(paths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid binary_paths: %v", err)
+	}
+	return &binaryConverter{
+		names: paths,
+		paths: ps,
+	}, nil
+}
+
+func (c *binaryConverter) process(rec data.Map, training bool, rep *qualityReport) error {
+	for i, p := range c.paths {
+		v, err := rec.Get(p)
+		if err != nil {
+			continue // missing fields are left to the Python side
+		}
+		if v.Type() == data.TypeNull {
+			continue
+		}
+		b, err := toBlob(v)
+		if err != nil {
+			rep.typeMismatch(c.names[i])
+			return fmt.Errorf("cannot convert '%v' to binary: %v", c.names[i], err)
+		}
+		if err := rec.Set(p, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toBlob converts a value to data.Blob. A string is decoded as base64 and
+// an array must only have integers in [0, 255].
+func toBlob(v data.Value) (data.Blob, error) {
+	switch v.Type() {
+	case data.TypeBlob:
+		b, _ := data.AsBlob(v)
+		return data.Blob(b), nil
+
+	case data.TypeString:
+		str, _ := data.AsString(v)
+		b, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return nil, err
+		}
+		return data.Blob(b), nil
+
+	case data.TypeArray:
+		arr, _ := data.AsArray(v)
+		b := make(data.Blob, len(arr))
+		for i, e := range arr {
+			n, err := data.AsInt(e)
+			if err != nil {
+				return nil, err
+			}
+			if n < 0 || n > 255 {
+				return nil, fmt.Errorf("%v is out of the range of a byte", n)
+			}
+			b[i] = byte(n)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported type: %v", v.Type())
+}
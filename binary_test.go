@@ -0,0 +1,60 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestBinaryConverter(t *testing.T) {
+	Convey("Given a binary converter", t, func() {
+		c, err := newBinaryConverter([]string{"image", "audio.chunk"})
+		So(err, ShouldBeNil)
+
+		Convey("When a record having binary features is processed", func() {
+			rec := data.Map{
+				"image": data.String("AAEC"), // base64 of 0x00 0x01 0x02
+				"audio": data.Map{
+					"chunk": data.Array{data.Int(3), data.Int(255)},
+				},
+				"label": data.Int(1),
+			}
+			So(c.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then the features should be converted to blobs", func() {
+				So(rec, ShouldResemble, data.Map{
+					"image": data.Blob{0, 1, 2},
+					"audio": data.Map{
+						"chunk": data.Blob{3, 255},
+					},
+					"label": data.Int(1),
+				})
+			})
+		})
+
+		Convey("When a record without binary features is processed", func() {
+			rec := data.Map{"label": data.Int(1)}
+			So(c.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then the record should not be changed", func() {
+				So(rec, ShouldResemble, data.Map{"label": data.Int(1)})
+			})
+		})
+
+		Convey("When a record having an invalid base64 string is processed", func() {
+			err := c.process(data.Map{"image": data.String("!!!")}, true, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a record having an out of range integer is processed", func() {
+			err := c.process(data.Map{"image": data.Array{data.Int(256)}}, true, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,221 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// CircuitOpenError is returned by Predict when the circuit breaker of the
+// state is open and no fallback value is configured.
+type CircuitOpenError struct {
+	// RetryAfter is the duration after which the breaker lets a call
+	// through to check if the model has recovered.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("the circuit breaker of the state is open (retry after %v)", e.RetryAfter)
+}
+
+type breakerPhase int
+
+const (
+	breakerClosed breakerPhase = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (p breakerPhase) String() string {
+	switch p {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker fails predictions fast while the model is struggling. It
+// opens when the rate of failed calls, which return errors or take longer
+// than callTimeout, in the latest window calls reaches errorRate. After
+// openDuration, it half-opens and lets one call through: the breaker closes
+// when the call succeeds and opens again otherwise.
+type circuitBreaker struct {
+	mu           sync.Mutex
+	errorRate    float64
+	window       int
+	callTimeout  time.Duration
+	openDuration time.Duration
+	fallback     data.Value
+
+	phase    breakerPhase
+	outcomes []bool // true means a failure
+	next     int
+	failures int
+	openedAt time.Time
+	probing  bool
+	opens    int64
+	rejected int64
+}
+
+func newCircuitBreaker(p *MLParams) (*circuitBreaker, error) {
+	b := &circuitBreaker{}
+	if err := b.configure(p); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// configure updates parameters. The window of outcomes is cleared when its
+// size changes.
+func (b *circuitBreaker) configure(p *MLParams) error {
+	var fallback data.Value
+	if len(p.BreakerFallback) > 0 {
+		m, err := data.UnmarshalMsgpack(p.BreakerFallback)
+		if err != nil {
+			return fmt.Errorf("cannot decode breaker_fallback: %v", err)
+		}
+		fallback = m["value"]
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errorRate = p.BreakerErrorRate
+	b.callTimeout = p.BreakerCallTimeout
+	b.openDuration = p.BreakerOpenDuration
+	b.fallback = fallback
+	if b.window != p.BreakerWindow {
+		b.window = p.BreakerWindow
+		b.reset()
+	}
+	return nil
+}
+
+// reset clears the window. It must be called while b.mu is locked.
+func (b *circuitBreaker) reset() {
+	b.outcomes = make([]bool, 0, b.window)
+	b.next = 0
+	b.failures = 0
+}
+
+// allow returns nil when a call can be made. Otherwise, it returns the
+// fallback value or a CircuitOpenError. done must be called with the result
+// of the allowed call.
+func (b *circuitBreaker) allow(now time.Time) (fallback data.Value, err error) {
+	if b == nil {
+		return nil, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.phase {
+	case breakerOpen:
+		if now.Sub(b.openedAt) >= b.openDuration {
+			b.phase = breakerHalfOpen
+			b.probing = true
+			return nil, nil
+		}
+	case breakerHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	b.rejected++
+	if b.fallback != nil {
+		return b.fallback, nil
+	}
+	retry := b.openDuration - now.Sub(b.openedAt)
+	if retry < 0 {
+		retry = 0
+	}
+	return nil, &CircuitOpenError{RetryAfter: retry}
+}
+
+// done records the outcome of an allowed call which took d. It returns the
+// new phase and true when the phase has changed.
+func (b *circuitBreaker) done(now time.Time, d time.Duration, err error) (breakerPhase, bool) {
+	if b == nil {
+		return breakerClosed, false
+	}
+	failed := err != nil || (b.callTimeout > 0 && d > b.callTimeout)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.phase {
+	case breakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open(now)
+		} else {
+			b.phase = breakerClosed
+			b.reset()
+		}
+		return b.phase, true
+
+	case breakerOpen:
+		return b.phase, false // a call allowed before the breaker opened
+	}
+
+	if len(b.outcomes) < b.window {
+		b.outcomes = append(b.outcomes, failed)
+	} else {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+		b.outcomes[b.next] = failed
+		b.next = (b.next + 1) % b.window
+	}
+	if failed {
+		b.failures++
+	}
+	if len(b.outcomes) == b.window && float64(b.failures) >= b.errorRate*float64(b.window) {
+		b.open(now)
+		return b.phase, true
+	}
+	return b.phase, false
+}
+
+// open opens the breaker. It must be called while b.mu is locked.
+func (b *circuitBreaker) open(now time.Time) {
+	b.phase = breakerOpen
+	b.openedAt = now
+	b.opens++
+	b.reset()
+}
+
+func (b *circuitBreaker) toMap() data.Map {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return data.Map{
+		"phase":    data.String(b.phase.String()),
+		"opens":    data.Int(b.opens),
+		"rejected": data.Int(b.rejected),
+	}
+}
+
+// observeBreaker records the outcome of the call of "predict" to the
+// circuit breaker and emits an event when the breaker opens or closes.
+func (s *State) observeBreaker(now time.Time, d time.Duration, err error) {
+	phase, changed := s.breaker.done(now, d, err)
+	if !changed {
+		return
+	}
+	switch phase {
+	case breakerOpen:
+		s.hooks.emit(Event{Type: EventCircuitOpened, Time: now})
+	case breakerClosed:
+		s.hooks.emit(Event{Type: EventCircuitClosed, Time: now})
+	}
+}
+
+// encodeFallbackValue encodes the fallback value given by the
+// breaker_fallback or fallback_value parameter.
+func encodeFallbackValue(v data.Value) ([]byte, error) {
+	return data.MarshalMsgpack(data.Map{"value": v})
+}
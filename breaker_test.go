@@ -0,0 +1,104 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	Convey("Given a circuit breaker opening at half failures of 4 calls", t, func() {
+		b, err := newCircuitBreaker(&MLParams{BreakerErrorRate: 0.5, BreakerWindow: 4,
+			BreakerCallTimeout: time.Second, BreakerOpenDuration: time.Minute})
+		So(err, ShouldBeNil)
+		now := time.Now()
+		fail := errors.New("failure")
+
+		call := func(d time.Duration, err error) {
+			_, e := b.allow(now)
+			So(e, ShouldBeNil)
+			b.done(now, d, err)
+		}
+
+		Convey("When calls fail less than the rate", func() {
+			call(0, nil)
+			call(0, fail)
+			call(0, nil)
+			call(0, nil)
+
+			Convey("Then it should be closed", func() {
+				So(b.phase, ShouldEqual, breakerClosed)
+			})
+		})
+
+		Convey("When calls fail or time out at the rate", func() {
+			call(0, nil)
+			call(0, fail)
+			call(0, nil)
+			call(2*time.Second, nil)
+
+			Convey("Then it should reject calls", func() {
+				So(b.phase, ShouldEqual, breakerOpen)
+				_, err := b.allow(now.Add(time.Second))
+				So(err, ShouldHaveSameTypeAs, &CircuitOpenError{})
+			})
+
+			Convey("Then it should let one call through after the open duration", func() {
+				now = now.Add(time.Minute)
+				_, err := b.allow(now)
+				So(err, ShouldBeNil)
+				So(b.phase, ShouldEqual, breakerHalfOpen)
+				_, err = b.allow(now)
+				So(err, ShouldNotBeNil)
+
+				Convey("And it should close when the call succeeds", func() {
+					phase, changed := b.done(now, 0, nil)
+					So(changed, ShouldBeTrue)
+					So(phase, ShouldEqual, breakerClosed)
+				})
+
+				Convey("And it should open again when the call fails", func() {
+					phase, _ := b.done(now, 0, fail)
+					So(phase, ShouldEqual, breakerOpen)
+					So(b.toMap()["opens"], ShouldEqual, data.Int(2))
+				})
+			})
+		})
+	})
+
+	Convey("Given a state having a circuit breaker with a fallback value", t, func() {
+		ctx := core.NewContext(nil)
+		fallback, err := encodeFallbackValue(data.String("unknown"))
+		So(err, ShouldBeNil)
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return nil, errors.New("the model is struggling")
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1, BreakerErrorRate: 1, BreakerWindow: 2,
+			BreakerOpenDuration: time.Minute, BreakerFallback: fallback}}
+		So(s.setUpParams(), ShouldBeNil)
+		var events []EventType
+		s.OnEvent(func(e Event) { events = append(events, e.Type) })
+
+		Convey("When predictions keep failing", func() {
+			for i := 0; i < 2; i++ {
+				_, err := s.Predict(ctx, data.Map{"x": data.Int(i)})
+				So(err, ShouldNotBeNil)
+			}
+
+			Convey("Then the fallback value should be returned without calling Python", func() {
+				res, err := s.Predict(ctx, data.Map{"x": data.Int(3)})
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.String("unknown"))
+				So(len(b.calls), ShouldEqual, 2)
+				So(events, ShouldResemble, []EventType{EventCircuitOpened})
+				So(s.Status()["circuit_breaker"], ShouldResemble, data.Map{
+					"phase": data.String("open"), "opens": data.Int(1), "rejected": data.Int(1)})
+			})
+		})
+	})
+}
@@ -0,0 +1,107 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+// keyedBuckets buffers training records into separate buckets by the value
+// at path. It's protected by the lock of State.
+type keyedBuckets struct {
+	path    data.Path
+	buckets map[string]*keyedBucket
+}
+
+type keyedBucket struct {
+	key     data.Value
+	records []data.Value
+	times   []time.Time
+	bytes   int64
+}
+
+func newKeyedBuckets(path string) (*keyedBuckets, error) {
+	p, err := data.CompilePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bucket_by_path '%v': %v", path, err)
+	}
+	return &keyedBuckets{
+		path:    p,
+		buckets: map[string]*keyedBucket{},
+	}, nil
+}
+
+// bucketOf returns the bucket of the record. The bucket is created when it
+// doesn't exist.
+func (k *keyedBuckets) bucketOf(rec data.Value) (string, *keyedBucket, error) {
+	m, err := data.AsMap(rec)
+	if err != nil {
+		return "", nil, fmt.Errorf("a record must be a map to be bucketed by a key: %v", err)
+	}
+	key, err := m.Get(k.path)
+	if err != nil {
+		return "", nil, fmt.Errorf("a record doesn't have the key of its bucket: %v", err)
+	}
+	id := valueKey(key)
+	b, ok := k.buckets[id]
+	if !ok {
+		b = &keyedBucket{key: key}
+		k.buckets[id] = b
+	}
+	return id, b, nil
+}
+
+// clear removes all buckets. It does nothing when k is nil.
+func (k *keyedBuckets) clear() {
+	if k == nil {
+		return
+	}
+	k.buckets = map[string]*keyedBucket{}
+}
+
+// stats returns the number of keys and buffered records.
+func (k *keyedBuckets) stats() (keys, records int) {
+	for _, b := range k.buckets {
+		records += len(b.records)
+	}
+	return len(k.buckets), records
+}
+
+// writeKeyed buffers preprocessed records into buckets by their keys and
+// trains each bucket having BatchSize records. ts is the timestamp of the
+// tuple. It must be called while the write lock is acquired.
+func (s *State) writeKeyed(ctx *core.Context, dataSet data.Value, ts time.Time) error {
+	recs := []data.Value{dataSet}
+	if dataSet.Type() == data.TypeArray {
+		recs, _ = data.AsArray(dataSet)
+	}
+
+	for _, rec := range recs {
+		if !s.curriculum.accept(rec) {
+			continue
+		}
+		id, b, err := s.keyedBuckets.bucketOf(rec)
+		if err != nil {
+			return err
+		}
+		overflow, drop := s.overflowBucket(ctx, &b.bytes, len(b.records), rec)
+		if drop {
+			continue
+		}
+		b.records = append(b.records, rec)
+		if s.params.BucketTTL > 0 {
+			b.times = append(b.times, ts)
+		}
+		if !overflow && len(b.records) < s.params.BatchSize {
+			continue
+		}
+
+		delete(s.keyedBuckets.buckets, id)
+		res, err := s.fit(ctx, b.records, b.key)
+		if err := s.finishWriteFit(ctx, res, err, len(b.records)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestKeyedBuckets(t *testing.T) {
+	Convey("Given keyed buckets by series", t, func() {
+		k, err := newKeyedBuckets("series")
+		So(err, ShouldBeNil)
+
+		Convey("When records of two series are bucketed", func() {
+			for _, s := range []string{"a", "b", "a"} {
+				_, b, err := k.bucketOf(data.Map{"series": data.String(s)})
+				So(err, ShouldBeNil)
+				b.records = append(b.records, data.String(s))
+			}
+
+			Convey("Then records should be buffered by their series", func() {
+				_, b, _ := k.bucketOf(data.Map{"series": data.String("a")})
+				So(b.key, ShouldEqual, data.String("a"))
+				So(len(b.records), ShouldEqual, 2)
+
+				keys, n := k.stats()
+				So(keys, ShouldEqual, 2)
+				So(n, ShouldEqual, 3)
+			})
+
+			Convey("Then they should be removed by clear", func() {
+				k.clear()
+				keys, n := k.stats()
+				So(keys, ShouldEqual, 0)
+				So(n, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a record without the key is bucketed", func() {
+			_, _, err := k.bucketOf(data.Map{"value": data.Int(1)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,35 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// approxSize returns the approximate size of the value serialized in
+// msgpack. It's used to limit the memory used by the bucket.
+func approxSize(v data.Value) int64 {
+	const header = 5 // the max size of a type and a length
+	switch v.Type() {
+	case data.TypeString:
+		s, _ := data.AsString(v)
+		return int64(len(s)) + header
+	case data.TypeBlob:
+		b, _ := data.AsBlob(v)
+		return int64(len(b)) + header
+	case data.TypeArray:
+		a, _ := data.AsArray(v)
+		n := int64(header)
+		for _, e := range a {
+			n += approxSize(e)
+		}
+		return n
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		n := int64(header)
+		for k, e := range m {
+			n += int64(len(k)) + header + approxSize(e)
+		}
+		return n
+	default:
+		return 9 // a type and a 64-bit value
+	}
+}
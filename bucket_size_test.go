@@ -0,0 +1,65 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestApproxSize(t *testing.T) {
+	Convey("Given a record with a large blob", t, func() {
+		small := data.Map{"label": data.String("a"), "image": data.Blob(make([]byte, 10))}
+		large := data.Map{"label": data.String("a"), "image": data.Blob(make([]byte, 10000))}
+
+		Convey("When their sizes are computed", func() {
+			s, l := approxSize(small), approxSize(large)
+
+			Convey("Then the size should reflect the blob", func() {
+				So(l-s, ShouldEqual, 9990)
+				So(l, ShouldBeGreaterThan, 10000)
+			})
+		})
+	})
+
+	Convey("Given nested values", t, func() {
+		v := data.Array{data.Int(1), data.Array{data.Float(1.5), data.Null{}}}
+
+		Convey("When its size is computed", func() {
+			Convey("Then it should include all elements", func() {
+				So(approxSize(v), ShouldEqual, 5+9+5+9+9)
+			})
+		})
+	})
+}
+
+func TestExtractBucketParams(t *testing.T) {
+	Convey("Given bucket parameters", t, func() {
+		params := data.Map{
+			"max_bucket_bytes": data.Int(1024),
+			"bucket_overflow":  data.String("drop"),
+		}
+
+		Convey("When they're extracted", func() {
+			mp := &MLParams{}
+			So(extractBucketParams(params, mp), ShouldBeNil)
+
+			Convey("Then they should be set", func() {
+				So(mp.MaxBucketBytes, ShouldEqual, 1024)
+				So(mp.BucketOverflow, ShouldEqual, "drop")
+				So(params, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given an invalid bucket_overflow", t, func() {
+		params := data.Map{"bucket_overflow": data.String("ignore")}
+
+		Convey("When it's extracted", func() {
+			err := extractBucketParams(params, &MLParams{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
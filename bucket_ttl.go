@@ -0,0 +1,94 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+// expireRecords splits records into ones written at or after deadline and
+// expired ones. times are timestamps of records. No record expires when
+// times don't correspond to records.
+func expireRecords(recs []data.Value, times []time.Time, deadline time.Time) (kept []data.Value,
+	keptTimes []time.Time, expired []data.Value) {
+	if len(recs) != len(times) {
+		return recs, times, nil
+	}
+	kept = recs[:0]
+	keptTimes = times[:0]
+	for i, r := range recs {
+		if times[i].Before(deadline) {
+			expired = append(expired, r)
+			continue
+		}
+		kept = append(kept, r)
+		keptTimes = append(keptTimes, times[i])
+	}
+	return kept, keptTimes, expired
+}
+
+// expireBuckets removes records older than bucket_ttl before now from
+// buckets. Expired records are trained in a batch of each bucket when
+// bucket_expiry is "fit". It must be called while the write lock is
+// acquired.
+func (s *State) expireBuckets(ctx *core.Context, now time.Time) error {
+	if s.params.BucketTTL <= 0 || s.params.BatchSize <= 1 {
+		return nil
+	}
+	deadline := now.Add(-s.params.BucketTTL)
+
+	var expired []data.Value
+	s.bucket, s.bucketTimes, expired = expireRecords(s.bucket, s.bucketTimes, deadline)
+	if err := s.handleExpired(ctx, "fit", &s.bucketBytes, expired); err != nil {
+		return err
+	}
+
+	if s.channels != nil {
+		for _, name := range s.channels.names() {
+			b := s.channels.buckets[name]
+			b.records, b.times, expired = expireRecords(b.records, b.times, deadline)
+			if err := s.handleExpired(ctx, b.method, &b.bytes, expired); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.keyedBuckets == nil {
+		return nil
+	}
+	for id, b := range s.keyedBuckets.buckets {
+		b.records, b.times, expired = expireRecords(b.records, b.times, deadline)
+		if len(b.records) == 0 {
+			delete(s.keyedBuckets.buckets, id)
+		}
+		if err := s.handleExpired(ctx, "fit", &b.bytes, expired, b.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleExpired drops or trains expired records of a bucket by the method.
+// args are passed to the method after the records.
+func (s *State) handleExpired(ctx *core.Context, method string, bucketBytes *int64, expired []data.Value,
+	args ...data.Value) error {
+	if len(expired) == 0 {
+		return nil
+	}
+	s.expiredRecords += int64(len(expired))
+	if s.params.MaxBucketBytes > 0 {
+		for _, r := range expired {
+			*bucketBytes -= approxSize(r)
+		}
+	}
+
+	if s.params.BucketExpiry != "fit" {
+		s.warnings.warn("bucket_expiry", func(suppressed int64) {
+			ctx.Log().WithField("records", len(expired)).WithField("suppressed", suppressed).
+				Warn("pymlstate dropped records expired by bucket_ttl")
+		})
+		return nil
+	}
+	res, err := s.fitWith(ctx, method, expired, args...)
+	return s.finishWriteFit(ctx, res, err, len(expired))
+}
@@ -0,0 +1,35 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestExpireRecords(t *testing.T) {
+	Convey("Given records written at different times", t, func() {
+		now := time.Now()
+		recs := []data.Value{data.Int(0), data.Int(1), data.Int(2)}
+		times := []time.Time{now.Add(-2 * time.Hour), now, now.Add(-3 * time.Hour)}
+
+		Convey("When records older than an hour expire", func() {
+			kept, keptTimes, expired := expireRecords(recs, times, now.Add(-time.Hour))
+
+			Convey("Then only the new record should be kept", func() {
+				So(kept, ShouldResemble, []data.Value{data.Int(1)})
+				So(keptTimes, ShouldResemble, []time.Time{now})
+				So(expired, ShouldResemble, []data.Value{data.Int(0), data.Int(2)})
+			})
+		})
+
+		Convey("When timestamps don't correspond to records", func() {
+			kept, _, expired := expireRecords(recs, times[:1], now)
+
+			Convey("Then no record should expire", func() {
+				So(len(kept), ShouldEqual, 3)
+				So(expired, ShouldBeEmpty)
+			})
+		})
+	})
+}
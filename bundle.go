@@ -0,0 +1,108 @@
+package pymlstate
+
+import (
+	"archive/tar"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ExportBundle writes checkpoints of all pymlstate states of the context to
+// a tar archive at path. The archive has the manifest written by SaveAll,
+// which has MLParams, the Python module, and the model version of each
+// state, followed by the checkpoints. It can be restored on another node by
+// ImportBundle.
+func ExportBundle(ctx *core.Context, path string) error {
+	dir, err := ioutil.TempDir("", "pymlstate-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := SaveAll(ctx, dir); err != nil {
+		return err
+	}
+	m, err := readCheckpointManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	files := []string{checkpointManifestName}
+	for _, e := range m.States {
+		files = append(files, e.File)
+	}
+	_, err = writeCheckpointFile(path, func(f *os.File) error {
+		tw := tar.NewWriter(f)
+		for _, name := range files {
+			if err := addTarFile(tw, dir, name); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write the bundle: %v", err)
+	}
+	return nil
+}
+
+func addTarFile(tw *tar.Writer, dir, name string) error {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	h, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	if err := tw.WriteHeader(h); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// ImportBundle restores states from the archive written by ExportBundle in
+// the same way as LoadAll.
+func ImportBundle(ctx *core.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dir, err := ioutil.TempDir("", "pymlstate-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read the bundle: %v", err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Files are extracted only into dir.
+		if _, err := writeCheckpointFile(filepath.Join(dir, filepath.Base(h.Name)), func(out *os.File) error {
+			_, err := io.Copy(out, tr)
+			return err
+		}); err != nil {
+			return fmt.Errorf("cannot extract '%v' from the bundle: %v", h.Name, err)
+		}
+	}
+	return LoadAll(ctx, dir)
+}
@@ -0,0 +1,79 @@
+package pymlstate
+
+import (
+	"archive/tar"
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportBundle(t *testing.T) {
+	Convey("Given a context having a pymlstate state", t, func() {
+		ctx := core.NewContext(&core.ContextConfig{})
+		s := &State{
+			base:         &fakeBackend{},
+			baseParams:   &pystate.BaseParams{ModuleName: "mnist", ClassName: "MNIST"},
+			params:       MLParams{BatchSize: 10},
+			modelVersion: "mnist:3",
+		}
+		So(ctx.SharedStates.Add("model1", "pymlstate", s), ShouldBeNil)
+		dir, err := ioutil.TempDir("", "pymlstate")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "bundle.tar")
+
+		Convey("When a bundle is exported", func() {
+			So(ExportBundle(ctx, path), ShouldBeNil)
+
+			Convey("Then it should have the manifest and the checkpoint", func() {
+				f, err := os.Open(path)
+				So(err, ShouldBeNil)
+				defer f.Close()
+				tr := tar.NewReader(f)
+				names := []string{}
+				var m checkpointManifest
+				for {
+					h, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					So(err, ShouldBeNil)
+					names = append(names, h.Name)
+					if h.Name == checkpointManifestName {
+						So(json.NewDecoder(tr).Decode(&m), ShouldBeNil)
+					}
+				}
+				So(names, ShouldResemble, []string{checkpointManifestName, "model1.state"})
+				So(len(m.States), ShouldEqual, 1)
+				e := m.States[0]
+				So(e.ModuleName, ShouldEqual, "mnist")
+				So(e.ClassName, ShouldEqual, "MNIST")
+				So(e.ModelVersion, ShouldEqual, "mnist:3")
+				var params map[string]interface{}
+				So(json.Unmarshal(e.Params, &params), ShouldBeNil)
+				So(params["batch_train_size"], ShouldEqual, 10)
+			})
+
+			Convey("And it's imported to a node having the state", func() {
+				ctx2 := core.NewContext(&core.ContextConfig{})
+				s2 := &State{base: &fakeBackend{}, baseParams: &pystate.BaseParams{}}
+				So(ctx2.SharedStates.Add("model1", "pymlstate", s2), ShouldBeNil)
+				err := ImportBundle(ctx2, path)
+
+				Convey("Then the state should be restored", func() {
+					So(err, ShouldBeNil)
+					So(s2.modelVersion, ShouldEqual, "mnist:3")
+					So(s2.params.BatchSize, ShouldEqual, 10)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,97 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"os"
+)
+
+// readCanaryData reads records from a JSON lines file.
+func readCanaryData(path string) (data.Array, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open canary_data: %v", err)
+	}
+	defer f.Close()
+
+	dr, err := newDatasetReader(f, DatasetJSONLines)
+	if err != nil {
+		return nil, err
+	}
+	var recs data.Array
+	for {
+		m, err := dr.read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read canary_data: %v", err)
+		}
+		recs = append(recs, m)
+	}
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("canary_data doesn't have any record")
+	}
+	return recs, nil
+}
+
+// evaluateModel computes the metric of the model b on records by calling
+// the method of the model. Records are redacted and preprocessed by s in the
+// same way as Predict does.
+func (s *State) evaluateModel(b Backend, method string, recs data.Array) (float64, error) {
+	v, err := s.redact(recs)
+	if err != nil {
+		return 0, err
+	}
+	return s.evaluateRedacted(b, method, v)
+}
+
+// evaluateRedacted is evaluateModel of records which have been redacted,
+// such as records of the validation set.
+func (s *State) evaluateRedacted(b Backend, method string, recs data.Value) (float64, error) {
+	v, err := s.preprocess(recs, preprocessInspect, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := b.Call(method, v)
+	if err != nil {
+		return 0, err
+	}
+	return s.params.Objective.score(method, res)
+}
+
+// validateCanary evaluates the current model of s and the candidate model
+// with the canary data of s and returns an error when the metric of the
+// candidate regresses more than CanaryMaxRegression. candidate is a State
+// holding the model and the preprocessors to be swapped in. It does nothing
+// when the canary validation is disabled.
+func (s *State) validateCanary(ctx *core.Context, candidate *State) error {
+	if s.params.CanaryData == "" {
+		return nil
+	}
+	recs, err := readCanaryData(s.params.CanaryData)
+	if err != nil {
+		return err
+	}
+	method := s.params.CanaryMethod
+	cur, err := s.evaluateModel(s.base, method, recs)
+	if err != nil {
+		return fmt.Errorf("cannot evaluate the current model with canary_data: %v", err)
+	}
+	cand, err := candidate.evaluateModel(candidate.base, method, recs)
+	if err != nil {
+		return fmt.Errorf("cannot evaluate the new model with canary_data: %v", err)
+	}
+
+	l := ctx.Log().WithField("current_metric", cur).
+		WithField("new_metric", cand).
+		WithField("canary_records", len(recs))
+	if cand < cur-s.params.CanaryMaxRegression {
+		l.Warn("pymlstate refused the new model because it failed the canary validation")
+		return fmt.Errorf("the new model regresses on canary_data: %v < %v (max regression: %v)",
+			cand, cur, s.params.CanaryMaxRegression)
+	}
+	l.Info("pymlstate's new model passed the canary validation")
+	return nil
+}
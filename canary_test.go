@@ -0,0 +1,200 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadCanaryData(t *testing.T) {
+	Convey("Given a JSON lines file", t, func() {
+		f, err := ioutil.TempFile("", "pymlstate_canary")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.Remove(f.Name())
+		})
+		_, err = f.WriteString("{\"x\": 1, \"label\": \"a\"}\n\n{\"x\": 2, \"label\": \"b\"}\n")
+		So(err, ShouldBeNil)
+		So(f.Close(), ShouldBeNil)
+
+		Convey("When records are read from the file", func() {
+			recs, err := readCanaryData(f.Name())
+			So(err, ShouldBeNil)
+
+			Convey("Then they should skip empty lines", func() {
+				So(len(recs), ShouldEqual, 2)
+				m, err := data.AsMap(recs[1])
+				So(err, ShouldBeNil)
+				So(m["label"], ShouldEqual, data.String("b"))
+			})
+		})
+
+		Convey("When the file has an invalid line", func() {
+			So(ioutil.WriteFile(f.Name(), []byte("{\"x\": 1}\n[1, 2]\n"), 0644), ShouldBeNil)
+			_, err := readCanaryData(f.Name())
+
+			Convey("Then it should fail with the line number", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "line 2")
+			})
+		})
+
+		Convey("When the file is empty", func() {
+			So(ioutil.WriteFile(f.Name(), nil, 0644), ShouldBeNil)
+			_, err := readCanaryData(f.Name())
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestExtractCanaryParams(t *testing.T) {
+	Convey("Given parameters without canary settings", t, func() {
+		params := data.Map{}
+
+		Convey("When canary parameters are extracted", func() {
+			mp := &MLParams{}
+			So(extractCanaryParams(params, mp), ShouldBeNil)
+
+			Convey("Then the canary validation should be disabled", func() {
+				So(mp.CanaryData, ShouldBeEmpty)
+				So(mp.CanaryMethod, ShouldEqual, "evaluate")
+			})
+		})
+	})
+
+	Convey("Given parameters with canary settings", t, func() {
+		params := data.Map{
+			"canary_data":           data.String("/path/to/holdout.jsonl"),
+			"canary_method":         data.String("score"),
+			"canary_max_regression": data.Float(0.01),
+		}
+
+		Convey("When canary parameters are extracted", func() {
+			mp := &MLParams{}
+			So(extractCanaryParams(params, mp), ShouldBeNil)
+
+			Convey("Then they should be set and removed from parameters", func() {
+				So(mp.CanaryData, ShouldEqual, "/path/to/holdout.jsonl")
+				So(mp.CanaryMethod, ShouldEqual, "score")
+				So(mp.CanaryMaxRegression, ShouldEqual, 0.01)
+				So(params, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When canary_max_regression is negative", func() {
+			params["canary_max_regression"] = data.Float(-1)
+
+			Convey("Then it should fail", func() {
+				So(extractCanaryParams(params, &MLParams{}), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+const canaryTestModule = `
+class Model(object):
+    @classmethod
+    def create(cls, **params):
+        return cls()
+
+    def evaluate(self, xs):
+        return 1.0
+
+    def save(self, filepath, params):
+        open(filepath, 'w').close()
+
+    @classmethod
+    def load(cls, filepath, **params):
+        return cls()
+`
+
+func TestLoadWithCanary(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 isn't available")
+	}
+	ctx := core.NewContext(nil)
+	dir, err := ioutil.TempDir("", "pymlstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "canary_test_model.py"), []byte(canaryTestModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	canary := filepath.Join(dir, "canary.jsonl")
+	if err := ioutil.WriteFile(canary, []byte("{\"x\": 1}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bp := &pystate.BaseParams{ModulePath: dir, ModuleName: "canary_test_model", ClassName: "Model"}
+	params := func() *MLParams {
+		return &MLParams{
+			BatchSize:     1,
+			Isolation:     "process",
+			PythonCommand: "python3",
+			CanaryData:    canary,
+			CanaryMethod:  "evaluate",
+		}
+	}
+
+	Convey("Given a state validating loaded models with canary_data", t, func() {
+		p := params()
+		p.BreakerErrorRate = 0.5
+		p.BreakerWindow = 10
+		p.MaxPredictsPerSec = 10
+		p.FailureBudget = 3
+		s, err := New(bp, p, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When a model saved with different params is loaded", func() {
+			p := params()
+			p.BreakerErrorRate = 0.8
+			p.BreakerWindow = 20
+			p.BreakerCallTimeout = time.Second
+			p.MaxPredictsPerSec = 50
+			p.FailureBudget = 7
+			saved, err := New(bp, p, data.Map{})
+			So(err, ShouldBeNil)
+			defer saved.Terminate(ctx)
+			buf := bytes.NewBuffer(nil)
+			So(saved.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			So(s.Load(ctx, buf, data.Map{}), ShouldBeNil)
+
+			Convey("Then the loaded params should be applied", func() {
+				So(s.breaker.errorRate, ShouldEqual, 0.8)
+				So(s.breaker.window, ShouldEqual, 20)
+				So(s.breaker.callTimeout, ShouldEqual, time.Second)
+				So(s.predictLimiter.rate, ShouldEqual, 50)
+				So(s.failures.budget, ShouldEqual, 7)
+			})
+		})
+
+		Convey("When a model saved without limits is loaded", func() {
+			saved, err := New(bp, params(), data.Map{})
+			So(err, ShouldBeNil)
+			defer saved.Terminate(ctx)
+			buf := bytes.NewBuffer(nil)
+			So(saved.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			So(s.Load(ctx, buf, data.Map{}), ShouldBeNil)
+
+			Convey("Then the limits should be removed", func() {
+				So(s.breaker, ShouldBeNil)
+				So(s.predictLimiter, ShouldBeNil)
+				So(s.failures.budget, ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,199 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"time"
+)
+
+// ChannelConfig is the configuration of a channel given by the channels
+// parameter. Records of the channel are buffered into its own bucket and
+// the bucket is passed to Method of the model when it has BatchSize
+// records. Method is "fit" and BatchSize is the batch_size of the state by
+// default.
+type ChannelConfig struct {
+	Method    string `codec:"method"`
+	BatchSize int    `codec:"batch_size"`
+}
+
+// channels buffers training records into buckets of channels by the name at
+// path. It's protected by the lock of State.
+type channels struct {
+	path    data.Path
+	buckets map[string]*channelBucket
+}
+
+type channelBucket struct {
+	method    string
+	batchSize int
+	records   []data.Value
+	times     []time.Time
+	bytes     int64
+}
+
+func newChannels(path string, configs map[string]ChannelConfig, batchSize int) (*channels, error) {
+	p, err := data.CompilePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel_path '%v': %v", path, err)
+	}
+	c := &channels{
+		path:    p,
+		buckets: map[string]*channelBucket{},
+	}
+	for name, conf := range configs {
+		b := &channelBucket{
+			method:    conf.Method,
+			batchSize: conf.BatchSize,
+		}
+		if b.method == "" {
+			b.method = "fit"
+		}
+		if b.batchSize <= 0 {
+			b.batchSize = batchSize
+		}
+		c.buckets[name] = b
+	}
+	return c, nil
+}
+
+// bucketOf returns the bucket of the channel of the record. It returns nil
+// when the record doesn't have the name of a channel.
+func (c *channels) bucketOf(rec data.Value) (*channelBucket, error) {
+	m, err := data.AsMap(rec)
+	if err != nil {
+		return nil, nil
+	}
+	v, err := m.Get(c.path)
+	if err != nil || v.Type() == data.TypeNull {
+		return nil, nil
+	}
+	name, err := data.AsString(v)
+	if err != nil {
+		return nil, fmt.Errorf("the channel of a record must be a string: %v", err)
+	}
+	b, ok := c.buckets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown channel: %v", name)
+	}
+	return b, nil
+}
+
+// clear removes all records from buckets. It does nothing when c is nil.
+func (c *channels) clear() {
+	if c == nil {
+		return
+	}
+	for _, b := range c.buckets {
+		b.records = nil
+		b.times = nil
+		b.bytes = 0
+	}
+}
+
+// names returns names of channels in ascending order.
+func (c *channels) names() []string {
+	names := make([]string, 0, len(c.buckets))
+	for name := range c.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stats returns the number of buffered records of each channel.
+func (c *channels) stats() data.Map {
+	res := data.Map{}
+	for name, b := range c.buckets {
+		res[name] = data.Int(len(b.records))
+	}
+	return res
+}
+
+// writeChannels buffers preprocessed records having names of channels into
+// buckets of the channels and trains each bucket having its batch size of
+// records by the method of the channel. It returns records without
+// channels, or nil when there's no such record. ts is the timestamp of the
+// tuple. It must be called while the write lock is acquired.
+func (s *State) writeChannels(ctx *core.Context, dataSet data.Value, ts time.Time) (data.Value, error) {
+	recs := []data.Value{dataSet}
+	if dataSet.Type() == data.TypeArray {
+		recs, _ = data.AsArray(dataSet)
+	}
+
+	var rest data.Array
+	for _, rec := range recs {
+		b, err := s.channels.bucketOf(rec)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			rest = append(rest, rec)
+			continue
+		}
+		overflow, drop := s.overflowBucket(ctx, &b.bytes, len(b.records), rec)
+		if drop {
+			continue
+		}
+		b.records = append(b.records, rec)
+		if s.params.BucketTTL > 0 {
+			b.times = append(b.times, ts)
+		}
+		if !overflow && len(b.records) < b.batchSize {
+			continue
+		}
+
+		bucket := b.records
+		b.records, b.times, b.bytes = nil, nil, 0
+		res, err := s.fitWith(ctx, b.method, bucket)
+		if err := s.finishWriteFit(ctx, res, err, len(bucket)); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(rest) == 0:
+		return nil, nil
+	case dataSet.Type() != data.TypeArray:
+		return rest[0], nil
+	default:
+		return rest, nil
+	}
+}
+
+func parseChannels(v data.Value) (map[string]ChannelConfig, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("channels must be a map: %v", err)
+	}
+	res := make(map[string]ChannelConfig, len(m))
+	for name, x := range m {
+		cm, err := data.AsMap(x)
+		if err != nil {
+			return nil, fmt.Errorf("channel '%v' must be a map: %v", name, err)
+		}
+		var conf ChannelConfig
+		for k, y := range cm {
+			switch k {
+			case "method":
+				if conf.Method, err = data.AsString(y); err != nil {
+					return nil, fmt.Errorf("method of channel '%v' must be a string: %v", name, err)
+				}
+			case "batch_size":
+				n, err := data.AsInt(y)
+				if err != nil {
+					return nil, fmt.Errorf("batch_size of channel '%v' must be an integer: %v", name, err)
+				}
+				if n <= 0 {
+					return nil, fmt.Errorf("batch_size of channel '%v' must be greater than 0", name)
+				}
+				conf.BatchSize = int(n)
+			default:
+				return nil, fmt.Errorf("unknown parameter of channel '%v': %v", name, k)
+			}
+		}
+		res[name] = conf
+	}
+	return res, nil
+}
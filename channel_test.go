@@ -0,0 +1,120 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestParseChannels(t *testing.T) {
+	Convey("Given channels parameters", t, func() {
+		Convey("When they're valid", func() {
+			c, err := parseChannels(data.Map{
+				"unlabeled": data.Map{"method": data.String("fit_unsupervised"), "batch_size": data.Int(3)},
+				"labeled":   data.Map{},
+			})
+
+			Convey("Then they should be parsed", func() {
+				So(err, ShouldBeNil)
+				So(c, ShouldResemble, map[string]ChannelConfig{
+					"unlabeled": {Method: "fit_unsupervised", BatchSize: 3},
+					"labeled":   {},
+				})
+			})
+		})
+
+		Convey("When a channel has an unknown parameter", func() {
+			_, err := parseChannels(data.Map{"a": data.Map{"size": data.Int(1)}})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a channel has a non-positive batch size", func() {
+			_, err := parseChannels(data.Map{"a": data.Map{"batch_size": data.Int(0)}})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestWriteChannels(t *testing.T) {
+	rec := func(channel string, x int) data.Value {
+		m := data.Map{"x": data.Int(x)}
+		if channel != "" {
+			m["channel"] = data.String(channel)
+		}
+		return m
+	}
+
+	Convey("Given a state with labeled and unlabeled channels", t, func() {
+		ctx := core.NewContext(nil)
+		buckets := map[string][]data.Value{}
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				arr, _ := data.AsArray(dt[0])
+				buckets[funcName] = append(buckets[funcName], arr...)
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 2, ChannelPath: "channel", Channels: map[string]ChannelConfig{
+			"labeled":   {},
+			"unlabeled": {Method: "fit_unsupervised", BatchSize: 3},
+		}}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When records of both channels are written", func() {
+			for i := 0; i < 3; i++ {
+				So(s.writeRecord(ctx, rec("unlabeled", i), time.Time{}), ShouldBeNil)
+			}
+			So(s.writeRecord(ctx, data.Array{rec("labeled", 3), rec("", 4)}, time.Time{}), ShouldBeNil)
+
+			Convey("Then each bucket should be trained by the method of its channel", func() {
+				So(b.calls, ShouldResemble, []string{"fit_unsupervised"})
+				So(buckets["fit_unsupervised"], ShouldResemble, []data.Value{
+					rec("unlabeled", 0), rec("unlabeled", 1), rec("unlabeled", 2)})
+			})
+
+			Convey("Then records should be buffered by their channels", func() {
+				So(s.channels.stats(), ShouldResemble, data.Map{"labeled": data.Int(1), "unlabeled": data.Int(0)})
+				So(s.bucket, ShouldResemble, []data.Value{data.Array{rec("", 4)}})
+			})
+
+			Convey("Then the labeled channel should be trained by fit with its batch size", func() {
+				So(s.writeRecord(ctx, rec("labeled", 5), time.Time{}), ShouldBeNil)
+				So(b.calls, ShouldResemble, []string{"fit_unsupervised", "fit"})
+				So(buckets["fit"], ShouldResemble, []data.Value{rec("labeled", 3), rec("labeled", 5)})
+			})
+
+			Convey("Then buffered records should be written to the write-ahead log", func() {
+				So(len(s.bufferedEntries()), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When a record of an unknown channel is written", func() {
+			err := s.writeRecord(ctx, rec("other", 0), time.Time{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When records of a channel expire", func() {
+			s.params.BucketTTL = time.Minute
+			s.params.BucketExpiry = "fit"
+			now := time.Now()
+			So(s.writeRecord(ctx, rec("unlabeled", 0), now), ShouldBeNil)
+			So(s.expireBuckets(ctx, now.Add(2*time.Minute)), ShouldBeNil)
+
+			Convey("Then they should be trained by the method of the channel", func() {
+				So(b.calls, ShouldResemble, []string{"fit_unsupervised"})
+				So(s.channels.stats()["unlabeled"], ShouldEqual, data.Int(0))
+			})
+		})
+	})
+}
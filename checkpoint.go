@@ -0,0 +1,256 @@
+package pymlstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// checkpointWorkers is the number of states saved or loaded concurrently
+	// by SaveAll and LoadAll.
+	checkpointWorkers = 4
+
+	// checkpointManifestName is the name of the manifest file written by
+	// SaveAll.
+	checkpointManifestName = "manifest.json"
+)
+
+// checkpointManifest lists states written to a directory by SaveAll.
+type checkpointManifest struct {
+	CreatedAt time.Time         `json:"created_at"`
+	States    []checkpointEntry `json:"states"`
+}
+
+// checkpointEntry is a state in checkpointManifest. Fields other than Name,
+// File, and Bytes describe the saved model so that the manifest can be
+// inspected without loading it.
+type checkpointEntry struct {
+	Name         string          `json:"name"`
+	File         string          `json:"file"`
+	Bytes        int64           `json:"bytes"`
+	ModuleName   string          `json:"module_name,omitempty"`
+	ClassName    string          `json:"class_name,omitempty"`
+	ModelVersion string          `json:"model_version,omitempty"`
+	Params       json.RawMessage `json:"params,omitempty"`
+}
+
+// SaveAll saves all pymlstate states of the context to files in dir
+// concurrently and writes a manifest of them. The manifest is written only
+// when all states are saved, so that a directory having the manifest always
+// has a complete checkpoint.
+func SaveAll(ctx *core.Context, dir string) error {
+	states, err := ctx.SharedStates.List()
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for name, st := range states {
+		if _, ok := st.(*State); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	entries := make([]checkpointEntry, len(names))
+	errs := runCheckpointWorkers(names, func(i int) error {
+		s := states[names[i]].(*State)
+		s.setName(names[i])
+		e := checkpointEntry{Name: names[i], File: url.PathEscape(names[i]) + ".state"}
+		n, err := writeCheckpointFile(filepath.Join(dir, e.File), func(f *os.File) error {
+			return s.save(ctx, f, data.Map{}, false)
+		})
+		if err != nil {
+			return err
+		}
+		e.Bytes = n
+		if err := e.describe(filepath.Join(dir, e.File)); err != nil {
+			return err
+		}
+		entries[i] = e
+		return nil
+	})
+	if err := checkpointError("save", names, errs); err != nil {
+		return err
+	}
+
+	m := &checkpointManifest{
+		CreatedAt: time.Now(),
+		States:    entries,
+	}
+	_, err = writeCheckpointFile(filepath.Join(dir, checkpointManifestName), func(f *os.File) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+	if err != nil {
+		return err
+	}
+	ctx.Log().WithField("states", len(names)).WithField("dir", dir).Info("pymlstate saved all states")
+	return nil
+}
+
+// describe sets fields describing the model written to the file.
+func (e *checkpointEntry) describe(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	saved, sd, _, err := readStateHeader(f)
+	if err != nil {
+		return err
+	}
+	if sd.Base != nil {
+		e.ModuleName = sd.Base.ModuleName
+		e.ClassName = sd.Base.ClassName
+	}
+	e.ModelVersion = sd.ModelVersion
+
+	// MLParams is encoded with codec tags, which are the names of parameters.
+	var params []byte
+	if err := codec.NewEncoderBytes(&params, &codec.JsonHandle{}).Encode(saved); err != nil {
+		return err
+	}
+	e.Params = params
+	return nil
+}
+
+// LoadAll loads states listed in the manifest in dir written by SaveAll
+// concurrently. A model is loaded into the state of the same name when it
+// exists. Otherwise, a new state is created and added to the context.
+func LoadAll(ctx *core.Context, dir string) error {
+	m, err := readCheckpointManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(m.States))
+	for i, e := range m.States {
+		names[i] = e.Name
+	}
+	errs := runCheckpointWorkers(names, func(i int) error {
+		e := m.States[i]
+		f, err := os.Open(filepath.Join(dir, filepath.Base(e.File)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if st, err := ctx.SharedStates.Get(e.Name); err == nil {
+			s, ok := st.(*State)
+			if !ok {
+				return fmt.Errorf("state '%v' isn't a State", e.Name)
+			}
+			s.setName(e.Name)
+			return s.Load(ctx, f, data.Map{})
+		}
+		st, err := (&StateCreator{}).LoadState(ctx, f, data.Map{})
+		if err != nil {
+			return err
+		}
+		if err := ctx.SharedStates.Add(e.Name, "pymlstate", st); err != nil {
+			st.Terminate(ctx)
+			return err
+		}
+		st.(*State).setName(e.Name)
+		return nil
+	})
+	if err := checkpointError("load", names, errs); err != nil {
+		return err
+	}
+	ctx.Log().WithField("states", len(names)).WithField("dir", dir).Info("pymlstate loaded all states")
+	return nil
+}
+
+func readCheckpointManifest(dir string) (*checkpointManifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, checkpointManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the manifest of the checkpoint: %v", err)
+	}
+	var m checkpointManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("cannot decode the manifest of the checkpoint: %v", err)
+	}
+	return &m, nil
+}
+
+// runCheckpointWorkers calls f for each index of names by at most
+// checkpointWorkers goroutines and returns errors of them.
+func runCheckpointWorkers(names []string, f func(i int) error) []error {
+	errs := make([]error, len(names))
+	idx := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < checkpointWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				errs[i] = f(i)
+			}
+		}()
+	}
+	for i := range names {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	return errs
+}
+
+func checkpointError(op string, names []string, errs []error) error {
+	msgs := []string{}
+	for i, err := range errs {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%v: %v", names[i], err))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("cannot %v %v of %v states: %v", op, len(msgs), len(names), strings.Join(msgs, "; "))
+}
+
+// writeCheckpointFile writes a file by write to a temporary file and renames
+// it to path, so that a broken file doesn't remain. It returns the size of
+// the file.
+func writeCheckpointFile(path string, write func(f *os.File) error) (int64, error) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	var size int64
+	if err == nil {
+		size, err = f.Seek(0, io.SeekCurrent)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return size, nil
+}
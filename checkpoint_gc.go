@@ -0,0 +1,209 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy decides which checkpoints written by SaveAll are kept by
+// CollectCheckpoints. A checkpoint is kept when it's one of the KeepLast
+// latest checkpoints, or when it's the latest checkpoint of a day within the
+// last KeepDailyDays days including today. At least one of them must be
+// greater than 0.
+type RetentionPolicy struct {
+	KeepLast      int
+	KeepDailyDays int
+}
+
+type checkpointDir struct {
+	path      string
+	createdAt time.Time
+}
+
+// CollectCheckpoints removes checkpoints in subdirectories of root which
+// aren't kept by the policy. A subdirectory is a checkpoint when it has the
+// manifest written by SaveAll, and its time is the creation time in the
+// manifest. Other subdirectories, such as ones being written, aren't
+// removed. It returns the number of removed checkpoints and their bytes.
+func CollectCheckpoints(root string, p RetentionPolicy) (int, int64, error) {
+	return collectCheckpoints(root, p, time.Now())
+}
+
+func collectCheckpoints(root string, p RetentionPolicy, now time.Time) (int, int64, error) {
+	if p.KeepLast <= 0 && p.KeepDailyDays <= 0 {
+		return 0, 0, fmt.Errorf("a retention policy must keep some checkpoints")
+	}
+	dirs, err := listCheckpointDirs(root)
+	if err != nil {
+		return 0, 0, err
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].createdAt.After(dirs[j].createdAt)
+	})
+
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	oldest := today.AddDate(0, 0, 1-p.KeepDailyDays)
+	days := map[time.Time]bool{}
+	removed, reclaimed := 0, int64(0)
+	for i, c := range dirs {
+		y, m, d := c.createdAt.In(now.Location()).Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+		daily := p.KeepDailyDays > 0 && !day.Before(oldest) && !days[day]
+		if daily {
+			days[day] = true
+		}
+		if i < p.KeepLast || daily {
+			continue
+		}
+
+		n, err := dirSize(c.path)
+		if err != nil {
+			return removed, reclaimed, err
+		}
+		if err := os.RemoveAll(c.path); err != nil {
+			return removed, reclaimed, fmt.Errorf("cannot remove the checkpoint '%v': %v", c.path, err)
+		}
+		removed++
+		reclaimed += n
+	}
+	return removed, reclaimed, nil
+}
+
+func listCheckpointDirs(root string) ([]checkpointDir, error) {
+	f, err := os.Open(root)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	dirs := []checkpointDir{}
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(root, fi.Name())
+		m, err := readCheckpointManifest(path)
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, checkpointDir{path: path, createdAt: m.CreatedAt})
+	}
+	return dirs, nil
+}
+
+func dirSize(path string) (int64, error) {
+	var n int64
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n, err
+}
+
+// checkpointGCStats is the statistics of all CheckpointGCs exposed by
+// MetricsHandler.
+var checkpointGCStats struct {
+	sync.Mutex
+	runs           int64
+	failures       int64
+	removed        int64
+	reclaimedBytes int64
+}
+
+func observeCheckpointGC(removed int, reclaimed int64, err error) {
+	checkpointGCStats.Lock()
+	defer checkpointGCStats.Unlock()
+	checkpointGCStats.runs++
+	if err != nil {
+		checkpointGCStats.failures++
+	}
+	checkpointGCStats.removed += int64(removed)
+	checkpointGCStats.reclaimedBytes += reclaimed
+}
+
+func writeCheckpointGCMetrics(w io.Writer) error {
+	checkpointGCStats.Lock()
+	defer checkpointGCStats.Unlock()
+	if checkpointGCStats.runs == 0 {
+		return nil
+	}
+	for _, m := range []struct {
+		name string
+		v    int64
+	}{
+		{"checkpoint_gc_runs_total", checkpointGCStats.runs},
+		{"checkpoint_gc_failures_total", checkpointGCStats.failures},
+		{"checkpoint_gc_removed_total", checkpointGCStats.removed},
+		{"checkpoint_gc_reclaimed_bytes_total", checkpointGCStats.reclaimedBytes},
+	} {
+		if _, err := fmt.Fprintf(w, "# TYPE pymlstate_%v counter\npymlstate_%v %v\n", m.name, m.name, m.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckpointGC collects checkpoints in a directory periodically in the
+// background.
+type CheckpointGC struct {
+	stop chan struct{}
+	once sync.Once
+	done chan struct{}
+}
+
+// StartCheckpointGC starts collecting checkpoints in root by the policy every
+// interval until Stop is called. Numbers of removed checkpoints and their
+// bytes are exposed by MetricsHandler.
+func StartCheckpointGC(ctx *core.Context, root string, p RetentionPolicy, interval time.Duration) (*CheckpointGC, error) {
+	if p.KeepLast <= 0 && p.KeepDailyDays <= 0 {
+		return nil, fmt.Errorf("a retention policy must keep some checkpoints")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("the interval of checkpoint GC must be greater than 0")
+	}
+	g := &CheckpointGC{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(g.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-t.C:
+			}
+			n, bytes, err := CollectCheckpoints(root, p)
+			observeCheckpointGC(n, bytes, err)
+			if err != nil {
+				ctx.ErrLog(err).WithField("dir", root).Error("pymlstate cannot collect checkpoints")
+			} else if n > 0 {
+				ctx.Log().WithField("dir", root).WithField("removed", n).
+					WithField("reclaimed_bytes", bytes).Info("pymlstate collected checkpoints")
+			}
+		}
+	}()
+	return g, nil
+}
+
+// Stop stops collecting checkpoints and waits for the running collection.
+func (g *CheckpointGC) Stop() {
+	g.once.Do(func() {
+		close(g.stop)
+	})
+	<-g.done
+}
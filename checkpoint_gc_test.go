@@ -0,0 +1,93 @@
+package pymlstate
+
+import (
+	"bytes"
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCheckpoint(root, name string, createdAt time.Time) {
+	dir := filepath.Join(root, name)
+	So(os.MkdirAll(dir, 0755), ShouldBeNil)
+	b, err := json.Marshal(&checkpointManifest{CreatedAt: createdAt})
+	So(err, ShouldBeNil)
+	So(ioutil.WriteFile(filepath.Join(dir, checkpointManifestName), b, 0644), ShouldBeNil)
+	So(ioutil.WriteFile(filepath.Join(dir, "m.state"), make([]byte, 100), 0644), ShouldBeNil)
+}
+
+func listTestCheckpoints(root string) []string {
+	fis, err := ioutil.ReadDir(root)
+	So(err, ShouldBeNil)
+	names := []string{}
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	return names
+}
+
+func TestCollectCheckpoints(t *testing.T) {
+	Convey("Given checkpoints written over days", t, func() {
+		root, err := ioutil.TempDir("", "pymlstate_gc")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(root)
+		})
+		now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+		writeTestCheckpoint(root, "a", now.Add(-1*time.Hour))
+		writeTestCheckpoint(root, "b", now.Add(-2*time.Hour))
+		writeTestCheckpoint(root, "c", now.Add(-3*time.Hour))
+		writeTestCheckpoint(root, "d", now.Add(-24*time.Hour))
+		writeTestCheckpoint(root, "e", now.Add(-25*time.Hour))
+		writeTestCheckpoint(root, "f", now.Add(-72*time.Hour))
+		So(os.MkdirAll(filepath.Join(root, "writing"), 0755), ShouldBeNil)
+
+		Convey("When they're collected by keeping the last ones", func() {
+			n, reclaimed, err := collectCheckpoints(root, RetentionPolicy{KeepLast: 2}, now)
+
+			Convey("Then older checkpoints should be removed", func() {
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 4)
+				So(reclaimed, ShouldBeGreaterThanOrEqualTo, 400)
+				So(listTestCheckpoints(root), ShouldResemble, []string{"a", "b", "writing"})
+			})
+		})
+
+		Convey("When they're collected by keeping dailies", func() {
+			n, _, err := collectCheckpoints(root, RetentionPolicy{KeepLast: 1, KeepDailyDays: 2}, now)
+
+			Convey("Then the latest checkpoint of each day should be kept", func() {
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 4)
+				So(listTestCheckpoints(root), ShouldResemble, []string{"a", "d", "writing"})
+			})
+		})
+
+		Convey("When the policy doesn't keep anything", func() {
+			_, _, err := collectCheckpoints(root, RetentionPolicy{}, now)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(len(listTestCheckpoints(root)), ShouldEqual, 7)
+			})
+		})
+	})
+
+	Convey("Given statistics of checkpoint GC", t, func() {
+		observeCheckpointGC(2, 300, nil)
+
+		Convey("When metrics are written", func() {
+			w := bytes.NewBuffer(nil)
+			So(writeCheckpointGCMetrics(w), ShouldBeNil)
+
+			Convey("Then they should have counters", func() {
+				So(w.String(), ShouldContainSubstring, "# TYPE pymlstate_checkpoint_gc_reclaimed_bytes_total counter\n")
+				So(w.String(), ShouldContainSubstring, "pymlstate_checkpoint_gc_removed_total ")
+			})
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package pymlstate
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveAll(t *testing.T) {
+	Convey("Given a context having pymlstate states", t, func() {
+		ctx := core.NewContext(&core.ContextConfig{})
+		b2 := &fakeBackend{}
+		So(ctx.SharedStates.Add("model1", "pymlstate", &State{base: &fakeBackend{}}), ShouldBeNil)
+		So(ctx.SharedStates.Add("model2", "pymlstate", &State{base: b2}), ShouldBeNil)
+		dir, err := ioutil.TempDir("", "pymlstate")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+
+		Convey("When all states are saved", func() {
+			err := SaveAll(ctx, dir)
+
+			Convey("Then the manifest should list them", func() {
+				So(err, ShouldBeNil)
+				b, err := ioutil.ReadFile(filepath.Join(dir, checkpointManifestName))
+				So(err, ShouldBeNil)
+				var m checkpointManifest
+				So(json.Unmarshal(b, &m), ShouldBeNil)
+				So(len(m.States), ShouldEqual, 2)
+				for i, name := range []string{"model1", "model2"} {
+					e := m.States[i]
+					So(e.Name, ShouldEqual, name)
+					fi, err := os.Stat(filepath.Join(dir, e.File))
+					So(err, ShouldBeNil)
+					So(fi.Size(), ShouldEqual, e.Bytes)
+					So(e.Bytes, ShouldBeGreaterThan, 0)
+				}
+			})
+		})
+
+		Convey("When a state cannot be saved", func() {
+			b2.terminated = true
+			err := SaveAll(ctx, dir)
+
+			Convey("Then it should fail without writing the manifest", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "model2")
+				_, err := os.Stat(filepath.Join(dir, checkpointManifestName))
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When states are loaded from a directory without a manifest", func() {
+			err := LoadAll(ctx, dir)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
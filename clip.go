@@ -0,0 +1,244 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// clipReservoirSize is the number of values sampled to estimate
+	// percentiles of a feature.
+	clipReservoirSize = 1000
+
+	// clipMinSamples is the number of samples required before percentile
+	// based clipping is applied.
+	clipMinSamples = 10
+
+	// clipRefreshInterval is the number of samples after which percentiles
+	// are recomputed once the reservoir is full.
+	clipRefreshInterval = 100
+)
+
+// ClipPolicy is the range to which a numeric feature at Path is clipped. Min
+// and Max are fixed bounds. LowerPercentile and UpperPercentile, which are in
+// (0, 100), are bounds learned online from training records. A bound which
+// is nil or 0 isn't applied. When both kinds of bounds are given, the tighter
+// one is applied.
+type ClipPolicy struct {
+	Path            string   `codec:"path"`
+	Min             *float64 `codec:"min"`
+	Max             *float64 `codec:"max"`
+	LowerPercentile float64  `codec:"lower_percentile"`
+	UpperPercentile float64  `codec:"upper_percentile"`
+}
+
+func (p *ClipPolicy) learnsPercentiles() bool {
+	return p.LowerPercentile > 0 || p.UpperPercentile > 0
+}
+
+// reservoir is a uniform sample of values seen so far.
+type reservoir struct {
+	Seen    int64     `codec:"seen"`
+	Samples []float64 `codec:"samples"`
+
+	dirty  int
+	sorted []float64
+}
+
+func (r *reservoir) add(x float64, rnd *rand.Rand) {
+	r.Seen++
+	if len(r.Samples) < clipReservoirSize {
+		r.Samples = append(r.Samples, x)
+	} else if i := rnd.Int63n(r.Seen); i < clipReservoirSize {
+		r.Samples[i] = x
+	}
+	r.dirty++
+}
+
+// percentile returns the p-th percentile of samples. It returns false when
+// there aren't enough samples.
+func (r *reservoir) percentile(p float64) (float64, bool) {
+	if len(r.Samples) < clipMinSamples {
+		return 0, false
+	}
+	// Percentiles are recomputed every time while the reservoir is filling
+	// because they change rapidly.
+	if r.sorted == nil || r.dirty >= clipRefreshInterval ||
+		(r.dirty > 0 && len(r.Samples) < clipReservoirSize) {
+		r.sorted = append(r.sorted[:0], r.Samples...)
+		sort.Float64s(r.sorted)
+		r.dirty = 0
+	}
+	i := int(math.Floor(p / 100 * float64(len(r.sorted)-1)))
+	return r.sorted[i], true
+}
+
+// clipper clips numeric features so that a single corrupt value cannot
+// destroy the model.
+type clipper struct {
+	policies []ClipPolicy
+	paths    []data.Path
+
+	// mu protects reservoirs because records can be processed concurrently
+	// by Fit and Predict, which only acquire the read lock of State.
+	mu         sync.Mutex
+	reservoirs []*reservoir
+	rnd        *rand.Rand
+}
+
+var _ preprocessor = &clipper{}
+
+func newClipper(policies []ClipPolicy) (*clipper, error) {
+	c := &clipper{
+		policies:   policies,
+		paths:      make([]data.Path, len(policies)),
+		reservoirs: make([]*reservoir, len(policies)),
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for i, p := range policies {
+		path, err := data.CompilePath(p.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of clip '%v': %v", p.Path, err)
+		}
+		c.paths[i] = path
+
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			return nil, fmt.Errorf("min of clip '%v' must not be greater than max", p.Path)
+		}
+		if p.LowerPercentile < 0 || p.LowerPercentile >= 100 ||
+			p.UpperPercentile < 0 || p.UpperPercentile >= 100 {
+			return nil, fmt.Errorf("percentiles of clip '%v' must be in (0, 100)", p.Path)
+		}
+		if p.UpperPercentile > 0 && p.LowerPercentile > p.UpperPercentile {
+			return nil, fmt.Errorf("lower_percentile of clip '%v' must not be greater than upper_percentile",
+				p.Path)
+		}
+		if p.learnsPercentiles() {
+			c.reservoirs[i] = &reservoir{}
+		}
+	}
+	return c, nil
+}
+
+func (c *clipper) process(rec data.Map, training bool, rep *qualityReport) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, path := range c.paths {
+		v, err := rec.Get(path)
+		if err != nil || v.Type() == data.TypeNull {
+			continue
+		}
+		p := &c.policies[i]
+		x, err := asNumber(v)
+		if err != nil {
+			rep.typeMismatch(p.Path)
+			return fmt.Errorf("cannot clip '%v': %v", p.Path, err)
+		}
+
+		lo, hi := math.Inf(-1), math.Inf(1)
+		if p.Min != nil {
+			lo = *p.Min
+		}
+		if p.Max != nil {
+			hi = *p.Max
+		}
+		if r := c.reservoirs[i]; r != nil {
+			if training && !math.IsNaN(x) && !math.IsInf(x, 0) {
+				r.add(x, c.rnd)
+			}
+			if q, ok := r.percentile(p.LowerPercentile); ok && p.LowerPercentile > 0 {
+				lo = math.Max(lo, q)
+			}
+			if q, ok := r.percentile(p.UpperPercentile); ok && p.UpperPercentile > 0 {
+				hi = math.Min(hi, q)
+			}
+		}
+
+		clipped := math.Min(math.Max(x, lo), hi)
+		if clipped != x {
+			rep.outOfRangeValue(p.Path)
+			if err := rec.Set(path, data.Float(clipped)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// snapshot returns a copy of reservoirs keyed by paths.
+func (c *clipper) snapshot() map[string]reservoir {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := map[string]reservoir{}
+	for i, p := range c.policies {
+		if r := c.reservoirs[i]; r != nil {
+			res[p.Path] = reservoir{
+				Seen:    r.Seen,
+				Samples: append([]float64(nil), r.Samples...),
+			}
+		}
+	}
+	return res
+}
+
+// restore sets reservoirs saved by snapshot.
+func (c *clipper) restore(rs map[string]reservoir) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.policies {
+		if r, ok := rs[p.Path]; ok && c.reservoirs[i] != nil {
+			c.reservoirs[i] = &reservoir{
+				Seen:    r.Seen,
+				Samples: r.Samples,
+			}
+		}
+	}
+}
+
+// parseClipPolicies parses clip parameter. It's a map from paths to maps
+// which have "min", "max", "lower_percentile", or "upper_percentile".
+func parseClipPolicies(v data.Value) ([]ClipPolicy, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("clip must be a map: %v", err)
+	}
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	policies := make([]ClipPolicy, 0, len(m))
+	for _, p := range paths {
+		cm, err := data.AsMap(m[p])
+		if err != nil {
+			return nil, fmt.Errorf("clip of '%v' must be a map: %v", p, err)
+		}
+		policy := ClipPolicy{Path: p}
+		for k, x := range cm {
+			f, err := asNumber(x)
+			if err != nil {
+				return nil, fmt.Errorf("%v of clip '%v' must be a number: %v", k, p, err)
+			}
+			switch k {
+			case "min":
+				policy.Min = &f
+			case "max":
+				policy.Max = &f
+			case "lower_percentile":
+				policy.LowerPercentile = f
+			case "upper_percentile":
+				policy.UpperPercentile = f
+			default:
+				return nil, fmt.Errorf("unknown parameter of clip '%v': %v", p, k)
+			}
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
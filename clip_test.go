@@ -0,0 +1,90 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestClipper(t *testing.T) {
+	Convey("Given a clipper having fixed bounds", t, func() {
+		policies, err := parseClipPolicies(data.Map{
+			"temperature": data.Map{
+				"min": data.Int(-50),
+				"max": data.Float(60),
+			},
+		})
+		So(err, ShouldBeNil)
+		c, err := newClipper(policies)
+		So(err, ShouldBeNil)
+
+		Convey("When an outlier is processed", func() {
+			rec := data.Map{"temperature": data.Float(1e308)}
+			So(c.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then it should be clipped", func() {
+				So(rec["temperature"], ShouldEqual, data.Float(60))
+			})
+		})
+
+		Convey("When a value in the range is processed", func() {
+			rec := data.Map{"temperature": data.Int(20)}
+			So(c.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then it should not be changed", func() {
+				So(rec["temperature"], ShouldEqual, data.Int(20))
+			})
+		})
+	})
+
+	Convey("Given a clipper learning percentiles", t, func() {
+		c, err := newClipper([]ClipPolicy{
+			{Path: "x", LowerPercentile: 10, UpperPercentile: 90},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When an outlier is processed before enough samples", func() {
+			rec := data.Map{"x": data.Float(1e308)}
+			So(c.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then it should not be clipped", func() {
+				So(rec["x"], ShouldEqual, data.Float(1e308))
+			})
+		})
+
+		Convey("When enough training records are processed", func() {
+			for i := 1; i <= 100; i++ {
+				So(c.process(data.Map{"x": data.Int(i)}, true, nil), ShouldBeNil)
+			}
+
+			Convey("And when an outlier is processed", func() {
+				rec := data.Map{"x": data.Float(1e308)}
+				So(c.process(rec, false, nil), ShouldBeNil)
+
+				Convey("Then it should be clipped to the percentile", func() {
+					So(rec["x"], ShouldEqual, data.Float(90))
+				})
+			})
+
+			Convey("And when samples are restored to another clipper", func() {
+				c2, err := newClipper(c.policies)
+				So(err, ShouldBeNil)
+				c2.restore(c.snapshot())
+
+				Convey("Then it should have the same samples", func() {
+					So(c2.snapshot(), ShouldResemble, c.snapshot())
+				})
+			})
+		})
+	})
+
+	Convey("Given an invalid clip parameter", t, func() {
+		_, err := parseClipPolicies(data.Map{
+			"x": data.Map{"median": data.Int(1)},
+		})
+
+		Convey("Then parsing it should fail", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
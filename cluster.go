@@ -0,0 +1,188 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sync"
+)
+
+// clusterTracker counts clusters assigned by AssignCluster in windows of
+// window assignments and computes the drift of cluster sizes as the total
+// variation distance between proportions of clusters in the last two
+// windows.
+type clusterTracker struct {
+	window    int
+	threshold float64
+
+	mu       sync.Mutex
+	counts   map[string]int64
+	n        int
+	baseline map[string]float64
+	drift    float64
+	hasDrift bool
+}
+
+func newClusterTracker(p *MLParams) *clusterTracker {
+	return &clusterTracker{
+		window:    p.ClusterDriftWindow,
+		threshold: p.ClusterDriftThreshold,
+		counts:    map[string]int64{},
+	}
+}
+
+// observe counts clusters in the result of predict, which is a cluster or
+// an array of clusters. It returns the latest drift, and true as drifted
+// when a window is completed and the drift exceeds the threshold. It does
+// nothing when t is nil.
+func (t *clusterTracker) observe(res data.Value) (drift float64, drifted bool) {
+	if t == nil {
+		return 0, false
+	}
+	clusters := []data.Value{res}
+	if res.Type() == data.TypeArray {
+		clusters, _ = data.AsArray(res)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range clusters {
+		t.counts[valueKey(c)]++
+		t.n++
+		if t.n < t.window {
+			continue
+		}
+
+		props := make(map[string]float64, len(t.counts))
+		for k, n := range t.counts {
+			props[k] = float64(n) / float64(t.n)
+		}
+		if t.baseline != nil {
+			t.drift = totalVariation(t.baseline, props)
+			t.hasDrift = true
+			if t.threshold > 0 && t.drift > t.threshold {
+				drifted = true
+			}
+		}
+		t.baseline = props
+		t.counts = map[string]int64{}
+		t.n = 0
+	}
+	return t.drift, drifted
+}
+
+// totalVariation returns the total variation distance between two
+// distributions.
+func totalVariation(p, q map[string]float64) float64 {
+	d := 0.0
+	for k, x := range p {
+		d += math.Abs(x - q[k])
+	}
+	for k, y := range q {
+		if _, ok := p[k]; !ok {
+			d += y
+		}
+	}
+	return d / 2
+}
+
+// toMap returns sizes of clusters in the current window and the latest
+// drift. It returns nil when no cluster has been assigned.
+func (t *clusterTracker) toMap() data.Map {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n == 0 && t.baseline == nil {
+		return nil
+	}
+	sizes := data.Map{}
+	for k, n := range t.counts {
+		sizes[k] = data.Int(n)
+	}
+	res := data.Map{"sizes": sizes}
+	if t.hasDrift {
+		res["drift"] = data.Float(t.drift)
+	}
+	return res
+}
+
+// AssignCluster assigns the data to clusters by "predict" of the model in
+// the same way as Predict except that the result isn't wrapped by
+// versioned_predictions. "predict" must return the ID of a cluster, or an
+// array of IDs when the data is an array. Sizes of assigned clusters are
+// tracked to compute their drift, and EventDriftDetected is emitted when
+// the drift exceeds cluster_drift_threshold.
+func (s *State) AssignCluster(ctx *core.Context, dt data.Value) (data.Value, error) {
+	res, err := s.predictWithFallback(ctx, dt, "", true, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClusters(res); err != nil {
+		return nil, err
+	}
+
+	s.rwm.RLock()
+	clusters := s.clusters
+	s.rwm.RUnlock()
+	if drift, drifted := clusters.observe(res); drifted {
+		ctx.Log().WithField("drift", drift).WithField("threshold", clusters.threshold).
+			Warn("pymlstate detected a drift of cluster sizes")
+		s.hooks.emit(Event{Type: EventDriftDetected, Details: data.Map{
+			"kind":      data.String("cluster_sizes"),
+			"drift":     data.Float(drift),
+			"threshold": data.Float(clusters.threshold),
+		}})
+	}
+	return res, nil
+}
+
+// checkClusters returns an error when the result of predict isn't an ID of
+// a cluster or an array of IDs.
+func checkClusters(res data.Value) error {
+	clusters := []data.Value{res}
+	if res.Type() == data.TypeArray {
+		clusters, _ = data.AsArray(res)
+	}
+	for _, c := range clusters {
+		switch c.Type() {
+		case data.TypeInt, data.TypeString:
+		default:
+			return fmt.Errorf("predict must return IDs of clusters as integers or strings: %v", c)
+		}
+	}
+	return nil
+}
+
+// ClusterCenters returns centers of clusters returned by "cluster_centers"
+// of the model, which usually returns cluster_centers_ of the estimator as
+// a list.
+func (s *State) ClusterCenters(ctx *core.Context) (data.Value, error) {
+	if err := s.authorize(ctx, ActionPredict); err != nil {
+		return nil, err
+	}
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return nil, err
+	}
+	return s.callPython(callPredict, "cluster_centers")
+}
+
+// AssignCluster assigns the data to clusters by the model of the state. See
+// State.AssignCluster for details.
+func AssignCluster(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.AssignCluster(ctx, dt)
+}
+
+// ClusterCenters returns centers of clusters of the model of the state.
+func ClusterCenters(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.ClusterCenters(ctx)
+}
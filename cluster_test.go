@@ -0,0 +1,97 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestClusterTracker(t *testing.T) {
+	Convey("Given a cluster tracker of a window of 4 with threshold 0.4", t, func() {
+		c := newClusterTracker(&MLParams{ClusterDriftWindow: 4, ClusterDriftThreshold: 0.4})
+
+		Convey("When clusters of the first window are observed", func() {
+			_, drifted := c.observe(data.Array{data.Int(0), data.Int(0), data.Int(1), data.Int(1)})
+
+			Convey("Then no drift should be computed", func() {
+				So(drifted, ShouldBeFalse)
+				So(c.toMap(), ShouldResemble, data.Map{"sizes": data.Map{}})
+			})
+
+			Convey("Then a window of the same sizes shouldn't drift", func() {
+				drift, drifted := c.observe(data.Array{data.Int(1), data.Int(0), data.Int(1), data.Int(0)})
+				So(drifted, ShouldBeFalse)
+				So(drift, ShouldEqual, 0)
+			})
+
+			Convey("Then a window of a different cluster should drift", func() {
+				c.observe(data.Int(2))
+				So(c.toMap()["sizes"], ShouldResemble, data.Map{"2": data.Int(1)})
+				drift, drifted := c.observe(data.Array{data.Int(2), data.Int(2), data.Int(0)})
+				So(drifted, ShouldBeTrue)
+				So(drift, ShouldEqual, 0.75)
+				So(c.toMap()["drift"], ShouldEqual, data.Float(0.75))
+			})
+		})
+
+		Convey("When nothing is observed", func() {
+			Convey("Then it shouldn't report anything", func() {
+				So(c.toMap(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestAssignCluster(t *testing.T) {
+	Convey("Given a clustering state", t, func() {
+		ctx := core.NewContext(nil)
+		var res data.Value = data.Int(3)
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				if funcName == "cluster_centers" {
+					return data.Array{data.Array{data.Float(0), data.Float(1)}}, nil
+				}
+				return res, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{ClusterDriftWindow: 1, ClusterDriftThreshold: 0.5}}
+		So(s.setUpParams(), ShouldBeNil)
+		var events []Event
+		s.OnEvent(func(e Event) { events = append(events, e) })
+
+		Convey("When records are assigned to different clusters", func() {
+			c, err := s.AssignCluster(ctx, data.Map{"x": data.Int(1)})
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, data.Int(3))
+			res = data.Int(4)
+			_, err = s.AssignCluster(ctx, data.Map{"x": data.Int(2)})
+			So(err, ShouldBeNil)
+
+			Convey("Then a drift should be emitted", func() {
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Type, ShouldEqual, EventDriftDetected)
+				So(events[0].Details["drift"], ShouldEqual, data.Float(1))
+				So(s.Status()["clusters"], ShouldNotBeNil)
+			})
+		})
+
+		Convey("When predict doesn't return a cluster", func() {
+			res = data.Float(0.5)
+			_, err := s.AssignCluster(ctx, data.Map{"x": data.Int(1)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When centers of clusters are requested", func() {
+			centers, err := s.ClusterCenters(ctx)
+
+			Convey("Then cluster_centers of the model should be returned", func() {
+				So(err, ShouldBeNil)
+				So(centers, ShouldResemble, data.Array{data.Array{data.Float(0), data.Float(1)}})
+			})
+		})
+	})
+}
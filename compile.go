@@ -0,0 +1,53 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+// compileResult is the result of the latest compilation of the model.
+type compileResult struct {
+	at      time.Time
+	elapsed time.Duration
+	err     error
+}
+
+func (c *compileResult) toMap() data.Map {
+	if c.at.IsZero() {
+		return nil
+	}
+	m := data.Map{
+		"compiled_at": data.Timestamp(c.at),
+		"seconds":     data.Float(c.elapsed.Seconds()),
+	}
+	if c.err != nil {
+		m["error"] = data.String(c.err.Error())
+	}
+	return m
+}
+
+// compileModel calls compile_method of the instance b, so that frameworks
+// compiling graphs of the model such as XLA or TensorRT do it before the
+// model serves. It must be called while the state is locked, before the
+// instance replaces the current one. A model failing to compile still
+// serves, so failures are only logged and reported by Status.
+func (s *State) compileModel(ctx *core.Context, b Backend) {
+	if s.params.CompileMethod == "" {
+		return
+	}
+	start := time.Now()
+	_, err := s.callBackend(b, callTrain, s.params.CompileMethod)
+	s.compiled = compileResult{
+		at:      start,
+		elapsed: time.Now().Sub(start),
+		err:     err,
+	}
+	l := ctx.Log().WithField("method", s.params.CompileMethod).
+		WithField("elapsed", s.compiled.elapsed.String())
+	if err != nil {
+		l.WithField("err", err).Error("pymlstate cannot compile the model")
+		return
+	}
+	l.Info("pymlstate compiled the model")
+}
@@ -0,0 +1,61 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestCompileModel(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a state with compile_method", t, func() {
+		var err error
+		b := &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+			return data.Null{}, err
+		}}
+		s := &State{base: b, params: MLParams{BatchSize: 1, CompileMethod: "compile"}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When the model is compiled", func() {
+			s.compileModel(ctx, b)
+
+			Convey("Then the compile method should be called", func() {
+				So(b.calls, ShouldResemble, []string{"compile"})
+			})
+
+			Convey("Then Status should have its duration", func() {
+				m := s.Status()["compile"].(data.Map)
+				So(m, ShouldContainKey, "compiled_at")
+				So(m["seconds"], ShouldBeGreaterThanOrEqualTo, data.Float(0))
+				So(m, ShouldNotContainKey, "error")
+			})
+		})
+
+		Convey("When the model fails to compile", func() {
+			err = errors.New("compilation failed")
+			s.compileModel(ctx, b)
+
+			Convey("Then Status should have the error", func() {
+				So(s.Status()["compile"].(data.Map)["error"], ShouldEqual, data.String("compilation failed"))
+			})
+		})
+	})
+
+	Convey("Given a state without compile_method", t, func() {
+		b := &fakeBackend{}
+		s := &State{base: b, params: MLParams{BatchSize: 1}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When the model is compiled", func() {
+			s.compileModel(ctx, b)
+
+			Convey("Then nothing should be called", func() {
+				So(b.calls, ShouldBeEmpty)
+				So(s.Status(), ShouldNotContainKey, "compile")
+			})
+		})
+	})
+}
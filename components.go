@@ -0,0 +1,509 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// components are parts of State built from MLParams by newComponents. They're
+// built without changing the state so that the state isn't changed by
+// invalid params, and installed by installComponents both when the state is
+// created and when a model is loaded.
+type components struct {
+	join     *joinBuffer
+	output   *outputSplitter
+	redactor *redactor
+	audit    *auditLogger
+
+	clipper       *clipper
+	imputer       *imputer
+	normalizer    *normalizer
+	vocabulary    *vocabulary
+	tokens        *tokenEncoder
+	images        *imageDecoder
+	references    *referenceJoiner
+	windows       *windowAggregator
+	skew          *skewTracker
+	preprocessors []preprocessor
+
+	writeLimiter   *rateLimiter
+	predictLimiter *rateLimiter
+
+	// predictCache is nil when predict_cache_size isn't set.
+	predictCache *predictCache
+
+	// scheduler is nil when call_priority isn't set.
+	scheduler *callScheduler
+
+	// hardExamples is nil when hard_example_count isn't set.
+	hardExamples *hardExamplePool
+
+	// curriculum is nil when curriculum isn't set.
+	curriculum *curriculum
+
+	// keyedBuckets is nil when bucket_by_path isn't set.
+	keyedBuckets *keyedBuckets
+
+	// channels is nil when channel_path isn't set.
+	channels *channels
+
+	// idempotency is nil when idempotency_key_path isn't set.
+	idempotency *idempotencyKeys
+
+	// privacy is nil when dp_budget isn't set.
+	privacy *privacyAccountant
+
+	// trainingSampler is nil when training_sample_size isn't set.
+	trainingSampler *trainingSampler
+
+	// replay is nil when replay_buffer_size isn't set.
+	replay *replayBuffer
+
+	// validation is nil when validation_fraction isn't set.
+	validation *validationSet
+
+	// warnings is kept when the state is loaded so that its counts
+	// accumulate.
+	warnings *warnLimiter
+
+	// tracer is nil when trace_calls isn't set.
+	tracer *callTracer
+
+	// alerter is nil when neither alert_loss nor alert_error_rate is set.
+	alerter *alerter
+
+	// requestIDPath is nil when request_id_path isn't set.
+	requestIDPath data.Path
+
+	asyncPredictions *asyncPredictions
+
+	// postprocessor is nil when postprocess isn't set.
+	postprocessor *postprocessor
+
+	// breaker is nil when breaker_error_rate isn't set.
+	breaker *circuitBreaker
+
+	// decisions is nil when bandit_decision_window is 0.
+	decisions *decisions
+
+	// embeddingIndex is nil when embedding_index_size isn't set.
+	embeddingIndex   *embeddingIndex
+	embeddingKeyPath data.Path
+
+	// clusters is nil when cluster_drift_window is 0.
+	clusters *clusterTracker
+
+	// predictionInputs is nil when correction_window isn't set.
+	predictionInputs    *predictionInputs
+	correctionLabelPath data.Path
+}
+
+// newComponents builds components from p.
+func newComponents(p *MLParams) (*components, error) {
+	c := &components{}
+	if p.JoinIDPath != "" {
+		j, err := newJoinBuffer(p)
+		if err != nil {
+			return nil, err
+		}
+		c.join = j
+	}
+
+	if len(p.DropPaths) > 0 || len(p.HashPaths) > 0 {
+		r, err := newRedactor(p)
+		if err != nil {
+			return nil, err
+		}
+		c.redactor = r
+	}
+
+	if p.AuditLog != "" {
+		c.audit = newAuditLogger(p)
+	}
+
+	if p.MaxWritesPerSec > 0 {
+		c.writeLimiter = newRateLimiter(p.MaxWritesPerSec)
+	}
+	if p.MaxPredictsPerSec > 0 {
+		c.predictLimiter = newRateLimiter(p.MaxPredictsPerSec)
+	}
+
+	if p.PredictCacheSize > 0 {
+		c.predictCache = newPredictCache(p.PredictCacheSize, p.PredictCacheTTL)
+	}
+
+	if p.HardExampleCount > 0 {
+		c.hardExamples = newHardExamplePool(p.HardExampleCount, p.SampleLossesKey)
+	}
+
+	c.warnings = newWarnLimiter(p.WarnLogInterval)
+
+	if p.TraceCalls > 0 {
+		c.tracer = newCallTracer(p.TraceCalls)
+	}
+
+	if p.IdempotencyKeyPath != "" {
+		k, err := newIdempotencyKeys(p.IdempotencyKeyPath, p.IdempotencyKeys)
+		if err != nil {
+			return nil, err
+		}
+		c.idempotency = k
+	}
+
+	if p.RequestIDPath != "" {
+		path, err := data.CompilePath(p.RequestIDPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request_id_path '%v': %v", p.RequestIDPath, err)
+		}
+		c.requestIDPath = path
+	}
+
+	if p.EmbeddingIndexSize > 0 {
+		c.embeddingIndex = newEmbeddingIndex(p)
+	}
+	if p.EmbeddingKeyPath != "" {
+		path, err := data.CompilePath(p.EmbeddingKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid embedding_key_path '%v': %v", p.EmbeddingKeyPath, err)
+		}
+		c.embeddingKeyPath = path
+	}
+
+	if p.ClusterDriftWindow > 0 {
+		c.clusters = newClusterTracker(p)
+	}
+
+	if p.CorrectionWindow > 0 {
+		path, err := data.CompilePath(p.CorrectionLabelPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid correction_label_path '%v': %v", p.CorrectionLabelPath, err)
+		}
+		c.predictionInputs = newPredictionInputs(p.CorrectionWindow)
+		c.correctionLabelPath = path
+	}
+
+	if len(p.Postprocess) > 0 {
+		pp, err := newPostprocessor(p.Postprocess)
+		if err != nil {
+			return nil, err
+		}
+		c.postprocessor = pp
+	}
+
+	// The fallback of the state is configured by installComponents, which
+	// must not fail after the state is changed.
+	var fb predictFallback
+	if err := fb.configure(p); err != nil {
+		return nil, err
+	}
+
+	if p.BreakerErrorRate > 0 {
+		b, err := newCircuitBreaker(p)
+		if err != nil {
+			return nil, err
+		}
+		c.breaker = b
+	}
+
+	c.asyncPredictions = newAsyncPredictions(p)
+
+	if p.BanditDecisionWindow > 0 {
+		c.decisions = newDecisions(p.BanditDecisionWindow)
+	}
+
+	if p.AlertLoss > 0 || p.AlertErrorRate > 0 {
+		c.alerter = newAlerter(p)
+	}
+
+	if p.DPBudget > 0 {
+		c.privacy = newPrivacyAccountant(p)
+	}
+
+	if p.TrainingSampleSize > 0 {
+		c.trainingSampler = newTrainingSampler(p)
+	}
+
+	if p.ReplayBufferSize > 0 {
+		c.replay = newReplayBuffer(p.ReplayBufferSize, p.ReplayRatio)
+		c.replay.rnd = newRand(p, "replay")
+	}
+
+	if p.ValidationFraction > 0 {
+		v, err := newValidationSet(p)
+		if err != nil {
+			return nil, err
+		}
+		c.validation = v
+	}
+
+	if p.BucketByPath != "" {
+		k, err := newKeyedBuckets(p.BucketByPath)
+		if err != nil {
+			return nil, err
+		}
+		c.keyedBuckets = k
+	}
+
+	if p.ChannelPath != "" {
+		ch, err := newChannels(p.ChannelPath, p.Channels, p.BatchSize)
+		if err != nil {
+			return nil, err
+		}
+		c.channels = ch
+	}
+
+	if p.Curriculum != nil {
+		cu, err := newCurriculum(p.Curriculum)
+		if err != nil {
+			return nil, err
+		}
+		c.curriculum = cu
+	}
+
+	if p.CallPriority != "" {
+		sc, err := newCallScheduler(p.CallPriority)
+		if err != nil {
+			return nil, err
+		}
+		c.scheduler = sc
+	}
+
+	if len(p.PredictOutputFields) > 0 {
+		sp, err := newOutputSplitter(p.PredictOutputFields)
+		if err != nil {
+			return nil, err
+		}
+		c.output = sp
+	}
+	if err := c.setUpPreprocessors(p); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *components) setUpPreprocessors(p *MLParams) error {
+	if p.ReferenceData != "" {
+		j, err := newReferenceJoiner(p)
+		if err != nil {
+			return err
+		}
+		if _, err := j.reload(); err != nil {
+			return err
+		}
+		c.references = j
+		c.preprocessors = append(c.preprocessors, j)
+	}
+	// Skew is tracked by features given to the state before they're
+	// transformed by other preprocessors.
+	if len(p.SkewPaths) > 0 {
+		t, err := newSkewTracker(p)
+		if err != nil {
+			return err
+		}
+		c.skew = t
+		c.preprocessors = append(c.preprocessors, t)
+	}
+	if len(p.ImagePaths) > 0 {
+		d, err := newImageDecoder(p)
+		if err != nil {
+			return err
+		}
+		c.images = d
+	}
+	if len(p.BinaryPaths) > 0 {
+		bc, err := newBinaryConverter(p.BinaryPaths)
+		if err != nil {
+			return err
+		}
+		c.preprocessors = append(c.preprocessors, bc)
+	}
+	if p.TimestampEncoding != "" {
+		e, err := newTimestampEncoder(p.TimestampEncoding)
+		if err != nil {
+			return err
+		}
+		c.preprocessors = append(c.preprocessors, e)
+	}
+
+	if len(p.WindowFeatures) > 0 {
+		w, err := newWindowAggregator(p)
+		if err != nil {
+			return err
+		}
+		c.windows = w
+		c.preprocessors = append(c.preprocessors, w)
+	}
+
+	if len(p.Clip) > 0 {
+		cl, err := newClipper(p.Clip)
+		if err != nil {
+			return err
+		}
+		cl.rnd = newRand(p, "clip")
+		c.clipper = cl
+		c.preprocessors = append(c.preprocessors, cl)
+	}
+
+	if len(p.Impute) > 0 {
+		im, err := newImputer(p.Impute)
+		if err != nil {
+			return err
+		}
+		c.imputer = im
+		c.preprocessors = append(c.preprocessors, im)
+	}
+
+	if len(p.NormalizePaths) > 0 {
+		n, err := newNormalizer(p.NormalizePaths)
+		if err != nil {
+			return err
+		}
+		c.normalizer = n
+		c.preprocessors = append(c.preprocessors, n)
+	}
+
+	if len(p.VocabularyPaths) > 0 {
+		v, err := newVocabulary(p.VocabularyPaths, p.VocabularyMaxSize)
+		if err != nil {
+			return err
+		}
+		c.vocabulary = v
+		c.preprocessors = append(c.preprocessors, v)
+	}
+
+	if len(p.TokenizePaths) > 0 {
+		e, err := newTokenEncoder(p)
+		if err != nil {
+			return err
+		}
+		c.tokens = e
+		c.preprocessors = append(c.preprocessors, e)
+	}
+
+	if len(p.HashFeatures) > 0 {
+		h, err := newFeatureHasher(p)
+		if err != nil {
+			return err
+		}
+		c.preprocessors = append(c.preprocessors, h)
+	}
+	return nil
+}
+
+// keep takes over data of old which doesn't depend on the model when params
+// are updated to p: embeddings unless the index is configured differently,
+// cluster sizes unless the window changes, pending decisions, the spent
+// privacy budget, and records of the validation set unless the label
+// changes.
+func (c *components) keep(old *components, p *MLParams) error {
+	if x := old.embeddingIndex; x != nil && c.embeddingIndex != nil && x.size == p.EmbeddingIndexSize &&
+		x.tables == p.EmbeddingIndexTables && x.bits == p.EmbeddingIndexBits {
+		c.embeddingIndex = x
+	}
+	if old.clusters != nil && c.clusters != nil && old.clusters.window == p.ClusterDriftWindow {
+		old.clusters.threshold = p.ClusterDriftThreshold
+		c.clusters = old.clusters
+	}
+	if old.decisions != nil && c.decisions != nil {
+		old.decisions.max = p.BanditDecisionWindow
+		c.decisions = old.decisions
+	}
+	if c.privacy != nil {
+		c.privacy.restore(old.privacy.spentBudget())
+	}
+	if old.validation != nil && c.validation != nil && old.validation.labelPath == p.ValidationLabelPath {
+		b, err := old.validation.snapshot()
+		if err == nil {
+			err = c.validation.restore(b)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore restores statistics of preprocessors, keys of trained records, the
+// spent privacy budget, the validation set, and the replay buffer saved with
+// a model.
+func (c *components) restore(sd *stateData) error {
+	if c.idempotency != nil {
+		c.idempotency.restore(sd.TrainedKeys)
+	}
+	if c.privacy != nil {
+		c.privacy.restore(sd.PrivacySpent)
+	}
+	if c.clipper != nil {
+		c.clipper.restore(sd.Clipper)
+	}
+	if c.imputer != nil {
+		c.imputer.restore(sd.Imputer)
+	}
+	if c.normalizer != nil {
+		c.normalizer.restore(sd.Normalizer)
+	}
+	if c.skew != nil {
+		c.skew.restore(sd.Skew)
+	}
+	if c.vocabulary != nil {
+		c.vocabulary.restore(sd.Vocabulary)
+	}
+	if c.tokens != nil {
+		c.tokens.vocab.restore(sd.Tokens)
+	}
+	if c.validation != nil {
+		if err := c.validation.restore(sd.Validation); err != nil {
+			return err
+		}
+	}
+	if c.replay != nil {
+		return c.replay.restore(sd.Replay)
+	}
+	return nil
+}
+
+// installComponents replaces components of s with c built from p and sets
+// s.params to p. The phase of the breaker, counts of warnings, pending async
+// predictions, and firing alerts are kept, and those components of s are
+// reconfigured with p instead.
+func (s *State) installComponents(c *components, p *MLParams) error {
+	// Components which can fail are configured before s is changed. They
+	// don't fail in practice because c has been built from p.
+	if err := s.fallback.configure(p); err != nil {
+		return err
+	}
+	if s.breaker != nil && c.breaker != nil {
+		if err := s.breaker.configure(p); err != nil {
+			return err
+		}
+		c.breaker = s.breaker
+	}
+
+	if s.warnings != nil {
+		s.warnings.setInterval(p.WarnLogInterval)
+		c.warnings = s.warnings
+	}
+	if s.asyncPredictions != nil {
+		s.asyncPredictions.configure(p)
+		c.asyncPredictions = s.asyncPredictions
+	}
+	if s.alerter != nil && c.alerter != nil {
+		s.alerter.setThresholds(p)
+		c.alerter = s.alerter
+	}
+	if s.audit != nil && s.audit != c.audit {
+		s.audit.close()
+	}
+	if c.skew != nil {
+		c.skew.mu.Lock()
+		c.skew.onSkew = s.reportSkew
+		c.skew.mu.Unlock()
+	}
+
+	s.params = *p
+	s.components = *c
+	s.failures.setBudget(s.params.FailureBudget)
+	s.predictions.configure(s.params.PredictionHistogramWindow, s.params.PredictionShiftThreshold)
+	s.setUpPredictBatcher()
+	return nil
+}
@@ -0,0 +1,56 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestComponents(t *testing.T) {
+	Convey("Given a state having components", t, func() {
+		s := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1, RequestIDPath: "id",
+			BreakerErrorRate: 0.5, BreakerWindow: 4, DPBudget: 2, DPEpsilon: 1}}
+		So(s.setUpParams(), ShouldBeNil)
+		breaker := s.breaker
+		s.privacy.restore(1)
+
+		Convey("When params are updated with an invalid one", func() {
+			s.params.RequestIDPath = "["
+			err := s.setUpParams()
+
+			Convey("Then components shouldn't be changed", func() {
+				So(err, ShouldNotBeNil)
+				So(s.requestIDPath, ShouldNotBeNil)
+				So(s.breaker, ShouldEqual, breaker)
+			})
+		})
+
+		Convey("When params are updated", func() {
+			s.params.RequestIDPath = ""
+			So(s.setUpParams(), ShouldBeNil)
+
+			Convey("Then components should be rebuilt", func() {
+				So(s.requestIDPath, ShouldBeNil)
+			})
+
+			Convey("Then the breaker and the spent budget should be kept", func() {
+				So(s.breaker, ShouldEqual, breaker)
+				So(s.privacy.spentBudget(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When components built for a loaded model are installed", func() {
+			p := s.params
+			c, err := newComponents(&p)
+			So(err, ShouldBeNil)
+			So(s.installComponents(c, &p), ShouldBeNil)
+
+			Convey("Then the breaker should be kept", func() {
+				So(s.breaker, ShouldEqual, breaker)
+			})
+
+			Convey("Then the spent budget shouldn't be kept", func() {
+				So(s.privacy.spentBudget(), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,132 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// predictionInputs keeps redacted inputs of the latest max predictions by
+// their request IDs so that corrected labels can be attached to them. The
+// oldest inputs are forgotten when the number of inputs exceeds max.
+type predictionInputs struct {
+	max int
+
+	mu     sync.Mutex
+	inputs map[string]data.Map
+	order  []string
+}
+
+func newPredictionInputs(max int) *predictionInputs {
+	return &predictionInputs{
+		max:    max,
+		inputs: map[string]data.Map{},
+	}
+}
+
+// remember keeps the input of the prediction of the request. Inputs other
+// than a record and predictions without request IDs are ignored. It does
+// nothing when p is nil.
+func (p *predictionInputs) remember(requestID string, in data.Value) {
+	if p == nil || requestID == "" {
+		return
+	}
+	m, err := data.AsMap(in)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.inputs[requestID]; !ok {
+		p.order = append(p.order, requestID)
+	}
+	p.inputs[requestID] = m
+	for len(p.order) > p.max {
+		delete(p.inputs, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+// take returns the input of the request and forgets it so that it isn't
+// corrected twice.
+func (p *predictionInputs) take(requestID string) (data.Map, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.inputs[requestID]
+	if !ok {
+		return nil, false
+	}
+	delete(p.inputs, requestID)
+	for i, id := range p.order {
+		if id == requestID {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+	return m, true
+}
+
+func (p *predictionInputs) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.inputs)
+}
+
+// Correct feeds the corrected label of the prediction of the request back
+// to training. When the state has the replay buffer and remembers the input
+// of the prediction by correction_window, the input with the label at
+// correction_label_path is preprocessed and added to the replay buffer
+// correction_weight times. Otherwise, the request ID and the label are
+// passed to "correct" of the model, which can be declared as
+// `def correct(self, request_id, label)`.
+func (s *State) Correct(ctx *core.Context, requestID string, label data.Value) error {
+	if err := s.authorize(ctx, ActionTrain); err != nil {
+		return err
+	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return err
+	}
+	defer s.predictCache.invalidate()
+
+	if s.replay != nil && s.predictionInputs != nil {
+		if in, ok := s.predictionInputs.take(requestID); ok {
+			return s.correctIntoReplay(in, label)
+		}
+	}
+	if _, err := s.callPython(callTrain, "correct", data.String(requestID), label); err != nil {
+		return fmt.Errorf("cannot correct the prediction of request '%v': %v", requestID, err)
+	}
+	return nil
+}
+
+func (s *State) correctIntoReplay(in data.Map, label data.Value) error {
+	rec := in.Copy()
+	if err := rec.Set(s.correctionLabelPath, label); err != nil {
+		return fmt.Errorf("cannot set the corrected label: %v", err)
+	}
+	dt, err := s.preprocess(rec, preprocessTrain, nil)
+	if err != nil {
+		return err
+	}
+	if dt == nil {
+		return nil // dropped by preprocessors
+	}
+	for i := 0; i < s.params.CorrectionWeight; i++ {
+		s.replay.add(dt)
+	}
+	return nil
+}
+
+// Correct feeds the corrected label of the prediction of the request back
+// to training of the state. See State.Correct for details. A return value
+// is always nil.
+func Correct(ctx *core.Context, stateName string, requestID string, label data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.Correct(ctx, requestID, label)
+}
@@ -0,0 +1,82 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPredictionInputs(t *testing.T) {
+	Convey("Given prediction inputs of size 2", t, func() {
+		p := newPredictionInputs(2)
+
+		Convey("When inputs of 3 requests are remembered", func() {
+			for _, id := range []string{"a", "b", "c"} {
+				p.remember(id, data.Map{"id": data.String(id)})
+			}
+			p.remember("", data.Map{})
+			p.remember("d", data.Array{data.Map{}})
+
+			Convey("Then the oldest input should be forgotten", func() {
+				So(p.len(), ShouldEqual, 2)
+				_, ok := p.take("a")
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Then an input should be taken only once", func() {
+				m, ok := p.take("b")
+				So(ok, ShouldBeTrue)
+				So(m, ShouldResemble, data.Map{"id": data.String("b")})
+				_, ok = p.take("b")
+				So(ok, ShouldBeFalse)
+				So(p.order, ShouldResemble, []string{"c"})
+			})
+		})
+	})
+}
+
+func TestCorrect(t *testing.T) {
+	Convey("Given a state with a replay buffer and correction_window", t, func() {
+		ctx := core.NewContext(nil)
+		var corrected []data.Value
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				if funcName == "correct" {
+					corrected = dt
+				}
+				return data.String("cat"), nil
+			},
+		}
+		s := &State{base: b, params: MLParams{ReplayBufferSize: 10, ReplayRatio: 1,
+			CorrectionWindow: 10, CorrectionWeight: 3, CorrectionLabelPath: "label"}}
+		So(s.setUpParams(), ShouldBeNil)
+		_, err := s.PredictWithRequestID(ctx, data.Map{"x": data.Int(1)}, "r1")
+		So(err, ShouldBeNil)
+
+		Convey("When the prediction is corrected", func() {
+			So(s.Correct(ctx, "r1", data.String("dog")), ShouldBeNil)
+
+			Convey("Then the corrected record should be added to the replay buffer with its weight", func() {
+				So(s.replay.len(), ShouldEqual, 3)
+				So(s.replay.records[0], ShouldResemble, data.Map{"x": data.Int(1), "label": data.String("dog")})
+				So(b.calls, ShouldResemble, []string{"predict"})
+			})
+
+			Convey("Then correcting it again should call correct of the model", func() {
+				So(s.Correct(ctx, "r1", data.String("cow")), ShouldBeNil)
+				So(b.calls, ShouldResemble, []string{"predict", "correct"})
+				So(corrected, ShouldResemble, []data.Value{data.String("r1"), data.String("cow")})
+			})
+		})
+
+		Convey("When an unknown prediction is corrected", func() {
+			So(s.Correct(ctx, "r2", data.String("dog")), ShouldBeNil)
+
+			Convey("Then correct of the model should be called", func() {
+				So(b.calls, ShouldResemble, []string{"predict", "correct"})
+				So(s.replay.len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -7,10 +7,160 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"io"
+	"runtime"
+	"time"
 )
 
 var (
 	batchTrainSizePath = data.MustCompilePath("batch_train_size")
+	joinIDPath         = data.MustCompilePath("join_id_path")
+	joinLabelPath      = data.MustCompilePath("join_label_path")
+	joinTTLPath        = data.MustCompilePath("join_ttl")
+
+	descriptionPath         = data.MustCompilePath("description")
+	tagsPath                = data.MustCompilePath("tags")
+	pythonEnvPath           = data.MustCompilePath("python_env")
+	sitePackagesPath        = data.MustCompilePath("site_packages")
+	requiredModulesPath     = data.MustCompilePath("required_modules")
+	checkDependenciesPath   = data.MustCompilePath("check_dependencies")
+	qualityReportPath       = data.MustCompilePath("quality_report")
+	trainingSampleSizePath  = data.MustCompilePath("training_sample_size")
+	predictOutputFieldsPath = data.MustCompilePath("predict_output_fields")
+	binaryPathsPath         = data.MustCompilePath("binary_paths")
+	imagePathsPath          = data.MustCompilePath("image_paths")
+	imageWidthPath          = data.MustCompilePath("image_width")
+	imageHeightPath         = data.MustCompilePath("image_height")
+	imageGrayscalePath      = data.MustCompilePath("image_grayscale")
+	imageMeanPath           = data.MustCompilePath("image_mean")
+	imageStdPath            = data.MustCompilePath("image_std")
+	imageWorkersPath        = data.MustCompilePath("image_workers")
+	timestampEncodingPath   = data.MustCompilePath("timestamp_encoding")
+	metadataKeyPath         = data.MustCompilePath("metadata_key")
+	dropPathsPath           = data.MustCompilePath("drop_paths")
+	referenceDataPath       = data.MustCompilePath("reference_data")
+	referenceKeyPath        = data.MustCompilePath("reference_key")
+	referenceKeyPathPath    = data.MustCompilePath("reference_key_path")
+	referenceOutputPathPath = data.MustCompilePath("reference_output_path")
+	hashPathsPath           = data.MustCompilePath("hash_paths")
+	hashSaltPath            = data.MustCompilePath("hash_salt")
+	clipPath                = data.MustCompilePath("clip")
+	windowFeaturesPath      = data.MustCompilePath("window_features")
+	windowKeyPathPath       = data.MustCompilePath("window_key_path")
+	windowMaxKeysPath       = data.MustCompilePath("window_max_keys")
+	imputePath              = data.MustCompilePath("impute")
+	normalizePathsPath      = data.MustCompilePath("normalize_paths")
+	vocabularyPathsPath     = data.MustCompilePath("vocabulary_paths")
+	vocabularyMaxSizePath   = data.MustCompilePath("vocabulary_max_size")
+	tokenizePathsPath       = data.MustCompilePath("tokenize_paths")
+	tokenizerPath           = data.MustCompilePath("tokenizer")
+	tokenizePatternPath     = data.MustCompilePath("tokenize_pattern")
+	tokenizeLowercasePath   = data.MustCompilePath("tokenize_lowercase")
+	tokenVocabMaxSizePath   = data.MustCompilePath("token_vocabulary_max_size")
+	hashFeaturesPath        = data.MustCompilePath("hash_features")
+	hashFeaturesDimPath     = data.MustCompilePath("hash_features_dim")
+	hashFeaturesKeyPath     = data.MustCompilePath("hash_features_key")
+	canaryDataPath          = data.MustCompilePath("canary_data")
+	canaryMethodPath        = data.MustCompilePath("canary_method")
+	canaryMaxRegressionPath = data.MustCompilePath("canary_max_regression")
+	registryPath            = data.MustCompilePath("registry")
+	retrainFromPath         = data.MustCompilePath("retrain_from")
+	retrainIntervalPath     = data.MustCompilePath("retrain_interval")
+	auditLogPath            = data.MustCompilePath("audit_log")
+	auditLogMaxBytesPath    = data.MustCompilePath("audit_log_max_bytes")
+	auditLogMaxBackupsPath  = data.MustCompilePath("audit_log_max_backups")
+	auditFullInputPath      = data.MustCompilePath("audit_full_input")
+	auditSampleRatePath     = data.MustCompilePath("audit_sample_rate")
+	maxWritesPerSecPath     = data.MustCompilePath("max_writes_per_sec")
+	maxPredictsPerSecPath   = data.MustCompilePath("max_predicts_per_sec")
+	maxModelBytesPath       = data.MustCompilePath("max_model_bytes")
+	evalDataPath            = data.MustCompilePath("eval_data")
+	evalIntervalPath        = data.MustCompilePath("eval_interval")
+	evalMethodPath          = data.MustCompilePath("eval_method")
+	evalHistorySizePath     = data.MustCompilePath("eval_history_size")
+	promoteAfterPath        = data.MustCompilePath("promote_after")
+	promoteMarginPath       = data.MustCompilePath("promote_margin")
+	retrainBelowMetricPath  = data.MustCompilePath("retrain_below_metric")
+	retrainBelowForPath     = data.MustCompilePath("retrain_below_for")
+	objectivePath           = data.MustCompilePath("objective")
+	validationFractionPath  = data.MustCompilePath("validation_fraction")
+	validationSizePath      = data.MustCompilePath("validation_size")
+	validationLabelPath     = data.MustCompilePath("validation_label_path")
+	predictCacheSizePath    = data.MustCompilePath("predict_cache_size")
+	predictCacheTTLPath     = data.MustCompilePath("predict_cache_ttl")
+	predictBatchWindowPath  = data.MustCompilePath("predict_batch_window")
+	predictBatchMaxSizePath = data.MustCompilePath("predict_batch_max_size")
+	predictBatchMethodPath  = data.MustCompilePath("predict_batch_method")
+	callPriorityPath        = data.MustCompilePath("call_priority")
+	maxBucketBytesPath      = data.MustCompilePath("max_bucket_bytes")
+	bucketOverflowPath      = data.MustCompilePath("bucket_overflow")
+	fitResultPolicyPath     = data.MustCompilePath("fit_result_policy")
+	fitResultFieldsPath     = data.MustCompilePath("fit_result_fields")
+	hardExampleCountPath    = data.MustCompilePath("hard_example_count")
+	sampleLossesKeyPath     = data.MustCompilePath("sample_losses_key")
+	curriculumPath          = data.MustCompilePath("curriculum")
+	bucketByPathPath        = data.MustCompilePath("bucket_by_path")
+	channelPathPath         = data.MustCompilePath("channel_path")
+	channelsPath            = data.MustCompilePath("channels")
+	bucketTTLPath           = data.MustCompilePath("bucket_ttl")
+	bucketExpiryPath        = data.MustCompilePath("bucket_expiry")
+	replayBufferSizePath    = data.MustCompilePath("replay_buffer_size")
+	replayRatioPath         = data.MustCompilePath("replay_ratio")
+	authorizerPath          = data.MustCompilePath("authorizer")
+	warnLogIntervalPath     = data.MustCompilePath("warn_log_interval")
+	traceCallsPath          = data.MustCompilePath("trace_calls")
+	wireFormatPath          = data.MustCompilePath("wire_format")
+	isolationPath           = data.MustCompilePath("isolation")
+	pythonCommandPath       = data.MustCompilePath("python_command")
+	threadLimitPath         = data.MustCompilePath("thread_limit")
+	threadLimitParamPath    = data.MustCompilePath("thread_limit_param")
+	standbyPath             = data.MustCompilePath("standby")
+	warmupSamplesPath       = data.MustCompilePath("warmup_samples")
+	compileMethodPath       = data.MustCompilePath("compile_method")
+	walPathPath             = data.MustCompilePath("wal_path")
+	idempotencyKeyPathPath  = data.MustCompilePath("idempotency_key_path")
+	idempotencyKeysPath     = data.MustCompilePath("idempotency_keys")
+	dpBudgetPath            = data.MustCompilePath("dp_budget")
+	dpEpsilonPath           = data.MustCompilePath("dp_epsilon")
+	dpSampleRatePath        = data.MustCompilePath("dp_sample_rate")
+	dpHookPath              = data.MustCompilePath("dp_hook")
+	alertLossPath           = data.MustCompilePath("alert_loss")
+	alertLossForPath        = data.MustCompilePath("alert_loss_for")
+	alertErrorRatePath      = data.MustCompilePath("alert_error_rate")
+	slowCallThresholdPath   = data.MustCompilePath("slow_call_threshold")
+	requestIDPathPath       = data.MustCompilePath("request_id_path")
+	passRequestIDPath       = data.MustCompilePath("pass_request_id")
+	versionedPredictionPath = data.MustCompilePath("versioned_predictions")
+	randomSeedPath          = data.MustCompilePath("random_seed")
+	teacherStatePath        = data.MustCompilePath("teacher_state")
+	teacherOutputKeyPath    = data.MustCompilePath("teacher_output_key")
+	postprocessPath         = data.MustCompilePath("postprocess")
+	fallbackStatePath       = data.MustCompilePath("fallback_state")
+	fallbackValuePath       = data.MustCompilePath("fallback_value")
+	breakerErrorRatePath    = data.MustCompilePath("breaker_error_rate")
+	breakerWindowPath       = data.MustCompilePath("breaker_window")
+	breakerCallTimeoutPath  = data.MustCompilePath("breaker_call_timeout")
+	breakerOpenDurationPath = data.MustCompilePath("breaker_open_duration")
+	breakerFallbackPath     = data.MustCompilePath("breaker_fallback")
+	failureBudgetPath       = data.MustCompilePath("failure_budget")
+	asyncConcurrencyPath    = data.MustCompilePath("async_predict_concurrency")
+	asyncResultTTLPath      = data.MustCompilePath("async_result_ttl")
+	asyncMaxPendingPath     = data.MustCompilePath("async_max_pending")
+	correctionWindowPath    = data.MustCompilePath("correction_window")
+	correctionWeightPath    = data.MustCompilePath("correction_weight")
+	correctionLabelPathPath = data.MustCompilePath("correction_label_path")
+	banditWindowPath        = data.MustCompilePath("bandit_decision_window")
+	experienceBatchSizePath = data.MustCompilePath("experience_batch_size")
+	clusterDriftWindowPath  = data.MustCompilePath("cluster_drift_window")
+	clusterDriftThreshPath  = data.MustCompilePath("cluster_drift_threshold")
+	skewPathsPath           = data.MustCompilePath("skew_paths")
+	skewWindowPath          = data.MustCompilePath("skew_window")
+	skewThresholdPath       = data.MustCompilePath("skew_threshold")
+	predHistogramWindowPath = data.MustCompilePath("prediction_histogram_window")
+	predShiftThresholdPath  = data.MustCompilePath("prediction_shift_threshold")
+	embeddingIndexSizePath  = data.MustCompilePath("embedding_index_size")
+	embeddingIndexTblsPath  = data.MustCompilePath("embedding_index_tables")
+	embeddingIndexBitsPath  = data.MustCompilePath("embedding_index_bits")
+	embeddingKeyPathPath    = data.MustCompilePath("embedding_key_path")
 )
 
 // StateCreator is used by BQL to create or load Multiple Layer Classification
@@ -30,27 +180,1782 @@ func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (
 		return nil, err
 	}
 
-	batchSize := 1
-	if bs, err := params.Get(batchTrainSizePath); err == nil {
-		var batchSize64 int64
-		if batchSize64, err = data.AsInt(bs); err != nil {
-			return nil, err
+	mlParams := &MLParams{}
+	if err := extractBatchSizeParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractJoinParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractDescriptionParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractPythonEnvParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractQualityParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractPredictOutputParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractEncodingParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractImageParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractRedactionParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractReferenceParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractWindowParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractPreprocessParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractTokenizeParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractHashFeaturesParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractCanaryParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractRegistryParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractDiagnosticsParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractIsolationParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractWarmupParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractWALParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractIdempotencyParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractDPParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractAlertParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractRequestIDParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractRandomSeedParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractDistillParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractBreakerParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractFailureBudgetParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractAsyncParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractCorrectionParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractBanditParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractClusterDriftParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractSkewParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractPredictionHistogramParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractEmbeddingParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractAuthorizerParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractRetrainParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractAuditParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractQuotaParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractBucketParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractFitResultParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractCurriculumParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractEvalParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if mlParams.RetrainBelowMetric > 0 && mlParams.RetrainFrom == "" && mlParams.ReplayBufferSize == 0 {
+		return nil, fmt.Errorf("retrain_below_metric requires retrain_from or replay_buffer_size")
+	}
+	if err := extractPredictCacheParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractPredictBatchParams(params, mlParams); err != nil {
+		return nil, err
+	}
+	if err := extractCallPriorityParams(params, mlParams); err != nil {
+		return nil, err
+	}
+
+	s, err := New(bp, mlParams, params)
+	if err != nil {
+		return nil, err
+	}
+	s.compileModel(ctx, s.base)
+	s.warmUp(ctx, s.base)
+	if err := s.openWAL(ctx); err != nil {
+		s.Terminate(ctx)
+		return nil, err
+	}
+	s.readiness.set(PhaseTrainingOnly)
+	s.setUpSlowCallLog(ctx)
+	s.scheduleRetraining(ctx)
+	s.scheduleEvaluation(ctx)
+	return s, nil
+}
+
+func extractBatchSizeParams(params data.Map, mp *MLParams) error {
+	mp.BatchSize = 1
+	if v, err := params.Get(batchTrainSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return err
 		}
-		if batchSize64 <= 0 {
-			return nil, fmt.Errorf("batch_train_size must be greater than 0")
+		if n <= 0 {
+			return fmt.Errorf("batch_train_size must be greater than 0")
 		}
-		batchSize = int(batchSize64)
+		mp.BatchSize = int(n)
 		delete(params, "batch_train_size")
 	}
+	return nil
+}
+
+func extractDescriptionParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(descriptionPath); err == nil {
+		if mp.Description, err = data.AsString(v); err != nil {
+			return fmt.Errorf("description must be a string: %v", err)
+		}
+		delete(params, "description")
+	}
 
-	return New(bp, &MLParams{BatchSize: batchSize}, params)
+	if v, err := params.Get(tagsPath); err == nil {
+		if mp.Tags, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("tags must be an array of strings: %v", err)
+		}
+		delete(params, "tags")
+	}
+	return nil
 }
 
-// LoadState is same as CREATE STATE.
-func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (
-	core.SharedState, error) {
-	s := &State{}
-	if err := s.load(ctx, r, params); err != nil {
+func extractPythonEnvParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(pythonEnvPath); err == nil {
+		if mp.PythonEnv, err = data.AsString(v); err != nil {
+			return fmt.Errorf("python_env must be a string: %v", err)
+		}
+		delete(params, "python_env")
+	}
+
+	if v, err := params.Get(sitePackagesPath); err == nil {
+		if mp.SitePackages, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("site_packages must be an array of strings: %v", err)
+		}
+		delete(params, "site_packages")
+	}
+
+	if v, err := params.Get(requiredModulesPath); err == nil {
+		if mp.RequiredModules, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("required_modules must be an array of strings: %v", err)
+		}
+		for _, m := range mp.RequiredModules {
+			if !pythonModuleNameRegexp.MatchString(m) {
+				return fmt.Errorf("invalid Python module name in required_modules: %v", m)
+			}
+		}
+		delete(params, "required_modules")
+	}
+
+	if v, err := params.Get(checkDependenciesPath); err == nil {
+		if mp.CheckDependencies, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("check_dependencies must be a bool: %v", err)
+		}
+		delete(params, "check_dependencies")
+	}
+	return nil
+}
+
+func extractQualityParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(qualityReportPath); err == nil {
+		if mp.QualityReport, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("quality_report must be a bool: %v", err)
+		}
+		delete(params, "quality_report")
+	}
+
+	if v, err := params.Get(trainingSampleSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("training_sample_size must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("training_sample_size must not be negative")
+		}
+		mp.TrainingSampleSize = int(n)
+		delete(params, "training_sample_size")
+	}
+	return nil
+}
+
+func extractPredictOutputParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(predictOutputFieldsPath); err == nil {
+		if mp.PredictOutputFields, err = parsePredictOutputFields(v); err != nil {
+			return err
+		}
+		delete(params, "predict_output_fields")
+	}
+
+	if v, err := params.Get(versionedPredictionPath); err == nil {
+		if mp.VersionedPredictions, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("versioned_predictions must be a bool: %v", err)
+		}
+		delete(params, "versioned_predictions")
+	}
+
+	if v, err := params.Get(postprocessPath); err == nil {
+		if mp.Postprocess, err = parsePostprocess(v); err != nil {
+			return err
+		}
+		if _, err := newPostprocessor(mp.Postprocess); err != nil {
+			return err
+		}
+		delete(params, "postprocess")
+	}
+	return nil
+}
+
+func extractEncodingParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(binaryPathsPath); err == nil {
+		if mp.BinaryPaths, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("binary_paths must be an array of strings: %v", err)
+		}
+		delete(params, "binary_paths")
+	}
+
+	if v, err := params.Get(timestampEncodingPath); err == nil {
+		if mp.TimestampEncoding, err = data.AsString(v); err != nil {
+			return fmt.Errorf("timestamp_encoding must be a string: %v", err)
+		}
+		delete(params, "timestamp_encoding")
+	}
+
+	if v, err := params.Get(metadataKeyPath); err == nil {
+		if mp.MetadataKey, err = data.AsString(v); err != nil {
+			return fmt.Errorf("metadata_key must be a string: %v", err)
+		}
+		delete(params, "metadata_key")
+	}
+	return nil
+}
+
+func extractPreprocessParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(clipPath); err == nil {
+		if mp.Clip, err = parseClipPolicies(v); err != nil {
+			return err
+		}
+		delete(params, "clip")
+	}
+
+	if v, err := params.Get(imputePath); err == nil {
+		if mp.Impute, err = parseImputePolicies(v); err != nil {
+			return err
+		}
+		delete(params, "impute")
+	}
+
+	if v, err := params.Get(normalizePathsPath); err == nil {
+		if mp.NormalizePaths, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("normalize_paths must be an array of strings: %v", err)
+		}
+		delete(params, "normalize_paths")
+	}
+
+	if v, err := params.Get(vocabularyPathsPath); err == nil {
+		if mp.VocabularyPaths, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("vocabulary_paths must be an array of strings: %v", err)
+		}
+		delete(params, "vocabulary_paths")
+	}
+
+	if v, err := params.Get(vocabularyMaxSizePath); err == nil {
+		size, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("vocabulary_max_size must be an integer: %v", err)
+		}
+		mp.VocabularyMaxSize = int(size)
+		delete(params, "vocabulary_max_size")
+	}
+	return nil
+}
+
+func extractRegistryParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(registryPath); err == nil {
+		if mp.Registry, err = data.AsString(v); err != nil {
+			return fmt.Errorf("registry must be a string: %v", err)
+		}
+		delete(params, "registry")
+	}
+	return nil
+}
+
+func extractDiagnosticsParams(params data.Map, mp *MLParams) error {
+	mp.WarnLogInterval = time.Minute
+	if v, err := params.Get(warnLogIntervalPath); err == nil {
+		if mp.WarnLogInterval, err = asDuration(v); err != nil {
+			return fmt.Errorf("warn_log_interval must be a duration: %v", err)
+		}
+		delete(params, "warn_log_interval")
+	}
+
+	if v, err := params.Get(traceCallsPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("trace_calls must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("trace_calls must not be negative")
+		}
+		mp.TraceCalls = int(n)
+		delete(params, "trace_calls")
+	}
+
+	if v, err := params.Get(slowCallThresholdPath); err == nil {
+		if mp.SlowCallThreshold, err = asDuration(v); err != nil {
+			return fmt.Errorf("slow_call_threshold must be a duration: %v", err)
+		}
+		delete(params, "slow_call_threshold")
+	}
+	return nil
+}
+
+func extractIsolationParams(params data.Map, mp *MLParams) error {
+	mp.WireFormat = "native"
+	if v, err := params.Get(wireFormatPath); err == nil {
+		if mp.WireFormat, err = data.AsString(v); err != nil {
+			return fmt.Errorf("wire_format must be a string: %v", err)
+		}
+		switch mp.WireFormat {
+		case "native", "json", "arrow":
+		default:
+			return fmt.Errorf("wire_format must be 'native', 'json', or 'arrow': %v", mp.WireFormat)
+		}
+		delete(params, "wire_format")
+	}
+
+	mp.Isolation = "shared"
+	if v, err := params.Get(isolationPath); err == nil {
+		if mp.Isolation, err = data.AsString(v); err != nil {
+			return fmt.Errorf("isolation must be a string: %v", err)
+		}
+		if mp.Isolation != "shared" && mp.Isolation != "process" {
+			return fmt.Errorf("isolation must be 'shared' or 'process': %v", mp.Isolation)
+		}
+		delete(params, "isolation")
+	}
+
+	mp.PythonCommand = "python3"
+	if v, err := params.Get(pythonCommandPath); err == nil {
+		if mp.PythonCommand, err = data.AsString(v); err != nil {
+			return fmt.Errorf("python_command must be a string: %v", err)
+		}
+		delete(params, "python_command")
+	}
+
+	if v, err := params.Get(threadLimitPath); err == nil {
+		l, err := data.ToInt(v)
+		if err != nil {
+			return fmt.Errorf("thread_limit must be an integer: %v", err)
+		}
+		if l <= 0 {
+			return fmt.Errorf("thread_limit must be positive: %v", l)
+		}
+		mp.ThreadLimit = int(l)
+		delete(params, "thread_limit")
+	}
+
+	if v, err := params.Get(threadLimitParamPath); err == nil {
+		if mp.ThreadLimitParam, err = data.AsString(v); err != nil {
+			return fmt.Errorf("thread_limit_param must be a string: %v", err)
+		}
+		delete(params, "thread_limit_param")
+	}
+	if mp.ThreadLimit > 0 && mp.Isolation != "process" && mp.ThreadLimitParam == "" {
+		return fmt.Errorf("thread_limit requires isolation 'process' or thread_limit_param " +
+			"because the embedded interpreter is shared by all states")
+	}
+
+	if v, err := params.Get(standbyPath); err == nil {
+		if mp.Standby, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("standby must be a bool: %v", err)
+		}
+		delete(params, "standby")
+	}
+	return nil
+}
+
+func extractWarmupParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(warmupSamplesPath); err == nil {
+		if mp.WarmupSamples, err = data.AsString(v); err != nil {
+			return fmt.Errorf("warmup_samples must be a string: %v", err)
+		}
+		if _, err := datasetFormatOf(mp.WarmupSamples); err != nil {
+			return err
+		}
+		delete(params, "warmup_samples")
+	}
+
+	if v, err := params.Get(compileMethodPath); err == nil {
+		if mp.CompileMethod, err = data.AsString(v); err != nil {
+			return fmt.Errorf("compile_method must be a string: %v", err)
+		}
+		delete(params, "compile_method")
+	}
+	return nil
+}
+
+func extractWALParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(walPathPath); err == nil {
+		if mp.WALPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("wal_path must be a string: %v", err)
+		}
+		delete(params, "wal_path")
+	}
+	return nil
+}
+
+func extractIdempotencyParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(idempotencyKeyPathPath); err == nil {
+		if mp.IdempotencyKeyPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("idempotency_key_path must be a string: %v", err)
+		}
+		if _, err := data.CompilePath(mp.IdempotencyKeyPath); err != nil {
+			return fmt.Errorf("invalid idempotency_key_path '%v': %v", mp.IdempotencyKeyPath, err)
+		}
+		delete(params, "idempotency_key_path")
+	}
+
+	mp.IdempotencyKeys = 100000
+	if v, err := params.Get(idempotencyKeysPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("idempotency_keys must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("idempotency_keys must be greater than 0")
+		}
+		mp.IdempotencyKeys = int(n)
+		delete(params, "idempotency_keys")
+	}
+	return nil
+}
+
+func extractDPParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(dpBudgetPath); err == nil {
+		if mp.DPBudget, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("dp_budget must be a number: %v", err)
+		}
+		if mp.DPBudget <= 0 {
+			return fmt.Errorf("dp_budget must be greater than 0")
+		}
+		delete(params, "dp_budget")
+	}
+
+	if v, err := params.Get(dpEpsilonPath); err == nil {
+		if mp.DPEpsilon, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("dp_epsilon must be a number: %v", err)
+		}
+		if mp.DPEpsilon <= 0 {
+			return fmt.Errorf("dp_epsilon must be greater than 0")
+		}
+		delete(params, "dp_epsilon")
+	}
+	if mp.DPBudget > 0 && mp.DPEpsilon == 0 {
+		return fmt.Errorf("dp_epsilon is required when dp_budget is set")
+	}
+
+	mp.DPSampleRate = 1
+	if v, err := params.Get(dpSampleRatePath); err == nil {
+		if mp.DPSampleRate, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("dp_sample_rate must be a number: %v", err)
+		}
+		if mp.DPSampleRate <= 0 || mp.DPSampleRate > 1 {
+			return fmt.Errorf("dp_sample_rate must be in (0, 1]")
+		}
+		delete(params, "dp_sample_rate")
+	}
+
+	if v, err := params.Get(dpHookPath); err == nil {
+		if mp.DPHook, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("dp_hook must be a bool: %v", err)
+		}
+		delete(params, "dp_hook")
+	}
+	return nil
+}
+
+func extractAlertParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(alertLossPath); err == nil {
+		if mp.AlertLoss, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("alert_loss must be a number: %v", err)
+		}
+		delete(params, "alert_loss")
+	}
+
+	mp.AlertLossFor = 5 * time.Minute
+	if v, err := params.Get(alertLossForPath); err == nil {
+		if mp.AlertLossFor, err = asDuration(v); err != nil {
+			return fmt.Errorf("alert_loss_for must be a duration: %v", err)
+		}
+		delete(params, "alert_loss_for")
+	}
+
+	if v, err := params.Get(alertErrorRatePath); err == nil {
+		if mp.AlertErrorRate, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("alert_error_rate must be a number: %v", err)
+		}
+		if mp.AlertErrorRate < 0 || mp.AlertErrorRate >= 1 {
+			return fmt.Errorf("alert_error_rate must be in [0, 1)")
+		}
+		delete(params, "alert_error_rate")
+	}
+	return nil
+}
+
+func extractRequestIDParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(requestIDPathPath); err == nil {
+		if mp.RequestIDPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("request_id_path must be a string: %v", err)
+		}
+		if _, err := data.CompilePath(mp.RequestIDPath); err != nil {
+			return fmt.Errorf("invalid request_id_path '%v': %v", mp.RequestIDPath, err)
+		}
+		delete(params, "request_id_path")
+	}
+
+	if v, err := params.Get(passRequestIDPath); err == nil {
+		if mp.PassRequestID, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("pass_request_id must be a bool: %v", err)
+		}
+		delete(params, "pass_request_id")
+	}
+	return nil
+}
+
+func extractRandomSeedParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(randomSeedPath); err == nil {
+		seed, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("random_seed must be an integer: %v", err)
+		}
+		mp.RandomSeed = &seed
+		// random_seed is kept in params so that it's also passed to the
+		// constructor of the Python class.
+	}
+	return nil
+}
+
+func extractDistillParams(params data.Map, mp *MLParams) error {
+	mp.TeacherOutputKey = "teacher_output"
+	if v, err := params.Get(teacherStatePath); err == nil {
+		if mp.TeacherState, err = data.AsString(v); err != nil {
+			return fmt.Errorf("teacher_state must be a string: %v", err)
+		}
+		delete(params, "teacher_state")
+	}
+
+	if v, err := params.Get(teacherOutputKeyPath); err == nil {
+		if mp.TeacherOutputKey, err = data.AsString(v); err != nil {
+			return fmt.Errorf("teacher_output_key must be a string: %v", err)
+		}
+		if mp.TeacherOutputKey == "" {
+			return fmt.Errorf("teacher_output_key must not be empty")
+		}
+		delete(params, "teacher_output_key")
+	}
+	return nil
+}
+
+func extractFailureBudgetParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(failureBudgetPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("failure_budget must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("failure_budget must not be negative")
+		}
+		mp.FailureBudget = int(n)
+		delete(params, "failure_budget")
+	}
+	return nil
+}
+
+func extractAsyncParams(params data.Map, mp *MLParams) error {
+	mp.AsyncPredictConcurrency = 1
+	mp.AsyncResultTTL = 10 * time.Minute
+	mp.AsyncMaxPending = 1000
+	if v, err := params.Get(asyncConcurrencyPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("async_predict_concurrency must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("async_predict_concurrency must be greater than 0")
+		}
+		mp.AsyncPredictConcurrency = int(n)
+		delete(params, "async_predict_concurrency")
+	}
+
+	if v, err := params.Get(asyncResultTTLPath); err == nil {
+		if mp.AsyncResultTTL, err = asDuration(v); err != nil {
+			return fmt.Errorf("async_result_ttl must be a duration: %v", err)
+		}
+		delete(params, "async_result_ttl")
+	}
+
+	if v, err := params.Get(asyncMaxPendingPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("async_max_pending must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("async_max_pending must be greater than 0")
+		}
+		mp.AsyncMaxPending = int(n)
+		delete(params, "async_max_pending")
+	}
+	return nil
+}
+
+func extractCorrectionParams(params data.Map, mp *MLParams) error {
+	mp.CorrectionWeight = 5
+	mp.CorrectionLabelPath = "label"
+	if v, err := params.Get(correctionWindowPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("correction_window must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("correction_window must not be negative")
+		}
+		mp.CorrectionWindow = int(n)
+		delete(params, "correction_window")
+	}
+
+	if v, err := params.Get(correctionWeightPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("correction_weight must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("correction_weight must be greater than 0")
+		}
+		mp.CorrectionWeight = int(n)
+		delete(params, "correction_weight")
+	}
+
+	if v, err := params.Get(correctionLabelPathPath); err == nil {
+		if mp.CorrectionLabelPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("correction_label_path must be a string: %v", err)
+		}
+		if _, err := data.CompilePath(mp.CorrectionLabelPath); err != nil {
+			return fmt.Errorf("invalid correction_label_path: %v", err)
+		}
+		delete(params, "correction_label_path")
+	}
+	return nil
+}
+
+func extractBanditParams(params data.Map, mp *MLParams) error {
+	mp.BanditDecisionWindow = 10000
+	if v, err := params.Get(banditWindowPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("bandit_decision_window must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("bandit_decision_window must not be negative")
+		}
+		mp.BanditDecisionWindow = int(n)
+		delete(params, "bandit_decision_window")
+	}
+
+	if v, err := params.Get(experienceBatchSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("experience_batch_size must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("experience_batch_size must be greater than 0")
+		}
+		mp.ExperienceBatchSize = int(n)
+		delete(params, "experience_batch_size")
+	}
+	return nil
+}
+
+func extractClusterDriftParams(params data.Map, mp *MLParams) error {
+	mp.ClusterDriftWindow = 1000
+	if v, err := params.Get(clusterDriftWindowPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("cluster_drift_window must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("cluster_drift_window must be greater than 0")
+		}
+		mp.ClusterDriftWindow = int(n)
+		delete(params, "cluster_drift_window")
+	}
+
+	if v, err := params.Get(clusterDriftThreshPath); err == nil {
+		if mp.ClusterDriftThreshold, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("cluster_drift_threshold must be a number: %v", err)
+		}
+		if mp.ClusterDriftThreshold < 0 || mp.ClusterDriftThreshold > 1 {
+			return fmt.Errorf("cluster_drift_threshold must be in [0, 1]")
+		}
+		delete(params, "cluster_drift_threshold")
+	}
+	return nil
+}
+
+func extractPredictionHistogramParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(predHistogramWindowPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("prediction_histogram_window must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("prediction_histogram_window must not be negative")
+		}
+		mp.PredictionHistogramWindow = int(n)
+		delete(params, "prediction_histogram_window")
+	}
+
+	if v, err := params.Get(predShiftThresholdPath); err == nil {
+		if mp.PredictionShiftThreshold, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("prediction_shift_threshold must be a number: %v", err)
+		}
+		if mp.PredictionShiftThreshold < 0 || mp.PredictionShiftThreshold > 1 {
+			return fmt.Errorf("prediction_shift_threshold must be in [0, 1]")
+		}
+		delete(params, "prediction_shift_threshold")
+	}
+	return nil
+}
+
+func extractAuthorizerParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(authorizerPath); err == nil {
+		if mp.Authorizer, err = data.AsString(v); err != nil {
+			return fmt.Errorf("authorizer must be a string: %v", err)
+		}
+		delete(params, "authorizer")
+	}
+	return nil
+}
+
+func extractRetrainParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(retrainFromPath); err == nil {
+		if mp.RetrainFrom, err = data.AsString(v); err != nil {
+			return fmt.Errorf("retrain_from must be a string: %v", err)
+		}
+		if _, err := datasetFormatOf(mp.RetrainFrom); err != nil {
+			return err
+		}
+		delete(params, "retrain_from")
+	}
+
+	if v, err := params.Get(retrainIntervalPath); err == nil {
+		if mp.RetrainInterval, err = asDuration(v); err != nil {
+			return fmt.Errorf("retrain_interval must be a duration: %v", err)
+		}
+		delete(params, "retrain_interval")
+	}
+	return nil
+}
+
+func extractCurriculumParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(curriculumPath); err == nil {
+		if mp.Curriculum, err = parseCurriculumPolicy(v); err != nil {
+			return err
+		}
+		delete(params, "curriculum")
+	}
+	return nil
+}
+
+func extractCallPriorityParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(callPriorityPath); err == nil {
+		if mp.CallPriority, err = data.AsString(v); err != nil {
+			return fmt.Errorf("call_priority must be a string: %v", err)
+		}
+		if _, err := newCallScheduler(mp.CallPriority); err != nil {
+			return err
+		}
+		delete(params, "call_priority")
+	}
+	return nil
+}
+
+func extractAuditParams(params data.Map, mp *MLParams) error {
+	mp.AuditLogMaxBytes = 100 * 1024 * 1024
+	mp.AuditLogMaxBackups = 5
+	mp.AuditSampleRate = 1
+	if v, err := params.Get(auditLogPath); err == nil {
+		if mp.AuditLog, err = data.AsString(v); err != nil {
+			return fmt.Errorf("audit_log must be a string: %v", err)
+		}
+		delete(params, "audit_log")
+	}
+
+	if v, err := params.Get(auditLogMaxBytesPath); err == nil {
+		if mp.AuditLogMaxBytes, err = data.AsInt(v); err != nil {
+			return fmt.Errorf("audit_log_max_bytes must be an integer: %v", err)
+		}
+		if mp.AuditLogMaxBytes < 0 {
+			return fmt.Errorf("audit_log_max_bytes must not be negative")
+		}
+		delete(params, "audit_log_max_bytes")
+	}
+
+	if v, err := params.Get(auditLogMaxBackupsPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("audit_log_max_backups must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("audit_log_max_backups must not be negative")
+		}
+		mp.AuditLogMaxBackups = int(n)
+		delete(params, "audit_log_max_backups")
+	}
+
+	if v, err := params.Get(auditFullInputPath); err == nil {
+		if mp.AuditFullInput, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("audit_full_input must be a bool: %v", err)
+		}
+		delete(params, "audit_full_input")
+	}
+
+	if v, err := params.Get(auditSampleRatePath); err == nil {
+		if mp.AuditSampleRate, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("audit_sample_rate must be a number: %v", err)
+		}
+		if mp.AuditSampleRate <= 0 || mp.AuditSampleRate > 1 {
+			return fmt.Errorf("audit_sample_rate must be in (0, 1]")
+		}
+		delete(params, "audit_sample_rate")
+	}
+	return nil
+}
+
+func extractQuotaParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(maxWritesPerSecPath); err == nil {
+		if mp.MaxWritesPerSec, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("max_writes_per_sec must be a number: %v", err)
+		}
+		if mp.MaxWritesPerSec < 0 {
+			return fmt.Errorf("max_writes_per_sec must not be negative")
+		}
+		delete(params, "max_writes_per_sec")
+	}
+
+	if v, err := params.Get(maxPredictsPerSecPath); err == nil {
+		if mp.MaxPredictsPerSec, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("max_predicts_per_sec must be a number: %v", err)
+		}
+		if mp.MaxPredictsPerSec < 0 {
+			return fmt.Errorf("max_predicts_per_sec must not be negative")
+		}
+		delete(params, "max_predicts_per_sec")
+	}
+
+	if v, err := params.Get(maxModelBytesPath); err == nil {
+		if mp.MaxModelBytes, err = data.AsInt(v); err != nil {
+			return fmt.Errorf("max_model_bytes must be an integer: %v", err)
+		}
+		if mp.MaxModelBytes < 0 {
+			return fmt.Errorf("max_model_bytes must not be negative")
+		}
+		delete(params, "max_model_bytes")
+	}
+	return nil
+}
+
+func extractPredictCacheParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(predictCacheSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("predict_cache_size must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("predict_cache_size must not be negative")
+		}
+		mp.PredictCacheSize = int(n)
+		delete(params, "predict_cache_size")
+	}
+
+	if v, err := params.Get(predictCacheTTLPath); err == nil {
+		if mp.PredictCacheTTL, err = asDuration(v); err != nil {
+			return fmt.Errorf("predict_cache_ttl must be a duration: %v", err)
+		}
+		delete(params, "predict_cache_ttl")
+	}
+	return nil
+}
+
+func extractPredictBatchParams(params data.Map, mp *MLParams) error {
+	mp.PredictBatchMaxSize = 64
+	mp.PredictBatchMethod = "predict_batch"
+	if v, err := params.Get(predictBatchWindowPath); err == nil {
+		if mp.PredictBatchWindow, err = asDuration(v); err != nil {
+			return fmt.Errorf("predict_batch_window must be a duration: %v", err)
+		}
+		delete(params, "predict_batch_window")
+	}
+
+	if v, err := params.Get(predictBatchMaxSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("predict_batch_max_size must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("predict_batch_max_size must be greater than 0")
+		}
+		mp.PredictBatchMaxSize = int(n)
+		delete(params, "predict_batch_max_size")
+	}
+
+	if v, err := params.Get(predictBatchMethodPath); err == nil {
+		if mp.PredictBatchMethod, err = data.AsString(v); err != nil {
+			return fmt.Errorf("predict_batch_method must be a string: %v", err)
+		}
+		delete(params, "predict_batch_method")
+	}
+	return nil
+}
+
+func extractBucketParams(params data.Map, mp *MLParams) error {
+	mp.BucketOverflow = "fit"
+	if v, err := params.Get(maxBucketBytesPath); err == nil {
+		if mp.MaxBucketBytes, err = data.AsInt(v); err != nil {
+			return fmt.Errorf("max_bucket_bytes must be an integer: %v", err)
+		}
+		if mp.MaxBucketBytes < 0 {
+			return fmt.Errorf("max_bucket_bytes must not be negative")
+		}
+		delete(params, "max_bucket_bytes")
+	}
+
+	if v, err := params.Get(bucketByPathPath); err == nil {
+		if mp.BucketByPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("bucket_by_path must be a string: %v", err)
+		}
+		if _, err := data.CompilePath(mp.BucketByPath); err != nil {
+			return fmt.Errorf("invalid bucket_by_path: %v", err)
+		}
+		delete(params, "bucket_by_path")
+	}
+
+	if v, err := params.Get(channelPathPath); err == nil {
+		if mp.ChannelPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("channel_path must be a string: %v", err)
+		}
+		if _, err := data.CompilePath(mp.ChannelPath); err != nil {
+			return fmt.Errorf("invalid channel_path: %v", err)
+		}
+		delete(params, "channel_path")
+	}
+
+	if v, err := params.Get(channelsPath); err == nil {
+		if mp.Channels, err = parseChannels(v); err != nil {
+			return err
+		}
+		delete(params, "channels")
+	}
+	if mp.ChannelPath != "" && len(mp.Channels) == 0 {
+		return fmt.Errorf("channels must be given with channel_path")
+	}
+
+	mp.ReplayRatio = 0.2
+	if v, err := params.Get(replayBufferSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("replay_buffer_size must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("replay_buffer_size must not be negative")
+		}
+		mp.ReplayBufferSize = int(n)
+		delete(params, "replay_buffer_size")
+	}
+
+	if v, err := params.Get(replayRatioPath); err == nil {
+		if mp.ReplayRatio, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("replay_ratio must be a number: %v", err)
+		}
+		if mp.ReplayRatio < 0 {
+			return fmt.Errorf("replay_ratio must not be negative")
+		}
+		delete(params, "replay_ratio")
+	}
+
+	mp.BucketExpiry = "drop"
+	if v, err := params.Get(bucketTTLPath); err == nil {
+		if mp.BucketTTL, err = asDuration(v); err != nil {
+			return fmt.Errorf("bucket_ttl must be a duration: %v", err)
+		}
+		delete(params, "bucket_ttl")
+	}
+
+	if v, err := params.Get(bucketExpiryPath); err == nil {
+		if mp.BucketExpiry, err = data.AsString(v); err != nil {
+			return fmt.Errorf("bucket_expiry must be a string: %v", err)
+		}
+		if mp.BucketExpiry != "drop" && mp.BucketExpiry != "fit" {
+			return fmt.Errorf("bucket_expiry must be 'drop' or 'fit': %v", mp.BucketExpiry)
+		}
+		delete(params, "bucket_expiry")
+	}
+
+	if v, err := params.Get(bucketOverflowPath); err == nil {
+		if mp.BucketOverflow, err = data.AsString(v); err != nil {
+			return fmt.Errorf("bucket_overflow must be a string: %v", err)
+		}
+		if mp.BucketOverflow != "fit" && mp.BucketOverflow != "drop" {
+			return fmt.Errorf("bucket_overflow must be 'fit' or 'drop': %v", mp.BucketOverflow)
+		}
+		delete(params, "bucket_overflow")
+	}
+	return nil
+}
+
+func extractFitResultParams(params data.Map, mp *MLParams) error {
+	mp.FitResultPolicy = "ignore"
+	if v, err := params.Get(fitResultPolicyPath); err == nil {
+		if mp.FitResultPolicy, err = data.AsString(v); err != nil {
+			return fmt.Errorf("fit_result_policy must be a string: %v", err)
+		}
+		switch mp.FitResultPolicy {
+		case "ignore", "warn", "error":
+		default:
+			return fmt.Errorf("fit_result_policy must be 'ignore', 'warn', or 'error': %v",
+				mp.FitResultPolicy)
+		}
+		delete(params, "fit_result_policy")
+	}
+
+	if v, err := params.Get(fitResultFieldsPath); err == nil {
+		if mp.FitResultFields, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("fit_result_fields must be an array of strings: %v", err)
+		}
+		delete(params, "fit_result_fields")
+	}
+
+	mp.SampleLossesKey = "sample_losses"
+	if v, err := params.Get(hardExampleCountPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("hard_example_count must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("hard_example_count must not be negative")
+		}
+		mp.HardExampleCount = int(n)
+		delete(params, "hard_example_count")
+	}
+
+	if v, err := params.Get(sampleLossesKeyPath); err == nil {
+		if mp.SampleLossesKey, err = data.AsString(v); err != nil {
+			return fmt.Errorf("sample_losses_key must be a string: %v", err)
+		}
+		delete(params, "sample_losses_key")
+	}
+	return nil
+}
+
+func extractEvalParams(params data.Map, mp *MLParams) error {
+	mp.EvalMethod = "evaluate"
+	mp.EvalHistorySize = 100
+	if v, err := params.Get(evalDataPath); err == nil {
+		if mp.EvalData, err = data.AsString(v); err != nil {
+			return fmt.Errorf("eval_data must be a string: %v", err)
+		}
+		if _, err := datasetFormatOf(mp.EvalData); err != nil {
+			return err
+		}
+		delete(params, "eval_data")
+	}
+
+	if v, err := params.Get(evalIntervalPath); err == nil {
+		if mp.EvalInterval, err = asDuration(v); err != nil {
+			return fmt.Errorf("eval_interval must be a duration: %v", err)
+		}
+		delete(params, "eval_interval")
+	}
+
+	if v, err := params.Get(evalMethodPath); err == nil {
+		if mp.EvalMethod, err = data.AsString(v); err != nil {
+			return fmt.Errorf("eval_method must be a string: %v", err)
+		}
+		if mp.EvalMethod == "" {
+			return fmt.Errorf("eval_method must not be empty")
+		}
+		delete(params, "eval_method")
+	}
+
+	if v, err := params.Get(evalHistorySizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("eval_history_size must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("eval_history_size must be greater than 0")
+		}
+		mp.EvalHistorySize = int(n)
+		delete(params, "eval_history_size")
+	}
+
+	if v, err := params.Get(promoteAfterPath); err == nil {
+		if mp.PromoteAfter, err = asDuration(v); err != nil {
+			return fmt.Errorf("promote_after must be a duration: %v", err)
+		}
+		delete(params, "promote_after")
+	}
+
+	if v, err := params.Get(promoteMarginPath); err == nil {
+		if mp.PromoteMargin, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("promote_margin must be a number: %v", err)
+		}
+		delete(params, "promote_margin")
+	}
+
+	if v, err := params.Get(objectivePath); err == nil {
+		if mp.Objective, err = parseObjective(v); err != nil {
+			return err
+		}
+		delete(params, "objective")
+	}
+
+	if v, err := params.Get(retrainBelowMetricPath); err == nil {
+		if mp.RetrainBelowMetric, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("retrain_below_metric must be a number: %v", err)
+		}
+		if mp.RetrainBelowMetric < 0 {
+			return fmt.Errorf("retrain_below_metric must not be negative")
+		}
+		delete(params, "retrain_below_metric")
+	}
+
+	if v, err := params.Get(retrainBelowForPath); err == nil {
+		if mp.RetrainBelowFor, err = asDuration(v); err != nil {
+			return fmt.Errorf("retrain_below_for must be a duration: %v", err)
+		}
+		if mp.RetrainBelowFor < 0 {
+			return fmt.Errorf("retrain_below_for must not be negative")
+		}
+		delete(params, "retrain_below_for")
+	}
+
+	mp.ValidationSize = 1000
+	mp.ValidationLabelPath = "label"
+	if v, err := params.Get(validationFractionPath); err == nil {
+		if mp.ValidationFraction, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("validation_fraction must be a number: %v", err)
+		}
+		if mp.ValidationFraction < 0 || mp.ValidationFraction >= 1 {
+			return fmt.Errorf("validation_fraction must be in [0, 1)")
+		}
+		delete(params, "validation_fraction")
+	}
+
+	if v, err := params.Get(validationSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("validation_size must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("validation_size must be greater than 0")
+		}
+		mp.ValidationSize = int(n)
+		delete(params, "validation_size")
+	}
+
+	if v, err := params.Get(validationLabelPath); err == nil {
+		if mp.ValidationLabelPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("validation_label_path must be a string: %v", err)
+		}
+		if _, err := data.CompilePath(mp.ValidationLabelPath); err != nil {
+			return fmt.Errorf("invalid validation_label_path: %v", err)
+		}
+		delete(params, "validation_label_path")
+	}
+	return nil
+}
+
+func extractEmbeddingParams(params data.Map, mp *MLParams) error {
+	mp.EmbeddingIndexTables = 8
+	mp.EmbeddingIndexBits = 12
+	if v, err := params.Get(embeddingIndexSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("embedding_index_size must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("embedding_index_size must not be negative")
+		}
+		mp.EmbeddingIndexSize = int(n)
+		delete(params, "embedding_index_size")
+	}
+
+	if v, err := params.Get(embeddingIndexTblsPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("embedding_index_tables must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("embedding_index_tables must be greater than 0")
+		}
+		mp.EmbeddingIndexTables = int(n)
+		delete(params, "embedding_index_tables")
+	}
+
+	if v, err := params.Get(embeddingIndexBitsPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("embedding_index_bits must be an integer: %v", err)
+		}
+		if n <= 0 || n > 64 {
+			return fmt.Errorf("embedding_index_bits must be in [1, 64]")
+		}
+		mp.EmbeddingIndexBits = int(n)
+		delete(params, "embedding_index_bits")
+	}
+
+	if v, err := params.Get(embeddingKeyPathPath); err == nil {
+		if mp.EmbeddingKeyPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("embedding_key_path must be a string: %v", err)
+		}
+		if _, err := data.CompilePath(mp.EmbeddingKeyPath); err != nil {
+			return fmt.Errorf("invalid embedding_key_path: %v", err)
+		}
+		delete(params, "embedding_key_path")
+	}
+	return nil
+}
+
+func extractSkewParams(params data.Map, mp *MLParams) error {
+	mp.SkewWindow = 1000
+	if v, err := params.Get(skewPathsPath); err == nil {
+		if mp.SkewPaths, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("skew_paths must be an array of strings: %v", err)
+		}
+		if _, err := compilePaths(mp.SkewPaths); err != nil {
+			return fmt.Errorf("invalid skew_paths: %v", err)
+		}
+		delete(params, "skew_paths")
+	}
+
+	if v, err := params.Get(skewWindowPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("skew_window must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("skew_window must be greater than 0")
+		}
+		mp.SkewWindow = int(n)
+		delete(params, "skew_window")
+	}
+
+	if v, err := params.Get(skewThresholdPath); err == nil {
+		if mp.SkewThreshold, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("skew_threshold must be a number: %v", err)
+		}
+		if mp.SkewThreshold < 0 {
+			return fmt.Errorf("skew_threshold must not be negative")
+		}
+		delete(params, "skew_threshold")
+	}
+	return nil
+}
+
+func extractCanaryParams(params data.Map, mp *MLParams) error {
+	mp.CanaryMethod = "evaluate"
+	if v, err := params.Get(canaryDataPath); err == nil {
+		if mp.CanaryData, err = data.AsString(v); err != nil {
+			return fmt.Errorf("canary_data must be a string: %v", err)
+		}
+		delete(params, "canary_data")
+	}
+
+	if v, err := params.Get(canaryMethodPath); err == nil {
+		if mp.CanaryMethod, err = data.AsString(v); err != nil {
+			return fmt.Errorf("canary_method must be a string: %v", err)
+		}
+		if mp.CanaryMethod == "" {
+			return fmt.Errorf("canary_method must not be empty")
+		}
+		delete(params, "canary_method")
+	}
+
+	if v, err := params.Get(canaryMaxRegressionPath); err == nil {
+		if mp.CanaryMaxRegression, err = data.ToFloat(v); err != nil {
+			return fmt.Errorf("canary_max_regression must be a number: %v", err)
+		}
+		if mp.CanaryMaxRegression < 0 {
+			return fmt.Errorf("canary_max_regression must not be negative")
+		}
+		delete(params, "canary_max_regression")
+	}
+	return nil
+}
+
+func extractJoinParams(params data.Map, mp *MLParams) error {
+	mp.JoinLabelPath = "label"
+	mp.JoinTTL = time.Hour
+
+	if v, err := params.Get(joinIDPath); err == nil {
+		if mp.JoinIDPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("join_id_path must be a string: %v", err)
+		}
+		delete(params, "join_id_path")
+	}
+
+	if v, err := params.Get(joinLabelPath); err == nil {
+		if mp.JoinLabelPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("join_label_path must be a string: %v", err)
+		}
+		delete(params, "join_label_path")
+	}
+
+	if v, err := params.Get(joinTTLPath); err == nil {
+		if mp.JoinTTL, err = asDuration(v); err != nil {
+			return fmt.Errorf("join_ttl is invalid: %v", err)
+		}
+		delete(params, "join_ttl")
+	}
+	return nil
+}
+
+func extractRedactionParams(params data.Map, mp *MLParams) error {
+	if v, err := params.Get(dropPathsPath); err == nil {
+		if mp.DropPaths, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("drop_paths must be an array of strings: %v", err)
+		}
+		delete(params, "drop_paths")
+	}
+
+	if v, err := params.Get(hashPathsPath); err == nil {
+		if mp.HashPaths, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("hash_paths must be an array of strings: %v", err)
+		}
+		delete(params, "hash_paths")
+	}
+
+	if v, err := params.Get(hashSaltPath); err == nil {
+		if mp.HashSalt, err = data.AsString(v); err != nil {
+			return fmt.Errorf("hash_salt must be a string: %v", err)
+		}
+		delete(params, "hash_salt")
+	}
+	return nil
+}
+
+func extractBreakerParams(params data.Map, mp *MLParams) error {
+	mp.BreakerWindow = 20
+	mp.BreakerOpenDuration = 30 * time.Second
+	if v, err := params.Get(breakerErrorRatePath); err == nil {
+		f, err := data.ToFloat(v)
+		if err != nil {
+			return fmt.Errorf("breaker_error_rate must be a float: %v", err)
+		}
+		if f <= 0 || f > 1 {
+			return fmt.Errorf("breaker_error_rate must be in (0, 1]: %v", f)
+		}
+		mp.BreakerErrorRate = f
+		delete(params, "breaker_error_rate")
+	}
+
+	if v, err := params.Get(breakerWindowPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("breaker_window must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("breaker_window must be greater than 0")
+		}
+		mp.BreakerWindow = int(n)
+		delete(params, "breaker_window")
+	}
+
+	if v, err := params.Get(breakerCallTimeoutPath); err == nil {
+		if mp.BreakerCallTimeout, err = asDuration(v); err != nil {
+			return fmt.Errorf("breaker_call_timeout must be a duration: %v", err)
+		}
+		delete(params, "breaker_call_timeout")
+	}
+
+	if v, err := params.Get(breakerOpenDurationPath); err == nil {
+		if mp.BreakerOpenDuration, err = asDuration(v); err != nil {
+			return fmt.Errorf("breaker_open_duration must be a duration: %v", err)
+		}
+		delete(params, "breaker_open_duration")
+	}
+
+	if v, err := params.Get(breakerFallbackPath); err == nil {
+		if mp.BreakerFallback, err = encodeFallbackValue(v); err != nil {
+			return fmt.Errorf("cannot encode breaker_fallback: %v", err)
+		}
+		delete(params, "breaker_fallback")
+	}
+
+	if v, err := params.Get(fallbackStatePath); err == nil {
+		if mp.FallbackState, err = data.AsString(v); err != nil {
+			return fmt.Errorf("fallback_state must be a string: %v", err)
+		}
+		delete(params, "fallback_state")
+	}
+
+	if v, err := params.Get(fallbackValuePath); err == nil {
+		if mp.FallbackValue, err = encodeFallbackValue(v); err != nil {
+			return fmt.Errorf("cannot encode fallback_value: %v", err)
+		}
+		delete(params, "fallback_value")
+	}
+	return nil
+}
+
+func extractReferenceParams(params data.Map, mp *MLParams) error {
+	for _, e := range []struct {
+		path data.Path
+		name string
+		v    *string
+	}{
+		{referenceDataPath, "reference_data", &mp.ReferenceData},
+		{referenceKeyPath, "reference_key", &mp.ReferenceKey},
+		{referenceKeyPathPath, "reference_key_path", &mp.ReferenceKeyPath},
+		{referenceOutputPathPath, "reference_output_path", &mp.ReferenceOutputPath},
+	} {
+		if v, err := params.Get(e.path); err == nil {
+			if *e.v, err = data.AsString(v); err != nil {
+				return fmt.Errorf("%v must be a string: %v", e.name, err)
+			}
+			delete(params, e.name)
+		}
+	}
+
+	if mp.ReferenceData == "" {
+		return nil
+	}
+	if mp.ReferenceKey == "" {
+		return fmt.Errorf("reference_key must be given with reference_data")
+	}
+	if _, err := datasetFormatOf(mp.ReferenceData); err != nil {
+		return err
+	}
+	_, err := newReferenceJoiner(mp)
+	return err
+}
+
+func extractWindowParams(params data.Map, mp *MLParams) error {
+	mp.WindowMaxKeys = 10000
+	if v, err := params.Get(windowFeaturesPath); err == nil {
+		if mp.WindowFeatures, err = parseWindowFeatures(v); err != nil {
+			return err
+		}
+		delete(params, "window_features")
+	}
+
+	if v, err := params.Get(windowKeyPathPath); err == nil {
+		if mp.WindowKeyPath, err = data.AsString(v); err != nil {
+			return fmt.Errorf("window_key_path must be a string: %v", err)
+		}
+		delete(params, "window_key_path")
+	}
+
+	if v, err := params.Get(windowMaxKeysPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("window_max_keys must be an integer: %v", err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("window_max_keys must be greater than 0")
+		}
+		mp.WindowMaxKeys = int(n)
+		delete(params, "window_max_keys")
+	}
+
+	if len(mp.WindowFeatures) > 0 {
+		if _, err := newWindowAggregator(mp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractImageParams(params data.Map, mp *MLParams) error {
+	mp.ImageWorkers = runtime.NumCPU()
+	if v, err := params.Get(imagePathsPath); err == nil {
+		if mp.ImagePaths, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("image_paths must be an array of strings: %v", err)
+		}
+		delete(params, "image_paths")
+	}
+
+	for _, e := range []struct {
+		path data.Path
+		name string
+		v    *int
+	}{
+		{imageWidthPath, "image_width", &mp.ImageWidth},
+		{imageHeightPath, "image_height", &mp.ImageHeight},
+		{imageWorkersPath, "image_workers", &mp.ImageWorkers},
+	} {
+		if v, err := params.Get(e.path); err == nil {
+			n, err := data.AsInt(v)
+			if err != nil {
+				return fmt.Errorf("%v must be an integer: %v", e.name, err)
+			}
+			if n <= 0 {
+				return fmt.Errorf("%v must be greater than 0", e.name)
+			}
+			*e.v = int(n)
+			delete(params, e.name)
+		}
+	}
+	if (mp.ImageWidth == 0) != (mp.ImageHeight == 0) {
+		return fmt.Errorf("image_width and image_height must be given together")
+	}
+
+	if v, err := params.Get(imageGrayscalePath); err == nil {
+		if mp.ImageGrayscale, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("image_grayscale must be a bool: %v", err)
+		}
+		delete(params, "image_grayscale")
+	}
+
+	for _, e := range []struct {
+		path data.Path
+		name string
+		v    *[]float64
+	}{
+		{imageMeanPath, "image_mean", &mp.ImageMean},
+		{imageStdPath, "image_std", &mp.ImageStd},
+	} {
+		if v, err := params.Get(e.path); err == nil {
+			fs, err := asFloatSlice(v)
+			if err != nil {
+				return fmt.Errorf("%v must be an array of numbers: %v", e.name, err)
+			}
+			*e.v = fs
+			delete(params, e.name)
+		}
+	}
+
+	if len(mp.ImagePaths) > 0 {
+		if _, err := newImageDecoder(mp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTokenizeParams(params data.Map, mp *MLParams) error {
+	mp.Tokenizer = "whitespace"
+	mp.TokenizePattern = `\w+`
+	if v, err := params.Get(tokenizePathsPath); err == nil {
+		if mp.TokenizePaths, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("tokenize_paths must be an array of strings: %v", err)
+		}
+		delete(params, "tokenize_paths")
+	}
+
+	if v, err := params.Get(tokenizerPath); err == nil {
+		if mp.Tokenizer, err = data.AsString(v); err != nil {
+			return fmt.Errorf("tokenizer must be a string: %v", err)
+		}
+		delete(params, "tokenizer")
+	}
+
+	if v, err := params.Get(tokenizePatternPath); err == nil {
+		if mp.TokenizePattern, err = data.AsString(v); err != nil {
+			return fmt.Errorf("tokenize_pattern must be a string: %v", err)
+		}
+		delete(params, "tokenize_pattern")
+	}
+
+	if v, err := params.Get(tokenizeLowercasePath); err == nil {
+		if mp.TokenizeLowercase, err = data.AsBool(v); err != nil {
+			return fmt.Errorf("tokenize_lowercase must be a bool: %v", err)
+		}
+		delete(params, "tokenize_lowercase")
+	}
+
+	if v, err := params.Get(tokenVocabMaxSizePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("token_vocabulary_max_size must be an integer: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("token_vocabulary_max_size must not be negative")
+		}
+		mp.TokenVocabularyMaxSize = int(n)
+		delete(params, "token_vocabulary_max_size")
+	}
+
+	if len(mp.TokenizePaths) > 0 {
+		if _, err := lookupTokenizer(mp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractHashFeaturesParams(params data.Map, mp *MLParams) error {
+	mp.HashFeaturesDim = 1024
+	mp.HashFeaturesKey = "hashed_features"
+
+	if v, err := params.Get(hashFeaturesPath); err == nil {
+		if mp.HashFeatures, err = asStringSlice(v); err != nil {
+			return fmt.Errorf("hash_features must be an array of strings: %v", err)
+		}
+		delete(params, "hash_features")
+	}
+
+	if v, err := params.Get(hashFeaturesDimPath); err == nil {
+		dim, err := data.AsInt(v)
+		if err != nil {
+			return fmt.Errorf("hash_features_dim must be an integer: %v", err)
+		}
+		if dim <= 0 {
+			return fmt.Errorf("hash_features_dim must be greater than 0")
+		}
+		mp.HashFeaturesDim = int(dim)
+		delete(params, "hash_features_dim")
+	}
+
+	if v, err := params.Get(hashFeaturesKeyPath); err == nil {
+		if mp.HashFeaturesKey, err = data.AsString(v); err != nil {
+			return fmt.Errorf("hash_features_key must be a string: %v", err)
+		}
+		delete(params, "hash_features_key")
+	}
+	return nil
+}
+
+// asStringSlice converts an array of strings to []string. A single string is
+// also accepted as an array having one element.
+func asStringSlice(v data.Value) ([]string, error) {
+	if v.Type() == data.TypeString {
+		str, _ := data.AsString(v)
+		return []string{str}, nil
+	}
+
+	arr, err := data.AsArray(v)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, len(arr))
+	for i, e := range arr {
+		if res[i], err = data.AsString(e); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// asFloatSlice converts a number or an array of numbers to []float64.
+func asFloatSlice(v data.Value) ([]float64, error) {
+	if v.Type() != data.TypeArray {
+		f, err := asNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		return []float64{f}, nil
+	}
+	arr, _ := data.AsArray(v)
+	res := make([]float64, len(arr))
+	for i, e := range arr {
+		f, err := asNumber(e)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = f
+	}
+	return res, nil
+}
+
+// asDuration converts a value to time.Duration. A number is considered as
+// seconds and a string is parsed by time.ParseDuration (e.g. "1m30s").
+func asDuration(v data.Value) (time.Duration, error) {
+	var d time.Duration
+	switch v.Type() {
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		d = time.Duration(i) * time.Second
+	case data.TypeFloat:
+		f, _ := data.AsFloat(v)
+		d = time.Duration(f * float64(time.Second))
+	case data.TypeString:
+		str, _ := data.AsString(v)
+		var err error
+		if d, err = time.ParseDuration(str); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("cannot convert %v to a duration", v.Type())
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration must not be negative")
+	}
+	return d, nil
+}
+
+// LoadState is same as CREATE STATE.
+func (c *StateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (
+	core.SharedState, error) {
+	s := &State{}
+	if err := s.load(ctx, r, params, ""); err != nil {
+		return nil, err
+	}
+	if err := s.openWAL(ctx); err != nil {
+		s.Terminate(ctx)
 		return nil, err
 	}
 	return s, nil
@@ -6,6 +6,7 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"testing"
+	"time"
 )
 
 func TestCreatePyMLState(t *testing.T) {
@@ -58,6 +59,43 @@ func TestCreatePyMLState(t *testing.T) {
 				So(cap(ps.bucket), ShouldEqual, 50)
 			})
 		})
+
+		Convey("When create a pymlstate with join parameters", func() {
+			params := data.Map{
+				"module_path":  data.String("./"),
+				"module_name":  data.String("_test_pymlstate"),
+				"class_name":   data.String("TestClass"),
+				"join_id_path": data.String("id"),
+				"join_ttl":     data.String("10m"),
+			}
+			s, err := sc.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			Convey("Then the state should have a join buffer", func() {
+				ps, ok := s.(*State)
+				So(ok, ShouldBeTrue)
+				So(ps.params.JoinIDPath, ShouldEqual, "id")
+				So(ps.params.JoinLabelPath, ShouldEqual, "label")
+				So(ps.params.JoinTTL, ShouldEqual, 10*time.Minute)
+				So(ps.join, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When create a pymlstate with an invalid join_ttl", func() {
+			params := data.Map{
+				"module_path":  data.String("./"),
+				"module_name":  data.String("_test_pymlstate"),
+				"class_name":   data.String("TestClass"),
+				"join_id_path": data.String("id"),
+				"join_ttl":     data.Int(-1),
+			}
+			_, err := sc.CreateState(ctx, params)
+			Convey("Then creator should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
 	})
 }
 
@@ -102,5 +140,42 @@ func TestLoadPyMLState(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When create a pymlstate normalizing features", func() {
+			params := data.Map{
+				"module_path":     data.String("./"),
+				"module_name":     data.String("_test_pymlstate"),
+				"class_name":      data.String("TestClass"),
+				"normalize_paths": data.Array{data.String("x")},
+			}
+			s, err := sc.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			ps, ok := s.(*State)
+			So(ok, ShouldBeTrue)
+			_, err = ps.Fit(ctx, []data.Value{
+				data.Map{"x": data.Int(1)}, data.Map{"x": data.Int(3)},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("And when save and load the state", func() {
+				buf := bytes.NewBuffer(nil)
+				So(ps.Save(ctx, buf, data.Map{}), ShouldBeNil)
+				s2, err := sc.LoadState(ctx, buf, data.Map{})
+				So(err, ShouldBeNil)
+				Reset(func() {
+					s2.Terminate(ctx)
+				})
+
+				Convey("Then the statistics should be loaded", func() {
+					ps2, ok := s2.(*State)
+					So(ok, ShouldBeTrue)
+					So(ps2.normalizer, ShouldNotBeNil)
+					So(ps2.normalizer.snapshot(), ShouldResemble, ps.normalizer.snapshot())
+				})
+			})
+		})
 	})
 }
@@ -0,0 +1,172 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// CurriculumPolicy controls which records are trained and in which order by
+// a numeric field at Path such as the confidence of a label. Records whose
+// value is less than Min or greater than Max aren't trained. Records in a
+// batch are sorted by the value in Order, which is "asc", "desc", or "none".
+// Records which don't have a numeric value at Path are placed at the end of
+// the batch and they're dropped when Min or Max is given.
+type CurriculumPolicy struct {
+	Path  string   `codec:"path"`
+	Order string   `codec:"order"`
+	Min   *float64 `codec:"min"`
+	Max   *float64 `codec:"max"`
+}
+
+// curriculum applies CurriculumPolicy to training records. Methods of a nil
+// curriculum don't change records.
+type curriculum struct {
+	policy CurriculumPolicy
+	path   data.Path
+}
+
+func newCurriculum(p *CurriculumPolicy) (*curriculum, error) {
+	path, err := data.CompilePath(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path of curriculum '%v': %v", p.Path, err)
+	}
+	switch p.Order {
+	case "asc", "desc", "none":
+	default:
+		return nil, fmt.Errorf("order of curriculum must be 'asc', 'desc', or 'none': %v", p.Order)
+	}
+	if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+		return nil, fmt.Errorf("min of curriculum must not be greater than max")
+	}
+	return &curriculum{
+		policy: *p,
+		path:   path,
+	}, nil
+}
+
+// value returns the numeric value of the record at the path.
+func (c *curriculum) value(rec data.Value) (float64, bool) {
+	m, err := data.AsMap(rec)
+	if err != nil {
+		return 0, false
+	}
+	v, err := m.Get(c.path)
+	if err != nil {
+		return 0, false
+	}
+	x, err := asNumber(v)
+	if err != nil {
+		return 0, false
+	}
+	return x, true
+}
+
+// accept returns true when the record is trained.
+func (c *curriculum) accept(rec data.Value) bool {
+	if c == nil || (c.policy.Min == nil && c.policy.Max == nil) {
+		return true
+	}
+	x, ok := c.value(rec)
+	if !ok {
+		return false
+	}
+	if c.policy.Min != nil && x < *c.policy.Min {
+		return false
+	}
+	if c.policy.Max != nil && x > *c.policy.Max {
+		return false
+	}
+	return true
+}
+
+// filter returns records accepted by the curriculum.
+func (c *curriculum) filter(recs []data.Value) []data.Value {
+	if c == nil || (c.policy.Min == nil && c.policy.Max == nil) {
+		return recs
+	}
+	res := make([]data.Value, 0, len(recs))
+	for _, r := range recs {
+		if c.accept(r) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// order returns a copy of the batch sorted by the policy.
+func (c *curriculum) order(batch []data.Value) []data.Value {
+	if c == nil || c.policy.Order == "none" {
+		return batch
+	}
+	type keyed struct {
+		rec data.Value
+		x   float64
+		ok  bool
+	}
+	ks := make([]keyed, len(batch))
+	for i, r := range batch {
+		x, ok := c.value(r)
+		ks[i] = keyed{rec: r, x: x, ok: ok}
+	}
+	desc := c.policy.Order == "desc"
+	sort.SliceStable(ks, func(i, j int) bool {
+		if ks[i].ok != ks[j].ok {
+			return ks[i].ok
+		}
+		if desc {
+			return ks[i].x > ks[j].x
+		}
+		return ks[i].x < ks[j].x
+	})
+
+	res := make([]data.Value, len(ks))
+	for i, k := range ks {
+		res[i] = k.rec
+	}
+	return res
+}
+
+// parseCurriculumPolicy parses curriculum parameter. It's a map which has
+// "path" and optionally "order", "min", and "max". The default order is
+// "desc".
+func parseCurriculumPolicy(v data.Value) (*CurriculumPolicy, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("curriculum must be a map: %v", err)
+	}
+	p := &CurriculumPolicy{Order: "desc"}
+	for k, x := range m {
+		switch k {
+		case "path", "order":
+			s, err := data.AsString(x)
+			if err != nil {
+				return nil, fmt.Errorf("%v of curriculum must be a string: %v", k, err)
+			}
+			if k == "path" {
+				p.Path = s
+			} else {
+				p.Order = s
+			}
+		case "min", "max":
+			f, err := asNumber(x)
+			if err != nil {
+				return nil, fmt.Errorf("%v of curriculum must be a number: %v", k, err)
+			}
+			if k == "min" {
+				p.Min = &f
+			} else {
+				p.Max = &f
+			}
+		default:
+			return nil, fmt.Errorf("unknown parameter of curriculum: %v", k)
+		}
+	}
+	if p.Path == "" {
+		return nil, fmt.Errorf("curriculum must have path")
+	}
+	if _, err := newCurriculum(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,96 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestCurriculum(t *testing.T) {
+	recs := []data.Value{
+		data.Map{"id": data.Int(0), "confidence": data.Float(0.5)},
+		data.Map{"id": data.Int(1)},
+		data.Map{"id": data.Int(2), "confidence": data.Float(0.9)},
+		data.Map{"id": data.Int(3), "confidence": data.Float(0.1)},
+	}
+	ids := func(recs []data.Value) []int64 {
+		res := make([]int64, len(recs))
+		for i, r := range recs {
+			m, _ := data.AsMap(r)
+			res[i], _ = data.AsInt(m["id"])
+		}
+		return res
+	}
+
+	Convey("Given a curriculum sorting records in descending order", t, func() {
+		p, err := parseCurriculumPolicy(data.Map{"path": data.String("confidence")})
+		So(err, ShouldBeNil)
+		c, err := newCurriculum(p)
+		So(err, ShouldBeNil)
+
+		Convey("When a batch is ordered", func() {
+			b := c.order(recs)
+
+			Convey("Then records should be sorted with ones without the value last", func() {
+				So(ids(b), ShouldResemble, []int64{2, 0, 3, 1})
+				So(ids(recs), ShouldResemble, []int64{0, 1, 2, 3})
+			})
+		})
+
+		Convey("When records are filtered", func() {
+			Convey("Then all records should be accepted", func() {
+				So(len(c.filter(recs)), ShouldEqual, 4)
+			})
+		})
+	})
+
+	Convey("Given a curriculum with min", t, func() {
+		p, err := parseCurriculumPolicy(data.Map{
+			"path":  data.String("confidence"),
+			"order": data.String("asc"),
+			"min":   data.Float(0.3),
+		})
+		So(err, ShouldBeNil)
+		c, err := newCurriculum(p)
+		So(err, ShouldBeNil)
+
+		Convey("When records are filtered and ordered", func() {
+			b := c.order(c.filter(recs))
+
+			Convey("Then only records having high values should be trained", func() {
+				So(ids(b), ShouldResemble, []int64{0, 2})
+			})
+		})
+	})
+
+	Convey("Given a nil curriculum", t, func() {
+		var c *curriculum
+
+		Convey("When records are filtered and ordered", func() {
+			Convey("Then they should be returned as they are", func() {
+				So(c.accept(recs[1]), ShouldBeTrue)
+				So(ids(c.order(c.filter(recs))), ShouldResemble, []int64{0, 1, 2, 3})
+			})
+		})
+	})
+
+	Convey("Given invalid curriculum parameters", t, func() {
+		Convey("When they're parsed", func() {
+			Convey("Then it should fail", func() {
+				_, err := parseCurriculumPolicy(data.Map{"order": data.String("asc")})
+				So(err, ShouldNotBeNil)
+				_, err = parseCurriculumPolicy(data.Map{
+					"path":  data.String("confidence"),
+					"order": data.String("random"),
+				})
+				So(err, ShouldNotBeNil)
+				_, err = parseCurriculumPolicy(data.Map{
+					"path": data.String("confidence"),
+					"min":  data.Float(1),
+					"max":  data.Float(0),
+				})
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
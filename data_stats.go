@@ -0,0 +1,155 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sync"
+	"time"
+)
+
+// featureStats is statistics of a top-level feature of ingested records.
+// Only integers and floats are numeric.
+type featureStats struct {
+	count    int64
+	numeric  runningStats
+	min, max float64
+}
+
+// dataStats accumulates statistics of records ingested for training since
+// the first record is ingested or it's reset. It has its own lock and it's
+// never replaced so that it's kept when parameters are updated or a model
+// is loaded.
+type dataStats struct {
+	mu       sync.Mutex
+	since    time.Time
+	records  int64
+	features map[string]*featureStats
+}
+
+// observe records a record or an array of records before they're
+// preprocessed. Values other than maps are ignored.
+func (d *dataStats) observe(v data.Value) {
+	recs := []data.Value{v}
+	if v.Type() == data.TypeArray {
+		recs, _ = data.AsArray(v)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.features == nil {
+		d.resetLocked()
+	}
+	for _, r := range recs {
+		m, err := data.AsMap(r)
+		if err != nil {
+			continue
+		}
+		d.records++
+		for k, x := range m {
+			if x.Type() == data.TypeNull {
+				continue
+			}
+			f, ok := d.features[k]
+			if !ok {
+				f = &featureStats{min: math.Inf(1), max: math.Inf(-1)}
+				d.features[k] = f
+			}
+			f.count++
+			if x.Type() != data.TypeInt && x.Type() != data.TypeFloat {
+				continue
+			}
+			n, _ := data.ToFloat(x)
+			f.numeric.add(n)
+			f.min = math.Min(f.min, n)
+			f.max = math.Max(f.max, n)
+		}
+	}
+}
+
+func (d *dataStats) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.resetLocked()
+}
+
+func (d *dataStats) resetLocked() {
+	d.since = time.Now()
+	d.records = 0
+	d.features = map[string]*featureStats{}
+}
+
+// toMap returns the number of records and statistics of each feature. The
+// null rate of a feature is the ratio of records in which it's null or
+// missing. "mean", "min", and "max" are only computed from numeric values.
+func (d *dataStats) toMap() data.Map {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.features == nil {
+		return data.Map{"records": data.Int(0), "features": data.Map{}}
+	}
+	features := make(data.Map, len(d.features))
+	for k, f := range d.features {
+		m := data.Map{
+			"count":     data.Int(f.count),
+			"null_rate": data.Float(1 - float64(f.count)/float64(d.records)),
+		}
+		if f.numeric.Count > 0 {
+			m["numeric_count"] = data.Int(f.numeric.Count)
+			m["mean"] = data.Float(f.numeric.Mean)
+			m["min"] = data.Float(f.min)
+			m["max"] = data.Float(f.max)
+		}
+		features[k] = m
+	}
+	return data.Map{
+		"since":    data.Timestamp(d.since),
+		"records":  data.Int(d.records),
+		"features": features,
+	}
+}
+
+// DataStats returns statistics of features of records ingested for training
+// since the first record is ingested or the statistics are reset, which is a
+// quick sanity check on what the state has ingested. "since" is the time
+// when the statistics started. They're computed from top-level features of
+// records before they're preprocessed.
+func (s *State) DataStats(ctx *core.Context) (data.Map, error) {
+	if err := s.authorize(ctx, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.dataStats.toMap(), nil
+}
+
+// ResetDataStats resets statistics returned by DataStats.
+func (s *State) ResetDataStats(ctx *core.Context) error {
+	if err := s.authorize(ctx, ActionTrain); err != nil {
+		return err
+	}
+	s.dataStats.reset()
+	return nil
+}
+
+// DataStats returns statistics of features of records ingested by the
+// state. See State.DataStats for details.
+func DataStats(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	m, err := s.DataStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ResetDataStats resets statistics of features of records ingested by the
+// state. A return value is always nil.
+func ResetDataStats(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.ResetDataStats(ctx)
+}
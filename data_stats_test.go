@@ -0,0 +1,79 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestDataStats(t *testing.T) {
+	Convey("Given a state ingesting records", t, func() {
+		s := &State{
+			base: &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.Float(0.5), nil
+			}},
+			params: MLParams{
+				BatchSize:      1,
+				NormalizePaths: []string{"x"},
+			},
+		}
+		So(s.setUpParams(), ShouldBeNil)
+		ctx := core.NewContext(nil)
+		So(ctx.SharedStates.Add("model", "pymlstate", s), ShouldBeNil)
+
+		Convey("When no record is ingested", func() {
+			st, err := DataStats(ctx, "model")
+
+			Convey("Then statistics should be empty", func() {
+				So(err, ShouldBeNil)
+				So(st, ShouldResemble, data.Map{"records": data.Int(0), "features": data.Map{}})
+			})
+		})
+
+		Convey("When records are trained", func() {
+			_, err := s.Fit(ctx, []data.Value{
+				data.Map{"x": data.Int(1), "c": data.String("a")},
+				data.Map{"x": data.Float(5), "c": data.Null{}},
+				data.Map{"x": data.Int(3)},
+				data.Map{"x": data.Null{}},
+			})
+			So(err, ShouldBeNil)
+			_, err = s.Predict(ctx, data.Map{"x": data.Int(100)})
+			So(err, ShouldBeNil)
+
+			Convey("Then statistics of raw features should be returned", func() {
+				v, err := DataStats(ctx, "model")
+				So(err, ShouldBeNil)
+				st, _ := data.AsMap(v)
+				So(st["records"], ShouldEqual, data.Int(4))
+				So(st, ShouldContainKey, "since")
+				features, _ := data.AsMap(st["features"])
+				So(features["x"], ShouldResemble, data.Map{
+					"count":         data.Int(3),
+					"null_rate":     data.Float(0.25),
+					"numeric_count": data.Int(3),
+					"mean":          data.Float(3),
+					"min":           data.Float(1),
+					"max":           data.Float(5),
+				})
+				So(features["c"], ShouldResemble, data.Map{
+					"count":     data.Int(1),
+					"null_rate": data.Float(0.75),
+				})
+			})
+
+			Convey("And when statistics are reset", func() {
+				_, err := ResetDataStats(ctx, "model")
+				So(err, ShouldBeNil)
+
+				Convey("Then they should be empty", func() {
+					st, err := s.DataStats(ctx)
+					So(err, ShouldBeNil)
+					So(st["records"], ShouldEqual, data.Int(0))
+					So(st["features"], ShouldResemble, data.Map{})
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,154 @@
+package pymlstate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DatasetJSONLines is a dataset having a JSON object in each line.
+	DatasetJSONLines = "jsonl"
+
+	// DatasetCSV is a CSV dataset whose first row is a header having keys of
+	// records.
+	DatasetCSV = "csv"
+
+	// DatasetMsgpack is a dataset of concatenated msgpack maps.
+	DatasetMsgpack = "msgpack"
+)
+
+// datasetReader reads records from a dataset one by one. read returns io.EOF
+// when there's no more record.
+type datasetReader interface {
+	read() (data.Map, error)
+}
+
+// datasetFormatOf returns the format of a dataset file from its extension.
+func datasetFormatOf(uri string) (string, error) {
+	if i := strings.IndexAny(uri, "?#"); i >= 0 {
+		uri = uri[:i]
+	}
+	switch strings.ToLower(path.Ext(uri)) {
+	case ".jsonl", ".json", ".ndjson":
+		return DatasetJSONLines, nil
+	case ".csv":
+		return DatasetCSV, nil
+	case ".msgpack", ".mpk":
+		return DatasetMsgpack, nil
+	default:
+		return "", fmt.Errorf("cannot detect the format of the dataset from its extension: %v", uri)
+	}
+}
+
+func newDatasetReader(r io.Reader, format string) (datasetReader, error) {
+	switch format {
+	case DatasetJSONLines:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(nil, 64*1024*1024)
+		return &jsonLinesReader{sc: sc}, nil
+	case DatasetCSV:
+		return newCSVReader(r)
+	case DatasetMsgpack:
+		h := &codec.MsgpackHandle{}
+		h.RawToString = true
+		h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+		return &msgpackReader{dec: codec.NewDecoder(r, h)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dataset format: %v", format)
+	}
+}
+
+type jsonLinesReader struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+func (j *jsonLinesReader) read() (data.Map, error) {
+	for j.sc.Scan() {
+		j.line++
+		b := bytes.TrimSpace(j.sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("invalid record at line %v: %v", j.line, err)
+		}
+		return newRecord(m)
+	}
+	if err := j.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("the CSV dataset doesn't have a header")
+	} else if err != nil {
+		return nil, err
+	}
+	return &csvReader{r: cr, header: header}, nil
+}
+
+// read returns a record whose fields are keyed by the header. Fields which
+// can be parsed as numbers are converted to numbers and empty fields are
+// converted to null.
+func (c *csvReader) read() (data.Map, error) {
+	row, err := c.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	m := make(data.Map, len(row))
+	for i, f := range row {
+		var v data.Value
+		if f == "" {
+			v = data.Null{}
+		} else if n, err := strconv.ParseInt(f, 10, 64); err == nil {
+			v = data.Int(n)
+		} else if x, err := strconv.ParseFloat(f, 64); err == nil {
+			v = data.Float(x)
+		} else {
+			v = data.String(f)
+		}
+		m[c.header[i]] = v
+	}
+	return m, nil
+}
+
+type msgpackReader struct {
+	dec *codec.Decoder
+}
+
+func (r *msgpackReader) read() (data.Map, error) {
+	var m map[string]interface{}
+	if err := r.dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return newRecord(m)
+}
+
+func newRecord(m map[string]interface{}) (data.Map, error) {
+	v, err := data.NewValue(m)
+	if err != nil {
+		return nil, err
+	}
+	return data.AsMap(v)
+}
@@ -0,0 +1,119 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDatasetFormatOf(t *testing.T) {
+	Convey("Given dataset URIs", t, func() {
+		cases := map[string]string{
+			"/data/train.jsonl":                 DatasetJSONLines,
+			"file:///data/train.JSON":           DatasetJSONLines,
+			"https://example.com/train.csv?v=2": DatasetCSV,
+			"train.mpk":                         DatasetMsgpack,
+		}
+
+		Convey("When their formats are detected", func() {
+			Convey("Then they should be detected by extensions", func() {
+				for uri, f := range cases {
+					format, err := datasetFormatOf(uri)
+					So(err, ShouldBeNil)
+					So(format, ShouldEqual, f)
+				}
+			})
+		})
+
+		Convey("When a URI has an unknown extension", func() {
+			_, err := datasetFormatOf("/data/train.parquet")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestCSVDatasetReader(t *testing.T) {
+	Convey("Given a CSV dataset", t, func() {
+		dr, err := newDatasetReader(strings.NewReader("x,y,label\n1,0.5,a\n,2,b\n"), DatasetCSV)
+		So(err, ShouldBeNil)
+
+		Convey("When records are read", func() {
+			m1, err := dr.read()
+			So(err, ShouldBeNil)
+			m2, err := dr.read()
+			So(err, ShouldBeNil)
+			_, err = dr.read()
+
+			Convey("Then fields should be converted by their values", func() {
+				So(m1, ShouldResemble, data.Map{
+					"x":     data.Int(1),
+					"y":     data.Float(0.5),
+					"label": data.String("a"),
+				})
+				So(m2["x"], ShouldResemble, data.Null{})
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+	})
+
+	Convey("Given an empty CSV dataset", t, func() {
+		_, err := newDatasetReader(strings.NewReader(""), DatasetCSV)
+
+		Convey("Then it should fail because of the missing header", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestJSONLinesDatasetReader(t *testing.T) {
+	Convey("Given a JSON lines dataset", t, func() {
+		dr, err := newDatasetReader(strings.NewReader("{\"x\": 1}\n\n{\"x\": 2}\n"), DatasetJSONLines)
+		So(err, ShouldBeNil)
+
+		Convey("When records are read", func() {
+			m1, err := dr.read()
+			So(err, ShouldBeNil)
+			m2, err := dr.read()
+			So(err, ShouldBeNil)
+			_, err = dr.read()
+
+			Convey("Then empty lines should be skipped", func() {
+				So(m1["x"], ShouldEqual, data.Float(1))
+				So(m2["x"], ShouldEqual, data.Float(2))
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+	})
+}
+
+func TestMsgpackDatasetReader(t *testing.T) {
+	Convey("Given a msgpack dataset", t, func() {
+		buf := bytes.NewBuffer(nil)
+		enc := codec.NewEncoder(buf, &codec.MsgpackHandle{})
+		So(enc.Encode(map[string]interface{}{"x": 1, "label": "a"}), ShouldBeNil)
+		So(enc.Encode(map[string]interface{}{"x": 2, "label": "b"}), ShouldBeNil)
+		dr, err := newDatasetReader(buf, DatasetMsgpack)
+		So(err, ShouldBeNil)
+
+		Convey("When records are read", func() {
+			m1, err := dr.read()
+			So(err, ShouldBeNil)
+			m2, err := dr.read()
+			So(err, ShouldBeNil)
+			_, err = dr.read()
+
+			Convey("Then they should be decoded", func() {
+				So(m1["label"], ShouldEqual, data.String("a"))
+				So(m2["x"], ShouldEqual, data.Int(2))
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+	})
+}
@@ -0,0 +1,52 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// distill passes the bucket to Predict of the teacher state and returns
+// copies of records to which outputs of the teacher are attached at
+// teacher_output_key. It returns the bucket as it is when teacher_state
+// isn't set.
+func (s *State) distill(ctx *core.Context, bucket []data.Value) ([]data.Value, error) {
+	name := s.params.TeacherState
+	if name == "" || len(bucket) == 0 {
+		return bucket, nil
+	}
+	teacher, err := lookupState(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the teacher state '%v': %v", name, err)
+	}
+	if teacher == s {
+		// Predict of the state would wait for the lock held by the caller.
+		return nil, fmt.Errorf("the state cannot be its own teacher")
+	}
+
+	res, err := teacher.predictWithFallback(ctx, data.Array(bucket), "", true, false)
+	if err != nil {
+		return nil, fmt.Errorf("the teacher state '%v' failed: %v", name, err)
+	}
+	outs, err := data.AsArray(res)
+	if err != nil {
+		return nil, fmt.Errorf("the teacher state '%v' must return an array: %v", name, err)
+	}
+	if len(outs) != len(bucket) {
+		return nil, fmt.Errorf("the teacher state '%v' returned %v outputs for %v records",
+			name, len(outs), len(bucket))
+	}
+
+	key := s.params.TeacherOutputKey
+	taught := make([]data.Value, len(bucket))
+	for i, r := range bucket {
+		m, err := data.AsMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("a record must be a map to be taught by the teacher state: %v", err)
+		}
+		c := m.Copy()
+		c[key] = outs[i]
+		taught[i] = c
+	}
+	return taught, nil
+}
@@ -0,0 +1,89 @@
+package pymlstate
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestDistill(t *testing.T) {
+	Convey("Given a student state with a teacher state", t, func() {
+		ctx := core.NewContext(&core.ContextConfig{})
+		teacherFails := false
+		tb := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				if teacherFails {
+					return nil, fmt.Errorf("predict failed")
+				}
+				arr, _ := data.AsArray(dt[0])
+				res := make(data.Array, len(arr))
+				for i := range arr {
+					res[i] = data.Float(0.1 * float64(i+1))
+				}
+				return res, nil
+			},
+		}
+		teacher := &State{base: tb}
+		So(teacher.setUpParams(), ShouldBeNil)
+		So(ctx.SharedStates.Add("teacher", "pymlstate", teacher), ShouldBeNil)
+
+		var fitted data.Value
+		sb := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				fitted = dt[0]
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: sb, params: MLParams{TeacherState: "teacher", TeacherOutputKey: "soft"}}
+		So(s.setUpParams(), ShouldBeNil)
+		bucket := []data.Value{data.Map{"x": data.Int(1)}, data.Map{"x": data.Int(2)}}
+
+		Convey("When a bucket is trained", func() {
+			_, err := s.fit(ctx, bucket)
+
+			Convey("Then outputs of the teacher should be attached to records", func() {
+				So(err, ShouldBeNil)
+				So(tb.calls, ShouldResemble, []string{"predict"})
+				So(fitted, ShouldResemble, data.Array{
+					data.Map{"x": data.Int(1), "soft": data.Float(0.1)},
+					data.Map{"x": data.Int(2), "soft": data.Float(0.2)},
+				})
+			})
+
+			Convey("Then the original records shouldn't be modified", func() {
+				So(bucket[0], ShouldResemble, data.Map{"x": data.Int(1)})
+			})
+		})
+
+		Convey("When the teacher fails", func() {
+			teacherFails = true
+			_, err := s.fit(ctx, bucket)
+
+			Convey("Then training should fail without calling fit", func() {
+				So(err, ShouldNotBeNil)
+				So(sb.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the teacher doesn't exist", func() {
+			s.params.TeacherState = "unknown"
+			_, err := s.fit(ctx, bucket)
+
+			Convey("Then training should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the state is its own teacher", func() {
+			So(ctx.SharedStates.Add("student", "pymlstate", s), ShouldBeNil)
+			s.params.TeacherState = "student"
+			_, err := s.fit(ctx, bucket)
+
+			Convey("Then training should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,333 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// embeddingIndex is an approximate nearest neighbor index of embeddings by
+// random hyperplane LSH for the cosine distance. Each of tables hashes an
+// embedding by signs of its dot products with bits random hyperplanes, and
+// candidates of a query are embeddings sharing a hash with it in any table.
+// The oldest embedding is removed when the index has more than size
+// embeddings. The index isn't saved with the model.
+type embeddingIndex struct {
+	size   int
+	tables int
+	bits   int
+
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	dim     int
+	planes  [][][]float64
+	buckets []map[uint64][]uint64
+	entries map[uint64]*embeddingEntry
+	order   []uint64
+	next    uint64
+}
+
+type embeddingEntry struct {
+	key    data.Value
+	vec    []float64
+	norm   float64
+	hashes []uint64
+}
+
+func newEmbeddingIndex(p *MLParams) *embeddingIndex {
+	x := &embeddingIndex{
+		size:    p.EmbeddingIndexSize,
+		tables:  p.EmbeddingIndexTables,
+		bits:    p.EmbeddingIndexBits,
+		rnd:     newRand(p, "embedding_index"),
+		buckets: make([]map[uint64][]uint64, p.EmbeddingIndexTables),
+		entries: map[uint64]*embeddingEntry{},
+	}
+	for i := range x.buckets {
+		x.buckets[i] = map[uint64][]uint64{}
+	}
+	return x
+}
+
+// hashes returns hashes of the embedding in tables. Hyperplanes are created
+// for the dimension of the first embedding, and embeddings of other
+// dimensions are rejected.
+func (x *embeddingIndex) hashes(vec []float64) ([]uint64, error) {
+	if x.planes == nil {
+		x.dim = len(vec)
+		x.planes = make([][][]float64, x.tables)
+		for t := range x.planes {
+			x.planes[t] = make([][]float64, x.bits)
+			for b := range x.planes[t] {
+				p := make([]float64, x.dim)
+				for i := range p {
+					p[i] = x.rnd.NormFloat64()
+				}
+				x.planes[t][b] = p
+			}
+		}
+	}
+	if len(vec) != x.dim {
+		return nil, fmt.Errorf("an embedding must have %v dimensions: %v", x.dim, len(vec))
+	}
+
+	hs := make([]uint64, x.tables)
+	for t, planes := range x.planes {
+		for b, p := range planes {
+			if dot(p, vec) >= 0 {
+				hs[t] |= 1 << uint(b)
+			}
+		}
+	}
+	return hs, nil
+}
+
+// add adds the embedding identified by the key.
+func (x *embeddingIndex) add(key data.Value, vec []float64) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	hs, err := x.hashes(vec)
+	if err != nil {
+		return err
+	}
+	id := x.next
+	x.next++
+	x.entries[id] = &embeddingEntry{key: key, vec: vec, norm: math.Sqrt(dot(vec, vec)), hashes: hs}
+	x.order = append(x.order, id)
+	for t, h := range hs {
+		x.buckets[t][h] = append(x.buckets[t][h], id)
+	}
+
+	for len(x.order) > x.size {
+		x.remove(x.order[0])
+		x.order = x.order[1:]
+	}
+	return nil
+}
+
+func (x *embeddingIndex) remove(id uint64) {
+	e := x.entries[id]
+	delete(x.entries, id)
+	for t, h := range e.hashes {
+		ids := x.buckets[t][h]
+		for i, v := range ids {
+			if v == id {
+				ids = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(x.buckets[t], h)
+		} else {
+			x.buckets[t][h] = ids
+		}
+	}
+}
+
+// nearest returns at most k candidates nearest to the embedding in
+// ascending order of their cosine distances.
+func (x *embeddingIndex) nearest(vec []float64, k int) (data.Array, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(x.entries) == 0 {
+		return data.Array{}, nil
+	}
+	hs, err := x.hashes(vec)
+	if err != nil {
+		return nil, err
+	}
+
+	type neighbor struct {
+		id       uint64
+		distance float64
+	}
+	norm := math.Sqrt(dot(vec, vec))
+	seen := map[uint64]bool{}
+	var ns []neighbor
+	for t, h := range hs {
+		for _, id := range x.buckets[t][h] {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			e := x.entries[id]
+			d := 1.0
+			if norm > 0 && e.norm > 0 {
+				d = 1 - dot(vec, e.vec)/(norm*e.norm)
+			}
+			ns = append(ns, neighbor{id, d})
+		}
+	}
+	sort.Slice(ns, func(i, j int) bool {
+		if ns[i].distance != ns[j].distance {
+			return ns[i].distance < ns[j].distance
+		}
+		return ns[i].id > ns[j].id // newer embeddings first
+	})
+	if len(ns) > k {
+		ns = ns[:k]
+	}
+
+	res := make(data.Array, len(ns))
+	for i, n := range ns {
+		res[i] = data.Map{
+			"key":      x.entries[n.id].key,
+			"distance": data.Float(n.distance),
+		}
+	}
+	return res, nil
+}
+
+func (x *embeddingIndex) len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.entries)
+}
+
+func dot(a, b []float64) float64 {
+	s := 0.0
+	for i, v := range a {
+		s += v * b[i]
+	}
+	return s
+}
+
+// asVector converts an embedding returned by "embed" to a vector.
+func asVector(v data.Value) ([]float64, error) {
+	arr, err := data.AsArray(v)
+	if err != nil {
+		return nil, fmt.Errorf("an embedding must be an array of numbers: %v", err)
+	}
+	vec := make([]float64, len(arr))
+	for i, e := range arr {
+		if vec[i], err = asNumber(e); err != nil {
+			return nil, fmt.Errorf("an embedding must be an array of numbers: %v", err)
+		}
+	}
+	return vec, nil
+}
+
+// embedded is an embedding computed by embed.
+type embedded struct {
+	vec []float64
+	// key is the key of the record in the index.
+	key   data.Value
+	index *embeddingIndex
+}
+
+// embed calls "embed" of the model with the preprocessed data. The index is
+// nil when the state doesn't have it.
+func (s *State) embed(ctx *core.Context, dt data.Value) (*embedded, error) {
+	called := time.Now()
+	if err := s.authorize(ctx, ActionPredict); err != nil {
+		return nil, err
+	}
+	s.lockForPredict(called)
+	defer s.rwm.RUnlock()
+	if err := s.predictLimiter.checkRate("predicts"); err != nil {
+		return nil, err
+	}
+	in, err := s.redact(dt)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.preprocess(in, preprocessInspect, nil)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errDropRecord
+	}
+	res, err := s.callPython(callPredict, "embed", v)
+	if err != nil {
+		return nil, err
+	}
+	vec, err := asVector(res)
+	if err != nil {
+		return nil, err
+	}
+	return &embedded{vec: vec, key: s.embeddingKeyOf(in), index: s.embeddingIndex}, nil
+}
+
+// Embed returns the embedding of the record computed by "embed" of the
+// model, which returns an array of numbers. The record is redacted and
+// preprocessed in the same way as Predict. When embedding_index_size is
+// set, the embedding is added to the nearest neighbor index with the value
+// at embedding_key_path of the record, or the redacted record when the path
+// isn't set.
+func (s *State) Embed(ctx *core.Context, dt data.Value) (data.Value, error) {
+	e, err := s.embed(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+	if e.index != nil {
+		if err := e.index.add(e.key, e.vec); err != nil {
+			return nil, err
+		}
+	}
+	res := make(data.Array, len(e.vec))
+	for i, f := range e.vec {
+		res[i] = data.Float(f)
+	}
+	return res, nil
+}
+
+// embeddingKeyOf returns the key of the redacted record in the index.
+func (s *State) embeddingKeyOf(in data.Value) data.Value {
+	if s.embeddingKeyPath == nil {
+		return in
+	}
+	m, err := data.AsMap(in)
+	if err != nil {
+		return in
+	}
+	v, err := m.Get(s.embeddingKeyPath)
+	if err != nil {
+		return data.Null{}
+	}
+	return v
+}
+
+// NearestNeighbors returns at most k embeddings in the index nearest to the
+// embedding of the record as an array of maps having "key" and "distance",
+// which is the cosine distance, in ascending order of distances. The
+// embedding of the record isn't added to the index.
+func (s *State) NearestNeighbors(ctx *core.Context, dt data.Value, k int) (data.Value, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("k must be greater than 0")
+	}
+	e, err := s.embed(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+	if e.index == nil {
+		return nil, fmt.Errorf("the state doesn't have an embedding index")
+	}
+	return e.index.nearest(e.vec, k)
+}
+
+// Embed returns the embedding of the data by the model of the state. See
+// State.Embed for details.
+func Embed(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.Embed(ctx, dt)
+}
+
+// NearestNeighbors returns at most k embeddings nearest to the embedding of
+// the data in the index of the state. See State.NearestNeighbors for
+// details.
+func NearestNeighbors(ctx *core.Context, stateName string, dt data.Value, k int) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.NearestNeighbors(ctx, dt, k)
+}
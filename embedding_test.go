@@ -0,0 +1,115 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestEmbeddingIndex(t *testing.T) {
+	Convey("Given an embedding index of size 3", t, func() {
+		seed := int64(1)
+		x := newEmbeddingIndex(&MLParams{EmbeddingIndexSize: 3, EmbeddingIndexTables: 4,
+			EmbeddingIndexBits: 2, RandomSeed: &seed})
+
+		Convey("When embeddings are added", func() {
+			So(x.add(data.String("a"), []float64{1, 0}), ShouldBeNil)
+			So(x.add(data.String("b"), []float64{0.9, 0.1}), ShouldBeNil)
+			So(x.add(data.String("c"), []float64{-1, 0}), ShouldBeNil)
+
+			Convey("Then the nearest one should be found first", func() {
+				res, err := x.nearest([]float64{1, 0.01}, 1)
+				So(err, ShouldBeNil)
+				So(len(res), ShouldEqual, 1)
+				m, _ := data.AsMap(res[0])
+				So(m["key"], ShouldEqual, data.String("a"))
+			})
+
+			Convey("Then the oldest one should be removed when the index is full", func() {
+				So(x.add(data.String("d"), []float64{0, 1}), ShouldBeNil)
+				So(x.len(), ShouldEqual, 3)
+				for _, m := range x.entries {
+					So(m.key, ShouldNotEqual, data.String("a"))
+				}
+				for _, b := range x.buckets {
+					n := 0
+					for _, ids := range b {
+						n += len(ids)
+					}
+					So(n, ShouldEqual, 3)
+				}
+			})
+
+			Convey("Then an embedding of a different dimension should be rejected", func() {
+				So(x.add(data.String("e"), []float64{1, 2, 3}), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestEmbed(t *testing.T) {
+	Convey("Given a state with an embedding index", t, func() {
+		ctx := core.NewContext(nil)
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				m, _ := data.AsMap(dt[0])
+				return data.Array{m["x"], data.Float(1)}, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{EmbeddingIndexSize: 10, EmbeddingIndexTables: 8,
+			EmbeddingIndexBits: 1, EmbeddingKeyPath: "id"}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When records are embedded", func() {
+			e, err := s.Embed(ctx, data.Map{"id": data.String("a"), "x": data.Float(1)})
+			So(err, ShouldBeNil)
+			_, err = s.Embed(ctx, data.Map{"id": data.String("b"), "x": data.Int(2)})
+			So(err, ShouldBeNil)
+
+			Convey("Then embeddings should be returned", func() {
+				So(e, ShouldResemble, data.Array{data.Float(1), data.Float(1)})
+				So(b.calls, ShouldResemble, []string{"embed", "embed"})
+				So(s.Status()["indexed_embeddings"], ShouldEqual, data.Int(2))
+			})
+
+			Convey("Then nearest neighbors should be returned by their keys", func() {
+				res, err := s.NearestNeighbors(ctx, data.Map{"id": data.String("q"), "x": data.Float(1.1)}, 2)
+				So(err, ShouldBeNil)
+				So(len(res.(data.Array)), ShouldEqual, 2)
+				m, _ := data.AsMap(res.(data.Array)[0])
+				So(m["key"], ShouldEqual, data.String("a"))
+				So(s.embeddingIndex.len(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When embed doesn't return numbers", func() {
+			b.call = func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.String("x"), nil
+			}
+			_, err := s.Embed(ctx, data.Map{"x": data.Int(1)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state without an embedding index", t, func() {
+		ctx := core.NewContext(nil)
+		s := &State{base: &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.Array{data.Float(1)}, nil
+			},
+		}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When nearest neighbors are searched", func() {
+			_, err := s.NearestNeighbors(ctx, data.Map{}, 1)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,73 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/py.v0"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// sitePackagesDirs returns site-packages directories of the Python
+// environment and extra directories given by MLParams. A virtualenv or conda
+// environment has its site-packages at lib/pythonX.Y/site-packages.
+func sitePackagesDirs(p *MLParams) ([]string, error) {
+	var dirs []string
+	if p.PythonEnv != "" {
+		if fi, err := os.Stat(p.PythonEnv); err != nil {
+			return nil, fmt.Errorf("python_env '%v' isn't available: %v", p.PythonEnv, err)
+		} else if !fi.IsDir() {
+			return nil, fmt.Errorf("python_env '%v' isn't a directory", p.PythonEnv)
+		}
+
+		found, err := filepath.Glob(filepath.Join(p.PythonEnv, "lib", "python*", "site-packages"))
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("python_env '%v' doesn't have site-packages", p.PythonEnv)
+		}
+		sort.Strings(found)
+		dirs = append(dirs, found...)
+	}
+	return append(dirs, p.SitePackages...), nil
+}
+
+// setUpPythonEnv adds site-packages directories of the state to sys.path. It
+// must be called before the Python instance is created or loaded so that
+// the module can import packages in the environment. It does nothing when
+// isolation is "process" because the directories are only added to sys.path
+// of the process, and adding them to the embedded interpreter would leak
+// them to other states.
+func setUpPythonEnv(p *MLParams) error {
+	if p.Isolation == "process" {
+		return nil
+	}
+	dirs, err := sitePackagesDirs(p)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+	return py.ImportSysAndAppendPath(dirs...)
+}
+
+// evalPython evaluates the Python expression in the embedded interpreter.
+func evalPython(expr string) (data.Value, error) {
+	var (
+		builtins py.ObjectModule
+		err      error
+	)
+	for _, n := range []string{"builtins", "__builtin__"} { // Python 3 and 2
+		if builtins, err = py.LoadModule(n); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the builtin module: %v", err)
+	}
+	defer builtins.Release()
+	return builtins.Call("eval", data.String(expr))
+}
@@ -0,0 +1,58 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSitePackagesDirs(t *testing.T) {
+	Convey("Given a virtualenv directory", t, func() {
+		root, err := ioutil.TempDir("", "pymlstate_env")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(root)
+		})
+		sp := filepath.Join(root, "lib", "python2.7", "site-packages")
+		So(os.MkdirAll(sp, 0755), ShouldBeNil)
+
+		Convey("When site-packages directories are resolved", func() {
+			dirs, err := sitePackagesDirs(&MLParams{
+				PythonEnv:    root,
+				SitePackages: []string{"/opt/extra"},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then they should have the environment's site-packages", func() {
+				So(dirs, ShouldResemble, []string{sp, "/opt/extra"})
+			})
+		})
+
+		Convey("When the environment doesn't have site-packages", func() {
+			So(os.RemoveAll(filepath.Join(root, "lib")), ShouldBeNil)
+			_, err := sitePackagesDirs(&MLParams{PythonEnv: root})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a missing environment", t, func() {
+		_, err := sitePackagesDirs(&MLParams{PythonEnv: "/no/such/env"})
+
+		Convey("Then resolving site-packages should fail", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an environment of a state running in a process", t, func() {
+		p := &MLParams{Isolation: "process", PythonEnv: "/no/such/env"}
+
+		Convey("Then it shouldn't be set up in the embedded interpreter", func() {
+			So(setUpPythonEnv(p), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,198 @@
+package pymlstate
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// Since the format version 3, a saved state is an envelope of sections
+// following the format version. Each section has a tag, which is a string
+// prefixed by its length in a byte, the size of its value in uint32, and its
+// value in msgpack. The "model" section is always the last one, and the
+// Python model follows it until the end of the data because its size isn't
+// known in advance. Sections having unknown tags are skipped so that a new
+// subsystem can persist its data by adding a section without bumping the
+// format version.
+const (
+	paramsSectionTag   = "params"
+	metadataSectionTag = "metadata"
+	modelSectionTag    = "model"
+)
+
+// stateMetadata is the metadata section.
+type stateMetadata struct {
+	Base         *pystate.BaseParams `codec:"base"`
+	ModelVersion string              `codec:"model_version"`
+}
+
+// extraSection is a field of stateData saved as an optional section.
+type extraSection struct {
+	// v is the pointer to the field.
+	v interface{}
+
+	// empty is true when the field is empty and isn't saved.
+	empty bool
+}
+
+// extraSections returns fields of stateData saved as optional sections by
+// their tags.
+func (sd *stateData) extraSections() map[string]extraSection {
+	return map[string]extraSection{
+		"create_params": {&sd.CreateParams, len(sd.CreateParams) == 0},
+		"clipper":       {&sd.Clipper, len(sd.Clipper) == 0},
+		"imputer":       {&sd.Imputer, len(sd.Imputer) == 0},
+		"normalizer":    {&sd.Normalizer, len(sd.Normalizer) == 0},
+		"skew":          {&sd.Skew, len(sd.Skew) == 0},
+		"vocabulary":    {&sd.Vocabulary, len(sd.Vocabulary) == 0},
+		"tokens":        {&sd.Tokens, len(sd.Tokens) == 0},
+		"replay":        {&sd.Replay, len(sd.Replay) == 0},
+		"validation":    {&sd.Validation, len(sd.Validation) == 0},
+		"trained_keys":  {&sd.TrainedKeys, len(sd.TrainedKeys) == 0},
+		"privacy_spent": {&sd.PrivacySpent, sd.PrivacySpent == 0},
+	}
+}
+
+// writeEnvelope writes the format version and sections of MLParams and
+// stateData. The Python model must be written after it.
+func writeEnvelope(w io.Writer, p *MLParams, sd *stateData) error {
+	if _, err := w.Write([]byte{pyMLStateFormatVersion}); err != nil {
+		return err
+	}
+	return writeSections(w, p, sd)
+}
+
+// writeSections writes sections of the envelope without the format version.
+func writeSections(w io.Writer, p *MLParams, sd *stateData) error {
+	if err := writeSection(w, paramsSectionTag, p); err != nil {
+		return err
+	}
+	md := &stateMetadata{Base: sd.Base, ModelVersion: sd.ModelVersion}
+	if err := writeSection(w, metadataSectionTag, md); err != nil {
+		return err
+	}
+
+	extras := sd.extraSections()
+	tags := make([]string, 0, len(extras))
+	for t := range extras {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	for _, t := range tags {
+		if extras[t].empty {
+			continue
+		}
+		if err := writeSection(w, t, extras[t].v); err != nil {
+			return err
+		}
+	}
+	return writeSectionHeader(w, modelSectionTag, 0)
+}
+
+// readEnvelope reads sections written by writeEnvelope until the model
+// section.
+func readEnvelope(r io.Reader) (*MLParams, *stateData, error) {
+	var (
+		saved     MLParams
+		sd        stateData
+		hasParams bool
+	)
+	extras := sd.extraSections()
+	for {
+		tag, size, err := readSectionHeader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		var v interface{}
+		switch tag {
+		case modelSectionTag:
+			if !hasParams {
+				return nil, nil, fmt.Errorf("the saved state doesn't have the params section")
+			}
+			return &saved, &sd, nil
+		case paramsSectionTag:
+			v = &saved
+			hasParams = true
+		case metadataSectionTag:
+			md := &stateMetadata{}
+			if err := readSectionValue(r, size, md, tag); err != nil {
+				return nil, nil, err
+			}
+			sd.Base, sd.ModelVersion = md.Base, md.ModelVersion
+			continue
+		default:
+			if v = extras[tag].v; v == nil {
+				// The section is written by a newer version.
+				if _, err := io.CopyN(ioutil.Discard, r, int64(size)); err != nil {
+					return nil, nil, fmt.Errorf("cannot skip the section '%v': %v", tag, err)
+				}
+				continue
+			}
+		}
+		if err := readSectionValue(r, size, v, tag); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func writeSectionHeader(w io.Writer, tag string, size uint32) error {
+	if len(tag) == 0 || len(tag) > 255 {
+		return fmt.Errorf("invalid section tag: '%v'", tag)
+	}
+	header := make([]byte, 0, 1+len(tag)+4)
+	header = append(header, byte(len(tag)))
+	header = append(header, tag...)
+	header = append(header, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(header[len(header)-4:], size)
+	_, err := w.Write(header)
+	return err
+}
+
+// writeSection writes v in msgpack as the section of the tag.
+func writeSection(w io.Writer, tag string, v interface{}) error {
+	var out []byte
+	enc := codec.NewEncoderBytes(&out, &codec.MsgpackHandle{})
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("cannot encode the section '%v': %v", tag, err)
+	}
+	if err := writeSectionHeader(w, tag, uint32(len(out))); err != nil {
+		return err
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+func readSectionHeader(r io.Reader) (string, uint32, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", 0, fmt.Errorf("cannot read a section: %v", err)
+	}
+	if n[0] == 0 {
+		return "", 0, fmt.Errorf("a section must have a tag")
+	}
+	tag := make([]byte, n[0])
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return "", 0, fmt.Errorf("cannot read a section: %v", err)
+	}
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return "", 0, fmt.Errorf("cannot read the section '%s': %v", tag, err)
+	}
+	return string(tag), size, nil
+}
+
+func readSectionValue(r io.Reader, size uint32, v interface{}, tag string) error {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return fmt.Errorf("cannot read the section '%v': %v", tag, err)
+	}
+	dec := codec.NewDecoderBytes(buf, &codec.MsgpackHandle{})
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("cannot decode the section '%v': %v", tag, err)
+	}
+	return nil
+}
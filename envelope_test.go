@@ -0,0 +1,78 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	Convey("Given a saved envelope", t, func() {
+		p := &MLParams{BatchSize: 3, Description: "test"}
+		sd := &stateData{
+			Base:         &pystate.BaseParams{ModuleName: "m", ClassName: "C"},
+			ModelVersion: "model:1",
+			Vocabulary:   map[string]map[string]int64{"word": {"a": 1}},
+			TrainedKeys:  []string{"k1"},
+			PrivacySpent: 0.5,
+		}
+		buf := bytes.NewBuffer(nil)
+		So(writeEnvelope(buf, p, sd), ShouldBeNil)
+		buf.WriteString("python model")
+
+		Convey("When it's read", func() {
+			saved, rsd, r, err := readStateHeader(buf)
+
+			Convey("Then it should have params and state data", func() {
+				So(err, ShouldBeNil)
+				So(saved.BatchSize, ShouldEqual, 3)
+				So(saved.Description, ShouldEqual, "test")
+				So(rsd.Base.ClassName, ShouldEqual, "C")
+				So(rsd.ModelVersion, ShouldEqual, "model:1")
+				So(rsd.Vocabulary, ShouldResemble, sd.Vocabulary)
+				So(rsd.TrainedKeys, ShouldResemble, []string{"k1"})
+				So(rsd.PrivacySpent, ShouldEqual, 0.5)
+				So(rsd.Normalizer, ShouldBeNil)
+			})
+
+			Convey("Then the Python model should follow it", func() {
+				So(err, ShouldBeNil)
+				rest, err := ioutil.ReadAll(r)
+				So(err, ShouldBeNil)
+				So(string(rest), ShouldEqual, "python model")
+			})
+		})
+	})
+
+	Convey("Given an envelope having a section of a newer version", t, func() {
+		buf := bytes.NewBuffer([]byte{pyMLStateFormatVersion})
+		So(writeSection(buf, paramsSectionTag, &MLParams{BatchSize: 2}), ShouldBeNil)
+		So(writeSection(buf, "future", map[string]int{"x": 1}), ShouldBeNil)
+		So(writeSectionHeader(buf, modelSectionTag, 0), ShouldBeNil)
+
+		Convey("When it's read", func() {
+			saved, _, _, err := readStateHeader(buf)
+
+			Convey("Then the unknown section should be skipped", func() {
+				So(err, ShouldBeNil)
+				So(saved.BatchSize, ShouldEqual, 2)
+				So(buf.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given an envelope without the params section", t, func() {
+		buf := bytes.NewBuffer([]byte{pyMLStateFormatVersion})
+		So(writeSectionHeader(buf, modelSectionTag, 0), ShouldBeNil)
+
+		Convey("When it's read", func() {
+			_, _, _, err := readStateHeader(buf)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,238 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// metricPoint is a metric computed at a time.
+type metricPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// metricHistory keeps the latest size metrics.
+type metricHistory struct {
+	size int
+
+	mu     sync.Mutex
+	points []metricPoint
+}
+
+func newMetricHistory(size int) *metricHistory {
+	return &metricHistory{size: size}
+}
+
+func (h *metricHistory) add(p metricPoint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.points = append(h.points, p)
+	if len(h.points) > h.size {
+		h.points = append(h.points[:0], h.points[len(h.points)-h.size:]...)
+	}
+}
+
+// toArray returns metrics from the oldest one. The value of a metric is null
+// when the model violates constraints of the objective.
+func (h *metricHistory) toArray() data.Array {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := make(data.Array, len(h.points))
+	for i, p := range h.points {
+		// The metric of a model violating constraints of the objective is
+		// negative infinity.
+		var v data.Value = data.Null{}
+		if !math.IsInf(p.Value, -1) {
+			v = data.Float(p.Value)
+		}
+		res[i] = data.Map{
+			"time":  data.Timestamp(p.Time),
+			"value": v,
+		}
+	}
+	return res
+}
+
+// readDataset reads all records of the dataset at the URI.
+func readDataset(uri string) (data.Array, error) {
+	format, err := datasetFormatOf(uri)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openURI(uri, &http.Client{Timeout: time.Hour})
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dr, err := newDatasetReader(f, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var recs data.Array
+	for {
+		m, err := dr.read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read the dataset '%v': %v", uri, err)
+		}
+		recs = append(recs, m)
+	}
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("the dataset '%v' doesn't have any record", uri)
+	}
+	return recs, nil
+}
+
+// evaluateWith computes metrics of the current model and the shadow model
+// with the dataset at the URI and records them to evaluation histories. The
+// validation set is used when the URI is empty. The shadow model and its
+// metric are nil when the state doesn't have it.
+func (s *State) evaluateWith(uri, method string) (float64, Backend, float64, error) {
+	evaluate := s.evaluateModel
+	var recs data.Array
+	if uri != "" {
+		rs, err := readDataset(uri)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		recs = rs
+	}
+
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return 0, nil, 0, err
+	}
+	if uri == "" {
+		if s.validation == nil {
+			return 0, nil, 0, fmt.Errorf("the state doesn't have a validation set")
+		}
+		if recs = s.validation.records(); len(recs) == 0 {
+			return 0, nil, 0, fmt.Errorf("the validation set doesn't have any record")
+		}
+		evaluate = func(b Backend, method string, recs data.Array) (float64, error) {
+			return s.evaluateRedacted(b, method, recs)
+		}
+	}
+	now := time.Now()
+	m, err := evaluate(s.base, method, recs)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if s.evalHistory != nil {
+		s.evalHistory.add(metricPoint{Time: now, Value: m})
+	}
+	if s.shadow == nil {
+		return m, nil, 0, nil
+	}
+
+	sm, err := evaluate(s.shadow, method, recs)
+	if err != nil {
+		return m, nil, 0, fmt.Errorf("cannot evaluate the shadow model: %v", err)
+	}
+	s.shadowHistory.add(metricPoint{Time: now, Value: sm})
+	return m, s.shadow, sm, nil
+}
+
+// evaluator evaluates the model of a state periodically until stop is
+// closed.
+type evaluator struct {
+	stop chan struct{}
+}
+
+// scheduleEvaluation stops the current evaluator and starts a new one when
+// the state has eval_data or validation_fraction, and eval_interval. The
+// validation set is used when eval_data isn't set. It must be called while the
+// write lock is acquired. Metrics are recorded to the evaluation history.
+// When promote_after is set, the shadow model is promoted after its metric
+// has been better than the one of the current model by promote_margin for
+// promote_after. When retrain_below_metric is set, the model is retrained
+// from scratch after its metric has been below it for retrain_below_for.
+func (s *State) scheduleEvaluation(ctx *core.Context) {
+	if s.evaluator != nil {
+		close(s.evaluator.stop)
+		s.evaluator = nil
+	}
+	if (s.params.EvalData == "" && s.validation == nil) || s.params.EvalInterval <= 0 {
+		return
+	}
+	if s.evalHistory == nil || s.evalHistory.size != s.params.EvalHistorySize {
+		s.evalHistory = newMetricHistory(s.params.EvalHistorySize)
+	}
+
+	e := &evaluator{stop: make(chan struct{})}
+	s.evaluator = e
+	uri := s.params.EvalData
+	source := uri
+	if source == "" {
+		source = "validation set"
+	}
+	method := s.params.EvalMethod
+	interval := s.params.EvalInterval
+	margin := s.params.PromoteMargin
+	after := s.params.PromoteAfter
+	drop := &metricDropPolicy{
+		threshold: s.params.RetrainBelowMetric,
+		period:    s.params.RetrainBelowFor,
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		// winningSince is when the shadow model started to beat the
+		// current model.
+		var (
+			winner       Backend
+			winningSince time.Time
+		)
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-t.C:
+			}
+
+			m, shadow, sm, err := s.evaluateWith(uri, method)
+			if err != nil {
+				ctx.ErrLog(err).WithField("uri", source).
+					Error("pymlstate's scheduled evaluation failed")
+				continue
+			}
+			l := ctx.Log().WithField("uri", source).WithField("metric", m)
+			if shadow != nil {
+				l = l.WithField("shadow_metric", sm)
+			}
+			l.Info("pymlstate evaluated the model")
+
+			if drop.observe(time.Now(), m) {
+				s.retrainOnMetricDrop(ctx, m, drop.threshold, e.stop)
+				winner = nil
+				continue
+			}
+
+			if after <= 0 || shadow == nil || sm <= m+margin {
+				winner = nil
+				continue
+			}
+			now := time.Now()
+			if winner != shadow {
+				winner, winningSince = shadow, now
+			}
+			if now.Sub(winningSince) < after {
+				continue
+			}
+			if err := s.promoteShadow(ctx, shadow); err != nil {
+				ctx.ErrLog(err).Error("pymlstate cannot promote the shadow model")
+			}
+			winner = nil
+		}
+	}()
+}
@@ -0,0 +1,63 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMetricHistory(t *testing.T) {
+	Convey("Given a metric history of size 2", t, func() {
+		h := newMetricHistory(2)
+		now := time.Now()
+
+		Convey("When 3 metrics are added", func() {
+			for i := 0; i < 3; i++ {
+				h.add(metricPoint{Time: now, Value: float64(i)})
+			}
+
+			Convey("Then it should keep the latest 2 metrics", func() {
+				arr := h.toArray()
+				So(len(arr), ShouldEqual, 2)
+				m0, _ := data.AsMap(arr[0])
+				m1, _ := data.AsMap(arr[1])
+				So(m0["value"], ShouldEqual, data.Float(1))
+				So(m1["value"], ShouldEqual, data.Float(2))
+			})
+		})
+	})
+}
+
+func TestReadDataset(t *testing.T) {
+	Convey("Given a CSV reference dataset", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_eval")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "ref.csv")
+		So(ioutil.WriteFile(path, []byte("x,label\n1,a\n2,b\n"), 0644), ShouldBeNil)
+
+		Convey("When it's read", func() {
+			recs, err := readDataset(path)
+
+			Convey("Then all records should be returned", func() {
+				So(err, ShouldBeNil)
+				So(len(recs), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When an empty dataset is read", func() {
+			So(ioutil.WriteFile(path, []byte("x,label\n"), 0644), ShouldBeNil)
+			_, err := readDataset(path)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,134 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// EventType is a type of an event of a state.
+type EventType string
+
+const (
+	// EventBatchTrained is emitted when a batch is trained. Event.Fit has the
+	// result.
+	EventBatchTrained EventType = "batch_trained"
+
+	// EventFitFailed is emitted when training of a batch fails. Event.Err has
+	// the error.
+	EventFitFailed EventType = "fit_failed"
+
+	// EventCheckpointWritten is emitted when the state is saved.
+	EventCheckpointWritten EventType = "checkpoint_written"
+
+	// EventModelLoaded is emitted when a model is loaded or reloaded.
+	EventModelLoaded EventType = "model_loaded"
+
+	// EventModelPromoted is emitted when the shadow model is promoted to the
+	// current model.
+	EventModelPromoted EventType = "model_promoted"
+
+	// EventModelRetrained is emitted when the model is replaced with a new
+	// instance retrained from scratch because its metric dropped below
+	// retrain_below_metric. Event.Details has "model_version" and
+	// "previous_model_version".
+	EventModelRetrained EventType = "model_retrained"
+
+	// EventDriftDetected is emitted when a drift of features or predictions
+	// is detected. Event.Details describes the drift.
+	EventDriftDetected EventType = "drift_detected"
+
+	// EventAlert is emitted when an alert of alert_loss or alert_error_rate
+	// starts firing. Event.Details has "rule", "value", and "threshold".
+	EventAlert EventType = "alert"
+
+	// EventAlertResolved is emitted when a firing alert stops. Event.Details
+	// is the same as EventAlert.
+	EventAlertResolved EventType = "alert_resolved"
+
+	// EventCircuitOpened is emitted when the circuit breaker opens and
+	// predictions start failing fast.
+	EventCircuitOpened EventType = "circuit_opened"
+
+	// EventCircuitClosed is emitted when the circuit breaker closes after a
+	// successful call in the half-open state.
+	EventCircuitClosed EventType = "circuit_closed"
+
+	// EventStateDisabled is emitted when the state is disabled because
+	// consecutive failures of its model have reached failure_budget.
+	// Event.Err has the last error and Event.Details has "failures".
+	EventStateDisabled EventType = "state_disabled"
+
+	// EventStateEnabled is emitted when a disabled state is enabled by
+	// Enable.
+	EventStateEnabled EventType = "state_enabled"
+
+	// EventTrainingSampled is emitted when records of a batch are sampled by
+	// training_sample_size. Event.Details has "method", "batch_size", and
+	// "records", which are preprocessed records passed to the model.
+	EventTrainingSampled EventType = "training_sampled"
+)
+
+// Event is an event of a state passed to hooks registered by OnEvent.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Fit is the result of training of EventBatchTrained.
+	Fit *FitResult
+
+	// Err is the error of EventFitFailed.
+	Err error
+
+	// Details has additional information of the event.
+	Details data.Map
+}
+
+// eventHooks is a list of hooks. It has its own lock so that hooks can be
+// registered while the state is locked.
+type eventHooks struct {
+	mu    sync.RWMutex
+	hooks []func(Event)
+}
+
+func (h *eventHooks) add(hook func(Event)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hook)
+}
+
+func (h *eventHooks) emit(e Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.hooks) == 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, hook := range h.hooks {
+		hook(e)
+	}
+}
+
+// OnEvent registers a hook called on events of the state. Hooks are called
+// synchronously, sometimes while the state is locked, so they must return
+// quickly and must not call methods of the state.
+func (s *State) OnEvent(hook func(Event)) {
+	s.hooks.add(hook)
+}
+
+// emitFit emits EventBatchTrained or EventFitFailed and records the result
+// to rolling metrics. Events of alerts are also emitted.
+func (s *State) emitFit(res *FitResult, err error) {
+	now := time.Now()
+	s.metrics.observeFit(now, res, err)
+	if err != nil {
+		s.hooks.emit(Event{Type: EventFitFailed, Err: err})
+		s.checkAlerts(now, nil)
+		return
+	}
+	s.readiness.trained()
+	s.hooks.emit(Event{Type: EventBatchTrained, Fit: res})
+	s.checkAlerts(now, res)
+}
@@ -0,0 +1,52 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEventHooks(t *testing.T) {
+	Convey("Given a state with a hook", t, func() {
+		s := &State{}
+		var events []Event
+		s.OnEvent(func(e Event) {
+			events = append(events, e)
+		})
+
+		Convey("When a fit result is emitted", func() {
+			s.emitFit(&FitResult{SamplesSeen: 3}, nil)
+
+			Convey("Then the hook should receive batch_trained", func() {
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Type, ShouldEqual, EventBatchTrained)
+				So(events[0].Fit.SamplesSeen, ShouldEqual, 3)
+				So(events[0].Time.IsZero(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a fit error is emitted", func() {
+			err := errors.New("fit failed")
+			s.emitFit(nil, err)
+
+			Convey("Then the hook should receive fit_failed", func() {
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Type, ShouldEqual, EventFitFailed)
+				So(events[0].Err, ShouldEqual, err)
+			})
+		})
+
+		Convey("When another hook is registered", func() {
+			n := 0
+			s.OnEvent(func(e Event) {
+				n++
+			})
+			s.hooks.emit(Event{Type: EventModelLoaded})
+
+			Convey("Then all hooks should be called", func() {
+				So(len(events), ShouldEqual, 1)
+				So(n, ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,113 @@
+package pymlstate
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// errDisabled is returned by calls to the model of a disabled state.
+var errDisabled = errors.New("the state is disabled after consecutive failures of its model until it's enabled")
+
+// failureBudget counts consecutive failures of calls to the model. It has
+// its own lock because the model is called concurrently by predictions.
+type failureBudget struct {
+	mu          sync.Mutex
+	budget      int
+	consecutive int
+	// prev is the phase before the state was disabled.
+	prev Phase
+}
+
+func (f *failureBudget) setBudget(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.budget = n
+}
+
+// observe records the result of a call and returns true when the state must
+// be disabled.
+func (f *failureBudget) observe(err error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		f.consecutive = 0
+		return false
+	}
+	f.consecutive++
+	return f.budget > 0 && f.consecutive == f.budget
+}
+
+func (f *failureBudget) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.consecutive = 0
+}
+
+func (f *failureBudget) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.consecutive
+}
+
+// observeCall records the result of a call to the model and disables the
+// state when consecutive failures reach failure_budget.
+func (s *State) observeCall(err error) {
+	if err == errDisabled || !s.failures.observe(err) {
+		return
+	}
+	s.readiness.mu.Lock()
+	p := s.readiness.phase
+	if p == PhaseDisabled || p == PhaseDraining {
+		s.readiness.mu.Unlock()
+		return
+	}
+	s.failures.mu.Lock()
+	s.failures.prev = p
+	n := s.failures.consecutive
+	s.failures.mu.Unlock()
+	s.readiness.setLocked(PhaseDisabled)
+	s.readiness.mu.Unlock()
+
+	s.hooks.emit(Event{Type: EventStateDisabled, Time: time.Now(), Err: err, Details: data.Map{
+		"failures": data.Int(n),
+	}})
+}
+
+// Enable enables the state disabled after consecutive failures of its model
+// so that it calls the model again. It should be called after the cause of
+// the failures, such as broken input or an external dependency of the model,
+// is fixed. Loading a model also enables the state.
+func (s *State) Enable(ctx *core.Context) error {
+	if err := s.authorize(ctx, ActionLoad); err != nil {
+		return err
+	}
+	s.readiness.mu.Lock()
+	if s.readiness.phase != PhaseDisabled {
+		s.readiness.mu.Unlock()
+		return fmt.Errorf("the state isn't disabled: %v", s.readiness.phase)
+	}
+	s.failures.mu.Lock()
+	prev := s.failures.prev
+	s.failures.consecutive = 0
+	s.failures.mu.Unlock()
+	s.readiness.setLocked(prev)
+	s.readiness.mu.Unlock()
+
+	ctx.Log().WithField("phase", prev).Info("pymlstate enabled the state")
+	s.hooks.emit(Event{Type: EventStateEnabled, Time: time.Now()})
+	return nil
+}
+
+// Enable enables the state disabled after consecutive failures of its
+// model. A return value is always nil.
+func Enable(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.Enable(ctx)
+}
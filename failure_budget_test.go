@@ -0,0 +1,86 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestFailureBudget(t *testing.T) {
+	Convey("Given a state having a failure budget", t, func() {
+		ctx := core.NewContext(nil)
+		failing := true
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				if failing {
+					return nil, errors.New("broken")
+				}
+				return data.String("label"), nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1, FailureBudget: 2}}
+		So(s.setUpParams(), ShouldBeNil)
+		s.readiness.set(PhaseServing)
+		var events []Event
+		s.OnEvent(func(e Event) {
+			events = append(events, e)
+		})
+
+		Convey("When the model fails less than the budget", func() {
+			_, err := s.Predict(ctx, data.Map{})
+			So(err, ShouldNotBeNil)
+			failing = false
+			_, err = s.Predict(ctx, data.Map{})
+			So(err, ShouldBeNil)
+			failing = true
+			_, err = s.Predict(ctx, data.Map{})
+			So(err, ShouldNotBeNil)
+
+			Convey("Then the state shouldn't be disabled", func() {
+				So(s.readiness.get(), ShouldEqual, PhaseServing)
+				So(s.Status()["consecutive_failures"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When the model fails consecutively", func() {
+			for i := 0; i < 2; i++ {
+				_, err := s.Predict(ctx, data.Map{})
+				So(err, ShouldNotBeNil)
+			}
+			n := len(b.calls)
+			_, err := s.Predict(ctx, data.Map{})
+
+			Convey("Then the state should be disabled without calling the model", func() {
+				So(err, ShouldEqual, errDisabled)
+				So(len(b.calls), ShouldEqual, n)
+				So(s.Status()["phase"], ShouldEqual, data.String(PhaseDisabled))
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Type, ShouldEqual, EventStateDisabled)
+				So(events[0].Details["failures"], ShouldEqual, data.Int(2))
+			})
+
+			Convey("And it's enabled", func() {
+				failing = false
+				So(s.Enable(ctx), ShouldBeNil)
+				res, err := s.Predict(ctx, data.Map{})
+
+				Convey("Then the model should be called again", func() {
+					So(err, ShouldBeNil)
+					So(res, ShouldEqual, data.String("label"))
+					So(s.readiness.get(), ShouldEqual, PhaseServing)
+					So(events[len(events)-1].Type, ShouldEqual, EventStateEnabled)
+				})
+			})
+		})
+
+		Convey("When a state which isn't disabled is enabled", func() {
+			err := s.Enable(ctx)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// predictFallback answers predictions while the model of the state is
+// unavailable by another state or a constant value. It has its own lock so
+// that it can be used while the state is locked for loading.
+type predictFallback struct {
+	mu    sync.Mutex
+	state string
+	value data.Value
+	// authorizer is a copy of the authorizer of the state.
+	authorizer string
+	fallbacks  int64
+}
+
+// configure updates the fallback. It's disabled when neither
+// fallback_state nor fallback_value is given.
+func (f *predictFallback) configure(p *MLParams) error {
+	var value data.Value
+	if len(p.FallbackValue) > 0 {
+		m, err := data.UnmarshalMsgpack(p.FallbackValue)
+		if err != nil {
+			return fmt.Errorf("cannot decode fallback_value: %v", err)
+		}
+		value = m["value"]
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state = p.FallbackState
+	f.value = value
+	f.authorizer = p.Authorizer
+	return nil
+}
+
+// authorize checks a prediction with the authorizer of the state without
+// acquiring the lock of the state.
+func (f *predictFallback) authorize(ctx *core.Context) error {
+	f.mu.Lock()
+	name := f.authorizer
+	f.mu.Unlock()
+	return authorizeBy(ctx, name, ActionPredict)
+}
+
+func (f *predictFallback) enabled() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state != "" || f.value != nil
+}
+
+// predict answers the prediction of the state s. A fallback state doesn't
+// fall back further.
+func (f *predictFallback) predict(ctx *core.Context, s *State, dt data.Value, requestID string, cause error) (data.Value, error) {
+	f.mu.Lock()
+	name, value := f.state, f.value
+	f.fallbacks++
+	f.mu.Unlock()
+	if name == "" {
+		return value, nil
+	}
+
+	fb, err := lookupState(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the fallback state of an unavailable model (%v): %v", cause, err)
+	}
+	if fb == s {
+		return nil, fmt.Errorf("the fallback state must not be the state itself")
+	}
+	return fb.predictWithFallback(ctx, dt, requestID, false, true)
+}
+
+func (f *predictFallback) count() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fallbacks
+}
+
+// unavailable returns true when the prediction failed because the model is
+// unavailable. It must be called while the lock is acquired.
+func (s *State) unavailable(err error) bool {
+	if _, ok := err.(*CircuitOpenError); ok {
+		return true
+	}
+	p := s.phase()
+	return p == PhaseFailed || p == PhaseDisabled
+}
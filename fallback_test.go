@@ -0,0 +1,101 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestPredictFallback(t *testing.T) {
+	Convey("Given a state falling back to another state", t, func() {
+		ctx := core.NewContext(&core.ContextConfig{})
+		var fbInputs []data.Value
+		fb := &State{base: &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				fbInputs = append(fbInputs, dt[0])
+				return data.String("fallback"), nil
+			},
+		}, params: MLParams{BatchSize: 1}}
+		So(fb.setUpParams(), ShouldBeNil)
+		So(ctx.SharedStates.Add("fb", "pymlstate", fb), ShouldBeNil)
+
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return nil, errors.New("failure")
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1, FallbackState: "fb",
+			BreakerErrorRate: 1, BreakerWindow: 1, BreakerOpenDuration: time.Minute}}
+		So(s.setUpParams(), ShouldBeNil)
+		s.readiness.set(PhaseServing)
+
+		Convey("When the circuit breaker is open", func() {
+			_, err := s.Predict(ctx, data.Map{"x": data.Int(1)})
+			So(err, ShouldNotBeNil)
+			res, err := s.Predict(ctx, data.Map{"x": data.Int(2)})
+
+			Convey("Then the fallback state should answer the prediction", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.String("fallback"))
+				So(fbInputs, ShouldResemble, []data.Value{data.Map{"x": data.Int(2)}})
+				So(s.Status()["fallbacks"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When the model is loading", func() {
+			s.readiness.set(PhaseLoading)
+			s.rwm.Lock()
+			res, err := s.Predict(ctx, data.Map{"x": data.Int(1)})
+			s.rwm.Unlock()
+
+			Convey("Then the fallback state should answer without waiting for the lock", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.String("fallback"))
+			})
+		})
+
+		Convey("When the fallback state is the state itself", func() {
+			So(ctx.SharedStates.Add("self", "pymlstate", s), ShouldBeNil)
+			s.params.FallbackState = "self"
+			So(s.setUpParams(), ShouldBeNil)
+			s.readiness.set(PhaseLoading)
+			_, err := s.Predict(ctx, data.Map{"x": data.Int(1)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state falling back to a constant value", t, func() {
+		ctx := core.NewContext(nil)
+		v, err := encodeFallbackValue(data.Map{"label": data.String("unknown")})
+		So(err, ShouldBeNil)
+		s := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1, FallbackValue: v}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When the model is loading", func() {
+			s.readiness.set(PhaseLoading)
+			res, err := s.Predict(ctx, data.Map{"x": data.Int(1)})
+
+			Convey("Then the value should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{"label": data.String("unknown")})
+			})
+		})
+
+		Convey("When a prediction fails while the model is available", func() {
+			s.base = &fakeBackend{call: func(string, ...data.Value) (data.Value, error) {
+				return nil, errors.New("bad input")
+			}}
+			_, err := s.Predict(ctx, data.Map{"x": data.Int(1)})
+
+			Convey("Then the error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,107 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"hash/fnv"
+)
+
+// featureHasher applies the hashing trick to high-cardinality features. Each
+// value of configured fields is hashed together with its path into an index
+// of a fixed size vector, and a signed count is added to the element. The
+// original fields are removed from the record and the vector is set at the
+// output key.
+type featureHasher struct {
+	names  []string
+	paths  []data.Path
+	fields []droppedField
+	dim    int
+	key    string
+}
+
+var _ preprocessor = &featureHasher{}
+
+func newFeatureHasher(p *MLParams) (*featureHasher, error) {
+	if p.HashFeaturesDim <= 0 {
+		return nil, fmt.Errorf("hash_features_dim must be greater than 0")
+	}
+	if p.HashFeaturesKey == "" {
+		return nil, fmt.Errorf("hash_features_key must not be empty")
+	}
+
+	ps, err := compilePaths(p.HashFeatures)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash_features: %v", err)
+	}
+	h := &featureHasher{
+		names: p.HashFeatures,
+		paths: ps,
+		dim:   p.HashFeaturesDim,
+		key:   p.HashFeaturesKey,
+	}
+	for _, name := range p.HashFeatures {
+		f, err := newDroppedField(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash_features: %v", err)
+		}
+		h.fields = append(h.fields, f)
+	}
+	return h, nil
+}
+
+func (h *featureHasher) process(rec data.Map, training bool, rep *qualityReport) error {
+	vec := make([]float64, h.dim)
+	for i, p := range h.paths {
+		v, err := rec.Get(p)
+		if err != nil || v.Type() == data.TypeNull {
+			continue
+		}
+
+		if v.Type() == data.TypeArray {
+			// An array is considered as a bag of values such as tokens.
+			arr, _ := data.AsArray(v)
+			for _, e := range arr {
+				if err := h.add(vec, h.names[i], e); err != nil {
+					rep.typeMismatch(h.names[i])
+					return err
+				}
+			}
+		} else if err := h.add(vec, h.names[i], v); err != nil {
+			rep.typeMismatch(h.names[i])
+			return err
+		}
+	}
+
+	for _, f := range h.fields {
+		f.drop(rec)
+	}
+	res := make(data.Array, h.dim)
+	for i, x := range vec {
+		res[i] = data.Float(x)
+	}
+	rec[h.key] = res
+	return nil
+}
+
+func (h *featureHasher) add(vec []float64, name string, v data.Value) error {
+	switch v.Type() {
+	case data.TypeArray, data.TypeMap:
+		return fmt.Errorf("'%v' cannot be hashed: %v", name, v.Type())
+	}
+
+	f := fnv.New64a()
+	f.Write([]byte(name))
+	f.Write([]byte{0})
+	f.Write([]byte(valueKey(v)))
+	sum := f.Sum64()
+
+	// The most significant bit decides the sign so that collisions cancel
+	// out in expectation.
+	idx := int((sum & (1<<63 - 1)) % uint64(h.dim))
+	if sum>>63 == 0 {
+		vec[idx]++
+	} else {
+		vec[idx]--
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestFeatureHasher(t *testing.T) {
+	Convey("Given a feature hasher", t, func() {
+		h, err := newFeatureHasher(&MLParams{
+			HashFeatures:    []string{"domain", "tokens"},
+			HashFeaturesDim: 16,
+			HashFeaturesKey: "hashed",
+		})
+		So(err, ShouldBeNil)
+
+		count := func(vec data.Array) float64 {
+			sum := 0.0
+			for _, x := range vec {
+				f, _ := data.AsFloat(x)
+				if f < 0 {
+					f = -f
+				}
+				sum += f
+			}
+			return sum
+		}
+
+		Convey("When a record is processed", func() {
+			rec := data.Map{
+				"domain": data.String("example.com"),
+				"tokens": data.Array{data.String("a"), data.String("b")},
+				"x":      data.Float(1),
+			}
+			So(h.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then the features should be replaced with a hashed vector", func() {
+				So(rec["domain"], ShouldBeNil)
+				So(rec["tokens"], ShouldBeNil)
+				So(rec["x"], ShouldEqual, data.Float(1))
+
+				vec, err := data.AsArray(rec["hashed"])
+				So(err, ShouldBeNil)
+				So(len(vec), ShouldEqual, 16)
+				So(count(vec), ShouldBeLessThanOrEqualTo, 3)
+			})
+
+			Convey("Then the same record should be hashed to the same vector", func() {
+				rec2 := data.Map{
+					"domain": data.String("example.com"),
+					"tokens": data.Array{data.String("a"), data.String("b")},
+				}
+				So(h.process(rec2, false, nil), ShouldBeNil)
+				So(rec2["hashed"], ShouldResemble, rec["hashed"])
+			})
+		})
+
+		Convey("When a record having a map feature is processed", func() {
+			err := h.process(data.Map{"domain": data.Map{}}, true, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an invalid dimensionality", t, func() {
+		_, err := newFeatureHasher(&MLParams{
+			HashFeatures:    []string{"domain"},
+			HashFeaturesKey: "hashed",
+		})
+
+		Convey("Then creating a hasher should fail", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
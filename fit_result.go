@@ -0,0 +1,129 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// FitResult is a result of training parsed from a value returned by the
+// "fit" method of Python. A map returned by the method can have "loss",
+// "accuracy", and "samples_seen" keys, and other numeric values are stored
+// in Metrics. A number returned by the method is considered as the loss.
+type FitResult struct {
+	// Loss is the loss of the batch. It's nil when it isn't returned.
+	Loss *float64
+
+	// Accuracy is the accuracy of the batch. It's nil when it isn't
+	// returned.
+	Accuracy *float64
+
+	// Metrics has other numeric values returned by the method.
+	Metrics map[string]float64
+
+	// SamplesSeen is the number of samples trained. It's the number of
+	// records passed to the method when the method doesn't return it.
+	SamplesSeen int64
+
+	// Raw is the value returned by the method as it is.
+	Raw data.Value
+}
+
+// ParseFitResult parses the value returned by the "fit" method. batchSize
+// is the number of records passed to the method. Values which cannot be
+// parsed are only kept in Raw.
+func ParseFitResult(v data.Value, batchSize int) *FitResult {
+	r := &FitResult{
+		Metrics:     map[string]float64{},
+		SamplesSeen: int64(batchSize),
+		Raw:         v,
+	}
+	if v == nil {
+		return r
+	}
+	if x, err := asNumber(v); err == nil {
+		r.Loss = &x
+		return r
+	}
+
+	m, err := data.AsMap(v)
+	if err != nil {
+		return r
+	}
+	for k, e := range m {
+		x, err := asNumber(e)
+		if err != nil {
+			continue
+		}
+		switch k {
+		case "loss":
+			r.Loss = &x
+		case "accuracy":
+			r.Accuracy = &x
+		case "samples_seen":
+			r.SamplesSeen = int64(x)
+		default:
+			r.Metrics[k] = x
+		}
+	}
+	return r
+}
+
+// checkFitResult returns an error when the value returned by the "fit" method
+// is malformed. A value is malformed when it's neither a number nor a map,
+// or when it lacks a numeric value of any of fields. When fields is empty, a
+// map must have at least one numeric value.
+func checkFitResult(v data.Value, fields []string) error {
+	if v == nil {
+		return fmt.Errorf("fit returned nothing")
+	}
+	if _, err := asNumber(v); err == nil {
+		if len(fields) == 0 || (len(fields) == 1 && fields[0] == "loss") {
+			return nil
+		}
+		return fmt.Errorf("fit returned a number instead of a map having %v", fields)
+	}
+	m, err := data.AsMap(v)
+	if err != nil {
+		return fmt.Errorf("fit returned neither a number nor a map: %v", v)
+	}
+
+	if len(fields) == 0 {
+		for _, e := range m {
+			if _, err := asNumber(e); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("the result of fit doesn't have any metric: %v", v)
+	}
+	for _, f := range fields {
+		e, ok := m[f]
+		if !ok {
+			return fmt.Errorf("the result of fit doesn't have '%v': %v", f, v)
+		}
+		if _, err := asNumber(e); err != nil {
+			return fmt.Errorf("'%v' in the result of fit isn't a number: %v", f, e)
+		}
+	}
+	return nil
+}
+
+// validateFitResult applies fit_result_policy to the value returned by the
+// "fit" method. It returns an error only when the policy is "error".
+func (s *State) validateFitResult(ctx *core.Context, v data.Value) error {
+	if s.params.FitResultPolicy == "" || s.params.FitResultPolicy == "ignore" {
+		return nil
+	}
+	err := checkFitResult(v, s.params.FitResultFields)
+	if err == nil {
+		return nil
+	}
+	if s.params.FitResultPolicy == "warn" {
+		s.warnings.warn("malformed_fit_result", func(suppressed int64) {
+			ctx.ErrLog(err).WithField("suppressed", suppressed).
+				Warn("pymlstate's fit returned a malformed result")
+		})
+		return nil
+	}
+	return err
+}
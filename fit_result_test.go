@@ -0,0 +1,130 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestParseFitResult(t *testing.T) {
+	Convey("Given a map returned by fit", t, func() {
+		v := data.Map{
+			"loss":         data.Float(0.5),
+			"accuracy":     data.Float(0.9),
+			"samples_seen": data.Int(100),
+			"f1":           data.Float(0.8),
+			"message":      data.String("ok"),
+		}
+
+		Convey("When it's parsed", func() {
+			r := ParseFitResult(v, 10)
+
+			Convey("Then known metrics and custom metrics should be parsed", func() {
+				So(*r.Loss, ShouldEqual, 0.5)
+				So(*r.Accuracy, ShouldEqual, 0.9)
+				So(r.SamplesSeen, ShouldEqual, 100)
+				So(r.Metrics, ShouldResemble, map[string]float64{"f1": 0.8})
+				So(r.Raw, ShouldResemble, v)
+			})
+		})
+	})
+
+	Convey("Given a number returned by fit", t, func() {
+		Convey("When it's parsed", func() {
+			r := ParseFitResult(data.Float(1.5), 10)
+
+			Convey("Then it should be the loss", func() {
+				So(*r.Loss, ShouldEqual, 1.5)
+				So(r.Accuracy, ShouldBeNil)
+				So(r.SamplesSeen, ShouldEqual, 10)
+			})
+		})
+	})
+
+	Convey("Given a string returned by fit", t, func() {
+		Convey("When it's parsed", func() {
+			r := ParseFitResult(data.String("fit called"), 10)
+
+			Convey("Then it should only be kept as the raw value", func() {
+				So(r.Loss, ShouldBeNil)
+				So(r.Metrics, ShouldBeEmpty)
+				So(r.Raw, ShouldEqual, data.String("fit called"))
+			})
+		})
+	})
+}
+
+func TestCheckFitResult(t *testing.T) {
+	Convey("Given values returned by fit", t, func() {
+		Convey("When a map with a metric is checked without fields", func() {
+			err := checkFitResult(data.Map{"loss": data.Float(0.1)}, nil)
+
+			Convey("Then it should succeed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When a map without metrics is checked", func() {
+			err := checkFitResult(data.Map{"message": data.String("ok")}, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a map with a typo is checked with fields", func() {
+			err := checkFitResult(data.Map{"los": data.Float(0.1)}, []string{"loss"})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a number is checked", func() {
+			Convey("Then it should be considered as the loss", func() {
+				So(checkFitResult(data.Float(0.1), nil), ShouldBeNil)
+				So(checkFitResult(data.Float(0.1), []string{"loss"}), ShouldBeNil)
+				So(checkFitResult(data.Float(0.1), []string{"accuracy"}), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When nil or a string is checked", func() {
+			Convey("Then it should fail", func() {
+				So(checkFitResult(nil, nil), ShouldNotBeNil)
+				So(checkFitResult(data.String("done"), nil), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestExtractFitResultParams(t *testing.T) {
+	Convey("Given fit result parameters", t, func() {
+		params := data.Map{
+			"fit_result_policy": data.String("error"),
+			"fit_result_fields": data.Array{data.String("loss"), data.String("accuracy")},
+		}
+
+		Convey("When they're extracted", func() {
+			mp := &MLParams{}
+			So(extractFitResultParams(params, mp), ShouldBeNil)
+
+			Convey("Then they should be set", func() {
+				So(mp.FitResultPolicy, ShouldEqual, "error")
+				So(mp.FitResultFields, ShouldResemble, []string{"loss", "accuracy"})
+				So(params, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given an invalid fit_result_policy", t, func() {
+		params := data.Map{"fit_result_policy": data.String("strict")}
+
+		Convey("When it's extracted", func() {
+			err := extractFitResultParams(params, &MLParams{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
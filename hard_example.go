@@ -0,0 +1,93 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"sync"
+)
+
+// hardExamplePool keeps records having the highest per-sample losses
+// returned by "fit" so that they're trained again with subsequent batches.
+type hardExamplePool struct {
+	size int
+	key  string
+
+	mu       sync.Mutex
+	examples []hardExample
+}
+
+type hardExample struct {
+	loss   float64
+	record data.Value
+}
+
+func newHardExamplePool(size int, key string) *hardExamplePool {
+	return &hardExamplePool{
+		size: size,
+		key:  key,
+	}
+}
+
+// withReplay returns the batch followed by the hard examples.
+func (p *hardExamplePool) withReplay(batch []data.Value) []data.Value {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.examples) == 0 {
+		return batch
+	}
+	res := make([]data.Value, 0, len(batch)+len(p.examples))
+	res = append(res, batch...)
+	for _, e := range p.examples {
+		res = append(res, e.record)
+	}
+	return res
+}
+
+// update replaces the hard examples with records of the batch having the
+// highest losses. The value returned by "fit" must be a map having an array
+// of per-sample losses in the same order as the batch. Because the batch
+// includes the current hard examples, their losses are also updated.
+func (p *hardExamplePool) update(batch []data.Value, res data.Value) error {
+	m, err := data.AsMap(res)
+	if err != nil {
+		return fmt.Errorf("fit must return a map having '%v': %v", p.key, err)
+	}
+	v, ok := m[p.key]
+	if !ok {
+		return fmt.Errorf("the result of fit doesn't have '%v'", p.key)
+	}
+	losses, err := data.AsArray(v)
+	if err != nil {
+		return fmt.Errorf("'%v' must be an array: %v", p.key, err)
+	}
+	if len(losses) != len(batch) {
+		return fmt.Errorf("'%v' has %v losses for %v records", p.key, len(losses), len(batch))
+	}
+
+	ex := make([]hardExample, len(batch))
+	for i, l := range losses {
+		x, err := asNumber(l)
+		if err != nil {
+			return fmt.Errorf("a loss in '%v' isn't a number: %v", p.key, err)
+		}
+		ex[i] = hardExample{loss: x, record: batch[i]}
+	}
+	sort.SliceStable(ex, func(i, j int) bool {
+		return ex[i].loss > ex[j].loss
+	})
+	if len(ex) > p.size {
+		ex = ex[:p.size]
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.examples = ex
+	return nil
+}
+
+func (p *hardExamplePool) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.examples)
+}
@@ -0,0 +1,51 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestHardExamplePool(t *testing.T) {
+	Convey("Given a hard example pool of size 2", t, func() {
+		p := newHardExamplePool(2, "sample_losses")
+		batch := []data.Value{data.Int(0), data.Int(1), data.Int(2)}
+
+		Convey("When it's updated with per-sample losses", func() {
+			res := data.Map{
+				"loss":          data.Float(0.5),
+				"sample_losses": data.Array{data.Float(0.1), data.Float(0.9), data.Float(0.5)},
+			}
+			So(p.update(batch, res), ShouldBeNil)
+
+			Convey("Then the hardest examples should be replayed", func() {
+				b := p.withReplay([]data.Value{data.Int(3)})
+				So(b, ShouldResemble, []data.Value{data.Int(3), data.Int(1), data.Int(2)})
+				So(p.len(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When it's updated with a wrong number of losses", func() {
+			err := p.update(batch, data.Map{"sample_losses": data.Array{data.Float(0.1)}})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(p.len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When it's updated without per-sample losses", func() {
+			err := p.update(batch, data.Map{"loss": data.Float(0.5)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When it's empty", func() {
+			Convey("Then the batch should be returned as it is", func() {
+				So(p.withReplay(batch), ShouldResemble, batch)
+			})
+		})
+	})
+}
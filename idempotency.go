@@ -0,0 +1,161 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// idempotencyKeys keeps keys of records which are buffered or trained, so
+// that records replayed by the upstream aren't trained twice. Keys of
+// buffered records are pending until their bucket is trained, and keys of
+// records whose training failed are forgotten so that they can be written
+// again. The oldest keys are forgotten when the number of keys exceeds max.
+type idempotencyKeys struct {
+	path data.Path
+	max  int
+
+	mu sync.Mutex
+	// keys is true when the record is trained and false when it's pending.
+	keys  map[string]bool
+	order []string
+}
+
+func newIdempotencyKeys(path string, max int) (*idempotencyKeys, error) {
+	p, err := data.CompilePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid idempotency_key_path '%v': %v", path, err)
+	}
+	return &idempotencyKeys{
+		path: p,
+		max:  max,
+		keys: map[string]bool{},
+	}, nil
+}
+
+// keyOf returns the key of the record. ok is false when the record doesn't
+// have the key.
+func (k *idempotencyKeys) keyOf(rec data.Value) (key string, ok bool) {
+	m, err := data.AsMap(rec)
+	if err != nil {
+		return "", false
+	}
+	v, err := m.Get(k.path)
+	if err != nil {
+		return "", false
+	}
+	return valueKey(v), true
+}
+
+// filter removes records whose keys have been seen from dataSet, which is a
+// record or an array of records, and makes keys of others pending. It
+// returns nil when all records are removed. Records without keys are always
+// kept. It returns dataSet as it is when k is nil.
+func (k *idempotencyKeys) filter(dataSet data.Value) data.Value {
+	if k == nil {
+		return dataSet
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if dataSet.Type() != data.TypeArray {
+		if !k.accept(dataSet) {
+			return nil
+		}
+		return dataSet
+	}
+
+	arr, _ := data.AsArray(dataSet)
+	res := make(data.Array, 0, len(arr))
+	for _, r := range arr {
+		if k.accept(r) {
+			res = append(res, r)
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+func (k *idempotencyKeys) accept(rec data.Value) bool {
+	key, ok := k.keyOf(rec)
+	if !ok {
+		return true
+	}
+	if _, seen := k.keys[key]; seen {
+		return false
+	}
+	k.add(key, false)
+	return true
+}
+
+func (k *idempotencyKeys) add(key string, trained bool) {
+	if _, ok := k.keys[key]; !ok {
+		k.order = append(k.order, key)
+	}
+	k.keys[key] = trained
+	for len(k.order) > k.max {
+		delete(k.keys, k.order[0])
+		k.order = k.order[1:]
+	}
+}
+
+// finish marks keys of the trained records as trained when ok is true.
+// Otherwise, it forgets their keys. It does nothing when k is nil.
+func (k *idempotencyKeys) finish(recs []data.Value, ok bool) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, r := range recs {
+		key, has := k.keyOf(r)
+		if !has {
+			continue
+		}
+		if ok {
+			k.add(key, true)
+		} else if !k.keys[key] {
+			delete(k.keys, key)
+		}
+	}
+	if !ok {
+		order := k.order[:0]
+		for _, key := range k.order {
+			if _, ok := k.keys[key]; ok {
+				order = append(order, key)
+			}
+		}
+		k.order = order
+	}
+}
+
+// snapshot returns keys of trained records from the oldest one.
+func (k *idempotencyKeys) snapshot() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	res := []string{}
+	for _, key := range k.order {
+		if k.keys[key] {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+// restore replaces keys with trained keys returned by snapshot.
+func (k *idempotencyKeys) restore(keys []string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = map[string]bool{}
+	k.order = nil
+	for _, key := range keys {
+		k.add(key, true)
+	}
+}
+
+func (k *idempotencyKeys) len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.keys)
+}
@@ -0,0 +1,101 @@
+package pymlstate
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	rec := func(id int) data.Value {
+		return data.Map{"id": data.Int(id)}
+	}
+
+	Convey("Given idempotency keys", t, func() {
+		k, err := newIdempotencyKeys("id", 3)
+		So(err, ShouldBeNil)
+
+		Convey("When records are filtered", func() {
+			So(k.filter(rec(1)), ShouldNotBeNil)
+			res := k.filter(data.Array{rec(1), rec(2), data.Map{}})
+
+			Convey("Then records having seen keys should be removed", func() {
+				So(res, ShouldResemble, data.Array{rec(2), data.Map{}})
+				So(k.filter(rec(2)), ShouldBeNil)
+			})
+		})
+
+		Convey("When training of pending records fails", func() {
+			k.filter(rec(1))
+			k.finish([]data.Value{rec(1)}, false)
+
+			Convey("Then they should be accepted again", func() {
+				So(k.filter(rec(1)), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When records are trained", func() {
+			k.filter(data.Array{rec(1), rec(2)})
+			k.finish([]data.Value{rec(1), rec(2)}, true)
+			k.filter(rec(3))
+
+			Convey("Then only trained keys should be in the snapshot", func() {
+				keys := k.snapshot()
+				So(keys, ShouldHaveLength, 2)
+
+				k2, _ := newIdempotencyKeys("id", 3)
+				k2.restore(keys)
+				So(k2.filter(rec(1)), ShouldBeNil)
+				So(k2.filter(rec(3)), ShouldNotBeNil)
+			})
+
+			Convey("Then the oldest key should be forgotten when it exceeds the max", func() {
+				k.filter(rec(4))
+				So(k.len(), ShouldEqual, 3)
+				So(k.filter(rec(1)), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state with idempotency_key_path", t, func() {
+		ctx := core.NewContext(nil)
+		fail := false
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				if fail {
+					return nil, fmt.Errorf("fit failed")
+				}
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 2, IdempotencyKeyPath: "id", IdempotencyKeys: 10}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When records are replayed after they're trained", func() {
+			for _, id := range []int{1, 2, 1, 2, 3} {
+				So(s.writeRecord(ctx, rec(id), time.Time{}), ShouldBeNil)
+			}
+
+			Convey("Then they shouldn't be trained twice", func() {
+				So(b.calls, ShouldResemble, []string{"fit"})
+				So(s.bucket, ShouldResemble, []data.Value{rec(3)})
+			})
+		})
+
+		Convey("When training fails", func() {
+			fail = true
+			s.writeRecord(ctx, rec(1), time.Time{})
+			s.writeRecord(ctx, rec(2), time.Time{})
+			fail = false
+			s.writeRecord(ctx, rec(1), time.Time{})
+			s.writeRecord(ctx, rec(2), time.Time{})
+
+			Convey("Then the records should be trained again", func() {
+				So(b.calls, ShouldResemble, []string{"fit", "fit"})
+			})
+		})
+	})
+}
@@ -0,0 +1,244 @@
+package pymlstate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"image"
+	_ "image/jpeg" // register the JPEG decoder
+	_ "image/png"  // register the PNG decoder
+	"math"
+	"sync"
+)
+
+// imageDecoder decodes JPEG or PNG images at image paths, resizes them,
+// and normalizes their pixels so that Python receives ready tensors instead
+// of decoding images while holding the GIL. Images of records are decoded
+// by a pool of workers.
+//
+// A tensor is a map having "shape", which is [height, width, channels],
+// "dtype", which is "float32", and "data", which is a blob of little-endian
+// float32 values in row-major order. Python can convert it to an ndarray by
+// np.frombuffer(t["data"], dtype=t["dtype"]).reshape(t["shape"]).
+type imageDecoder struct {
+	names     []string
+	paths     []data.Path
+	width     int
+	height    int
+	grayscale bool
+	mean      []float64
+	std       []float64
+	workers   int
+}
+
+func newImageDecoder(p *MLParams) (*imageDecoder, error) {
+	ps, err := compilePaths(p.ImagePaths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image_paths: %v", err)
+	}
+	d := &imageDecoder{
+		names:     p.ImagePaths,
+		paths:     ps,
+		width:     p.ImageWidth,
+		height:    p.ImageHeight,
+		grayscale: p.ImageGrayscale,
+		workers:   p.ImageWorkers,
+	}
+	if d.workers <= 0 {
+		d.workers = 1
+	}
+	if d.mean, err = d.channelValues("image_mean", p.ImageMean, 0); err != nil {
+		return nil, err
+	}
+	if d.std, err = d.channelValues("image_std", p.ImageStd, 1); err != nil {
+		return nil, err
+	}
+	for _, s := range d.std {
+		if s <= 0 {
+			return nil, fmt.Errorf("image_std must be greater than 0")
+		}
+	}
+	return d, nil
+}
+
+// channels returns the number of channels of tensors.
+func (d *imageDecoder) channels() int {
+	if d.grayscale {
+		return 1
+	}
+	return 3
+}
+
+// channelValues returns a value of each channel. A single value is used for
+// all channels.
+func (d *imageDecoder) channelValues(name string, vs []float64, def float64) ([]float64, error) {
+	res := make([]float64, d.channels())
+	switch len(vs) {
+	case 0:
+		vs = []float64{def}
+		fallthrough
+	case 1:
+		for i := range res {
+			res[i] = vs[0]
+		}
+	case len(res):
+		copy(res, vs)
+	default:
+		return nil, fmt.Errorf("%v must have 1 or %v values: %v", name, len(res), len(vs))
+	}
+	return res, nil
+}
+
+// decodeAll returns copies of records in v having tensors at image paths.
+// v is a record or an array of records.
+func (d *imageDecoder) decodeAll(v data.Value, rep *qualityReport) (data.Value, error) {
+	var recs []data.Map
+	res, _ := mapRecords(v, func(m data.Map) (data.Map, error) {
+		rec := m.Copy()
+		recs = append(recs, rec)
+		return rec, nil
+	})
+	if len(recs) == 0 {
+		return v, nil
+	}
+
+	// A record is processed by one worker because its map can't be
+	// modified concurrently.
+	type failure struct {
+		path int
+		err  error
+	}
+	var (
+		jobs     = make(chan data.Map)
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []failure
+	)
+	workers := d.workers
+	if workers > len(recs) {
+		workers = len(recs)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range jobs {
+				for p := range d.paths {
+					if err := d.decodePath(rec, p); err != nil {
+						mu.Lock()
+						failures = append(failures, failure{p, err})
+						mu.Unlock()
+						break
+					}
+				}
+			}
+		}()
+	}
+	for _, rec := range recs {
+		jobs <- rec
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		f := failures[0]
+		rep.typeMismatch(d.names[f.path])
+		return nil, fmt.Errorf("cannot decode the image at '%v': %v", d.names[f.path], f.err)
+	}
+	return res, nil
+}
+
+func (d *imageDecoder) decodePath(rec data.Map, i int) error {
+	v, err := rec.Get(d.paths[i])
+	if err != nil || v.Type() == data.TypeNull {
+		return nil // missing fields are left to the Python side
+	}
+	b, err := toBlob(v)
+	if err != nil {
+		return err
+	}
+	t, err := d.decode(b)
+	if err != nil {
+		return err
+	}
+	return rec.Set(d.paths[i], t)
+}
+
+// decode decodes the image and converts it to a tensor.
+func (d *imageDecoder) decode(b []byte) (data.Map, error) {
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	w, h := d.width, d.height
+	if w <= 0 || h <= 0 {
+		w, h = bounds.Dx(), bounds.Dy()
+	}
+	c := d.channels()
+
+	buf := make([]byte, 4*w*h*c)
+	px := make([]float64, c)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d.sample(img, bounds, w, h, x, y, px)
+			for k, f := range px {
+				f = (f - d.mean[k]) / d.std[k]
+				binary.LittleEndian.PutUint32(buf[4*((y*w+x)*c+k):], math.Float32bits(float32(f)))
+			}
+		}
+	}
+	return data.Map{
+		"shape": data.Array{data.Int(h), data.Int(w), data.Int(c)},
+		"dtype": data.String("float32"),
+		"data":  data.Blob(buf),
+	}, nil
+}
+
+// sample computes channels of the pixel (x, y) of the resized image by
+// bilinear interpolation. Channels are in [0, 1].
+func (d *imageDecoder) sample(img image.Image, bounds image.Rectangle, w, h, x, y int, px []float64) {
+	sx := (float64(x)+0.5)*float64(bounds.Dx())/float64(w) - 0.5
+	sy := (float64(y)+0.5)*float64(bounds.Dy())/float64(h) - 0.5
+	x0, y0 := math.Floor(sx), math.Floor(sy)
+	fx, fy := sx-x0, sy-y0
+
+	for i := range px {
+		px[i] = 0
+	}
+	for _, c := range [4]struct {
+		dx, dy int
+		weight float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		if c.weight == 0 {
+			continue
+		}
+		ix := clampInt(int(x0)+c.dx, 0, bounds.Dx()-1) + bounds.Min.X
+		iy := clampInt(int(y0)+c.dy, 0, bounds.Dy()-1) + bounds.Min.Y
+		r, g, b, _ := img.At(ix, iy).RGBA()
+		if d.grayscale {
+			// ITU-R BT.601 luma
+			px[0] += c.weight * (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+		} else {
+			px[0] += c.weight * float64(r) / 0xffff
+			px[1] += c.weight * float64(g) / 0xffff
+			px[2] += c.weight * float64(b) / 0xffff
+		}
+	}
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
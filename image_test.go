@@ -0,0 +1,117 @@
+package pymlstate
+
+import (
+	"bytes"
+	"encoding/binary"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func TestImageDecoder(t *testing.T) {
+	encodePNG := func(w, h int, c color.Color) data.Blob {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.Set(x, y, c)
+			}
+		}
+		var buf bytes.Buffer
+		So(png.Encode(&buf, img), ShouldBeNil)
+		return data.Blob(buf.Bytes())
+	}
+	values := func(t data.Value) []float64 {
+		m, err := data.AsMap(t)
+		So(err, ShouldBeNil)
+		b, err := data.AsBlob(m["data"])
+		So(err, ShouldBeNil)
+		res := make([]float64, len(b)/4)
+		for i := range res {
+			res[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:])))
+		}
+		return res
+	}
+
+	Convey("Given an image decoder resizing images to 2x3", t, func() {
+		d, err := newImageDecoder(&MLParams{ImagePaths: []string{"img"}, ImageWidth: 2, ImageHeight: 3,
+			ImageMean: []float64{0.5}, ImageStd: []float64{0.5}, ImageWorkers: 4})
+		So(err, ShouldBeNil)
+
+		Convey("When an array of records having images is decoded", func() {
+			recs := data.Array{}
+			for i := 0; i < 5; i++ {
+				recs = append(recs, data.Map{"img": encodePNG(4, 4, color.RGBA{255, 0, 255, 255}), "id": data.Int(i)})
+			}
+			res, err := d.decodeAll(recs, nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then each image should be a normalized tensor", func() {
+				arr, _ := data.AsArray(res)
+				So(len(arr), ShouldEqual, 5)
+				for i, r := range arr {
+					m, _ := data.AsMap(r)
+					So(m["id"], ShouldEqual, data.Int(i))
+					t, _ := data.AsMap(m["img"])
+					So(t["shape"], ShouldResemble, data.Array{data.Int(3), data.Int(2), data.Int(3)})
+					So(t["dtype"], ShouldEqual, data.String("float32"))
+					vs := values(t)
+					So(len(vs), ShouldEqual, 18)
+					So(vs[:3], ShouldResemble, []float64{1, -1, 1})
+				}
+			})
+
+			Convey("Then original records shouldn't be modified", func() {
+				m, _ := data.AsMap(recs[0])
+				So(m["img"].Type(), ShouldEqual, data.TypeBlob)
+			})
+		})
+
+		Convey("When a record having a broken image is decoded", func() {
+			_, err := d.decodeAll(data.Map{"img": data.Blob("not an image")}, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a record doesn't have an image", func() {
+			res, err := d.decodeAll(data.Map{"x": data.Int(1)}, nil)
+
+			Convey("Then it should be left as it is", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{"x": data.Int(1)})
+			})
+		})
+	})
+
+	Convey("Given a grayscale image decoder keeping sizes", t, func() {
+		d, err := newImageDecoder(&MLParams{ImagePaths: []string{"img"}, ImageGrayscale: true})
+		So(err, ShouldBeNil)
+
+		Convey("When a white image is decoded", func() {
+			res, err := d.decodeAll(data.Map{"img": encodePNG(3, 2, color.White)}, nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have one channel", func() {
+				m, _ := data.AsMap(res)
+				t, _ := data.AsMap(m["img"])
+				So(t["shape"], ShouldResemble, data.Array{data.Int(2), data.Int(3), data.Int(1)})
+				for _, v := range values(t) {
+					So(v, ShouldAlmostEqual, 1, 1e-6)
+				}
+			})
+		})
+	})
+
+	Convey("Given normalization values not matching channels", t, func() {
+		_, err := newImageDecoder(&MLParams{ImagePaths: []string{"img"}, ImageMean: []float64{0.1, 0.2}})
+
+		Convey("Then the decoder shouldn't be created", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,184 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"sync"
+)
+
+const (
+	// ImputeMean replaces a missing value with the mean of values seen in
+	// training records so far.
+	ImputeMean = "mean"
+
+	// ImputeDrop drops a record having a missing value.
+	ImputeDrop = "drop"
+
+	// ImputeConstant replaces a missing value with a constant.
+	ImputeConstant = "constant"
+)
+
+// ImputePolicy is how a missing value at Path is handled. Value is only used
+// by ImputeConstant. It's encoded in msgpack so that it can be saved with
+// MLParams.
+type ImputePolicy struct {
+	Path     string `codec:"path"`
+	Strategy string `codec:"strategy"`
+	Value    []byte `codec:"value"`
+}
+
+// imputer fills null or absent features in records.
+type imputer struct {
+	policies  []ImputePolicy
+	paths     []data.Path
+	constants []data.Value
+
+	// mu protects means because records can be processed concurrently by Fit
+	// and Predict, which only acquire the read lock of State.
+	mu    sync.Mutex
+	means []runningStats
+}
+
+var _ preprocessor = &imputer{}
+
+func newImputer(policies []ImputePolicy) (*imputer, error) {
+	im := &imputer{
+		policies:  policies,
+		paths:     make([]data.Path, len(policies)),
+		constants: make([]data.Value, len(policies)),
+		means:     make([]runningStats, len(policies)),
+	}
+	for i, p := range policies {
+		path, err := data.CompilePath(p.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of impute '%v': %v", p.Path, err)
+		}
+		im.paths[i] = path
+
+		switch p.Strategy {
+		case ImputeMean, ImputeDrop:
+		case ImputeConstant:
+			m, err := data.UnmarshalMsgpack(p.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constant of impute '%v': %v", p.Path, err)
+			}
+			im.constants[i] = m["value"]
+		default:
+			return nil, fmt.Errorf("unsupported impute strategy of '%v': %v", p.Path, p.Strategy)
+		}
+	}
+	return im, nil
+}
+
+func (im *imputer) process(rec data.Map, training bool, rep *qualityReport) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	for i, p := range im.paths {
+		v, err := rec.Get(p)
+		missing := err != nil || v.Type() == data.TypeNull
+
+		policy := im.policies[i]
+		if policy.Strategy == ImputeMean && !missing {
+			x, err := asNumber(v)
+			if err != nil {
+				rep.typeMismatch(policy.Path)
+				return fmt.Errorf("cannot compute the mean of '%v': %v", policy.Path, err)
+			}
+			if training {
+				im.means[i].add(x)
+			}
+		}
+		if !missing {
+			continue
+		}
+		rep.null(policy.Path)
+
+		var val data.Value
+		switch policy.Strategy {
+		case ImputeDrop:
+			return errDropRecord
+		case ImputeConstant:
+			val = im.constants[i]
+		case ImputeMean:
+			if im.means[i].Count == 0 {
+				// Nothing can be imputed before any value is observed.
+				return errDropRecord
+			}
+			val = data.Float(im.means[i].Mean)
+		}
+		if err := rec.Set(p, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot returns a copy of means keyed by paths.
+func (im *imputer) snapshot() map[string]runningStats {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	res := map[string]runningStats{}
+	for i, p := range im.policies {
+		if p.Strategy == ImputeMean {
+			res[p.Path] = im.means[i]
+		}
+	}
+	return res
+}
+
+// restore sets means saved by snapshot.
+func (im *imputer) restore(means map[string]runningStats) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	for i, p := range im.policies {
+		if st, ok := means[p.Path]; ok && p.Strategy == ImputeMean {
+			im.means[i] = st
+		}
+	}
+}
+
+// parseImputePolicies parses impute parameter. It's a map from paths to
+// strategies. A strategy is "mean", "drop", or a map having "constant" key
+// whose value replaces missing values.
+func parseImputePolicies(v data.Value) ([]ImputePolicy, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("impute must be a map: %v", err)
+	}
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	policies := make([]ImputePolicy, 0, len(m))
+	for _, p := range paths {
+		policy := ImputePolicy{Path: p}
+		switch m[p].Type() {
+		case data.TypeString:
+			policy.Strategy, _ = data.AsString(m[p])
+			if policy.Strategy != ImputeMean && policy.Strategy != ImputeDrop {
+				return nil, fmt.Errorf("unsupported impute strategy of '%v': %v", p, policy.Strategy)
+			}
+
+		case data.TypeMap:
+			cm, _ := data.AsMap(m[p])
+			c, ok := cm["constant"]
+			if !ok {
+				return nil, fmt.Errorf("impute of '%v' must have a constant", p)
+			}
+			b, err := data.MarshalMsgpack(data.Map{"value": c})
+			if err != nil {
+				return nil, err
+			}
+			policy.Strategy = ImputeConstant
+			policy.Value = b
+
+		default:
+			return nil, fmt.Errorf("impute of '%v' must be a string or a map", p)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
@@ -0,0 +1,84 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestImputer(t *testing.T) {
+	Convey("Given an imputer", t, func() {
+		policies, err := parseImputePolicies(data.Map{
+			"age":    data.String("mean"),
+			"income": data.String("drop"),
+			"city":   data.Map{"constant": data.String("unknown")},
+		})
+		So(err, ShouldBeNil)
+		So(len(policies), ShouldEqual, 3)
+		im, err := newImputer(policies)
+		So(err, ShouldBeNil)
+
+		Convey("When a complete record is processed", func() {
+			rec := data.Map{
+				"age":    data.Int(20),
+				"income": data.Int(100),
+				"city":   data.String("Tokyo"),
+			}
+			So(im.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then it should not be changed", func() {
+				So(rec, ShouldResemble, data.Map{
+					"age":    data.Int(20),
+					"income": data.Int(100),
+					"city":   data.String("Tokyo"),
+				})
+			})
+
+			Convey("And when a record missing optional features is processed", func() {
+				rec := data.Map{
+					"age":    data.Null{},
+					"income": data.Int(100),
+				}
+				So(im.process(rec, false, nil), ShouldBeNil)
+
+				Convey("Then missing features should be imputed", func() {
+					So(rec, ShouldResemble, data.Map{
+						"age":    data.Float(20),
+						"income": data.Int(100),
+						"city":   data.String("unknown"),
+					})
+				})
+			})
+		})
+
+		Convey("When a record missing a required feature is processed", func() {
+			err := im.process(data.Map{
+				"age":  data.Int(20),
+				"city": data.String("Tokyo"),
+			}, true, nil)
+
+			Convey("Then it should be dropped", func() {
+				So(err, ShouldEqual, errDropRecord)
+			})
+		})
+
+		Convey("When a record missing the mean feature is processed first", func() {
+			err := im.process(data.Map{
+				"income": data.Int(100),
+				"city":   data.String("Tokyo"),
+			}, true, nil)
+
+			Convey("Then it should be dropped", func() {
+				So(err, ShouldEqual, errDropRecord)
+			})
+		})
+	})
+
+	Convey("Given an unsupported impute strategy", t, func() {
+		_, err := parseImputePolicies(data.Map{"age": data.String("median")})
+
+		Convey("Then parsing it should fail", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+// joinBuffer buffers feature records until labels having the same ID arrive.
+// A feature tuple has its features in "data" field and a label tuple has its
+// label at the label path. Both of them have the ID at the ID path.
+type joinBuffer struct {
+	idPath    data.Path
+	labelPath data.Path
+	ttl       time.Duration
+
+	pending map[data.HashValue]*pendingFeature
+	// order has keys of pending in arrival order. It's used to expire old
+	// features without scanning the whole map. A key whose feature was
+	// already joined or overwritten is skipped when it's expired.
+	order []pendingKey
+}
+
+type pendingFeature struct {
+	id        data.Value
+	record    data.Map
+	timestamp time.Time
+}
+
+type pendingKey struct {
+	key       data.HashValue
+	timestamp time.Time
+}
+
+func newJoinBuffer(p *MLParams) (*joinBuffer, error) {
+	idPath, err := data.CompilePath(p.JoinIDPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid join_id_path: %v", err)
+	}
+	lp := p.JoinLabelPath
+	if lp == "" {
+		lp = "label"
+	}
+	labelPath, err := data.CompilePath(lp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid join_label_path: %v", err)
+	}
+	return &joinBuffer{
+		idPath:    idPath,
+		labelPath: labelPath,
+		ttl:       p.JoinTTL,
+		pending:   map[data.HashValue]*pendingFeature{},
+	}, nil
+}
+
+// add adds a tuple to the buffer. It returns a joined record and true when
+// the tuple is a label tuple and its feature record is pending. Otherwise,
+// it returns false.
+func (j *joinBuffer) add(t *core.Tuple) (data.Map, bool, error) {
+	j.expire(t.Timestamp)
+
+	id, err := t.Data.Get(j.idPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("the tuple doesn't have a join ID: %v", err)
+	}
+	key := data.Hash(id)
+
+	if label, err := t.Data.Get(j.labelPath); err == nil {
+		f, ok := j.pending[key]
+		if !ok || !data.Equal(f.id, id) {
+			// The feature record has already been expired or hasn't arrived.
+			return nil, false, nil
+		}
+		delete(j.pending, key)
+
+		rec := f.record.Copy()
+		if err := rec.Set(j.labelPath, label); err != nil {
+			return nil, false, err
+		}
+		return rec, true, nil
+	}
+
+	dt, err := t.Data.Get(datPath)
+	if err != nil {
+		return nil, false, err
+	}
+	rec, err := data.AsMap(dt)
+	if err != nil {
+		return nil, false, fmt.Errorf("features to be joined must be a map: %v", err)
+	}
+	j.pending[key] = &pendingFeature{
+		id:        id,
+		record:    rec,
+		timestamp: t.Timestamp,
+	}
+	j.order = append(j.order, pendingKey{key: key, timestamp: t.Timestamp})
+	return nil, false, nil
+}
+
+// expire removes feature records which have been waiting for labels longer
+// than TTL. The age of a record is measured by the timestamps of tuples.
+func (j *joinBuffer) expire(now time.Time) {
+	if j.ttl <= 0 {
+		return
+	}
+	deadline := now.Add(-j.ttl)
+
+	i := 0
+	for ; i < len(j.order); i++ {
+		k := j.order[i]
+		if !k.timestamp.Before(deadline) {
+			break
+		}
+		if f, ok := j.pending[k.key]; ok && f.timestamp.Equal(k.timestamp) {
+			delete(j.pending, k.key)
+		}
+	}
+	j.order = j.order[i:]
+}
+
+// size returns the number of pending feature records.
+func (j *joinBuffer) size() int {
+	return len(j.pending)
+}
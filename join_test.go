@@ -0,0 +1,96 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestJoinBuffer(t *testing.T) {
+	Convey("Given a join buffer", t, func() {
+		j, err := newJoinBuffer(&MLParams{
+			JoinIDPath:    "id",
+			JoinLabelPath: "label",
+			JoinTTL:       time.Minute,
+		})
+		So(err, ShouldBeNil)
+		now := time.Now()
+
+		feature := &core.Tuple{
+			Data: data.Map{
+				"id":   data.Int(1),
+				"data": data.Map{"x": data.Float(1.5)},
+			},
+			Timestamp: now,
+		}
+		label := &core.Tuple{
+			Data: data.Map{
+				"id":    data.Int(1),
+				"label": data.Int(3),
+			},
+			Timestamp: now.Add(30 * time.Second),
+		}
+
+		Convey("When a feature tuple is added", func() {
+			_, joined, err := j.add(feature)
+			So(err, ShouldBeNil)
+			So(joined, ShouldBeFalse)
+			So(j.size(), ShouldEqual, 1)
+
+			Convey("And when its label tuple arrives in time", func() {
+				rec, joined, err := j.add(label)
+				So(err, ShouldBeNil)
+
+				Convey("Then the joined record should be returned", func() {
+					So(joined, ShouldBeTrue)
+					So(rec, ShouldResemble, data.Map{
+						"x":     data.Float(1.5),
+						"label": data.Int(3),
+					})
+					So(j.size(), ShouldEqual, 0)
+				})
+			})
+
+			Convey("And when its label tuple arrives after TTL", func() {
+				label.Timestamp = now.Add(2 * time.Minute)
+				_, joined, err := j.add(label)
+				So(err, ShouldBeNil)
+
+				Convey("Then the feature record should be discarded", func() {
+					So(joined, ShouldBeFalse)
+					So(j.size(), ShouldEqual, 0)
+				})
+			})
+
+			Convey("And when a label tuple having another ID arrives", func() {
+				label.Data["id"] = data.Int(2)
+				_, joined, err := j.add(label)
+				So(err, ShouldBeNil)
+
+				Convey("Then the feature record should still be pending", func() {
+					So(joined, ShouldBeFalse)
+					So(j.size(), ShouldEqual, 1)
+				})
+			})
+		})
+
+		Convey("When a tuple without an ID is added", func() {
+			_, _, err := j.add(&core.Tuple{Data: data.Map{"data": data.Map{}}})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a feature tuple whose data isn't a map is added", func() {
+			feature.Data["data"] = data.Int(1)
+			_, _, err := j.add(feature)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// tupleMetadata creates a map having metadata of the tuple:
+//
+//	data.Map{
+//	  "timestamp":      [event time] (data.Timestamp),
+//	  "proc_timestamp": [processing time] (data.Timestamp),
+//	  "trace":          [trace events] (data.Array of data.Map),
+//	}
+//
+// Each trace event has "timestamp", "type" ("input", "output", or "other"),
+// and "msg" fields.
+func tupleMetadata(t *core.Tuple) data.Map {
+	trace := make(data.Array, len(t.Trace))
+	for i, e := range t.Trace {
+		trace[i] = data.Map{
+			"timestamp": data.Timestamp(e.Timestamp),
+			"type":      data.String(traceEventType(e.Type)),
+			"msg":       data.String(e.Msg),
+		}
+	}
+	return data.Map{
+		"timestamp":      data.Timestamp(t.Timestamp),
+		"proc_timestamp": data.Timestamp(t.ProcTimestamp),
+		"trace":          trace,
+	}
+}
+
+func traceEventType(t core.EventType) string {
+	switch t {
+	case core.ETInput:
+		return "input"
+	case core.ETOutput:
+		return "output"
+	default:
+		return "other"
+	}
+}
+
+// attachMetadata returns records in v with metadata set at the key. v is a
+// record or an array of records. Records are shallow-copied so that the
+// original tuple isn't modified.
+func attachMetadata(v data.Value, key string, meta data.Map) data.Value {
+	res, _ := mapRecords(v, func(m data.Map) (data.Map, error) {
+		res := make(data.Map, len(m)+1)
+		for k, x := range m {
+			res[k] = x
+		}
+		res[key] = meta
+		return res, nil
+	})
+	return res
+}
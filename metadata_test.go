@@ -0,0 +1,69 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestAttachMetadata(t *testing.T) {
+	Convey("Given a tuple having trace events", t, func() {
+		now := time.Now()
+		tu := &core.Tuple{
+			Data:          data.Map{"data": data.Map{"x": data.Int(1)}},
+			Timestamp:     now,
+			ProcTimestamp: now.Add(time.Second),
+			Trace: []core.TraceEvent{
+				{Timestamp: now, Type: core.ETInput, Msg: "source"},
+			},
+		}
+		meta := tupleMetadata(tu)
+
+		Convey("When metadata is created", func() {
+			Convey("Then it should have timestamps and trace events", func() {
+				So(meta, ShouldResemble, data.Map{
+					"timestamp":      data.Timestamp(now),
+					"proc_timestamp": data.Timestamp(now.Add(time.Second)),
+					"trace": data.Array{
+						data.Map{
+							"timestamp": data.Timestamp(now),
+							"type":      data.String("input"),
+							"msg":       data.String("source"),
+						},
+					},
+				})
+			})
+		})
+
+		Convey("When metadata is attached to a record", func() {
+			rec := data.Map{"x": data.Int(1)}
+			v := attachMetadata(rec, "_meta", meta)
+
+			Convey("Then the result should have metadata at the key", func() {
+				So(v, ShouldResemble, data.Map{
+					"x":     data.Int(1),
+					"_meta": meta,
+				})
+			})
+
+			Convey("Then the original record should not be modified", func() {
+				So(rec, ShouldResemble, data.Map{"x": data.Int(1)})
+			})
+		})
+
+		Convey("When metadata is attached to an array of records", func() {
+			v := attachMetadata(data.Array{
+				data.Map{"x": data.Int(1)}, data.Int(2),
+			}, "_meta", meta)
+
+			Convey("Then only maps should have metadata", func() {
+				So(v, ShouldResemble, data.Array{
+					data.Map{"x": data.Int(1), "_meta": meta},
+					data.Int(2),
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,230 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// metricSlotSeconds is the granularity of rolling metrics.
+	metricSlotSeconds = 5
+
+	// metricSlots is the number of slots covering the longest window.
+	metricSlots = 3600 / metricSlotSeconds
+)
+
+// metricWindows are windows of rolling metrics.
+var metricWindows = []struct {
+	name string
+	d    time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+}
+
+// metricSlot aggregates observations of a period of metricSlotSeconds.
+type metricSlot struct {
+	index         int64
+	fits          int64
+	fitErrors     int64
+	lossSum       float64
+	losses        int64
+	accuracySum   float64
+	accuracies    int64
+	predicts      int64
+	predictErrors int64
+	latency       time.Duration
+}
+
+func (s *metricSlot) merge(o *metricSlot) {
+	s.fits += o.fits
+	s.fitErrors += o.fitErrors
+	s.lossSum += o.lossSum
+	s.losses += o.losses
+	s.accuracySum += o.accuracySum
+	s.accuracies += o.accuracies
+	s.predicts += o.predicts
+	s.predictErrors += o.predictErrors
+	s.latency += o.latency
+}
+
+// rollingMetrics aggregates losses, accuracies, predict latencies, and error
+// rates over windows of the last 1 minute, 5 minutes, and 1 hour, which are
+// less noisy than values of the last batch.
+type rollingMetrics struct {
+	mu    sync.Mutex
+	slots []metricSlot
+}
+
+// slot returns the slot of the time. It must be called with the lock.
+func (m *rollingMetrics) slot(now time.Time) *metricSlot {
+	if m.slots == nil {
+		m.slots = make([]metricSlot, metricSlots)
+	}
+	i := now.Unix() / metricSlotSeconds
+	s := &m.slots[i%metricSlots]
+	if s.index != i {
+		*s = metricSlot{index: i}
+	}
+	return s
+}
+
+func (m *rollingMetrics) observeFit(now time.Time, res *FitResult, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.slot(now)
+	s.fits++
+	if err != nil {
+		s.fitErrors++
+		return
+	}
+	if res.Loss != nil {
+		s.lossSum += *res.Loss
+		s.losses++
+	}
+	if res.Accuracy != nil {
+		s.accuracySum += *res.Accuracy
+		s.accuracies++
+	}
+}
+
+func (m *rollingMetrics) observePredict(now time.Time, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.slot(now)
+	s.predicts++
+	s.latency += latency
+	if err != nil {
+		s.predictErrors++
+	}
+}
+
+// aggregate returns observations in the window ending at now.
+func (m *rollingMetrics) aggregate(now time.Time, d time.Duration) metricSlot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res metricSlot
+	last := now.Unix() / metricSlotSeconds
+	first := last - int64(d/time.Second)/metricSlotSeconds
+	for i := range m.slots {
+		if s := &m.slots[i]; s.index > first && s.index <= last {
+			res.merge(s)
+		}
+	}
+	return res
+}
+
+// values returns aggregates of the window. A value is absent when there's
+// no observation for it.
+func (s *metricSlot) values() map[string]float64 {
+	res := map[string]float64{
+		"fits":     float64(s.fits),
+		"predicts": float64(s.predicts),
+	}
+	if s.fits > 0 {
+		res["fit_error_rate"] = float64(s.fitErrors) / float64(s.fits)
+	}
+	if s.losses > 0 {
+		res["loss"] = s.lossSum / float64(s.losses)
+	}
+	if s.accuracies > 0 {
+		res["accuracy"] = s.accuracySum / float64(s.accuracies)
+	}
+	if s.predicts > 0 {
+		res["predict_error_rate"] = float64(s.predictErrors) / float64(s.predicts)
+		res["predict_latency_seconds"] = s.latency.Seconds() / float64(s.predicts)
+	}
+	return res
+}
+
+// toMap returns aggregates of all windows.
+func (m *rollingMetrics) toMap(now time.Time) data.Map {
+	res := data.Map{}
+	for _, w := range metricWindows {
+		s := m.aggregate(now, w.d)
+		vs := data.Map{}
+		for k, v := range s.values() {
+			vs[k] = data.Float(v)
+		}
+		res[w.name] = vs
+	}
+	return res
+}
+
+// MetricsHandler returns an http.Handler exposing metrics of all pymlstate
+// states of the context in the Prometheus text format. Exposed metrics are
+// listed in README.md.
+func MetricsHandler(ctx *core.Context) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := WritePrometheusMetrics(ctx, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// WritePrometheusMetrics writes metrics exposed by MetricsHandler to w.
+func WritePrometheusMetrics(ctx *core.Context, w io.Writer) error {
+	states, err := ctx.SharedStates.List()
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for name, st := range states {
+		if _, ok := st.(*State); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// Samples are grouped by metrics as required by the format.
+	now := time.Now()
+	samples := map[string][]string{}
+	for _, name := range names {
+		s := states[name].(*State)
+		for _, win := range metricWindows {
+			agg := s.metrics.aggregate(now, win.d)
+			for k, v := range agg.values() {
+				samples[k] = append(samples[k],
+					fmt.Sprintf("pymlstate_%v{state=%q,window=%q} %v\n", k, name, win.name, v))
+			}
+		}
+		for k, lines := range s.predictions.prometheusLines(name) {
+			samples[k] = append(samples[k], lines...)
+		}
+	}
+	metrics := make([]string, 0, len(samples))
+	for k := range samples {
+		metrics = append(metrics, k)
+	}
+	sort.Strings(metrics)
+	for _, k := range metrics {
+		if _, err := fmt.Fprintf(w, "# TYPE pymlstate_%v gauge\n", k); err != nil {
+			return err
+		}
+		for _, line := range samples[k] {
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := io.WriteString(w, "# TYPE pymlstate_wait_seconds histogram\n"); err != nil {
+		return err
+	}
+	for _, name := range names {
+		for _, line := range states[name].(*State).waits.prometheusLines(name) {
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return writeCheckpointGCMetrics(w)
+}
@@ -0,0 +1,76 @@
+package pymlstate
+
+import (
+	"bytes"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestRollingMetrics(t *testing.T) {
+	Convey("Given rolling metrics", t, func() {
+		var m rollingMetrics
+		now := time.Unix(1000000, 0)
+		loss := func(x float64) *FitResult { return &FitResult{Loss: &x} }
+
+		Convey("When results are observed at different times", func() {
+			m.observeFit(now.Add(-30*time.Minute), loss(4), nil)
+			m.observeFit(now.Add(-3*time.Minute), loss(2), nil)
+			m.observeFit(now.Add(-10*time.Second), loss(1), nil)
+			m.observeFit(now, nil, errors.New("failed"))
+			m.observePredict(now.Add(-2*time.Minute), 30*time.Millisecond, nil)
+			m.observePredict(now, 10*time.Millisecond, errors.New("failed"))
+
+			Convey("Then each window should aggregate results in it", func() {
+				st := m.toMap(now)
+				w1 := st["1m"].(data.Map)
+				So(w1["loss"], ShouldEqual, data.Float(1))
+				So(w1["fits"], ShouldEqual, data.Float(2))
+				So(w1["fit_error_rate"], ShouldEqual, data.Float(0.5))
+				So(w1["predict_error_rate"], ShouldEqual, data.Float(1))
+				So(w1, ShouldNotContainKey, "accuracy")
+
+				w5 := st["5m"].(data.Map)
+				So(w5["loss"], ShouldEqual, data.Float(1.5))
+				So(w5["predict_latency_seconds"], ShouldAlmostEqual, 0.02)
+				So(w5["predict_error_rate"], ShouldEqual, data.Float(0.5))
+
+				w60 := st["1h"].(data.Map)
+				So(w60["loss"], ShouldAlmostEqual, 7.0/3)
+			})
+
+			Convey("Then old results should drop out of windows", func() {
+				st := m.toMap(now.Add(2 * time.Hour))
+				So(st["1h"], ShouldResemble, data.Map{"fits": data.Float(0), "predicts": data.Float(0)})
+			})
+		})
+	})
+
+	Convey("Given a context having a state which trained a batch", t, func() {
+		ctx := core.NewContext(&core.ContextConfig{})
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.Map{"loss": data.Float(0.5)}, nil
+			},
+		}
+		s := &State{base: b}
+		So(ctx.SharedStates.Add("model1", "pymlstate", s), ShouldBeNil)
+		_, err := s.Fit(ctx, []data.Value{data.Map{"x": data.Int(1)}})
+		So(err, ShouldBeNil)
+
+		Convey("When metrics are written in the Prometheus format", func() {
+			w := &bytes.Buffer{}
+			So(WritePrometheusMetrics(ctx, w), ShouldBeNil)
+
+			Convey("Then they should have the loss of each window", func() {
+				So(w.String(), ShouldContainSubstring, "# TYPE pymlstate_loss gauge\n"+
+					`pymlstate_loss{state="model1",window="1m"} 0.5`+"\n"+
+					`pymlstate_loss{state="model1",window="5m"} 0.5`+"\n"+
+					`pymlstate_loss{state="model1",window="1h"} 0.5`+"\n")
+			})
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package pymlstate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Migration converts the header of a saved state, which is the part written
+// before the Python model, from a format version to another. It reads the
+// header without the format version from r and writes the converted header
+// without the format version to w. It must not read the Python model
+// following the header.
+type Migration func(r io.Reader, w io.Writer) error
+
+type migrationKey struct {
+	from, to uint8
+}
+
+var (
+	migrationsMutex sync.RWMutex
+	migrations      = map[migrationKey]Migration{
+		{1, 2}: migrateV1ToV2,
+		{2, 3}: migrateV2ToV3,
+	}
+)
+
+// RegisterMigration registers a migration from a format version to another
+// so that Load can read states saved in older format versions. Load applies
+// migrations from the version of a saved state until the current version,
+// choosing the one to the latest version at each step.
+func RegisterMigration(from, to uint8, m Migration) error {
+	if from >= to {
+		return fmt.Errorf("a migration must be from an older format version: %v to %v", from, to)
+	}
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+	k := migrationKey{from, to}
+	if _, ok := migrations[k]; ok {
+		return fmt.Errorf("migration from %v to %v is already registered", from, to)
+	}
+	migrations[k] = m
+	return nil
+}
+
+// nextMigration returns the migration from the version to the latest version
+// not newer than the current one.
+func nextMigration(from uint8) (Migration, uint8, bool) {
+	migrationsMutex.RLock()
+	defer migrationsMutex.RUnlock()
+	var (
+		m  Migration
+		to uint8
+	)
+	for k, x := range migrations {
+		if k.from == from && k.to <= pyMLStateFormatVersion && k.to > to {
+			m, to = x, k.to
+		}
+	}
+	return m, to, m != nil
+}
+
+// migrateHeader migrates the header following the format version read from
+// r to the current format version. The returned reader has the migrated
+// header and the Python model.
+func migrateHeader(r io.Reader, version uint8) (io.Reader, error) {
+	if version > pyMLStateFormatVersion {
+		return nil, fmt.Errorf("unsupported format version of State container: %v", version)
+	}
+	for version < pyMLStateFormatVersion {
+		m, to, ok := nextMigration(version)
+		if !ok {
+			return nil, fmt.Errorf("no migration from the format version %v", version)
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := m(r, buf); err != nil {
+			return nil, fmt.Errorf("cannot migrate the format version %v to %v: %v", version, to, err)
+		}
+		r = io.MultiReader(buf, r)
+		version = to
+	}
+	return r, nil
+}
+
+// Migrate converts the state saved by Save in an older format version read
+// from r to the current format version and writes it to w. The Python model
+// is copied as it is.
+func Migrate(r io.Reader, w io.Writer) error {
+	var version [1]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return err
+	}
+	r, err := migrateHeader(r, version[0])
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{pyMLStateFormatVersion}); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// migrateV1ToV2 adds empty stateData to MLParams.
+func migrateV1ToV2(r io.Reader, w io.Writer) error {
+	var p MLParams
+	if err := readMsgpackSection(r, &p, "MLParams"); err != nil {
+		return err
+	}
+	if err := writeMsgpackSection(w, &p); err != nil {
+		return err
+	}
+	return writeMsgpackSection(w, &stateData{})
+}
+
+// migrateV2ToV3 writes MLParams and stateData as sections of the envelope.
+func migrateV2ToV3(r io.Reader, w io.Writer) error {
+	var (
+		p  MLParams
+		sd stateData
+	)
+	if err := readMsgpackSection(r, &p, "MLParams"); err != nil {
+		return err
+	}
+	if err := readMsgpackSection(r, &sd, "state data"); err != nil {
+		return err
+	}
+	return writeSections(w, &p, &sd)
+}
@@ -0,0 +1,94 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"testing"
+)
+
+func TestMigration(t *testing.T) {
+	Convey("Given data saved in the format version 2", t, func() {
+		buf := bytes.NewBuffer([]byte{2})
+		So(writeMsgpackSection(buf, &MLParams{BatchSize: 4}), ShouldBeNil)
+		So(writeMsgpackSection(buf, &stateData{ModelVersion: "model:2"}), ShouldBeNil)
+		buf.WriteString("python model")
+
+		Convey("When it's read", func() {
+			saved, sd, r, err := readStateHeader(buf)
+
+			Convey("Then it should be migrated", func() {
+				So(err, ShouldBeNil)
+				So(saved.BatchSize, ShouldEqual, 4)
+				So(sd.ModelVersion, ShouldEqual, "model:2")
+				rest := bytes.NewBuffer(nil)
+				_, err := io.Copy(rest, r)
+				So(err, ShouldBeNil)
+				So(rest.String(), ShouldEqual, "python model")
+			})
+		})
+
+		Convey("When it's migrated by Migrate", func() {
+			out := bytes.NewBuffer(nil)
+			So(Migrate(buf, out), ShouldBeNil)
+
+			Convey("Then it should be in the current format version", func() {
+				So(out.Bytes()[0], ShouldEqual, pyMLStateFormatVersion)
+				saved, _, r, err := readStateHeader(out)
+				So(err, ShouldBeNil)
+				So(saved.BatchSize, ShouldEqual, 4)
+				rest := bytes.NewBuffer(nil)
+				_, err = io.Copy(rest, r)
+				So(err, ShouldBeNil)
+				So(rest.String(), ShouldEqual, "python model")
+			})
+		})
+	})
+
+	Convey("Given data saved in the format version 1", t, func() {
+		buf := bytes.NewBuffer([]byte{1})
+		So(writeMsgpackSection(buf, &MLParams{BatchSize: 5}), ShouldBeNil)
+
+		Convey("When it's read", func() {
+			saved, sd, _, err := readStateHeader(buf)
+
+			Convey("Then it should be migrated through all versions", func() {
+				So(err, ShouldBeNil)
+				So(saved.BatchSize, ShouldEqual, 5)
+				So(sd.Base, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given data saved in a newer format version", t, func() {
+		buf := bytes.NewBuffer([]byte{pyMLStateFormatVersion + 1})
+
+		Convey("When it's read", func() {
+			_, _, _, err := readStateHeader(buf)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a migration", t, func() {
+		m := func(r io.Reader, w io.Writer) error { return nil }
+
+		Convey("When it's registered for versions already migrated", func() {
+			err := RegisterMigration(1, 2, m)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When it's registered to an older version", func() {
+			err := RegisterMigration(3, 2, m)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
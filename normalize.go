@@ -0,0 +1,115 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sync"
+)
+
+// runningStats is the running mean and variance of a feature computed by
+// Welford's algorithm.
+type runningStats struct {
+	Count int64   `codec:"count"`
+	Mean  float64 `codec:"mean"`
+	M2    float64 `codec:"m2"`
+}
+
+func (st *runningStats) add(x float64) {
+	st.Count++
+	d := x - st.Mean
+	st.Mean += d / float64(st.Count)
+	st.M2 += d * (x - st.Mean)
+}
+
+func (st *runningStats) variance() float64 {
+	if st.Count == 0 {
+		return 0
+	}
+	return st.M2 / float64(st.Count)
+}
+
+// zscore returns the z-score of x. It returns 0 when the variance is 0
+// because x cannot be scaled.
+func (st *runningStats) zscore(x float64) float64 {
+	sd := math.Sqrt(st.variance())
+	if sd == 0 {
+		return 0
+	}
+	return (x - st.Mean) / sd
+}
+
+// normalizer applies z-score normalization to numeric features. Statistics
+// are updated by records used for training and the same statistics are
+// applied to records used for prediction.
+type normalizer struct {
+	names []string
+	paths []data.Path
+
+	// mu protects stats because records can be processed concurrently by
+	// Fit and Predict, which only acquire the read lock of State.
+	mu    sync.Mutex
+	stats []runningStats
+}
+
+var _ preprocessor = &normalizer{}
+
+func newNormalizer(paths []string) (*normalizer, error) {
+	ps, err := compilePaths(paths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid normalize_paths: %v", err)
+	}
+	return &normalizer{
+		names: paths,
+		paths: ps,
+		stats: make([]runningStats, len(paths)),
+	}, nil
+}
+
+func (n *normalizer) process(rec data.Map, training bool, rep *qualityReport) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, p := range n.paths {
+		v, err := rec.Get(p)
+		if err != nil || v.Type() == data.TypeNull {
+			continue
+		}
+		x, err := asNumber(v)
+		if err != nil {
+			rep.typeMismatch(n.names[i])
+			return fmt.Errorf("cannot normalize '%v': %v", n.names[i], err)
+		}
+
+		st := &n.stats[i]
+		if training {
+			st.add(x)
+		}
+		if err := rec.Set(p, data.Float(st.zscore(x))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot returns a copy of statistics keyed by paths.
+func (n *normalizer) snapshot() map[string]runningStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	res := make(map[string]runningStats, len(n.names))
+	for i, name := range n.names {
+		res[name] = n.stats[i]
+	}
+	return res
+}
+
+// restore sets statistics saved by snapshot. Statistics of paths which are
+// no longer normalized are ignored.
+func (n *normalizer) restore(stats map[string]runningStats) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, name := range n.names {
+		if st, ok := stats[name]; ok {
+			n.stats[i] = st
+		}
+	}
+}
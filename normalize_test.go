@@ -0,0 +1,65 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestNormalizer(t *testing.T) {
+	Convey("Given a normalizer", t, func() {
+		n, err := newNormalizer([]string{"x"})
+		So(err, ShouldBeNil)
+
+		Convey("When training records are processed", func() {
+			for _, x := range []data.Value{data.Int(1), data.Float(3)} {
+				So(n.process(data.Map{"x": x}, true, nil), ShouldBeNil)
+			}
+
+			Convey("Then statistics should be updated", func() {
+				st := n.snapshot()["x"]
+				So(st.Count, ShouldEqual, 2)
+				So(st.Mean, ShouldEqual, 2)
+				So(st.variance(), ShouldEqual, 1)
+			})
+
+			Convey("And when a record for prediction is processed", func() {
+				rec := data.Map{"x": data.Int(4)}
+				So(n.process(rec, false, nil), ShouldBeNil)
+
+				Convey("Then it should be normalized without updating statistics", func() {
+					So(rec["x"], ShouldEqual, data.Float(2))
+					So(n.snapshot()["x"].Count, ShouldEqual, 2)
+				})
+			})
+
+			Convey("And when statistics are restored to another normalizer", func() {
+				n2, err := newNormalizer([]string{"x", "y"})
+				So(err, ShouldBeNil)
+				n2.restore(n.snapshot())
+
+				Convey("Then it should have the same statistics", func() {
+					So(n2.snapshot()["x"], ShouldResemble, n.snapshot()["x"])
+					So(n2.snapshot()["y"].Count, ShouldEqual, 0)
+				})
+			})
+		})
+
+		Convey("When a record having a constant feature is processed", func() {
+			rec := data.Map{"x": data.Int(1)}
+			So(n.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then the feature should be 0", func() {
+				So(rec["x"], ShouldEqual, data.Float(0))
+			})
+		})
+
+		Convey("When a record having a non-numeric feature is processed", func() {
+			err := n.process(data.Map{"x": data.String("a")}, true, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,170 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sort"
+)
+
+// Objective combines metrics returned by the evaluation method of the model
+// into a score by which models are compared. The score is the weighted sum
+// of metrics in Weights. A model violating any of Constraints has the score
+// of negative infinity so that it never beats a model satisfying them.
+type Objective struct {
+	Weights     map[string]float64    `codec:"weights"`
+	Constraints []ObjectiveConstraint `codec:"constraints"`
+}
+
+// ObjectiveConstraint requires a metric to be at least Min and at most Max.
+// At least one of them must be set.
+type ObjectiveConstraint struct {
+	Metric string   `codec:"metric"`
+	Min    *float64 `codec:"min"`
+	Max    *float64 `codec:"max"`
+}
+
+// score computes the score from the result of the evaluation method, which
+// must be a map having all metrics of the objective. It returns the result
+// itself as the score when o is nil.
+func (o *Objective) score(method string, res data.Value) (float64, error) {
+	if o == nil {
+		m, err := asNumber(res)
+		if err != nil {
+			return 0, fmt.Errorf("%v must return a number: %v", method, err)
+		}
+		return m, nil
+	}
+	metrics, err := data.AsMap(res)
+	if err != nil {
+		return 0, fmt.Errorf("%v must return a map of metrics for the objective: %v", method, err)
+	}
+	metricOf := func(name string) (float64, error) {
+		v, ok := metrics[name]
+		if !ok {
+			return 0, fmt.Errorf("%v doesn't return the metric '%v' of the objective", method, name)
+		}
+		m, err := asNumber(v)
+		if err != nil {
+			return 0, fmt.Errorf("the metric '%v' returned by %v must be a number: %v", name, method, err)
+		}
+		return m, nil
+	}
+
+	feasible := true
+	for _, c := range o.Constraints {
+		m, err := metricOf(c.Metric)
+		if err != nil {
+			return 0, err
+		}
+		if (c.Min != nil && m < *c.Min) || (c.Max != nil && m > *c.Max) {
+			feasible = false
+		}
+	}
+
+	// Metrics are summed in a fixed order so that the same metrics always
+	// have the same score.
+	names := make([]string, 0, len(o.Weights))
+	for name := range o.Weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	score := 0.0
+	for _, name := range names {
+		m, err := metricOf(name)
+		if err != nil {
+			return 0, err
+		}
+		score += o.Weights[name] * m
+	}
+	if !feasible {
+		return math.Inf(-1), nil
+	}
+	return score, nil
+}
+
+// parseObjective parses the objective given as a map having "weights",
+// which is a map from metrics to their weights, and "constraints", which is
+// an array of maps having "metric" and "min" or "max", e.g.
+//
+//	{"weights": {"precision": 0.7, "recall": 0.3},
+//	 "constraints": [{"metric": "latency", "max": 0.1}]}
+func parseObjective(v data.Value) (*Objective, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("objective must be a map: %v", err)
+	}
+	o := &Objective{}
+	for k, x := range m {
+		switch k {
+		case "weights":
+			w, err := data.AsMap(x)
+			if err != nil {
+				return nil, fmt.Errorf("weights of objective must be a map: %v", err)
+			}
+			o.Weights = make(map[string]float64, len(w))
+			for name, y := range w {
+				f, err := data.ToFloat(y)
+				if err != nil {
+					return nil, fmt.Errorf("the weight of '%v' must be a number: %v", name, err)
+				}
+				o.Weights[name] = f
+			}
+
+		case "constraints":
+			a, err := data.AsArray(x)
+			if err != nil {
+				return nil, fmt.Errorf("constraints of objective must be an array: %v", err)
+			}
+			for i, y := range a {
+				c, err := parseObjectiveConstraint(y)
+				if err != nil {
+					return nil, fmt.Errorf("invalid constraint %v of objective: %v", i, err)
+				}
+				o.Constraints = append(o.Constraints, c)
+			}
+
+		default:
+			return nil, fmt.Errorf("unknown parameter of objective: %v", k)
+		}
+	}
+	if len(o.Weights) == 0 {
+		return nil, fmt.Errorf("objective must have weights of metrics")
+	}
+	return o, nil
+}
+
+func parseObjectiveConstraint(v data.Value) (ObjectiveConstraint, error) {
+	c := ObjectiveConstraint{}
+	m, err := data.AsMap(v)
+	if err != nil {
+		return c, fmt.Errorf("a constraint must be a map: %v", err)
+	}
+	for k, x := range m {
+		switch k {
+		case "metric":
+			c.Metric, err = data.AsString(x)
+		case "min", "max":
+			var f float64
+			if f, err = data.ToFloat(x); err == nil {
+				if k == "min" {
+					c.Min = &f
+				} else {
+					c.Max = &f
+				}
+			}
+		default:
+			return c, fmt.Errorf("unknown parameter: %v", k)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid %v: %v", k, err)
+		}
+	}
+	if c.Metric == "" {
+		return c, fmt.Errorf("metric must be set")
+	}
+	if c.Min == nil && c.Max == nil {
+		return c, fmt.Errorf("min or max must be set")
+	}
+	return c, nil
+}
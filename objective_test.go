@@ -0,0 +1,113 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestObjective(t *testing.T) {
+	Convey("Given a composite objective", t, func() {
+		o, err := parseObjective(data.Map{
+			"weights": data.Map{"precision": data.Float(0.5), "recall": data.Int(2)},
+			"constraints": data.Array{
+				data.Map{"metric": data.String("latency"), "max": data.Float(0.1)},
+			},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When metrics satisfy constraints", func() {
+			m, err := o.score("evaluate", data.Map{
+				"precision": data.Float(0.8), "recall": data.Float(0.5), "latency": data.Float(0.05),
+			})
+
+			Convey("Then the score should be the weighted sum", func() {
+				So(err, ShouldBeNil)
+				So(m, ShouldAlmostEqual, 1.4)
+			})
+		})
+
+		Convey("When metrics violate a constraint", func() {
+			m, err := o.score("evaluate", data.Map{
+				"precision": data.Float(1), "recall": data.Float(1), "latency": data.Float(0.2),
+			})
+
+			Convey("Then the score should be negative infinity", func() {
+				So(err, ShouldBeNil)
+				So(math.IsInf(m, -1), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a metric is missing", func() {
+			_, err := o.score("evaluate", data.Map{"precision": data.Float(1), "latency": data.Float(0)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the result isn't a map", func() {
+			_, err := o.score("evaluate", data.Float(1))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given no objective", t, func() {
+		var o *Objective
+
+		Convey("When a number is scored", func() {
+			m, err := o.score("evaluate", data.Int(3))
+
+			Convey("Then it should be the score", func() {
+				So(err, ShouldBeNil)
+				So(m, ShouldEqual, 3)
+			})
+		})
+	})
+
+	Convey("Given invalid objectives", t, func() {
+		for _, v := range []data.Value{
+			data.String("a"),
+			data.Map{},
+			data.Map{"weights": data.Map{"a": data.String("x")}},
+			data.Map{"weights": data.Map{"a": data.Int(1)}, "constraints": data.Array{data.Map{"metric": data.String("b")}}},
+			data.Map{"weights": data.Map{"a": data.Int(1)}, "constraints": data.Array{data.Map{"min": data.Int(1)}}},
+			data.Map{"weights": data.Map{"a": data.Int(1)}, "unknown": data.Int(1)},
+		} {
+			_, err := parseObjective(v)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Given a state evaluated by an objective", t, func() {
+		s := &State{params: MLParams{
+			BatchSize: 1,
+			Objective: &Objective{
+				Weights:     map[string]float64{"accuracy": 1},
+				Constraints: []ObjectiveConstraint{{Metric: "recall", Min: new(float64)}},
+			},
+		}}
+		*s.params.Objective.Constraints[0].Min = 0.5
+		So(s.setUpParams(), ShouldBeNil)
+		b := &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+			return data.Map{"accuracy": data.Float(0.9), "recall": data.Float(0.4)}, nil
+		}}
+
+		Convey("When a model violating constraints is evaluated", func() {
+			m, err := s.evaluateModel(b, "evaluate", data.Array{data.Map{}})
+			So(err, ShouldBeNil)
+			h := newMetricHistory(1)
+			h.add(metricPoint{Time: time.Now(), Value: m})
+
+			Convey("Then its metric should never beat other models", func() {
+				So(math.IsInf(m, -1), ShouldBeTrue)
+				So(h.toArray()[0].(data.Map)["value"], ShouldEqual, data.Null{})
+			})
+		})
+	})
+}
@@ -12,6 +12,62 @@ func init() {
 		udf.MustConvertGeneric(pymlstate.Fit))
 	udf.MustRegisterGlobalUDF("pymlstate_predict",
 		udf.MustConvertGeneric(pymlstate.Predict))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_with_request_id",
+		udf.MustConvertGeneric(pymlstate.PredictWithRequestID))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_async",
+		udf.MustConvertGeneric(pymlstate.PredictAsync))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_result",
+		udf.MustConvertGeneric(pymlstate.PredictResult))
 	udf.MustRegisterGlobalUDF("pymlstate_flush",
 		udf.MustConvertGeneric(pymlstate.Flush))
+	udf.MustRegisterGlobalUDF("pymlstate_reload_module",
+		udf.MustConvertGeneric(pymlstate.ReloadModule))
+	udf.MustRegisterGlobalUDF("pymlstate_deploy_from_registry",
+		udf.MustConvertGeneric(pymlstate.DeployFromRegistry))
+	udf.MustRegisterGlobalUDF("pymlstate_retrain_from",
+		udf.MustConvertGeneric(pymlstate.RetrainFrom))
+	udf.MustRegisterGlobalUDF("pymlstate_status",
+		udf.MustConvertGeneric(pymlstate.Status))
+	udf.MustRegisterGlobalUDF("pymlstate_list_states",
+		udf.MustConvertGeneric(pymlstate.ListStates))
+	udf.MustRegisterGlobalUDF("pymlstate_list_tenant_states",
+		udf.MustConvertGeneric(pymlstate.ListTenantStates))
+	udf.MustRegisterGlobalUDF("pymlstate_load_shadow",
+		udf.MustConvertGeneric(pymlstate.LoadShadow))
+	udf.MustRegisterGlobalUDF("pymlstate_promote_shadow",
+		udf.MustConvertGeneric(pymlstate.PromoteShadow))
+	udf.MustRegisterGlobalUDF("pymlstate_reload_reference",
+		udf.MustConvertGeneric(pymlstate.ReloadReference))
+	udf.MustRegisterGlobalUDF("pymlstate_write_replay",
+		udf.MustConvertGeneric(pymlstate.WriteReplay))
+	udf.MustRegisterGlobalUDF("pymlstate_choose",
+		udf.MustConvertGeneric(pymlstate.Choose))
+	udf.MustRegisterGlobalUDF("pymlstate_reward",
+		udf.MustConvertGeneric(pymlstate.Reward))
+	udf.MustRegisterGlobalUDF("pymlstate_act",
+		udf.MustConvertGeneric(pymlstate.Act))
+	udf.MustRegisterGlobalUDF("pymlstate_observe",
+		udf.MustConvertGeneric(pymlstate.Observe))
+	udf.MustRegisterGlobalUDF("pymlstate_rank",
+		udf.MustConvertGeneric(pymlstate.Rank))
+	udf.MustRegisterGlobalUDF("pymlstate_embed",
+		udf.MustConvertGeneric(pymlstate.Embed))
+	udf.MustRegisterGlobalUDF("pymlstate_nearest_neighbors",
+		udf.MustConvertGeneric(pymlstate.NearestNeighbors))
+	udf.MustRegisterGlobalUDF("pymlstate_assign_cluster",
+		udf.MustConvertGeneric(pymlstate.AssignCluster))
+	udf.MustRegisterGlobalUDF("pymlstate_cluster_centers",
+		udf.MustConvertGeneric(pymlstate.ClusterCenters))
+	udf.MustRegisterGlobalUDF("pymlstate_correct",
+		udf.MustConvertGeneric(pymlstate.Correct))
+	udf.MustRegisterGlobalUDF("pymlstate_trace",
+		udf.MustConvertGeneric(pymlstate.Trace))
+	udf.MustRegisterGlobalUDF("pymlstate_wait_ready",
+		udf.MustConvertGeneric(pymlstate.WaitReady))
+	udf.MustRegisterGlobalUDF("pymlstate_enable",
+		udf.MustConvertGeneric(pymlstate.Enable))
+	udf.MustRegisterGlobalUDF("pymlstate_data_stats",
+		udf.MustConvertGeneric(pymlstate.DataStats))
+	udf.MustRegisterGlobalUDF("pymlstate_reset_data_stats",
+		udf.MustConvertGeneric(pymlstate.ResetDataStats))
 }
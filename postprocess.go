@@ -0,0 +1,231 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sync"
+)
+
+// Postprocessor fixes up a result of Predict. A state uses postprocessors
+// registered with names given by the postprocess parameter.
+type Postprocessor interface {
+	// Postprocess returns the fixed up value. It must not modify the value
+	// because it can be shared with the prediction cache, and it must be
+	// safe for concurrent use.
+	Postprocess(v data.Value) (data.Value, error)
+}
+
+// PostprocessorFunc is a function used as a Postprocessor.
+type PostprocessorFunc func(v data.Value) (data.Value, error)
+
+// Postprocess calls f(v).
+func (f PostprocessorFunc) Postprocess(v data.Value) (data.Value, error) {
+	return f(v)
+}
+
+var (
+	postprocessorsMutex sync.RWMutex
+	postprocessors      = map[string]Postprocessor{}
+)
+
+// RegisterPostprocessor registers a postprocessor with a name so that states
+// can use it by the postprocess parameter. "clamp" and "labels" are built
+// in.
+func RegisterPostprocessor(name string, p Postprocessor) error {
+	postprocessorsMutex.Lock()
+	defer postprocessorsMutex.Unlock()
+	if _, ok := postprocessors[name]; ok || name == "clamp" || name == "labels" {
+		return fmt.Errorf("postprocessor '%v' is already registered", name)
+	}
+	postprocessors[name] = p
+	return nil
+}
+
+// PostprocessStep is a step applied to results of Predict in order. Type is
+// "clamp", which clamps numbers into [Min, Max], "labels", which maps
+// integer indices to Labels, or the name of a postprocessor registered by
+// RegisterPostprocessor. Built-in steps also apply to arrays of values. The
+// step applies to the value at Path of a map result, or to the whole result
+// when Path is empty.
+type PostprocessStep struct {
+	Type   string   `codec:"type"`
+	Path   string   `codec:"path"`
+	Min    float64  `codec:"min"`
+	Max    float64  `codec:"max"`
+	Labels []string `codec:"labels"`
+}
+
+type postprocessStep struct {
+	PostprocessStep
+	path data.Path
+	p    Postprocessor
+}
+
+// postprocessor applies steps to results of Predict.
+type postprocessor struct {
+	steps []postprocessStep
+}
+
+func newPostprocessor(steps []PostprocessStep) (*postprocessor, error) {
+	pp := &postprocessor{}
+	for i, st := range steps {
+		s := postprocessStep{PostprocessStep: st}
+		if st.Path != "" {
+			p, err := data.CompilePath(st.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path of the postprocess step %v: %v", i, err)
+			}
+			s.path = p
+		}
+
+		switch st.Type {
+		case "clamp":
+			if st.Min > st.Max {
+				return nil, fmt.Errorf("min of the postprocess step %v must not be greater than max", i)
+			}
+			s.p = PostprocessorFunc(st.clamp)
+		case "labels":
+			if len(st.Labels) == 0 {
+				return nil, fmt.Errorf("the postprocess step %v must have labels", i)
+			}
+			s.p = PostprocessorFunc(st.label)
+		default:
+			postprocessorsMutex.RLock()
+			p, ok := postprocessors[st.Type]
+			postprocessorsMutex.RUnlock()
+			if !ok {
+				return nil, fmt.Errorf("postprocessor '%v' isn't registered", st.Type)
+			}
+			s.p = p
+		}
+		pp.steps = append(pp.steps, s)
+	}
+	return pp, nil
+}
+
+func (pp *postprocessor) process(res data.Value) (data.Value, error) {
+	for i, s := range pp.steps {
+		if s.path == nil {
+			v, err := s.p.Postprocess(res)
+			if err != nil {
+				return nil, fmt.Errorf("cannot postprocess the result by '%v': %v", s.Type, err)
+			}
+			res = v
+			continue
+		}
+
+		m, err := data.AsMap(res)
+		if err != nil {
+			return nil, fmt.Errorf("the postprocess step %v needs a map result: %v", i, err)
+		}
+		v, err := m.Get(s.path)
+		if err != nil {
+			return nil, fmt.Errorf("the result doesn't have '%v': %v", s.Path, err)
+		}
+		if v, err = s.p.Postprocess(v); err != nil {
+			return nil, fmt.Errorf("cannot postprocess '%v' by '%v': %v", s.Path, s.Type, err)
+		}
+		m = m.Copy()
+		if err := m.Set(s.path, v); err != nil {
+			return nil, err
+		}
+		res = m
+	}
+	return res, nil
+}
+
+// clamp clamps a number or numbers in an array. Integers are clamped into
+// integers in the range.
+func (st PostprocessStep) clamp(v data.Value) (data.Value, error) {
+	switch v.Type() {
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		if f := math.Ceil(st.Min); float64(i) < f {
+			i = int64(f)
+		} else if f := math.Floor(st.Max); float64(i) > f {
+			i = int64(f)
+		}
+		return data.Int(i), nil
+	case data.TypeFloat:
+		f, _ := data.AsFloat(v)
+		return data.Float(math.Min(math.Max(f, st.Min), st.Max)), nil
+	case data.TypeArray:
+		return mapArray(v, st.clamp)
+	}
+	return nil, fmt.Errorf("%v isn't a number", v.Type())
+}
+
+// label maps an index or indices in an array to labels.
+func (st PostprocessStep) label(v data.Value) (data.Value, error) {
+	switch v.Type() {
+	case data.TypeInt, data.TypeFloat:
+		f, _ := asNumber(v)
+		if f != math.Trunc(f) || f < 0 || f >= float64(len(st.Labels)) {
+			return nil, fmt.Errorf("no label for the index %v", f)
+		}
+		return data.String(st.Labels[int(f)]), nil
+	case data.TypeArray:
+		return mapArray(v, st.label)
+	}
+	return nil, fmt.Errorf("%v isn't an index", v.Type())
+}
+
+// mapArray returns a new array having f applied to elements of the array.
+func mapArray(v data.Value, f func(data.Value) (data.Value, error)) (data.Value, error) {
+	a, _ := data.AsArray(v)
+	res := make(data.Array, len(a))
+	for i, e := range a {
+		x, err := f(e)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = x
+	}
+	return res, nil
+}
+
+func parsePostprocess(v data.Value) ([]PostprocessStep, error) {
+	a, err := data.AsArray(v)
+	if err != nil {
+		return nil, fmt.Errorf("postprocess must be an array: %v", err)
+	}
+	steps := make([]PostprocessStep, 0, len(a))
+	for i, x := range a {
+		m, err := data.AsMap(x)
+		if err != nil {
+			return nil, fmt.Errorf("postprocess step %v must be a map: %v", i, err)
+		}
+		st := PostprocessStep{}
+		hasMin, hasMax := false, false
+		for k, y := range m {
+			switch k {
+			case "type":
+				st.Type, err = data.AsString(y)
+			case "path":
+				st.Path, err = data.AsString(y)
+			case "min":
+				st.Min, err = data.ToFloat(y)
+				hasMin = true
+			case "max":
+				st.Max, err = data.ToFloat(y)
+				hasMax = true
+			case "labels":
+				st.Labels, err = asStringSlice(y)
+			default:
+				return nil, fmt.Errorf("unknown parameter of postprocess step %v: %v", i, k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v of postprocess step %v: %v", k, i, err)
+			}
+		}
+		if st.Type == "" {
+			return nil, fmt.Errorf("postprocess step %v must have type", i)
+		}
+		if st.Type == "clamp" && !(hasMin && hasMax) {
+			return nil, fmt.Errorf("postprocess step %v must have min and max", i)
+		}
+		steps = append(steps, st)
+	}
+	return steps, nil
+}
@@ -0,0 +1,133 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"testing"
+)
+
+func TestPostprocess(t *testing.T) {
+	err := RegisterPostprocessor("upper", PostprocessorFunc(func(v data.Value) (data.Value, error) {
+		str, err := data.AsString(v)
+		if err != nil {
+			return nil, err
+		}
+		return data.String(strings.ToUpper(str)), nil
+	}))
+
+	Convey("Given a state with postprocess steps", t, func() {
+		So(err, ShouldBeNil)
+		ctx := core.NewContext(nil)
+		var res data.Value
+		s := &State{base: &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return res, nil
+			},
+		}, params: MLParams{BatchSize: 1, Postprocess: []PostprocessStep{
+			{Type: "clamp", Path: "score", Min: 0, Max: 1},
+			{Type: "labels", Path: "class", Labels: []string{"cat", "dog"}},
+			{Type: "upper", Path: "class"},
+		}}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When a result is predicted", func() {
+			res = data.Map{
+				"score": data.Float(1.5),
+				"class": data.Int(1),
+			}
+			v, err := s.Predict(ctx, data.Map{})
+
+			Convey("Then the steps should be applied in order", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Map{
+					"score": data.Float(1),
+					"class": data.String("DOG"),
+				})
+			})
+
+			Convey("Then the result of the model shouldn't be modified", func() {
+				So(res.(data.Map)["class"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When a result has an unknown index", func() {
+			res = data.Map{
+				"score": data.Float(0.5),
+				"class": data.Int(2),
+			}
+			_, err := s.Predict(ctx, data.Map{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given built-in steps without paths", t, func() {
+		Convey("When numbers in an array are clamped", func() {
+			pp, err := newPostprocessor([]PostprocessStep{{Type: "clamp", Min: -0.5, Max: 2.5}})
+			So(err, ShouldBeNil)
+			v, err := pp.process(data.Array{data.Int(-3), data.Float(0.25), data.Int(5)})
+
+			Convey("Then integers should stay integers in the range", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{data.Int(0), data.Float(0.25), data.Int(2)})
+			})
+		})
+
+		Convey("When indices in an array are labeled", func() {
+			pp, err := newPostprocessor([]PostprocessStep{{Type: "labels", Labels: []string{"a", "b"}}})
+			So(err, ShouldBeNil)
+			v, err := pp.process(data.Array{data.Int(1), data.Float(0)})
+
+			Convey("Then they should be mapped to labels", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{data.String("b"), data.String("a")})
+			})
+		})
+	})
+
+	Convey("Given postprocess parameters", t, func() {
+		Convey("When a step is parsed", func() {
+			steps, err := parsePostprocess(data.Array{data.Map{
+				"type": data.String("clamp"),
+				"min":  data.Int(0),
+				"max":  data.Float(1),
+			}})
+
+			Convey("Then it should have the bounds", func() {
+				So(err, ShouldBeNil)
+				So(steps, ShouldResemble, []PostprocessStep{{Type: "clamp", Max: 1}})
+			})
+		})
+
+		Convey("When clamp doesn't have max", func() {
+			_, err := parsePostprocess(data.Array{data.Map{
+				"type": data.String("clamp"),
+				"min":  data.Int(0),
+			}})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the postprocessor isn't registered", func() {
+			_, err := newPostprocessor([]PostprocessStep{{Type: "unknown"}})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a built-in name is registered", func() {
+			err := RegisterPostprocessor("clamp", PostprocessorFunc(nil))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
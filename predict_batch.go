@@ -0,0 +1,109 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// predictBatcher coalesces predictions requested within window into a single
+// call of call. A batch is sent when window has elapsed since its first
+// request or when it has maxSize requests.
+type predictBatcher struct {
+	window  time.Duration
+	maxSize int
+	call    func([]data.Value) ([]data.Value, error)
+
+	mu      sync.Mutex
+	pending []*batchRequest
+	timer   *time.Timer
+
+	// seq identifies the pending batch so that a timer of a batch which has
+	// already been sent doesn't send the next one early.
+	seq uint64
+}
+
+type batchRequest struct {
+	in   data.Value
+	res  data.Value
+	err  error
+	done chan struct{}
+}
+
+func newPredictBatcher(window time.Duration, maxSize int,
+	call func([]data.Value) ([]data.Value, error)) *predictBatcher {
+	return &predictBatcher{
+		window:  window,
+		maxSize: maxSize,
+		call:    call,
+	}
+}
+
+// predict adds the input to the pending batch and waits for its result.
+func (b *predictBatcher) predict(in data.Value) (data.Value, error) {
+	req := &batchRequest{in: in, done: make(chan struct{})}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, req)
+	if len(b.pending) >= b.maxSize {
+		batch := b.take()
+		b.mu.Unlock()
+		b.run(batch)
+	} else {
+		if len(b.pending) == 1 {
+			seq := b.seq
+			b.timer = time.AfterFunc(b.window, func() { b.flush(seq) })
+		}
+		b.mu.Unlock()
+	}
+
+	<-req.done
+	return req.res, req.err
+}
+
+// take removes the pending batch. It must be called while b.mu is locked.
+func (b *predictBatcher) take() []*batchRequest {
+	batch := b.pending
+	b.pending = nil
+	b.seq++
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return batch
+}
+
+// flush sends the pending batch when it's still the batch identified by seq.
+func (b *predictBatcher) flush(seq uint64) {
+	b.mu.Lock()
+	if seq != b.seq || len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	batch := b.take()
+	b.mu.Unlock()
+	b.run(batch)
+}
+
+// run calls call with inputs of the batch and distributes results to
+// requests.
+func (b *predictBatcher) run(batch []*batchRequest) {
+	in := make([]data.Value, len(batch))
+	for i, r := range batch {
+		in[i] = r.in
+	}
+	res, err := b.call(in)
+	if err == nil && len(res) != len(batch) {
+		err = fmt.Errorf("the batched prediction returned %v results for %v inputs",
+			len(res), len(batch))
+	}
+	for i, r := range batch {
+		if err != nil {
+			r.err = err
+		} else {
+			r.res = res[i]
+		}
+		close(r.done)
+	}
+}
@@ -0,0 +1,91 @@
+package pymlstate
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPredictBatcher(t *testing.T) {
+	Convey("Given a predict batcher doubling inputs", t, func() {
+		var (
+			mu    sync.Mutex
+			sizes []int
+		)
+		double := func(in []data.Value) ([]data.Value, error) {
+			mu.Lock()
+			sizes = append(sizes, len(in))
+			mu.Unlock()
+			res := make([]data.Value, len(in))
+			for i, v := range in {
+				n, _ := data.AsInt(v)
+				res[i] = data.Int(n * 2)
+			}
+			return res, nil
+		}
+		b := newPredictBatcher(50*time.Millisecond, 4, double)
+
+		Convey("When predictions are requested concurrently", func() {
+			res := make([]data.Value, 4)
+			errs := make([]error, 4)
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					res[i], errs[i] = b.predict(data.Int(i))
+				}(i)
+			}
+			wg.Wait()
+
+			Convey("Then they should be sent in a batch", func() {
+				So(sizes, ShouldResemble, []int{4})
+				for i := 0; i < 4; i++ {
+					So(errs[i], ShouldBeNil)
+					So(res[i], ShouldEqual, data.Int(i*2))
+				}
+			})
+		})
+
+		Convey("When a single prediction is requested", func() {
+			v, err := b.predict(data.Int(3))
+
+			Convey("Then it should be sent after the window", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(6))
+				So(sizes, ShouldResemble, []int{1})
+			})
+		})
+	})
+
+	Convey("Given a predict batcher returning a wrong number of results", t, func() {
+		b := newPredictBatcher(time.Millisecond, 4, func(in []data.Value) ([]data.Value, error) {
+			return nil, nil
+		})
+
+		Convey("When a prediction is requested", func() {
+			_, err := b.predict(data.Int(1))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a failing predict batcher", t, func() {
+		b := newPredictBatcher(time.Millisecond, 4, func(in []data.Value) ([]data.Value, error) {
+			return nil, fmt.Errorf("failure")
+		})
+
+		Convey("When a prediction is requested", func() {
+			_, err := b.predict(data.Int(1))
+
+			Convey("Then the error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
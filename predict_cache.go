@@ -0,0 +1,149 @@
+package pymlstate
+
+import (
+	"bytes"
+	"container/list"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// predictCache is an LRU cache of prediction results keyed by preprocessed
+// inputs. Entries expire after ttl unless it's 0. All entries are removed by
+// invalidate whenever the model changes.
+type predictCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	// generation is incremented by invalidate. A result computed with an
+	// older generation is stale and isn't cached.
+	generation uint64
+	hits       int64
+	misses     int64
+}
+
+type predictCacheEntry struct {
+	key     string
+	value   data.Value
+	expires time.Time
+}
+
+func newPredictCache(size int, ttl time.Duration) *predictCache {
+	return &predictCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// get returns the cached result of the key and the current generation, which
+// must be passed to put when the result isn't cached.
+func (c *predictCache) get(key string, now time.Time) (data.Value, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		ent := e.Value.(*predictCacheEntry)
+		if c.ttl <= 0 || now.Before(ent.expires) {
+			c.lru.MoveToFront(e)
+			c.hits++
+			return ent.value, c.generation, true
+		}
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+	c.misses++
+	return nil, c.generation, false
+}
+
+// put caches the result computed at the generation. It ignores the result
+// when the cache has been invalidated since then.
+func (c *predictCache) put(key string, v data.Value, generation uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	ent := &predictCacheEntry{key: key, value: v, expires: now.Add(c.ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = ent
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(ent)
+	for c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*predictCacheEntry).key)
+	}
+}
+
+// invalidate removes all entries. It does nothing when c is nil.
+func (c *predictCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
+
+// stats returns the numbers of hits, misses, and cached entries.
+func (c *predictCache) stats() (hits, misses int64, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses, c.lru.Len()
+}
+
+// predictCacheKey returns the key of preprocessed inputs in the cache. Unlike
+// valueKey, it has types of all values including nested ones, so that inputs
+// such as a string "1" and an integer 1 don't share a result.
+func predictCacheKey(v data.Value) string {
+	b := &bytes.Buffer{}
+	writePredictCacheKey(b, v)
+	return b.String()
+}
+
+func writePredictCacheKey(b *bytes.Buffer, v data.Value) {
+	b.WriteString(v.Type().String())
+	switch v.Type() {
+	case data.TypeArray:
+		a, _ := data.AsArray(v)
+		b.WriteByte('[')
+		for i, e := range a {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writePredictCacheKey(b, e)
+		}
+		b.WriteByte(']')
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Quote(k))
+			b.WriteByte(':')
+			writePredictCacheKey(b, m[k])
+		}
+		b.WriteByte('}')
+	default:
+		b.WriteByte(':')
+		b.WriteString(strconv.Quote(valueKey(v)))
+	}
+}
@@ -0,0 +1,111 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestPredictCache(t *testing.T) {
+	Convey("Given a predict cache of size 2 with TTL", t, func() {
+		c := newPredictCache(2, time.Minute)
+		now := time.Now()
+
+		Convey("When a result is put", func() {
+			_, gen, ok := c.get("a", now)
+			So(ok, ShouldBeFalse)
+			c.put("a", data.Int(1), gen, now)
+
+			Convey("Then it should be returned", func() {
+				v, _, ok := c.get("a", now)
+				So(ok, ShouldBeTrue)
+				So(v, ShouldEqual, data.Int(1))
+
+				hits, misses, n := c.stats()
+				So(hits, ShouldEqual, 1)
+				So(misses, ShouldEqual, 1)
+				So(n, ShouldEqual, 1)
+			})
+
+			Convey("Then it should expire after TTL", func() {
+				_, _, ok := c.get("a", now.Add(time.Minute))
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Then it should be removed by invalidation", func() {
+				c.invalidate()
+				_, _, ok := c.get("a", now)
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the cache is invalidated while a result is computed", func() {
+			_, gen, _ := c.get("a", now)
+			c.invalidate()
+			c.put("a", data.Int(1), gen, now)
+
+			Convey("Then the stale result shouldn't be cached", func() {
+				_, _, ok := c.get("a", now)
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When more results than its size are put", func() {
+			for _, k := range []string{"a", "b"} {
+				_, gen, _ := c.get(k, now)
+				c.put(k, data.String(k), gen, now)
+			}
+			c.get("a", now)
+			_, gen, _ := c.get("c", now)
+			c.put("c", data.String("c"), gen, now)
+
+			Convey("Then the least recently used result should be evicted", func() {
+				_, _, ok := c.get("b", now)
+				So(ok, ShouldBeFalse)
+				_, _, ok = c.get("a", now)
+				So(ok, ShouldBeTrue)
+				_, _, ok = c.get("c", now)
+				So(ok, ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given inputs having the same string representations", t, func() {
+		inputs := []data.Value{
+			data.String("1"), data.Int(1), data.Float(1),
+			data.Map{"x": data.String("1")}, data.Map{"x": data.Int(1)},
+			data.Array{data.String("1")}, data.Array{data.Int(1)},
+		}
+
+		Convey("When their keys are computed", func() {
+			keys := map[string]bool{}
+			for _, in := range inputs {
+				keys[predictCacheKey(in)] = true
+			}
+
+			Convey("Then they should be different", func() {
+				So(len(keys), ShouldEqual, len(inputs))
+			})
+		})
+
+		Convey("When keys of equal maps are computed", func() {
+			a := data.Map{"x": data.Int(1), "y": data.String("a")}
+			b := data.Map{"y": data.String("a"), "x": data.Int(1)}
+
+			Convey("Then they should be the same", func() {
+				So(predictCacheKey(a), ShouldEqual, predictCacheKey(b))
+			})
+		})
+	})
+
+	Convey("Given a nil predict cache", t, func() {
+		var c *predictCache
+
+		Convey("When it's invalidated", func() {
+			Convey("Then it shouldn't panic", func() {
+				So(c.invalidate, ShouldNotPanic)
+			})
+		})
+	})
+}
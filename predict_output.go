@@ -0,0 +1,131 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// PredictOutputField specifies which part of a prediction result is assigned
+// to a named field. When Path is empty, Index is the position of the value
+// in an array result. Otherwise, Path is evaluated on a map result.
+type PredictOutputField struct {
+	Name  string `codec:"name"`
+	Index int    `codec:"index"`
+	Path  string `codec:"path"`
+}
+
+// outputSplitter splits a multi-output prediction result into named fields.
+type outputSplitter struct {
+	fields []PredictOutputField
+	paths  []data.Path
+}
+
+func newOutputSplitter(fields []PredictOutputField) (*outputSplitter, error) {
+	sp := &outputSplitter{
+		fields: fields,
+		paths:  make([]data.Path, len(fields)),
+	}
+	for i, f := range fields {
+		if f.Name == "" {
+			return nil, fmt.Errorf("a name of predict output field must not be empty")
+		}
+		if f.Path == "" {
+			if f.Index < 0 {
+				return nil, fmt.Errorf("index of predict output field '%v' must not be negative", f.Name)
+			}
+			continue
+		}
+		p, err := data.CompilePath(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of predict output field '%v': %v", f.Name, err)
+		}
+		sp.paths[i] = p
+	}
+	return sp, nil
+}
+
+// split creates a map from a prediction result.
+func (sp *outputSplitter) split(v data.Value) (data.Map, error) {
+	res := make(data.Map, len(sp.fields))
+	switch v.Type() {
+	case data.TypeArray:
+		arr, _ := data.AsArray(v)
+		for _, f := range sp.fields {
+			if f.Path != "" {
+				return nil, fmt.Errorf("predict output field '%v' requires a map result", f.Name)
+			}
+			if f.Index >= len(arr) {
+				return nil, fmt.Errorf("prediction result doesn't have an output at %v for '%v'",
+					f.Index, f.Name)
+			}
+			res[f.Name] = arr[f.Index]
+		}
+
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		for i, f := range sp.fields {
+			if f.Path == "" {
+				return nil, fmt.Errorf("predict output field '%v' requires an array result", f.Name)
+			}
+			o, err := m.Get(sp.paths[i])
+			if err != nil {
+				return nil, fmt.Errorf("prediction result doesn't have an output at '%v' for '%v'",
+					f.Path, f.Name)
+			}
+			res[f.Name] = o
+		}
+
+	default:
+		return nil, fmt.Errorf("prediction result must be an array or a map to be split: %v",
+			v.Type())
+	}
+	return res, nil
+}
+
+// parsePredictOutputFields parses predict_output_fields parameter. It's
+// an array of field names, which are assigned to values in an array result
+// by their position, or a map from field names to indexes (for an array
+// result) or paths (for a map result).
+func parsePredictOutputFields(v data.Value) ([]PredictOutputField, error) {
+	switch v.Type() {
+	case data.TypeArray:
+		arr, _ := data.AsArray(v)
+		fields := make([]PredictOutputField, len(arr))
+		for i, n := range arr {
+			name, err := data.AsString(n)
+			if err != nil {
+				return nil, fmt.Errorf("a name of predict output field must be a string: %v", err)
+			}
+			fields[i] = PredictOutputField{Name: name, Index: i}
+		}
+		return fields, nil
+
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		names := make([]string, 0, len(m))
+		for n := range m {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		fields := make([]PredictOutputField, 0, len(m))
+		for _, n := range names {
+			f := PredictOutputField{Name: n}
+			switch m[n].Type() {
+			case data.TypeInt:
+				i, _ := data.AsInt(m[n])
+				f.Index = int(i)
+			case data.TypeString:
+				f.Path, _ = data.AsString(m[n])
+			default:
+				return nil, fmt.Errorf("predict output field '%v' must be an index or a path", n)
+			}
+			fields = append(fields, f)
+		}
+		return fields, nil
+
+	default:
+		return nil, fmt.Errorf("predict_output_fields must be an array or a map: %v", v.Type())
+	}
+}
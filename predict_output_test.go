@@ -0,0 +1,120 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestParsePredictOutputFields(t *testing.T) {
+	Convey("Given predict_output_fields parameters", t, func() {
+		Convey("When an array of names is parsed", func() {
+			fields, err := parsePredictOutputFields(data.Array{
+				data.String("value"), data.String("stddev"),
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then names should be assigned by position", func() {
+				So(fields, ShouldResemble, []PredictOutputField{
+					{Name: "value", Index: 0},
+					{Name: "stddev", Index: 1},
+				})
+			})
+		})
+
+		Convey("When a map of indexes and paths is parsed", func() {
+			fields, err := parsePredictOutputFields(data.Map{
+				"value":  data.String("mean"),
+				"stddev": data.Int(1),
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then fields should be sorted by their names", func() {
+				So(fields, ShouldResemble, []PredictOutputField{
+					{Name: "stddev", Index: 1},
+					{Name: "value", Path: "mean"},
+				})
+			})
+		})
+
+		Convey("When an invalid value is parsed", func() {
+			_, err := parsePredictOutputFields(data.String("value"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestOutputSplitter(t *testing.T) {
+	Convey("Given an output splitter for array results", t, func() {
+		sp, err := newOutputSplitter([]PredictOutputField{
+			{Name: "value", Index: 0},
+			{Name: "stddev", Index: 1},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When an array result is split", func() {
+			m, err := sp.split(data.Array{data.Float(1.5), data.Float(0.1)})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have named fields", func() {
+				So(m, ShouldResemble, data.Map{
+					"value":  data.Float(1.5),
+					"stddev": data.Float(0.1),
+				})
+			})
+		})
+
+		Convey("When a short array result is split", func() {
+			_, err := sp.split(data.Array{data.Float(1.5)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a scalar result is split", func() {
+			_, err := sp.split(data.Float(1.5))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an output splitter for map results", t, func() {
+		sp, err := newOutputSplitter([]PredictOutputField{
+			{Name: "value", Path: "out.mean"},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When a map result is split", func() {
+			m, err := sp.split(data.Map{
+				"out": data.Map{"mean": data.Float(1.5)},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have named fields", func() {
+				So(m, ShouldResemble, data.Map{"value": data.Float(1.5)})
+			})
+		})
+
+		Convey("When a map result without the path is split", func() {
+			_, err := sp.split(data.Map{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an output field without a name", t, func() {
+		_, err := newOutputSplitter([]PredictOutputField{{Index: 0}})
+
+		Convey("Then creating a splitter should fail", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package pymlstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strconv"
+)
+
+// DecodePrediction decodes a value returned by Predict into out in the same
+// way as encoding/json does, so out can be a struct having json tags.
+func DecodePrediction(v data.Value, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cannot encode the prediction: %v", err)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("cannot decode the prediction: %v", err)
+	}
+	return nil
+}
+
+// predictionField returns the value of the first key found in v when v is a
+// map. Otherwise, it returns v itself.
+func predictionField(v data.Value, keys ...string) data.Value {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return v
+	}
+	for _, k := range keys {
+		if e, ok := m[k]; ok {
+			return e
+		}
+	}
+	return v
+}
+
+// ClassLabel returns the class label of a prediction. The prediction is a
+// string or an integer, or a map having it at "label" or "class" key.
+func ClassLabel(v data.Value) (string, error) {
+	v = predictionField(v, "label", "class")
+	switch v.Type() {
+	case data.TypeString:
+		return data.AsString(v)
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		return strconv.FormatInt(i, 10), nil
+	}
+	return "", fmt.Errorf("the prediction doesn't have a class label: %v", v.Type())
+}
+
+// ProbabilityVector returns the probabilities of classes of a prediction.
+// The prediction is an array of numbers, or a map having it at
+// "probabilities" or "proba" key.
+func ProbabilityVector(v data.Value) ([]float64, error) {
+	v = predictionField(v, "probabilities", "proba")
+	arr, err := data.AsArray(v)
+	if err != nil {
+		return nil, fmt.Errorf("the prediction doesn't have probabilities: %v", err)
+	}
+	res := make([]float64, len(arr))
+	for i, e := range arr {
+		x, err := asNumber(e)
+		if err != nil {
+			return nil, fmt.Errorf("probability at %v is invalid: %v", i, err)
+		}
+		res[i] = x
+	}
+	return res, nil
+}
+
+// RegressionValue returns the value of a regression model. The prediction
+// is a number or an array of a single number, or a map having it at "value"
+// or "prediction" key.
+func RegressionValue(v data.Value) (float64, error) {
+	v = predictionField(v, "value", "prediction")
+	if arr, err := data.AsArray(v); err == nil && len(arr) == 1 {
+		v = arr[0]
+	}
+	x, err := asNumber(v)
+	if err != nil {
+		return 0, fmt.Errorf("the prediction doesn't have a regression value: %v", err)
+	}
+	return x, nil
+}
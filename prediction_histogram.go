@@ -0,0 +1,241 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// predictionQuantiles are quantiles of numeric predictions kept for each
+// window. They're also edges of bins used to compare numeric predictions
+// of two windows.
+var predictionQuantiles = []float64{0, 0.1, 0.25, 0.5, 0.75, 0.9, 1}
+
+// predictionHistogram records predictions returned by Predict in tumbling
+// windows of window predictions. Integers, strings, and bools are counted
+// as classes, and floats are summarized by quantiles. The shift of the
+// distribution is the total variation distance between the last two
+// windows, where numeric predictions are binned by quantiles of the older
+// window. It's the larger one when a window has both kinds of predictions.
+// It has its own lock and it's never replaced so that metrics can be read
+// without the lock of State.
+type predictionHistogram struct {
+	mu        sync.Mutex
+	window    int
+	threshold float64
+
+	counts map[string]int64
+	values []float64
+	n      int
+
+	// classes, sorted, and quantiles are of the last completed window.
+	classes   map[string]float64
+	sorted    []float64
+	quantiles []float64
+	shift     float64
+	hasShift  bool
+}
+
+// configure sets parameters. Predictions are kept unless the window
+// changes.
+func (h *predictionHistogram) configure(window int, threshold float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.window != window {
+		h.resetLocked()
+	}
+	h.window = window
+	h.threshold = threshold
+}
+
+// reset discards predictions, which is done when a model is loaded.
+func (h *predictionHistogram) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resetLocked()
+}
+
+func (h *predictionHistogram) resetLocked() {
+	h.counts = map[string]int64{}
+	h.values = nil
+	h.n = 0
+	h.classes = nil
+	h.sorted = nil
+	h.quantiles = nil
+	h.shift = 0
+	h.hasShift = false
+}
+
+// observe records a prediction or an array of predictions. Maps and other
+// values which aren't classes or numbers are ignored. It returns the latest
+// shift, and true as shifted when a window is completed and the shift
+// exceeds the threshold. It does nothing when the window is 0.
+func (h *predictionHistogram) observe(res data.Value) (shift float64, shifted bool) {
+	preds := []data.Value{res}
+	if res.Type() == data.TypeArray {
+		preds, _ = data.AsArray(res)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.window <= 0 {
+		return 0, false
+	}
+	for _, p := range preds {
+		switch p.Type() {
+		case data.TypeInt, data.TypeString, data.TypeBool:
+			h.counts[valueKey(p)]++
+		case data.TypeFloat:
+			f, _ := data.AsFloat(p)
+			if math.IsNaN(f) {
+				continue
+			}
+			h.values = append(h.values, f)
+		default:
+			continue
+		}
+		h.n++
+		if h.n < h.window {
+			continue
+		}
+		if h.completeWindow() {
+			shifted = true
+		}
+	}
+	return h.shift, shifted
+}
+
+// completeWindow compares the current window with the last one and starts
+// a new window. It returns true when the shift exceeds the threshold.
+func (h *predictionHistogram) completeWindow() bool {
+	var classes map[string]float64
+	if total := h.n - len(h.values); total > 0 {
+		classes = make(map[string]float64, len(h.counts))
+		for k, n := range h.counts {
+			classes[k] = float64(n) / float64(total)
+		}
+	}
+	sort.Float64s(h.values)
+
+	first := h.classes == nil && h.sorted == nil
+	shift := 0.0
+	switch {
+	case classes != nil && h.classes != nil:
+		shift = totalVariation(h.classes, classes)
+	case classes != nil || h.classes != nil:
+		shift = 1
+	}
+	if len(h.values) > 0 || len(h.sorted) > 0 {
+		if d := binnedVariation(h.sorted, h.values); d > shift {
+			shift = d
+		}
+	}
+
+	h.classes = classes
+	h.sorted = h.values
+	h.quantiles = nil
+	if len(h.sorted) > 0 {
+		h.quantiles = make([]float64, len(predictionQuantiles))
+		for i, q := range predictionQuantiles {
+			h.quantiles[i] = quantileOf(h.sorted, q)
+		}
+	}
+	h.counts = map[string]int64{}
+	h.values = nil
+	h.n = 0
+	if first {
+		return false
+	}
+	h.shift = shift
+	h.hasShift = true
+	return h.threshold > 0 && shift > h.threshold
+}
+
+// quantileOf returns the q-quantile of sorted values by the nearest rank.
+func quantileOf(sorted []float64, q float64) float64 {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// binnedVariation returns the total variation distance between numeric
+// values of two windows binned by quantiles of the older one. It's 1 when
+// only one of them has values.
+func binnedVariation(old, cur []float64) float64 {
+	if len(old) == 0 || len(cur) == 0 {
+		return 1
+	}
+	edges := make([]float64, 0, len(predictionQuantiles))
+	for _, q := range predictionQuantiles[1 : len(predictionQuantiles)-1] {
+		edges = append(edges, quantileOf(old, q))
+	}
+	bins := func(vs []float64) map[string]float64 {
+		res := map[string]float64{}
+		for _, v := range vs {
+			res[strconv.Itoa(sort.SearchFloat64s(edges, v))] += 1 / float64(len(vs))
+		}
+		return res
+	}
+	return totalVariation(bins(old), bins(cur))
+}
+
+// toMap returns proportions of classes and quantiles of numbers in the
+// last completed window and the latest shift. It returns nil when no window
+// has been completed.
+func (h *predictionHistogram) toMap() data.Map {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.classes == nil && h.sorted == nil {
+		return nil
+	}
+	res := data.Map{}
+	if h.classes != nil {
+		classes := data.Map{}
+		for k, p := range h.classes {
+			classes[k] = data.Float(p)
+		}
+		res["classes"] = classes
+	}
+	if h.quantiles != nil {
+		qs := data.Map{}
+		for i, q := range predictionQuantiles {
+			qs[strconv.FormatFloat(q, 'g', -1, 64)] = data.Float(h.quantiles[i])
+		}
+		res["quantiles"] = qs
+	}
+	if h.hasShift {
+		res["shift"] = data.Float(h.shift)
+	}
+	return res
+}
+
+// prometheusLines returns samples of proportions of classes, quantiles, and
+// the shift of the last completed window keyed by names of gauges.
+func (h *predictionHistogram) prometheusLines(state string) map[string][]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lines := map[string][]string{}
+	classes := make([]string, 0, len(h.classes))
+	for k := range h.classes {
+		classes = append(classes, k)
+	}
+	sort.Strings(classes)
+	for _, k := range classes {
+		lines["prediction_class_proportion"] = append(lines["prediction_class_proportion"],
+			fmt.Sprintf("pymlstate_prediction_class_proportion{state=%q,class=%q} %v\n", state, k, h.classes[k]))
+	}
+	for i, v := range h.quantiles {
+		lines["prediction_quantile"] = append(lines["prediction_quantile"],
+			fmt.Sprintf("pymlstate_prediction_quantile{state=%q,quantile=\"%v\"} %v\n", state, predictionQuantiles[i], v))
+	}
+	if h.hasShift {
+		lines["prediction_shift"] = append(lines["prediction_shift"],
+			fmt.Sprintf("pymlstate_prediction_shift{state=%q} %v\n", state, h.shift))
+	}
+	return lines
+}
@@ -0,0 +1,127 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPredictionHistogram(t *testing.T) {
+	Convey("Given a prediction histogram", t, func() {
+		h := &predictionHistogram{}
+		h.configure(4, 0.3)
+
+		Convey("When classes are predicted in a window", func() {
+			_, shifted := h.observe(data.Array{data.String("a"), data.String("a"), data.String("b"), data.Int(1)})
+
+			Convey("Then proportions of classes should be computed without a shift", func() {
+				So(shifted, ShouldBeFalse)
+				So(h.toMap(), ShouldResemble, data.Map{"classes": data.Map{
+					"a": data.Float(0.5), "b": data.Float(0.25), "1": data.Float(0.25),
+				}})
+			})
+
+			Convey("And when the next window has a similar distribution", func() {
+				shift, shifted := h.observe(data.Array{data.String("a"), data.String("b"), data.String("a"), data.String("b")})
+
+				Convey("Then it shouldn't be shifted", func() {
+					So(shifted, ShouldBeFalse)
+					So(shift, ShouldAlmostEqual, 0.25)
+					So(h.toMap()["shift"], ShouldEqual, data.Float(shift))
+				})
+			})
+
+			Convey("And when the next window has other classes", func() {
+				shift, shifted := h.observe(data.Array{data.String("c"), data.String("c"), data.String("c"), data.String("a")})
+
+				Convey("Then it should be shifted", func() {
+					So(shifted, ShouldBeTrue)
+					So(shift, ShouldAlmostEqual, 0.75)
+				})
+			})
+		})
+
+		Convey("When numbers are predicted in windows", func() {
+			for _, x := range []float64{1, 2, 3, 4} {
+				h.observe(data.Float(x))
+			}
+			_, same := h.observe(data.Array{data.Float(1), data.Float(2), data.Float(3), data.Float(4)})
+			_, shifted := h.observe(data.Array{data.Float(10), data.Float(11), data.Float(12), data.Float(13)})
+
+			Convey("Then quantiles should be computed and a shift should be detected", func() {
+				So(same, ShouldBeFalse)
+				So(shifted, ShouldBeTrue)
+				m := h.toMap()
+				So(m["shift"], ShouldEqual, data.Float(1))
+				So(m["quantiles"], ShouldResemble, data.Map{
+					"0": data.Float(10), "0.1": data.Float(10), "0.25": data.Float(10),
+					"0.5": data.Float(11), "0.75": data.Float(12), "0.9": data.Float(13), "1": data.Float(13),
+				})
+			})
+		})
+
+		Convey("When maps are predicted", func() {
+			for i := 0; i < 8; i++ {
+				h.observe(data.Map{"a": data.Float(1)})
+			}
+
+			Convey("Then they should be ignored", func() {
+				So(h.toMap(), ShouldBeNil)
+			})
+		})
+
+		Convey("When the window changes", func() {
+			h.observe(data.Array{data.String("a"), data.String("a"), data.String("b"), data.Int(1)})
+			h.configure(2, 0.3)
+
+			Convey("Then predictions should be discarded", func() {
+				So(h.toMap(), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state monitoring predictions", t, func() {
+		s := &State{
+			base: &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return dt[0], nil
+			}},
+			params: MLParams{
+				BatchSize:                 1,
+				PredictionHistogramWindow: 2,
+				PredictionShiftThreshold:  0.5,
+			},
+		}
+		So(s.setUpParams(), ShouldBeNil)
+		s.readiness.set(PhaseServing)
+		events := []Event{}
+		s.OnEvent(func(e Event) {
+			events = append(events, e)
+		})
+		ctx := core.NewContext(nil)
+
+		Convey("When the distribution of predictions shifts", func() {
+			for _, v := range []string{"a", "a", "b", "b"} {
+				_, err := s.Predict(ctx, data.String(v))
+				So(err, ShouldBeNil)
+			}
+
+			Convey("Then a drift should be detected", func() {
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Type, ShouldEqual, EventDriftDetected)
+				So(events[0].Details["kind"], ShouldEqual, data.String("prediction_distribution"))
+				So(events[0].Details["drift"], ShouldEqual, data.Float(1))
+			})
+
+			Convey("And metrics should have the histogram", func() {
+				So(ctx.SharedStates.Add("model", "pymlstate", s), ShouldBeNil)
+				w := bytes.NewBuffer(nil)
+				So(WritePrometheusMetrics(ctx, w), ShouldBeNil)
+				So(w.String(), ShouldContainSubstring, "# TYPE pymlstate_prediction_class_proportion gauge\n")
+				So(w.String(), ShouldContainSubstring, `pymlstate_prediction_class_proportion{state="model",class="b"} 1`)
+				So(w.String(), ShouldContainSubstring, `pymlstate_prediction_shift{state="model"} 1`)
+			})
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestDecodePrediction(t *testing.T) {
+	Convey("Given a prediction map", t, func() {
+		v := data.Map{
+			"label": data.String("cat"),
+			"proba": data.Array{data.Float(0.25), data.Float(0.75)},
+		}
+
+		Convey("When it's decoded into a struct", func() {
+			var out struct {
+				Label string    `json:"label"`
+				Proba []float64 `json:"proba"`
+			}
+			So(DecodePrediction(v, &out), ShouldBeNil)
+
+			Convey("Then fields should be set", func() {
+				So(out.Label, ShouldEqual, "cat")
+				So(out.Proba, ShouldResemble, []float64{0.25, 0.75})
+			})
+		})
+
+		Convey("When typed helpers are applied", func() {
+			l, err := ClassLabel(v)
+			So(err, ShouldBeNil)
+			p, err := ProbabilityVector(v)
+			So(err, ShouldBeNil)
+
+			Convey("Then they should extract values", func() {
+				So(l, ShouldEqual, "cat")
+				So(p, ShouldResemble, []float64{0.25, 0.75})
+			})
+		})
+	})
+
+	Convey("Given bare predictions", t, func() {
+		Convey("Then typed helpers should accept them", func() {
+			l, err := ClassLabel(data.Int(3))
+			So(err, ShouldBeNil)
+			So(l, ShouldEqual, "3")
+
+			x, err := RegressionValue(data.Array{data.Float(1.5)})
+			So(err, ShouldBeNil)
+			So(x, ShouldEqual, 1.5)
+
+			_, err = RegressionValue(data.String("a"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strconv"
+	"strings"
+)
+
+// moduleFoundExpr is a Python expression evaluated to a function returning
+// whether a module can be imported without importing it. It uses find_spec of
+// importlib.util, and pkgutil.find_loader on Python 2, which doesn't have it.
+const moduleFoundExpr = "(lambda f: lambda n: n in __import__('sys').modules or f(n) is not None)(" +
+	"getattr(getattr(__import__('importlib', fromlist=['util']), 'util', None), 'find_spec', None) or " +
+	"__import__('pkgutil').find_loader)"
+
+// missingModulesExpr returns a Python expression evaluated to the list of
+// modules which can't be found. Parent packages of a module are checked first
+// because finding a module of a missing package fails.
+func missingModulesExpr(modules []string) string {
+	quoted := make([]string, len(modules))
+	for i, m := range modules {
+		quoted[i] = strconv.Quote(m)
+	}
+	return fmt.Sprintf("(lambda found: [m for m in [%v] if not all(found('.'.join(m.split('.')[:i])) "+
+		"for i in range(1, m.count('.') + 2))])(%v)", strings.Join(quoted, ", "), moduleFoundExpr)
+}
+
+// checkRequiredModules returns an error listing modules of required_modules
+// which can't be imported by the Python interpreter of this process. It must
+// be called after setUpPythonEnv.
+func checkRequiredModules(p *MLParams) error {
+	if len(p.RequiredModules) == 0 {
+		return nil
+	}
+	res, err := evalPython(missingModulesExpr(p.RequiredModules))
+	if err != nil {
+		return fmt.Errorf("cannot check required_modules: %v", err)
+	}
+	return missingModulesError(res)
+}
+
+// missingModulesError returns an error listing missing modules when res
+// returned by a check isn't empty.
+func missingModulesError(res data.Value) error {
+	if res == nil || res.Type() == data.TypeNull {
+		return nil
+	}
+	missing, err := asStringSlice(res)
+	if err != nil {
+		return fmt.Errorf("the list of missing modules must be an array of strings: %v", err)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("missing Python packages or modules: %v", strings.Join(missing, ", "))
+}
+
+// checkDependencies calls "check_dependencies" of the instance when
+// check_dependencies is set. The method returns a list of missing packages,
+// which is empty or None when all dependencies are available.
+func checkDependencies(b Backend, p *MLParams) error {
+	if !p.CheckDependencies {
+		return nil
+	}
+	res, err := b.Call("check_dependencies")
+	if err != nil {
+		return fmt.Errorf("check_dependencies failed: %v", err)
+	}
+	return missingModulesError(res)
+}
@@ -0,0 +1,111 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const preflightTestModule = `
+class Model(object):
+    @classmethod
+    def create(cls, **params):
+        m = cls()
+        m.missing = params.get('missing', [])
+        return m
+
+    def check_dependencies(self):
+        return self.missing
+`
+
+func TestCheckDependencies(t *testing.T) {
+	Convey("Given a model checking its dependencies", t, func() {
+		missing := data.Value(data.Null{})
+		b := &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+			return missing, nil
+		}}
+		p := &MLParams{CheckDependencies: true}
+
+		Convey("When all dependencies are available", func() {
+			err := checkDependencies(b, p)
+
+			Convey("Then it should succeed", func() {
+				So(err, ShouldBeNil)
+				So(b.calls, ShouldResemble, []string{"check_dependencies"})
+			})
+		})
+
+		Convey("When packages are missing", func() {
+			missing = data.Array{data.String("numpy"), data.String("scipy")}
+			err := checkDependencies(b, p)
+
+			Convey("Then it should fail with missing packages", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "numpy, scipy")
+			})
+		})
+
+		Convey("When the check is disabled", func() {
+			p.CheckDependencies = false
+
+			Convey("Then the model shouldn't be called", func() {
+				So(checkDependencies(b, p), ShouldBeNil)
+				So(b.calls, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestProcessBackendPreflight(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 isn't available")
+	}
+	dir, err := ioutil.TempDir("", "pymlstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "preflight_test_model.py"), []byte(preflightTestModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bp := &pystate.BaseParams{ModulePath: dir, ModuleName: "preflight_test_model", ClassName: "Model"}
+
+	Convey("Given required modules of a model running in a process", t, func() {
+		p := &MLParams{Isolation: "process", PythonCommand: "python3"}
+
+		Convey("When they're available", func() {
+			p.RequiredModules = []string{"json", "os.path", "preflight_test_model"}
+			b, err := newBackend(bp, p, data.Map{})
+
+			Convey("Then the instance should be created", func() {
+				So(err, ShouldBeNil)
+				So(b.Terminate(nil), ShouldBeNil)
+			})
+		})
+
+		Convey("When some of them are missing", func() {
+			p.RequiredModules = []string{"json", "pymlstate_no_such_module", "pymlstate_no_such_package.sub"}
+			_, err := newBackend(bp, p, data.Map{})
+
+			Convey("Then it should fail with missing modules", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "pymlstate_no_such_module, pymlstate_no_such_package.sub")
+			})
+		})
+
+		Convey("When the model reports missing dependencies", func() {
+			p.CheckDependencies = true
+			_, err := newBackend(bp, p, data.Map{"missing": data.Array{data.String("torch")}})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "torch")
+			})
+		})
+	})
+}
@@ -0,0 +1,145 @@
+package pymlstate
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// preprocessor transforms a record before it's passed to Python.
+type preprocessor interface {
+	// process transforms the record in place. training is true when the
+	// record is used for training. Preprocessors having statistics only
+	// update them with records used for training.
+	process(rec data.Map, training bool, rep *qualityReport) error
+}
+
+// errDropRecord is returned by a preprocessor when the record must not be
+// passed to Python.
+var errDropRecord = errors.New("the record is dropped by preprocessing")
+
+// preprocessMode is what records passed to preprocess are used for.
+type preprocessMode int
+
+const (
+	// preprocessTrain is for records used for training.
+	preprocessTrain preprocessMode = iota
+
+	// preprocessServe is for records predicted by Predict.
+	preprocessServe
+
+	// preprocessInspect is for records used otherwise, e.g. to evaluate a
+	// model or to retrain a new instance. They aren't observed as serving
+	// traffic by the skew tracker.
+	preprocessInspect
+)
+
+// preprocess applies preprocessors of the state to records in v. Records are
+// copied before they're transformed because they might be shared with other
+// parts of the topology. Dropped records are removed from an array and nil
+// is returned when v itself is a dropped record. Images are decoded before
+// other preprocessors are applied. Issues detected by preprocessors are
+// recorded to rep if it isn't nil. Records used for training are counted by
+// DataStats before they're preprocessed.
+func (s *State) preprocess(v data.Value, mode preprocessMode, rep *qualityReport) (data.Value, error) {
+	training := mode == preprocessTrain
+	if training {
+		s.dataStats.observe(v)
+	}
+	if s.images != nil {
+		var err error
+		if v, err = s.images.decodeAll(v, rep); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.preprocessors) == 0 {
+		return v, nil
+	}
+	return mapRecords(v, func(m data.Map) (data.Map, error) {
+		rec := m.Copy()
+		for _, p := range s.preprocessors {
+			if mode == preprocessInspect && p == preprocessor(s.skew) {
+				continue
+			}
+			if err := p.process(rec, training, rep); err != nil {
+				if err == errDropRecord {
+					rep.record(true)
+					return nil, nil
+				}
+				return nil, err
+			}
+		}
+		rep.record(false)
+		return rec, nil
+	})
+}
+
+// mapRecords applies f to records in v. v is a record or an array of
+// records. Values other than maps are passed as they are. When f returns a
+// nil map, the record is dropped.
+func mapRecords(v data.Value, f func(m data.Map) (data.Map, error)) (data.Value, error) {
+	switch v.Type() {
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		r, err := f(m)
+		if err != nil || r == nil {
+			return nil, err
+		}
+		return r, nil
+
+	case data.TypeArray:
+		arr, _ := data.AsArray(v)
+		res := make(data.Array, 0, len(arr))
+		for _, e := range arr {
+			if e.Type() != data.TypeMap {
+				res = append(res, e)
+				continue
+			}
+			m, _ := data.AsMap(e)
+			r, err := f(m)
+			if err != nil {
+				return nil, err
+			}
+			if r != nil {
+				res = append(res, r)
+			}
+		}
+		return res, nil
+	}
+	return v, nil
+}
+
+// compilePaths compiles paths given as parameters.
+func compilePaths(paths []string) ([]data.Path, error) {
+	res := make([]data.Path, len(paths))
+	for i, p := range paths {
+		c, err := data.CompilePath(p)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = c
+	}
+	return res, nil
+}
+
+// asNumber converts an integer or a float to float64. Other types aren't
+// converted.
+func asNumber(v data.Value) (float64, error) {
+	switch v.Type() {
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		return float64(i), nil
+	case data.TypeFloat:
+		return data.AsFloat(v)
+	}
+	return 0, fmt.Errorf("%v isn't a number", v.Type())
+}
+
+// valueKey returns a string identifying a value. A string is used as it is
+// and other values are represented by their string representation.
+func valueKey(v data.Value) string {
+	if str, err := data.AsString(v); err == nil {
+		return str
+	}
+	return v.String()
+}
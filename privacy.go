@@ -0,0 +1,113 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// privacyAccountant tracks the privacy budget spent by training batches
+// under differential privacy. Each batch is Poisson-subsampled with
+// sampleRate, which amplifies the privacy of the batch, and costs epsilon
+// amplified by the subsampling. Costs of batches are summed up by the basic
+// composition, and training fails once the budget is exhausted.
+type privacyAccountant struct {
+	budget     float64
+	epsilon    float64
+	sampleRate float64
+
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	spent   float64
+	batches int64
+}
+
+func newPrivacyAccountant(p *MLParams) *privacyAccountant {
+	return &privacyAccountant{
+		budget:     p.DPBudget,
+		epsilon:    p.DPEpsilon,
+		sampleRate: p.DPSampleRate,
+		rnd:        newRand(p, "privacy"),
+	}
+}
+
+// batchEpsilon returns the cost of a batch, which is
+// ln(1 + q(e^epsilon - 1)) for the sample rate q.
+func (a *privacyAccountant) batchEpsilon() float64 {
+	return math.Log1p(a.sampleRate * math.Expm1(a.epsilon))
+}
+
+// check returns an error when the remaining budget is less than the cost of
+// a batch. It does nothing when a is nil.
+func (a *privacyAccountant) check() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.spent+a.batchEpsilon() > a.budget*(1+1e-9) {
+		return fmt.Errorf("the privacy budget %v is exhausted: %v has been spent", a.budget, a.spent)
+	}
+	return nil
+}
+
+// subsample returns records chosen from the batch with the sample rate.
+func (a *privacyAccountant) subsample(batch []data.Value) []data.Value {
+	if a.sampleRate >= 1 {
+		return batch
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	res := make([]data.Value, 0, int(float64(len(batch))*a.sampleRate)+1)
+	for _, r := range batch {
+		if a.rnd.Float64() < a.sampleRate {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// spend records the cost of a batch.
+func (a *privacyAccountant) spend() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.spent += a.batchEpsilon()
+	a.batches++
+}
+
+// spentBudget returns the spent budget. It returns 0 when a is nil.
+func (a *privacyAccountant) spentBudget() float64 {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.spent
+}
+
+func (a *privacyAccountant) restore(spent float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.spent = spent
+}
+
+// hookArgs returns the argument of "apply_dp" of the model.
+func (a *privacyAccountant) hookArgs() data.Map {
+	return data.Map{
+		"epsilon":     data.Float(a.epsilon),
+		"sample_rate": data.Float(a.sampleRate),
+	}
+}
+
+func (a *privacyAccountant) status() data.Map {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return data.Map{
+		"budget":    data.Float(a.budget),
+		"spent":     data.Float(a.spent),
+		"remaining": data.Float(math.Max(a.budget-a.spent, 0)),
+		"batches":   data.Int(a.batches),
+	}
+}
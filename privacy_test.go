@@ -0,0 +1,83 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"testing"
+)
+
+func TestPrivacyAccountant(t *testing.T) {
+	Convey("Given a privacy accountant with subsampling", t, func() {
+		a := newPrivacyAccountant(&MLParams{DPBudget: 1, DPEpsilon: 0.5, DPSampleRate: 0.1})
+
+		Convey("When the cost of a batch is computed", func() {
+			e := a.batchEpsilon()
+
+			Convey("Then it should be amplified by the sample rate", func() {
+				So(e, ShouldAlmostEqual, math.Log(1+0.1*(math.Exp(0.5)-1)))
+				So(e, ShouldBeLessThan, 0.5)
+			})
+		})
+
+		Convey("When a batch is subsampled", func() {
+			batch := make([]data.Value, 10000)
+			for i := range batch {
+				batch[i] = data.Int(i)
+			}
+			res := a.subsample(batch)
+
+			Convey("Then about the sample rate of records should be chosen", func() {
+				So(len(res), ShouldBeBetween, 800, 1200)
+			})
+		})
+
+		Convey("When batches are trained until the budget is spent", func() {
+			n := 0
+			for a.check() == nil {
+				a.spend()
+				n++
+			}
+
+			Convey("Then the spent budget should not exceed the budget", func() {
+				So(n, ShouldEqual, int(1/a.batchEpsilon()))
+				st := a.status()
+				So(st["batches"], ShouldEqual, data.Int(n))
+				So(a.spentBudget(), ShouldBeLessThanOrEqualTo, 1)
+			})
+		})
+	})
+}
+
+func TestDifferentiallyPrivateFit(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a state with a privacy budget for two batches", t, func() {
+		b := &fakeBackend{}
+		s := &State{base: b, params: MLParams{DPBudget: 1, DPEpsilon: 0.5, DPSampleRate: 1, DPHook: true}}
+		So(s.setUpParams(), ShouldBeNil)
+		bucket := []data.Value{data.Map{"x": data.Int(1)}}
+
+		Convey("When batches are trained", func() {
+			_, err1 := s.Fit(ctx, bucket)
+			_, err2 := s.Fit(ctx, bucket)
+			_, err3 := s.Fit(ctx, bucket)
+
+			Convey("Then the budget should be spent by the first two batches", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(err3, ShouldNotBeNil)
+				So(b.calls, ShouldResemble, []string{"fit", "apply_dp", "fit", "apply_dp"})
+				st := s.Status()["privacy_budget"].(data.Map)
+				So(st["spent"], ShouldEqual, data.Float(1))
+				So(st["remaining"], ShouldEqual, data.Float(0))
+			})
+
+			Convey("Then the spent budget should be kept when parameters are updated", func() {
+				So(s.setUpParams(), ShouldBeNil)
+				So(s.privacy.spentBudget(), ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,344 @@
+package pymlstate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// processWorker is the Python script run by processBackend. It reads a JSON
+// request from each line of stdin and writes a JSON response to stdout.
+// Outputs of the model written to stdout are redirected to stderr so that
+// they don't break responses.
+const processWorker = `
+import importlib, json, os, sys, traceback
+
+out = os.fdopen(os.dup(1), 'w')
+os.dup2(2, 1)
+sys.stdout = sys.stderr
+instance = None
+for line in sys.stdin:
+    req = json.loads(line)
+    try:
+        op = req['op']
+        res = None
+        for p in reversed(req.get('paths') or []):
+            if p not in sys.path:
+                sys.path.insert(0, p)
+        if op == 'eval':
+            res = eval(req['expr'])
+        elif op in ('create', 'load'):
+            cls = getattr(importlib.import_module(req['module_name']), req['class_name'])
+            if op == 'create':
+                instance = cls.create(**req['params'])
+            else:
+                instance = cls.load(req['path'], **req['params'])
+        elif op == 'call':
+            res = getattr(instance, req['method'])(*req.get('args', []))
+        elif op == 'save':
+            instance.save(req['path'], req['params'])
+        else:
+            raise ValueError('unknown op: %s' % op)
+        resp = json.dumps({'result': res})
+    except Exception:
+        resp = json.dumps({'error': traceback.format_exc()})
+    out.write(resp + '\n')
+    out.flush()
+`
+
+// processBackend runs the instance in a Python process dedicated to the
+// state, so that module-level globals and monkeypatches of the model don't
+// affect other states. Values are passed as JSON, so blobs become base64
+// strings and timestamps become strings.
+type processBackend struct {
+	baseParams pystate.BaseParams
+	paths      []string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	in     io.WriteCloser
+	out    *bufio.Reader
+	exited chan struct{}
+}
+
+// processRequest is a request to processWorker.
+type processRequest struct {
+	Op         string       `json:"op"`
+	Paths      []string     `json:"paths,omitempty"`
+	ModuleName string       `json:"module_name,omitempty"`
+	ClassName  string       `json:"class_name,omitempty"`
+	Method     string       `json:"method,omitempty"`
+	Args       []data.Value `json:"args,omitempty"`
+	Path       string       `json:"path,omitempty"`
+	Expr       string       `json:"expr,omitempty"`
+	Params     data.Map     `json:"params"`
+}
+
+// processSnapshot is the model written by processBackend.Save.
+type processSnapshot struct {
+	Base  pystate.BaseParams `codec:"base"`
+	Model []byte             `codec:"model"`
+}
+
+func startProcess(baseParams *pystate.BaseParams, p *MLParams) (*processBackend, error) {
+	paths, err := sitePackagesDirs(p)
+	if err != nil {
+		return nil, err
+	}
+	if baseParams.ModulePath != "" {
+		paths = append([]string{baseParams.ModulePath}, paths...)
+	}
+
+	cmd := exec.Command(p.PythonCommand, "-c", processWorker)
+	cmd.Stderr = os.Stderr
+	cmd.Env = threadLimitEnv(p)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start the Python process: %v", err)
+	}
+	b := &processBackend{
+		baseParams: *baseParams,
+		paths:      paths,
+		cmd:        cmd,
+		in:         in,
+		out:        bufio.NewReader(out),
+		exited:     make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(b.exited)
+	}()
+	return b, nil
+}
+
+// newProcessBackend starts a process and creates an instance of the class
+// in it.
+func newProcessBackend(baseParams *pystate.BaseParams, p *MLParams, params data.Map) (*processBackend, error) {
+	b, err := startProcess(baseParams, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkRequiredModules(p); err != nil {
+		b.Terminate(nil)
+		return nil, err
+	}
+	if _, err := b.request(b.classRequest("create", "", params)); err != nil {
+		b.Terminate(nil)
+		return nil, err
+	}
+	return b, nil
+}
+
+// loadProcessBackend starts a process and loads the instance written by
+// processBackend.Save in it.
+func loadProcessBackend(ctx *core.Context, r io.Reader, p *MLParams, params data.Map) (*processBackend, error) {
+	var snapshot processSnapshot
+	if err := readMsgpackSection(r, &snapshot, "the model of the Python process"); err != nil {
+		return nil, err
+	}
+	b, err := startProcess(&snapshot.Base, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkRequiredModules(p); err != nil {
+		b.Terminate(ctx)
+		return nil, err
+	}
+	if err := b.load(snapshot.Model, params); err != nil {
+		b.Terminate(ctx)
+		return nil, err
+	}
+	return b, nil
+}
+
+// checkRequiredModules checks required_modules in the process before the
+// module of the class is imported.
+func (b *processBackend) checkRequiredModules(p *MLParams) error {
+	if len(p.RequiredModules) == 0 {
+		return nil
+	}
+	res, err := b.eval(missingModulesExpr(p.RequiredModules))
+	if err != nil {
+		return fmt.Errorf("cannot check required_modules: %v", err)
+	}
+	return missingModulesError(res)
+}
+
+// eval evaluates the Python expression in the process.
+func (b *processBackend) eval(expr string) (data.Value, error) {
+	return b.request(&processRequest{Op: "eval", Paths: b.paths, Expr: expr, Params: data.Map{}})
+}
+
+func (b *processBackend) classRequest(op, path string, params data.Map) *processRequest {
+	if params == nil {
+		params = data.Map{}
+	}
+	return &processRequest{
+		Op:         op,
+		Paths:      b.paths,
+		ModuleName: b.baseParams.ModuleName,
+		ClassName:  b.baseParams.ClassName,
+		Path:       path,
+		Params:     params,
+	}
+}
+
+// request sends the request to the process and returns its result.
+func (b *processBackend) request(req *processRequest) (data.Value, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.CheckTermination(); err != nil {
+		return nil, err
+	}
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode a request to the Python process: %v", err)
+	}
+	if _, err := b.in.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("cannot send a request to the Python process: %v", err)
+	}
+	line, err = b.out.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("cannot receive a response from the Python process: %v", err)
+	}
+
+	var resp struct {
+		Result interface{} `json:"result"`
+		Error  string      `json:"error"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("cannot decode a response from the Python process: %v", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%v failed in the Python process: %v", req.Op, resp.Error)
+	}
+	return data.NewValue(fromJSONNumbers(resp.Result))
+}
+
+// fromJSONNumbers converts json.Number in v to int64 or float64 so that
+// integers returned by Python stay integers.
+func fromJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, e := range v {
+			v[i] = fromJSONNumbers(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = fromJSONNumbers(e)
+		}
+	}
+	return v
+}
+
+func (b *processBackend) Call(funcName string, dt ...data.Value) (data.Value, error) {
+	return b.request(&processRequest{Op: "call", Method: funcName, Args: dt, Params: data.Map{}})
+}
+
+func (b *processBackend) CheckTermination() error {
+	select {
+	case <-b.exited:
+		return fmt.Errorf("the Python process of the state has exited")
+	default:
+		return nil
+	}
+}
+
+func (b *processBackend) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	f, err := ioutil.TempFile("", "pymlstate")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if _, err := b.request(b.classRequest("save", f.Name(), params)); err != nil {
+		return err
+	}
+	model, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	return writeMsgpackSection(w, &processSnapshot{Base: b.baseParams, Model: model})
+}
+
+func (b *processBackend) Load(ctx *core.Context, r io.Reader, params data.Map) error {
+	var snapshot processSnapshot
+	if err := readMsgpackSection(r, &snapshot, "the model of the Python process"); err != nil {
+		return err
+	}
+	if snapshot.Base.ModuleName != b.baseParams.ModuleName || snapshot.Base.ClassName != b.baseParams.ClassName {
+		return fmt.Errorf("the model of %v.%v cannot be loaded into the process of %v.%v",
+			snapshot.Base.ModuleName, snapshot.Base.ClassName, b.baseParams.ModuleName, b.baseParams.ClassName)
+	}
+	return b.load(snapshot.Model, params)
+}
+
+// load writes the model to a temporary file and loads it by the class.
+func (b *processBackend) load(model []byte, params data.Map) error {
+	f, err := ioutil.TempFile("", "pymlstate")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(model); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	_, err = b.request(b.classRequest("load", f.Name(), params))
+	return err
+}
+
+// processTerminateTimeout is how long Terminate waits for the process to
+// exit before killing it.
+var processTerminateTimeout = 10 * time.Second
+
+// Terminate closes stdin of the process and waits for it to exit. The
+// process is killed when it doesn't exit in processTerminateTimeout, e.g.
+// when the model has a thread which doesn't stop.
+func (b *processBackend) Terminate(ctx *core.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.in.Close()
+	select {
+	case <-b.exited:
+	case <-time.After(processTerminateTimeout):
+		if ctx != nil {
+			ctx.Log().Warn("pymlstate kills the Python process which doesn't exit")
+		}
+		if kerr := b.cmd.Process.Kill(); kerr != nil && err == nil {
+			err = kerr
+		}
+		<-b.exited
+	}
+	return err
+}
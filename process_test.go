@@ -0,0 +1,148 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const processTestModule = `
+calls = 0
+
+class Model(object):
+    @classmethod
+    def create(cls, **params):
+        m = cls()
+        m.n = params.get('n', 0)
+        return m
+
+    def fit(self, xs):
+        global calls
+        calls += 1
+        self.n += len(xs)
+        return self.n
+
+    def predict(self, x):
+        print('predicting')
+        return {'n': self.n, 'x': x, 'calls': calls}
+
+    def save(self, filepath, params):
+        with open(filepath, 'w') as f:
+            f.write(str(self.n))
+
+    @classmethod
+    def load(cls, filepath, **params):
+        m = cls()
+        with open(filepath) as f:
+            m.n = int(f.read())
+        m.load_params = params
+        return m
+
+    def get_load_params(self):
+        return self.load_params
+
+    def block_exit(self):
+        import threading, time
+        threading.Thread(target=time.sleep, args=(3600,)).start()
+`
+
+func TestProcessBackend(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 isn't available")
+	}
+	dir, err := ioutil.TempDir("", "pymlstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "process_test_model.py"), []byte(processTestModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bp := &pystate.BaseParams{ModulePath: dir, ModuleName: "process_test_model", ClassName: "Model"}
+	p := &MLParams{Isolation: "process", PythonCommand: "python3"}
+
+	Convey("Given a model running in a process", t, func() {
+		b, err := newBackend(bp, p, data.Map{"n": data.Int(1)})
+		So(err, ShouldBeNil)
+		defer b.Terminate(nil)
+
+		Convey("When it's trained", func() {
+			res, err := b.Call("fit", data.Array{data.Int(1), data.Int(2)})
+
+			Convey("Then the result should be returned from the process", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.Int(3))
+			})
+
+			Convey("Then outputs to stdout shouldn't break predictions", func() {
+				res, err := b.Call("predict", data.String("a"))
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{"n": data.Int(3), "x": data.String("a"), "calls": data.Int(1)})
+			})
+
+			Convey("Then another process shouldn't share globals of the module", func() {
+				b2, err := newBackend(bp, p, data.Map{})
+				So(err, ShouldBeNil)
+				defer b2.Terminate(nil)
+				res, err := b2.Call("predict", data.String("a"))
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{"n": data.Int(0), "x": data.String("a"), "calls": data.Int(0)})
+			})
+
+			Convey("Then it should be saved and loaded into another process", func() {
+				buf := bytes.NewBuffer(nil)
+				So(b.Save(nil, buf, data.Map{}), ShouldBeNil)
+				b2, err := loadBackend(nil, buf, p, data.Map{"k": data.Int(1)})
+				So(err, ShouldBeNil)
+				defer b2.Terminate(nil)
+				res, err := b2.Call("predict", data.Int(0))
+				So(err, ShouldBeNil)
+				So(res.(data.Map)["n"], ShouldEqual, data.Int(3))
+				res, err = b2.Call("get_load_params")
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{"k": data.Int(1)})
+			})
+		})
+
+		Convey("When an undefined method is called", func() {
+			_, err := b.Call("undefined")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(b.CheckTermination(), ShouldBeNil)
+			})
+		})
+
+		Convey("When it's terminated", func() {
+			So(b.Terminate(nil), ShouldBeNil)
+
+			Convey("Then it shouldn't be called", func() {
+				So(b.CheckTermination(), ShouldNotBeNil)
+				_, err := b.Call("predict", data.Int(0))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When it's terminated while the model doesn't let it exit", func() {
+			_, err := b.Call("block_exit")
+			So(err, ShouldBeNil)
+			timeout := processTerminateTimeout
+			processTerminateTimeout = 100 * time.Millisecond
+			Reset(func() {
+				processTerminateTimeout = timeout
+			})
+			b.Terminate(nil)
+
+			Convey("Then the process should be killed", func() {
+				So(b.CheckTermination(), ShouldNotBeNil)
+			})
+		})
+	})
+}
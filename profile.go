@@ -0,0 +1,38 @@
+package pymlstate
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// setName sets the name of the state used by profiler labels. The state
+// doesn't know its name until it's looked up by the name.
+func (s *State) setName(name string) {
+	s.name.Store(name)
+}
+
+// profileName returns the name of the state, or the module and the class of
+// the model when the name is unknown.
+func (s *State) profileName() string {
+	if n, ok := s.name.Load().(string); ok {
+		return n
+	}
+	if s.baseParams != nil {
+		return s.baseParams.ModuleName + "." + s.baseParams.ClassName
+	}
+	return "unknown"
+}
+
+// profileLabels returns runtime/pprof labels identifying the state and the
+// Python method.
+func (s *State) profileLabels(method string) pprof.LabelSet {
+	return pprof.Labels("pymlstate_state", s.profileName(), "pymlstate_method", method)
+}
+
+// withProfileLabels runs f with profileLabels so that CPU profiles attribute
+// time spent in Python to the state and the method.
+func (s *State) withProfileLabels(method string, f func()) {
+	pprof.Do(context.Background(), s.profileLabels(method), func(context.Context) {
+		f()
+	})
+}
@@ -0,0 +1,33 @@
+package pymlstate
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestProfileLabels(t *testing.T) {
+	Convey("Given a state whose name is unknown", t, func() {
+		s := &State{baseParams: &pystate.BaseParams{ModuleName: "mod", ClassName: "Model"}}
+
+		Convey("When its profile name is computed", func() {
+			Convey("Then it should be the module and the class", func() {
+				So(s.profileName(), ShouldEqual, "mod.Model")
+			})
+		})
+
+		Convey("When the name is set", func() {
+			s.setName("model1")
+
+			Convey("Then labels should have the name and the method", func() {
+				ctx := pprof.WithLabels(context.Background(), s.profileLabels("predict"))
+				state, _ := pprof.Label(ctx, "pymlstate_state")
+				method, _ := pprof.Label(ctx, "pymlstate_method")
+				So(state, ShouldEqual, "model1")
+				So(method, ShouldEqual, "predict")
+			})
+		})
+	})
+}
@@ -0,0 +1,144 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// transferProgressInterval is the interval of progress logs of Save and
+// Load.
+const transferProgressInterval = 10 * time.Second
+
+// transferProgress is the progress of saving or loading a model. It has its
+// own lock so that the progress of Load can be read while the state is
+// locked.
+type transferProgress struct {
+	mu     sync.Mutex
+	active bool
+	bytes  int64
+	total  int64
+	start  time.Time
+	end    time.Time
+	stop   chan struct{}
+}
+
+// begin starts tracking a transfer of total bytes, which is 0 when it's
+// unknown. The progress is logged periodically while the transfer lasts.
+func (p *transferProgress) begin(ctx *core.Context, op string, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active = true
+	p.bytes = 0
+	p.total = total
+	p.start = time.Now()
+	p.stop = make(chan struct{})
+
+	stop := p.stop
+	go func() {
+		t := time.NewTicker(transferProgressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+			l := ctx.Log()
+			for k, v := range p.toMap() {
+				l = l.WithField(k, v)
+			}
+			l.Info("pymlstate is " + op + " the model")
+		}
+	}()
+}
+
+func (p *transferProgress) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes += int64(n)
+}
+
+func (p *transferProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active = false
+	p.end = time.Now()
+	close(p.stop)
+}
+
+func (p *transferProgress) isActive() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// toMap returns the progress. It returns nil when no transfer has started.
+func (p *transferProgress) toMap() data.Map {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.start.IsZero() {
+		return nil
+	}
+	end := p.end
+	if p.active {
+		end = time.Now()
+	}
+	m := data.Map{
+		"active":  data.Bool(p.active),
+		"bytes":   data.Int(p.bytes),
+		"elapsed": data.String(end.Sub(p.start).String()),
+	}
+	if p.total > 0 {
+		m["total_bytes"] = data.Int(p.total)
+		m["percent"] = data.Float(float64(p.bytes) * 100 / float64(p.total))
+	}
+	return m
+}
+
+type progressWriter struct {
+	w io.Writer
+	p *transferProgress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.p.add(n)
+	return n, err
+}
+
+type progressReader struct {
+	r io.Reader
+	p *transferProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.add(n)
+	return n, err
+}
+
+// readerSize returns the number of bytes which can be read from r, or 0 when
+// it's unknown.
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface {
+		Len() int
+	}:
+		return int64(r.Len())
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return 0
+		}
+		off, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0
+		}
+		return fi.Size() - off
+	}
+	return 0
+}
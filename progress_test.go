@@ -0,0 +1,84 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"testing"
+)
+
+func TestTransferProgress(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a transfer progress", t, func() {
+		var p transferProgress
+
+		Convey("When no transfer has started", func() {
+			Convey("Then it should have no progress", func() {
+				So(p.toMap(), ShouldBeNil)
+			})
+		})
+
+		Convey("When a model of a known size is being read", func() {
+			src := bytes.NewReader(make([]byte, 200))
+			p.begin(ctx, "loading", readerSize(src))
+			r := &progressReader{r: src, p: &p}
+			b := make([]byte, 50)
+			_, err := r.Read(b)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have the percent", func() {
+				m := p.toMap()
+				So(p.isActive(), ShouldBeTrue)
+				So(m["bytes"], ShouldEqual, data.Int(50))
+				So(m["total_bytes"], ShouldEqual, data.Int(200))
+				So(m["percent"], ShouldEqual, data.Float(25))
+			})
+
+			Convey("And it finishes", func() {
+				ioutil.ReadAll(r)
+				p.finish()
+
+				Convey("Then it should be inactive and have all bytes", func() {
+					m := p.toMap()
+					So(p.isActive(), ShouldBeFalse)
+					So(m["active"], ShouldEqual, data.Bool(false))
+					So(m["bytes"], ShouldEqual, data.Int(200))
+					So(m["percent"], ShouldEqual, data.Float(100))
+				})
+			})
+		})
+
+		Convey("When a model is written", func() {
+			p.begin(ctx, "saving", 0)
+			w := &progressWriter{w: &bytes.Buffer{}, p: &p}
+			w.Write(make([]byte, 30))
+			p.finish()
+
+			Convey("Then it should have bytes without the percent", func() {
+				m := p.toMap()
+				So(m["bytes"], ShouldEqual, data.Int(30))
+				So(m, ShouldNotContainKey, "percent")
+			})
+		})
+	})
+
+	Convey("Given a state loading a model", t, func() {
+		s := &State{}
+		s.loadProgress.begin(ctx, "loading", 0)
+		s.rwm.Lock()
+		defer s.rwm.Unlock()
+
+		Convey("When its status is retrieved", func() {
+			st := s.Status()
+
+			Convey("Then it should report the progress without waiting for the lock", func() {
+				So(st["ready"], ShouldEqual, data.Bool(false))
+				So(st, ShouldContainKey, "load_progress")
+			})
+		})
+		s.loadProgress.finish()
+	})
+}
@@ -0,0 +1,152 @@
+// Package pymlstatebench provides benchmarks and load generators measuring
+// pymlstate with a user-supplied Python class. They're intended to detect
+// performance regressions in the conversion between Go and Python.
+//
+// A benchmark of a model is written as
+//
+//	func BenchmarkPredict(b *testing.B) {
+//		pymlstatebench.BenchmarkPredict(b, &pymlstatebench.Config{
+//			ModulePath: "./",
+//			ModuleName: "my_model",
+//			ClassName:  "MyModel",
+//			Features:   100,
+//		})
+//	}
+package pymlstatebench
+
+import (
+	"gopkg.in/sensorbee/pymlstate.v0"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+// Config is the configuration of a state under benchmark and its records.
+type Config struct {
+	// ModulePath, ModuleName, and ClassName identify the Python class in the
+	// same way as parameters of CREATE STATE.
+	ModulePath string
+	ModuleName string
+	ClassName  string
+
+	// BatchSize is batch_train_size of the state. The default value is 10.
+	BatchSize int
+
+	// Params has other parameters of CREATE STATE. This is optional.
+	Params data.Map
+
+	// Features is the number of features of a record. The default value is
+	// 10.
+	Features int
+
+	// Classes is the number of labels. The default value is 2.
+	Classes int
+
+	// Seed is the seed of the generator of records.
+	Seed int64
+}
+
+func (c *Config) batchSize() int {
+	if c.BatchSize <= 0 {
+		return 10
+	}
+	return c.BatchSize
+}
+
+// Generator creates the generator of records configured by c.
+func (c *Config) Generator() *Generator {
+	features, classes := c.Features, c.Classes
+	if features <= 0 {
+		features = 10
+	}
+	if classes <= 0 {
+		classes = 2
+	}
+	return NewGenerator(features, classes, c.Seed)
+}
+
+// NewState creates a state configured by c.
+func (c *Config) NewState(ctx *core.Context) (*pymlstate.State, error) {
+	params := data.Map{
+		"module_path":      data.String(c.ModulePath),
+		"module_name":      data.String(c.ModuleName),
+		"class_name":       data.String(c.ClassName),
+		"batch_train_size": data.Int(c.batchSize()),
+	}
+	for k, v := range c.Params {
+		params[k] = v
+	}
+	st, err := (&pymlstate.StateCreator{}).CreateState(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return st.(*pymlstate.State), nil
+}
+
+func newBenchState(b *testing.B, c *Config) (*core.Context, *pymlstate.State) {
+	ctx := core.NewContext(nil)
+	s, err := c.NewState(ctx)
+	if err != nil {
+		b.Fatalf("cannot create a state: %v", err)
+	}
+	return ctx, s
+}
+
+// BenchmarkWrite measures Write. Each operation writes a tuple, and fit is
+// called at every BatchSize operations. It reports "records/s".
+func BenchmarkWrite(b *testing.B, c *Config) {
+	ctx, s := newBenchState(b, c)
+	defer s.Terminate(ctx)
+	g := c.Generator()
+	ts := make([]*core.Tuple, c.batchSize())
+	for i := range ts {
+		ts[i] = g.Tuple()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.Write(ctx, ts[i%len(ts)]); err != nil {
+			b.Fatalf("cannot write a tuple: %v", err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "records/s")
+}
+
+// BenchmarkFit measures the latency of Fit. Each operation trains a batch of
+// BatchSize records. It reports "records/s".
+func BenchmarkFit(b *testing.B, c *Config) {
+	ctx, s := newBenchState(b, c)
+	defer s.Terminate(ctx)
+	batch := c.Generator().Batch(c.batchSize())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Fit(ctx, batch); err != nil {
+			b.Fatalf("cannot fit: %v", err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N*len(batch))/b.Elapsed().Seconds(), "records/s")
+}
+
+// BenchmarkPredict measures Predict called concurrently by GOMAXPROCS
+// goroutines. It reports "qps".
+func BenchmarkPredict(b *testing.B, c *Config) {
+	ctx, s := newBenchState(b, c)
+	defer s.Terminate(ctx)
+	g := c.Generator()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rec := g.Record()
+		for pb.Next() {
+			if _, err := s.Predict(ctx, rec); err != nil {
+				b.Errorf("cannot predict: %v", err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "qps")
+}
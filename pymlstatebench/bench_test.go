@@ -0,0 +1,24 @@
+package pymlstatebench
+
+import (
+	"testing"
+)
+
+var testConfig = &Config{
+	ModulePath: "../",
+	ModuleName: "_test_pymlstate",
+	ClassName:  "TestClass",
+	Features:   100,
+}
+
+func BenchmarkTestClassWrite(b *testing.B) {
+	BenchmarkWrite(b, testConfig)
+}
+
+func BenchmarkTestClassFit(b *testing.B) {
+	BenchmarkFit(b, testConfig)
+}
+
+func BenchmarkTestClassPredict(b *testing.B) {
+	BenchmarkPredict(b, testConfig)
+}
@@ -0,0 +1,72 @@
+package pymlstatebench
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Generator generates synthetic records for benchmarks. A record is a map
+// having "label", which is an integer in [0, Classes), and "features", which
+// is an array of Features random floats in [0, 1). Generator is safe for
+// concurrent use.
+type Generator struct {
+	// Features is the number of features of a record.
+	Features int
+
+	// Classes is the number of labels.
+	Classes int
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewGenerator creates a generator. The same seed generates the same
+// records.
+func NewGenerator(features, classes int, seed int64) *Generator {
+	return &Generator{
+		Features: features,
+		Classes:  classes,
+		rnd:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Record returns a new record.
+func (g *Generator) Record() data.Map {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fs := make(data.Array, g.Features)
+	for i := range fs {
+		fs[i] = data.Float(g.rnd.Float64())
+	}
+	label := 0
+	if g.Classes > 0 {
+		label = g.rnd.Intn(g.Classes)
+	}
+	return data.Map{
+		"label":    data.Int(label),
+		"features": fs,
+	}
+}
+
+// Batch returns n new records.
+func (g *Generator) Batch(n int) []data.Value {
+	b := make([]data.Value, n)
+	for i := range b {
+		b[i] = g.Record()
+	}
+	return b
+}
+
+// Tuple returns a new tuple having a record at "data", which is written to a
+// state by INSERT INTO.
+func (g *Generator) Tuple() *core.Tuple {
+	now := time.Now()
+	return &core.Tuple{
+		Data:          data.Map{"data": g.Record()},
+		Timestamp:     now,
+		ProcTimestamp: now,
+	}
+}
@@ -0,0 +1,36 @@
+package pymlstatebench
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestGenerator(t *testing.T) {
+	Convey("Given a generator of 5 features and 3 classes", t, func() {
+		g := NewGenerator(5, 3, 1)
+
+		Convey("When a tuple is generated", func() {
+			tu := g.Tuple()
+
+			Convey("Then it should have a record at data", func() {
+				rec, err := tu.Data.Get(data.MustCompilePath("data"))
+				So(err, ShouldBeNil)
+				m, err := data.AsMap(rec)
+				So(err, ShouldBeNil)
+				fs, err := data.AsArray(m["features"])
+				So(err, ShouldBeNil)
+				So(len(fs), ShouldEqual, 5)
+				l, err := data.AsInt(m["label"])
+				So(err, ShouldBeNil)
+				So(l, ShouldBeBetweenOrEqual, 0, 2)
+			})
+		})
+
+		Convey("When records are generated with the same seed", func() {
+			Convey("Then they should be the same", func() {
+				So(NewGenerator(5, 3, 7).Batch(3), ShouldResemble, NewGenerator(5, 3, 7).Batch(3))
+			})
+		})
+	})
+}
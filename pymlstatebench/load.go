@@ -0,0 +1,107 @@
+package pymlstatebench
+
+import (
+	"gopkg.in/sensorbee/pymlstate.v0"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Result is a result of a load generator.
+type Result struct {
+	// Ops is the number of successful operations.
+	Ops int64
+
+	// Errors is the number of failed operations.
+	Errors int64
+
+	// Elapsed is the duration of the load.
+	Elapsed time.Duration
+
+	// P50 and P99 are percentiles of latencies of operations.
+	P50 time.Duration
+	P99 time.Duration
+}
+
+// Throughput returns successful operations per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+// run calls op from concurrency goroutines for d and aggregates latencies.
+func run(concurrency int, d time.Duration, op func() error) *Result {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var (
+		mu        sync.Mutex
+		res       Result
+		latencies []time.Duration
+		wg        sync.WaitGroup
+	)
+	start := time.Now()
+	deadline := start.Add(d)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var ls []time.Duration
+			var ops, errs int64
+			for time.Now().Before(deadline) {
+				t := time.Now()
+				if err := op(); err != nil {
+					errs++
+					continue
+				}
+				ops++
+				ls = append(ls, time.Now().Sub(t))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			res.Ops += ops
+			res.Errors += errs
+			latencies = append(latencies, ls...)
+		}()
+	}
+	wg.Wait()
+	res.Elapsed = time.Now().Sub(start)
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	res.P50 = percentile(latencies, 0.5)
+	res.P99 = percentile(latencies, 0.99)
+	return &res
+}
+
+// percentile returns the p-th percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+// RunPredictLoad calls Predict of the state with generated records from
+// concurrency goroutines for d.
+func RunPredictLoad(ctx *core.Context, s *pymlstate.State, g *Generator, concurrency int,
+	d time.Duration) *Result {
+	return run(concurrency, d, func() error {
+		_, err := s.Predict(ctx, g.Record())
+		return err
+	})
+}
+
+// RunWriteLoad writes generated tuples to the state from concurrency
+// goroutines for d. Latencies include fit called by Write.
+func RunWriteLoad(ctx *core.Context, s *pymlstate.State, g *Generator, concurrency int,
+	d time.Duration) *Result {
+	return run(concurrency, d, func() error {
+		return s.Write(ctx, g.Tuple())
+	})
+}
@@ -0,0 +1,35 @@
+package pymlstatebench
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	Convey("Given an operation failing every other call", t, func() {
+		var n int64
+		op := func() error {
+			if atomic.AddInt64(&n, 1)%2 == 0 {
+				return fmt.Errorf("failure")
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		}
+
+		Convey("When it's run from 2 goroutines", func() {
+			r := run(2, 50*time.Millisecond, op)
+
+			Convey("Then operations and errors should be counted", func() {
+				So(r.Ops, ShouldBeGreaterThan, 0)
+				So(r.Errors, ShouldBeGreaterThan, 0)
+				So(r.Ops+r.Errors, ShouldEqual, atomic.LoadInt64(&n))
+				So(r.P50, ShouldBeGreaterThanOrEqualTo, time.Millisecond)
+				So(r.P99, ShouldBeGreaterThanOrEqualTo, r.P50)
+				So(r.Throughput(), ShouldBeGreaterThan, 0)
+			})
+		})
+	})
+}
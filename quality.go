@@ -0,0 +1,71 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"time"
+)
+
+// qualityReport is a summary of data issues detected by preprocessors while
+// records of a batch are processed. All methods are no-op on a nil report
+// so that preprocessors can be called without a report.
+type qualityReport struct {
+	startedAt      time.Time
+	records        int
+	dropped        int
+	nulls          map[string]int
+	typeMismatches map[string]int
+	outOfRange     map[string]int
+}
+
+func newQualityReport() *qualityReport {
+	return &qualityReport{
+		startedAt:      time.Now(),
+		nulls:          map[string]int{},
+		typeMismatches: map[string]int{},
+		outOfRange:     map[string]int{},
+	}
+}
+
+func (r *qualityReport) record(dropped bool) {
+	if r == nil {
+		return
+	}
+	r.records++
+	if dropped {
+		r.dropped++
+	}
+}
+
+func (r *qualityReport) null(path string) {
+	if r != nil {
+		r.nulls[path]++
+	}
+}
+
+func (r *qualityReport) typeMismatch(path string) {
+	if r != nil {
+		r.typeMismatches[path]++
+	}
+}
+
+func (r *qualityReport) outOfRangeValue(path string) {
+	if r != nil {
+		r.outOfRange[path]++
+	}
+}
+
+// log writes the report with the number of records trained in the batch.
+func (r *qualityReport) log(ctx *core.Context, batchSize int) {
+	if r == nil {
+		return
+	}
+	ctx.Log().WithField("batch_started_at", r.startedAt).
+		WithField("batch_trained_at", time.Now()).
+		WithField("batch_size", batchSize).
+		WithField("records", r.records).
+		WithField("dropped_records", r.dropped).
+		WithField("null_counts", r.nulls).
+		WithField("type_mismatch_counts", r.typeMismatches).
+		WithField("out_of_range_counts", r.outOfRange).
+		Info("pymlstate's data quality report of a batch")
+}
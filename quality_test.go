@@ -0,0 +1,63 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestQualityReport(t *testing.T) {
+	Convey("Given a state having preprocessors and a quality report", t, func() {
+		s := &State{
+			params: MLParams{
+				Clip:   []ClipPolicy{{Path: "x", Max: new(float64)}},
+				Impute: []ImputePolicy{{Path: "y", Strategy: ImputeDrop}},
+			},
+		}
+		So(s.setUpParams(), ShouldBeNil)
+		rep := newQualityReport()
+
+		Convey("When records having issues are preprocessed", func() {
+			v, err := s.preprocess(data.Array{
+				data.Map{"x": data.Int(1), "y": data.Int(1)},
+				data.Map{"x": data.Int(-1), "y": data.Null{}},
+				data.Map{"x": data.Int(-1), "y": data.Int(1)},
+			}, preprocessTrain, rep)
+			So(err, ShouldBeNil)
+
+			Convey("Then the issues should be reported", func() {
+				arr, err := data.AsArray(v)
+				So(err, ShouldBeNil)
+				So(len(arr), ShouldEqual, 2)
+				So(rep.records, ShouldEqual, 3)
+				So(rep.dropped, ShouldEqual, 1)
+				So(rep.nulls, ShouldResemble, map[string]int{"y": 1})
+				So(rep.outOfRange, ShouldResemble, map[string]int{"x": 1})
+			})
+		})
+
+		Convey("When a record having a type mismatch is preprocessed", func() {
+			_, err := s.preprocess(data.Map{"x": data.String("a")}, preprocessTrain, rep)
+
+			Convey("Then it should fail and be reported", func() {
+				So(err, ShouldNotBeNil)
+				So(rep.typeMismatches, ShouldResemble, map[string]int{"x": 1})
+			})
+		})
+	})
+
+	Convey("Given a nil quality report", t, func() {
+		var rep *qualityReport
+
+		Convey("When issues are recorded", func() {
+			Convey("Then it should not panic", func() {
+				So(func() {
+					rep.record(true)
+					rep.null("x")
+					rep.typeMismatch("x")
+					rep.outOfRangeValue("x")
+				}, ShouldNotPanic)
+			})
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package pymlstate
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing rate events per second with a burst
+// of one second.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu       sync.Mutex
+	tokens   float64
+	last     time.Time
+	rejected int64
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// allow consumes a token and returns true when the event is allowed at now.
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if d := now.Sub(l.last); d > 0 {
+		l.tokens += d.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+	if l.tokens < 1 {
+		l.rejected++
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func (l *rateLimiter) rejectedCount() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rejected
+}
+
+// checkRate returns an error when the event exceeds the rate quota. It
+// always allows the event when l is nil.
+func (l *rateLimiter) checkRate(name string) error {
+	if l == nil || l.allow(time.Now()) {
+		return nil
+	}
+	return fmt.Errorf("the quota of %v (%v/sec) of the state is exceeded", name, l.rate)
+}
+
+// quotaWriter fails when more than limit bytes are written. It doesn't limit
+// when limit is 0.
+type quotaWriter struct {
+	w     io.Writer
+	limit int64
+	n     int64
+}
+
+func (q *quotaWriter) Write(p []byte) (int, error) {
+	if q.limit > 0 && q.n+int64(len(p)) > q.limit {
+		return 0, fmt.Errorf("the size of the model exceeds max_model_bytes (%v bytes)", q.limit)
+	}
+	n, err := q.w.Write(p)
+	q.n += int64(n)
+	return n, err
+}
+
+// quotaReader fails when more than limit bytes are read. It doesn't limit
+// when limit is 0.
+type quotaReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.n += int64(n)
+	if q.limit > 0 && q.n > q.limit {
+		return n, fmt.Errorf("the size of the model exceeds max_model_bytes (%v bytes)", q.limit)
+	}
+	return n, err
+}
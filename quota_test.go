@@ -0,0 +1,82 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	Convey("Given a rate limiter of 2 events per second", t, func() {
+		l := newRateLimiter(2)
+		now := l.last
+
+		Convey("When events exceed the burst", func() {
+			So(l.allow(now), ShouldBeTrue)
+			So(l.allow(now), ShouldBeTrue)
+
+			Convey("Then the next event should be rejected", func() {
+				So(l.allow(now), ShouldBeFalse)
+				So(l.rejectedCount(), ShouldEqual, 1)
+			})
+
+			Convey("Then an event should be allowed after tokens are refilled", func() {
+				So(l.allow(now.Add(500*time.Millisecond)), ShouldBeTrue)
+				So(l.allow(now.Add(500*time.Millisecond)), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a nil rate limiter", t, func() {
+		var l *rateLimiter
+
+		Convey("Then it should allow any event", func() {
+			So(l.checkRate("writes"), ShouldBeNil)
+		})
+	})
+}
+
+func TestModelBytesQuota(t *testing.T) {
+	Convey("Given a writer limited to 4 bytes", t, func() {
+		buf := bytes.NewBuffer(nil)
+		w := &quotaWriter{w: buf, limit: 4}
+
+		Convey("When 5 bytes are written", func() {
+			_, err1 := w.Write([]byte("abc"))
+			_, err2 := w.Write([]byte("de"))
+
+			Convey("Then it should fail after the limit", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldNotBeNil)
+				So(err2.Error(), ShouldContainSubstring, "max_model_bytes")
+			})
+		})
+	})
+
+	Convey("Given a reader limited to 4 bytes", t, func() {
+		r := &quotaReader{r: bytes.NewReader([]byte("abcde")), limit: 4}
+
+		Convey("When all bytes are read", func() {
+			_, err := ioutil.ReadAll(r)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an unlimited reader", t, func() {
+		r := &quotaReader{r: bytes.NewReader([]byte("abcde"))}
+
+		Convey("When all bytes are read", func() {
+			b, err := ioutil.ReadAll(r)
+
+			Convey("Then it should succeed", func() {
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "abcde")
+			})
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"time"
+)
+
+// Rank scores candidates for the context such as a user by "rank" of the
+// model, which is declared as `def rank(self, context, candidates)` and
+// returns an array of scores of candidates in the same order. The context
+// and candidates are redacted in the same way as Predict. It returns an
+// array of maps having "candidate" and "score" in descending order of
+// scores. Candidates having the same score keep their order.
+func (s *State) Rank(ctx *core.Context, context data.Value, candidates data.Array) (data.Value, error) {
+	called := time.Now()
+	if err := s.authorize(ctx, ActionPredict); err != nil {
+		return nil, err
+	}
+	s.lockForPredict(called)
+	defer s.rwm.RUnlock()
+	if err := s.predictLimiter.checkRate("predicts"); err != nil {
+		return nil, err
+	}
+	c, err := s.redact(context)
+	if err != nil {
+		return nil, err
+	}
+	cands, err := s.redact(candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := s.callPython(callPredict, "rank", c, cands)
+	end := time.Now()
+	s.metrics.observePredict(end, end.Sub(start), err)
+	if err != nil {
+		return nil, err
+	}
+	return rankCandidates(candidates, res)
+}
+
+// rankCandidates orders candidates by scores returned by "rank".
+func rankCandidates(candidates data.Array, res data.Value) (data.Array, error) {
+	scores, err := data.AsArray(res)
+	if err != nil {
+		return nil, fmt.Errorf("rank must return an array of scores: %v", err)
+	}
+	if len(scores) != len(candidates) {
+		return nil, fmt.Errorf("rank returned %v scores for %v candidates", len(scores), len(candidates))
+	}
+	type scored struct {
+		candidate data.Value
+		score     float64
+	}
+	ss := make([]scored, len(candidates))
+	for i, c := range candidates {
+		f, err := asNumber(scores[i])
+		if err != nil {
+			return nil, fmt.Errorf("a score returned by rank must be a number: %v", err)
+		}
+		ss[i] = scored{c, f}
+	}
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].score > ss[j].score })
+
+	ranked := make(data.Array, len(ss))
+	for i, x := range ss {
+		ranked[i] = data.Map{
+			"candidate": x.candidate,
+			"score":     data.Float(x.score),
+		}
+	}
+	return ranked, nil
+}
+
+// Rank scores candidates for the context by the model of the state and
+// returns them in descending order of scores. See State.Rank for details.
+func Rank(ctx *core.Context, stateName string, context data.Value, candidates data.Array) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.Rank(ctx, context, candidates)
+}
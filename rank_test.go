@@ -0,0 +1,62 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestRank(t *testing.T) {
+	Convey("Given a state ranking candidates", t, func() {
+		ctx := core.NewContext(nil)
+		var args []data.Value
+		var scores data.Value = data.Array{data.Float(0.2), data.Int(1), data.Float(0.2)}
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				args = dt
+				return scores, nil
+			},
+		}
+		s := &State{base: b}
+		So(s.setUpParams(), ShouldBeNil)
+		user := data.Map{"user": data.String("u1")}
+		candidates := data.Array{data.String("a"), data.String("b"), data.String("c")}
+
+		Convey("When candidates are ranked", func() {
+			res, err := s.Rank(ctx, user, candidates)
+
+			Convey("Then the context and candidates should be passed to rank", func() {
+				So(err, ShouldBeNil)
+				So(b.calls, ShouldResemble, []string{"rank"})
+				So(args, ShouldResemble, []data.Value{user, candidates})
+			})
+
+			Convey("Then candidates should be ordered by their scores", func() {
+				So(res, ShouldResemble, data.Array{
+					data.Map{"candidate": data.String("b"), "score": data.Float(1)},
+					data.Map{"candidate": data.String("a"), "score": data.Float(0.2)},
+					data.Map{"candidate": data.String("c"), "score": data.Float(0.2)},
+				})
+			})
+		})
+
+		Convey("When rank returns scores of a different length", func() {
+			scores = data.Array{data.Float(1)}
+			_, err := s.Rank(ctx, user, candidates)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When rank returns a non-numeric score", func() {
+			scores = data.Array{data.Float(1), data.String("x"), data.Float(0)}
+			_, err := s.Rank(ctx, user, candidates)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,146 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// Phase is a readiness phase of a state. A state is ready to serve
+// predictions only in PhaseServing.
+type Phase string
+
+const (
+	// PhaseInitializing is the phase while the state is being created.
+	PhaseInitializing Phase = "initializing"
+
+	// PhaseLoading is the phase while a model is being loaded or reloaded.
+	PhaseLoading Phase = "loading"
+
+	// PhaseTrainingOnly is the phase of a created state whose model hasn't
+	// been trained yet. It accepts training, but its predictions may not be
+	// meaningful. It becomes PhaseServing when a batch is trained.
+	PhaseTrainingOnly Phase = "training_only"
+
+	// PhaseServing is the phase while the state serves predictions.
+	PhaseServing Phase = "serving"
+
+	// PhaseDraining is the phase while the state is being terminated or
+	// after it's terminated.
+	PhaseDraining Phase = "draining"
+
+	// PhaseFailed is the phase after the Python instance of the state has
+	// terminated unexpectedly, for example when its process crashed.
+	PhaseFailed Phase = "failed"
+
+	// PhaseDisabled is the phase after consecutive failures of calls to the
+	// model have reached failure_budget. The state doesn't call the model
+	// until it's enabled by Enable or a model is loaded.
+	PhaseDisabled Phase = "disabled"
+)
+
+// readiness is the readiness phase of a state. It has its own lock so that
+// the phase can be read while the state is locked for loading.
+type readiness struct {
+	mu      sync.Mutex
+	phase   Phase
+	changed chan struct{}
+}
+
+func (r *readiness) get() Phase {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.phase == "" {
+		return PhaseInitializing
+	}
+	return r.phase
+}
+
+func (r *readiness) set(p Phase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setLocked(p)
+}
+
+func (r *readiness) setLocked(p Phase) {
+	if r.phase == p {
+		return
+	}
+	r.phase = p
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+}
+
+// trained makes the phase PhaseServing when it's PhaseTrainingOnly.
+func (r *readiness) trained() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.phase == PhaseTrainingOnly {
+		r.setLocked(PhaseServing)
+	}
+}
+
+// wait waits until the phase becomes PhaseServing. It fails when the timeout
+// expires or the state is draining.
+func (r *readiness) wait(timeout time.Duration) error {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		r.mu.Lock()
+		p := r.phase
+		if p == PhaseServing {
+			r.mu.Unlock()
+			return nil
+		}
+		if p == PhaseDraining {
+			r.mu.Unlock()
+			return fmt.Errorf("the state is draining")
+		}
+		if r.changed == nil {
+			r.changed = make(chan struct{})
+		}
+		ch := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-t.C:
+			return fmt.Errorf("the state isn't ready after %v: %v", timeout, r.get())
+		}
+	}
+}
+
+// phase returns the readiness phase of the state. It must be called while
+// the lock is acquired.
+func (s *State) phase() Phase {
+	p := s.readiness.get()
+	if (p == PhaseServing || p == PhaseTrainingOnly) && s.base != nil && s.base.CheckTermination() != nil {
+		return PhaseFailed
+	}
+	return p
+}
+
+// WaitReady waits until the state becomes ready to serve predictions. It
+// returns an error when the state doesn't become ready within the timeout.
+func (s *State) WaitReady(timeout time.Duration) error {
+	return s.readiness.wait(timeout)
+}
+
+// WaitReady waits until the state becomes ready to serve predictions. It
+// returns false when the state doesn't become ready within the timeout,
+// which is a number of seconds or a duration string such as "30s".
+func WaitReady(ctx *core.Context, stateName string, timeout data.Value) (data.Value, error) {
+	d, err := asDuration(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("timeout must be a duration: %v", err)
+	}
+	s, err := lookupAuthorizedState(ctx, stateName, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+	return data.Bool(s.WaitReady(d) == nil), nil
+}
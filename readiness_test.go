@@ -0,0 +1,53 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	Convey("Given a state being created", t, func() {
+		b := &fakeBackend{}
+		s := &State{base: b}
+		So(s.phase(), ShouldEqual, PhaseInitializing)
+
+		Convey("When it becomes ready while waiting", func() {
+			s.readiness.set(PhaseTrainingOnly)
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				s.readiness.trained()
+			}()
+
+			Convey("Then WaitReady should return", func() {
+				So(s.WaitReady(time.Second), ShouldBeNil)
+				So(s.phase(), ShouldEqual, PhaseServing)
+			})
+		})
+
+		Convey("When it doesn't become ready", func() {
+			err := s.WaitReady(10 * time.Millisecond)
+
+			Convey("Then WaitReady should time out", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When it's draining", func() {
+			s.readiness.set(PhaseDraining)
+
+			Convey("Then WaitReady should fail immediately", func() {
+				So(s.WaitReady(time.Hour), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the instance terminates unexpectedly while serving", func() {
+			s.readiness.set(PhaseServing)
+			b.terminated = true
+
+			Convey("Then it should have failed", func() {
+				So(s.phase(), ShouldEqual, PhaseFailed)
+			})
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package pymlstate
+
+import (
+	"errors"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+)
+
+// errReadOnly is returned when a read-only state is trained.
+var errReadOnly = errors.New("the state is read-only")
+
+// OpenReadOnly creates an inference-only state from the file written by
+// Save or SaveAll, so that a serving binary can use the model without
+// creating the state by a CREATE STATE statement. The Python class is
+// instantiated by baseParams, such as the path of the module on this host,
+// or by base parameters saved with the model when it's nil. The state
+// rejects all training such as Write and Fit, and it doesn't open the
+// write-ahead log or retrain the model periodically. The state isn't added
+// to the context.
+func OpenReadOnly(ctx *core.Context, path string, baseParams *pystate.BaseParams) (*State, error) {
+	s := &State{readOnly: true}
+	if baseParams != nil {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		saved, _, _, err := readStateHeader(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		b, err := newBackend(baseParams, saved, data.Map{})
+		if err != nil {
+			return nil, err
+		}
+		s.base = b
+		s.params = *saved
+		// The model is loaded into the instance without a canary.
+		s.params.CanaryData = ""
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.terminateBase(ctx)
+		return nil, err
+	}
+	defer f.Close()
+	if err := s.load(ctx, f, data.Map{}, ""); err != nil {
+		s.terminateBase(ctx)
+		return nil, err
+	}
+	if baseParams != nil {
+		bp := *baseParams
+		s.baseParams = &bp
+	}
+	return s, nil
+}
+
+// terminateBase terminates the instance created for a state which couldn't
+// be opened.
+func (s *State) terminateBase(ctx *core.Context) {
+	if s.base == nil {
+		return
+	}
+	if err := s.base.Terminate(ctx); err != nil {
+		ctx.ErrLog(err).Warn("cannot terminate the instance of pymlstate")
+	}
+}
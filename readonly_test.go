@@ -0,0 +1,61 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestReadOnlyState(t *testing.T) {
+	Convey("Given a read-only state", t, func() {
+		ctx := core.NewContext(nil)
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.String("label"), nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1}, readOnly: true}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When a tuple is written", func() {
+			err := s.Write(ctx, &core.Tuple{Data: data.Map{"x": data.Int(1)}})
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldEqual, errReadOnly)
+				So(b.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When it's fit", func() {
+			_, err := s.Fit(ctx, []data.Value{data.Map{"x": data.Int(1)}})
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldEqual, errReadOnly)
+				So(b.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the data is predicted", func() {
+			res, err := s.Predict(ctx, data.Map{"x": data.Int(1)})
+
+			Convey("Then the model should be applied", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.String("label"))
+				So(s.Status()["read_only"], ShouldEqual, data.Bool(true))
+			})
+		})
+	})
+
+	Convey("Given a checkpoint which doesn't exist", t, func() {
+		ctx := core.NewContext(nil)
+
+		Convey("When it's opened", func() {
+			_, err := OpenReadOnly(ctx, "/path/to/nowhere.state", nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
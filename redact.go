@@ -0,0 +1,149 @@
+package pymlstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+)
+
+// redactor removes or hashes fields of records so that Python never sees
+// raw values of them. It's applied before records are buffered.
+type redactor struct {
+	drops  []droppedField
+	hashes []data.Path
+	salt   string
+}
+
+// droppedField is a field to be removed. The field is removed from the map
+// at parent. A nil parent means the record itself.
+type droppedField struct {
+	parent data.Path
+	key    string
+}
+
+func newRedactor(p *MLParams) (*redactor, error) {
+	r := &redactor{
+		salt: p.HashSalt,
+	}
+	for _, dp := range p.DropPaths {
+		f, err := newDroppedField(dp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid drop_paths: %v", err)
+		}
+		r.drops = append(r.drops, f)
+	}
+
+	hs, err := compilePaths(p.HashPaths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash_paths: %v", err)
+	}
+	r.hashes = hs
+	return r, nil
+}
+
+// newDroppedField parses a path to be dropped. The last element of the path
+// must be a key of a map (e.g. "user.email", but not "emails[0]").
+func newDroppedField(path string) (droppedField, error) {
+	parent, key := "", path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parent, key = path[:i], path[i+1:]
+	}
+	if key == "" || strings.ContainsAny(key, "[]\"") {
+		return droppedField{}, fmt.Errorf("'%v' must end with a key of a map", path)
+	}
+
+	f := droppedField{key: key}
+	if parent != "" {
+		p, err := data.CompilePath(parent)
+		if err != nil {
+			return droppedField{}, err
+		}
+		f.parent = p
+	}
+	return f, nil
+}
+
+// drop removes the field from the record if it exists.
+func (f *droppedField) drop(rec data.Map) {
+	target := rec
+	if f.parent != nil {
+		v, err := rec.Get(f.parent)
+		if err != nil {
+			return
+		}
+		pm, err := data.AsMap(v)
+		if err != nil {
+			return
+		}
+		target = pm
+	}
+	delete(target, f.key)
+}
+
+// redact returns a redacted copy of the record.
+func (r *redactor) redact(m data.Map) (data.Map, error) {
+	rec := m.Copy()
+	for _, f := range r.drops {
+		f.drop(rec)
+	}
+
+	for _, p := range r.hashes {
+		v, err := rec.Get(p)
+		if err != nil || v.Type() == data.TypeNull {
+			continue
+		}
+		if err := rec.Set(p, r.hash(v)); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// hash returns the hex-encoded SHA-256 hash of the salted value. A string is
+// hashed as it is and other values are hashed by their string representation.
+func (r *redactor) hash(v data.Value) data.Value {
+	sum := sha256.Sum256([]byte(r.salt + valueKey(v)))
+	return data.String(hex.EncodeToString(sum[:]))
+}
+
+// redactTuple returns a copy of the tuple whose "data" field is redacted.
+// The original tuple isn't modified.
+func (r *redactor) redactTuple(t *core.Tuple) (*core.Tuple, error) {
+	return mapTupleRecords(t, r.redact)
+}
+
+// mapTupleRecords returns a copy of the tuple whose records in "data" field
+// are converted by f. The original tuple isn't modified.
+func mapTupleRecords(t *core.Tuple, f func(m data.Map) (data.Map, error)) (*core.Tuple, error) {
+	dt, err := t.Data.Get(datPath)
+	if err != nil {
+		return t, nil
+	}
+	v, err := mapRecords(dt, f)
+	if err != nil {
+		return nil, err
+	}
+
+	res := *t
+	res.Data = make(data.Map, len(t.Data))
+	for k, x := range t.Data {
+		res.Data[k] = x
+	}
+	res.Data["data"] = v
+	return &res, nil
+}
+
+// redact removes or hashes fields of records in v given by Fit or Predict.
+// Records given by Write are redacted by redactTuple before they're
+// buffered.
+// The feature allowlist is also applied.
+func (s *State) redact(v data.Value) (data.Value, error) {
+	v, err := applyFeatureAllowlist(v)
+	if err != nil || s.redactor == nil {
+		return v, err
+	}
+	return mapRecords(v, s.redactor.redact)
+}
@@ -0,0 +1,97 @@
+package pymlstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	hashOf := func(s string) data.Value {
+		sum := sha256.Sum256([]byte(s))
+		return data.String(hex.EncodeToString(sum[:]))
+	}
+
+	Convey("Given a redactor", t, func() {
+		r, err := newRedactor(&MLParams{
+			DropPaths: []string{"email", "user.phone"},
+			HashPaths: []string{"user.id"},
+			HashSalt:  "salt",
+		})
+		So(err, ShouldBeNil)
+
+		newRecord := func() data.Map {
+			return data.Map{
+				"email": data.String("a@example.com"),
+				"user": data.Map{
+					"id":    data.String("u1"),
+					"phone": data.String("000"),
+				},
+				"x": data.Float(1),
+			}
+		}
+
+		Convey("When a record is redacted", func() {
+			rec := newRecord()
+			res, err := r.redact(rec)
+			So(err, ShouldBeNil)
+
+			Convey("Then fields should be dropped or hashed", func() {
+				So(res, ShouldResemble, data.Map{
+					"user": data.Map{
+						"id": hashOf("saltu1"),
+					},
+					"x": data.Float(1),
+				})
+			})
+
+			Convey("Then the original record should not be modified", func() {
+				So(rec, ShouldResemble, newRecord())
+			})
+		})
+
+		Convey("When a record without the fields is redacted", func() {
+			res, err := r.redact(data.Map{"x": data.Float(1)})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should not be changed", func() {
+				So(res, ShouldResemble, data.Map{"x": data.Float(1)})
+			})
+		})
+
+		Convey("When a tuple is redacted", func() {
+			tu := &core.Tuple{
+				Data: data.Map{
+					"data":  newRecord(),
+					"other": data.Int(1),
+				},
+			}
+			rt, err := r.redactTuple(tu)
+			So(err, ShouldBeNil)
+
+			Convey("Then only its data field should be redacted", func() {
+				dt, err := rt.Data.Get(datPath)
+				So(err, ShouldBeNil)
+				m, err := data.AsMap(dt)
+				So(err, ShouldBeNil)
+				So(m["email"], ShouldBeNil)
+				So(rt.Data["other"], ShouldEqual, data.Int(1))
+			})
+
+			Convey("Then the original tuple should not be modified", func() {
+				So(tu.Data["data"], ShouldResemble, newRecord())
+			})
+		})
+	})
+
+	Convey("Given a drop path ending with an index", t, func() {
+		_, err := newRedactor(&MLParams{DropPaths: []string{"emails[0]"}})
+
+		Convey("Then creating a redactor should fail", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// referenceJoiner merges rows of a static reference table into records
+// having the same keys. The table is a dataset read in the same way as
+// eval_data and it's replaced by reload.
+type referenceJoiner struct {
+	uri        string
+	key        string
+	keyPath    data.Path
+	outputPath data.Path
+
+	mu   sync.RWMutex
+	rows map[string]data.Map
+}
+
+var _ preprocessor = &referenceJoiner{}
+
+func newReferenceJoiner(p *MLParams) (*referenceJoiner, error) {
+	j := &referenceJoiner{
+		uri: p.ReferenceData,
+		key: p.ReferenceKey,
+	}
+	keyPath := p.ReferenceKeyPath
+	if keyPath == "" {
+		keyPath = p.ReferenceKey
+	}
+	kp, err := data.CompilePath(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference_key_path '%v': %v", keyPath, err)
+	}
+	j.keyPath = kp
+	if p.ReferenceOutputPath != "" {
+		if j.outputPath, err = data.CompilePath(p.ReferenceOutputPath); err != nil {
+			return nil, fmt.Errorf("invalid reference_output_path '%v': %v", p.ReferenceOutputPath, err)
+		}
+	}
+	return j, nil
+}
+
+// reload reads the reference table and replaces rows with it. Rows are kept
+// when it fails. It returns the number of rows.
+func (j *referenceJoiner) reload() (int, error) {
+	recs, err := readDataset(j.uri)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read the reference data: %v", err)
+	}
+	rows := make(map[string]data.Map, len(recs))
+	for i, r := range recs {
+		m, _ := data.AsMap(r)
+		k, ok := m[j.key]
+		if !ok || k.Type() == data.TypeNull {
+			return 0, fmt.Errorf("the row %v of the reference data doesn't have '%v'", i+1, j.key)
+		}
+		rows[valueKey(k)] = m // a later row overwrites an earlier one
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.rows = rows
+	return len(rows), nil
+}
+
+// process merges the row having the key of the record. The row is set at
+// reference_output_path, or its fields are merged into the record without
+// overwriting existing fields when the path isn't given. Records without
+// matching rows are left as they are.
+func (j *referenceJoiner) process(rec data.Map, training bool, rep *qualityReport) error {
+	k, err := rec.Get(j.keyPath)
+	if err != nil || k.Type() == data.TypeNull {
+		return nil
+	}
+	j.mu.RLock()
+	row, ok := j.rows[valueKey(k)]
+	j.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if j.outputPath != nil {
+		return rec.Set(j.outputPath, row.Copy())
+	}
+	for f, v := range row {
+		if _, ok := rec[f]; !ok {
+			rec[f] = v
+		}
+	}
+	return nil
+}
+
+// len returns the number of rows.
+func (j *referenceJoiner) len() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return len(j.rows)
+}
+
+// ReloadReference reads reference_data again and replaces the reference
+// table with it, so that records are joined with updated rows without
+// recreating the state. The current table is kept when it fails. It returns
+// the number of rows of the table.
+func (s *State) ReloadReference(ctx *core.Context) (int, error) {
+	s.rwm.RLock()
+	j := s.references
+	s.rwm.RUnlock()
+	if j == nil {
+		return 0, fmt.Errorf("the state doesn't have reference_data")
+	}
+	return j.reload()
+}
+
+// ReloadReference reloads the reference table of the state and returns the
+// number of its rows. See State.ReloadReference for details.
+func ReloadReference(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupAuthorizedState(ctx, stateName, ActionLoad)
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.ReloadReference(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return data.Int(n), nil
+}
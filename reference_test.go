@@ -0,0 +1,85 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReferenceJoiner(t *testing.T) {
+	Convey("Given a reference table in CSV", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_reference")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "items.csv")
+		So(ioutil.WriteFile(path, []byte("item_id,category,price\n1,book,10\n2,food,3.5\n"), 0644), ShouldBeNil)
+
+		Convey("When records are joined with it", func() {
+			j, err := newReferenceJoiner(&MLParams{ReferenceData: path, ReferenceKey: "item_id"})
+			So(err, ShouldBeNil)
+			n, err := j.reload()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+
+			rec := data.Map{"item_id": data.Int(2), "price": data.Int(4)}
+			So(j.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then fields of the matching row should be merged", func() {
+				So(rec["category"], ShouldEqual, data.String("food"))
+			})
+
+			Convey("Then existing fields shouldn't be overwritten", func() {
+				So(rec["price"], ShouldEqual, data.Int(4))
+			})
+
+			Convey("Then records without matching rows should be left as they are", func() {
+				rec := data.Map{"item_id": data.Int(3)}
+				So(j.process(rec, true, nil), ShouldBeNil)
+				So(rec, ShouldResemble, data.Map{"item_id": data.Int(3)})
+			})
+		})
+
+		Convey("When rows are set at an output path", func() {
+			j, err := newReferenceJoiner(&MLParams{ReferenceData: path, ReferenceKey: "item_id",
+				ReferenceKeyPath: "item.id", ReferenceOutputPath: "item.info"})
+			So(err, ShouldBeNil)
+			_, err = j.reload()
+			So(err, ShouldBeNil)
+
+			rec := data.Map{"item": data.Map{"id": data.Int(1)}}
+			So(j.process(rec, false, nil), ShouldBeNil)
+
+			Convey("Then the row should be set at the path", func() {
+				info, err := rec.Get(data.MustCompilePath("item.info.category"))
+				So(err, ShouldBeNil)
+				So(info, ShouldEqual, data.String("book"))
+			})
+		})
+
+		Convey("When it's reloaded by a state", func() {
+			s := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1, ReferenceData: path, ReferenceKey: "item_id"}}
+			So(s.setUpParams(), ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte("item_id,category\n1,book\n2,food\n3,toy\n"), 0644), ShouldBeNil)
+			n, err := s.ReloadReference(core.NewContext(nil))
+
+			Convey("Then it should have updated rows", func() {
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 3)
+				So(s.Status()["reference_rows"], ShouldEqual, data.Int(3))
+			})
+
+			Convey("Then broken reference data should keep the current rows", func() {
+				So(ioutil.WriteFile(path, []byte("category\nbook\n"), 0644), ShouldBeNil)
+				_, err := s.ReloadReference(core.NewContext(nil))
+				So(err, ShouldNotBeNil)
+				So(s.references.len(), ShouldEqual, 3)
+			})
+		})
+	})
+}
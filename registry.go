@@ -0,0 +1,212 @@
+package pymlstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry is a client of a model registry, which manages artifacts of
+// models by names and versions.
+type Registry interface {
+	// Resolve returns the URI of the artifact of the version of the model.
+	// The artifact must be data written by State.Save.
+	Resolve(name, version string) (string, error)
+
+	// ReportDeployment notifies the registry that the version of the model
+	// has been deployed to the state.
+	ReportDeployment(name, version, stateName string) error
+}
+
+var (
+	registriesMutex sync.RWMutex
+	registries      = map[string]Registry{}
+)
+
+// RegisterRegistry registers a registry with a name so that states can use
+// it by the registry parameter.
+func RegisterRegistry(name string, r Registry) error {
+	registriesMutex.Lock()
+	defer registriesMutex.Unlock()
+	if _, ok := registries[name]; ok {
+		return fmt.Errorf("registry '%v' is already registered", name)
+	}
+	registries[name] = r
+	return nil
+}
+
+// lookupRegistry returns the registry registered with the name. A name
+// starting with http:// or https:// is considered as the base URL of an
+// HTTPRegistry.
+func lookupRegistry(name string) (Registry, error) {
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		return NewHTTPRegistry(name), nil
+	}
+	registriesMutex.RLock()
+	defer registriesMutex.RUnlock()
+	r, ok := registries[name]
+	if !ok {
+		return nil, fmt.Errorf("registry '%v' isn't registered", name)
+	}
+	return r, nil
+}
+
+// HTTPRegistry is a Registry communicating with a registry server over
+// HTTP in JSON. It resolves an artifact by
+//
+//	GET <BaseURL>/models/<name>/versions/<version>
+//
+// which responds {"uri": "<artifact URI>"}, and reports a deployment by
+//
+//	POST <BaseURL>/models/<name>/versions/<version>/deployments
+//
+// with {"state": "<state name>", "deployed_at": "<RFC 3339 time>"}.
+type HTTPRegistry struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+var _ Registry = &HTTPRegistry{}
+
+// NewHTTPRegistry creates an HTTPRegistry having a client with a timeout.
+func NewHTTPRegistry(baseURL string) *HTTPRegistry {
+	return &HTTPRegistry{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (r *HTTPRegistry) versionURL(name, version string) string {
+	return fmt.Sprintf("%v/models/%v/versions/%v", r.BaseURL,
+		url.PathEscape(name), url.PathEscape(version))
+}
+
+// Resolve resolves the artifact URI by the registry server.
+func (r *HTTPRegistry) Resolve(name, version string) (string, error) {
+	res, err := r.Client.Get(r.versionURL(name, version))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if err := checkRegistryResponse(res); err != nil {
+		return "", err
+	}
+
+	var body struct {
+		URI string `json:"uri"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid response of the registry: %v", err)
+	}
+	if body.URI == "" {
+		return "", fmt.Errorf("the registry doesn't have the artifact of %v:%v", name, version)
+	}
+	return body.URI, nil
+}
+
+// ReportDeployment reports the deployment to the registry server.
+func (r *HTTPRegistry) ReportDeployment(name, version, stateName string) error {
+	b, err := json.Marshal(map[string]string{
+		"state":       stateName,
+		"deployed_at": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	res, err := r.Client.Post(r.versionURL(name, version)+"/deployments",
+		"application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return checkRegistryResponse(res)
+}
+
+func checkRegistryResponse(res *http.Response) error {
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("the registry responded %v: %v", res.Status, strings.TrimSpace(string(msg)))
+}
+
+// openURI opens a file at the URI. The URI is a file path, a file
+// URI, or an HTTP(S) URL.
+func openURI(uri string, client *http.Client) (io.ReadCloser, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URI '%v': %v", uri, err)
+	}
+	switch u.Scheme {
+	case "":
+		return os.Open(uri)
+	case "file":
+		return os.Open(u.Path)
+	case "http", "https":
+		res, err := client.Get(uri)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode/100 != 2 {
+			res.Body.Close()
+			return nil, fmt.Errorf("cannot download '%v': %v", uri, res.Status)
+		}
+		return res.Body, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme of the URI: %v", uri)
+	}
+}
+
+// DeployFromRegistry loads the version of the model resolved by the registry
+// of the state and reports the deployment to the registry. The loaded model
+// is validated with canary_data when it's set. A return value is always nil.
+func DeployFromRegistry(ctx *core.Context, stateName, modelName, version string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.rwm.RLock()
+	name := s.params.Registry
+	s.rwm.RUnlock()
+	if name == "" {
+		return nil, fmt.Errorf("state '%v' doesn't have a registry", stateName)
+	}
+	reg, err := lookupRegistry(name)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, err := reg.Resolve(modelName, version)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %v:%v: %v", modelName, version, err)
+	}
+	a, err := openURI(uri, &http.Client{Timeout: 10 * time.Minute})
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	if err := s.loadVersion(ctx, a, data.Map{}, fmt.Sprintf("%v:%v", modelName, version)); err != nil {
+		return nil, fmt.Errorf("cannot deploy %v:%v: %v", modelName, version, err)
+	}
+
+	if err := reg.ReportDeployment(modelName, version, stateName); err != nil {
+		// The model has already been deployed even if the report fails.
+		ctx.ErrLog(err).WithField("model", modelName).WithField("version", version).
+			Warn("pymlstate cannot report the deployment to the registry")
+	}
+	ctx.Log().WithField("state", stateName).WithField("model", modelName).
+		WithField("version", version).WithField("uri", uri).
+		Info("pymlstate deployed the model from the registry")
+	return nil, nil
+}
@@ -0,0 +1,136 @@
+package pymlstate
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHTTPRegistry(t *testing.T) {
+	Convey("Given a registry server", t, func() {
+		var deployed map[string]string
+		mux := http.NewServeMux()
+		mux.HandleFunc("/models/mnist/versions/3", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"uri": "file:///models/mnist/3.state"}`))
+		})
+		mux.HandleFunc("/models/mnist/versions/3/deployments", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&deployed)
+			w.WriteHeader(http.StatusCreated)
+		})
+		ts := httptest.NewServer(mux)
+		Reset(ts.Close)
+
+		reg, err := lookupRegistry(ts.URL + "/")
+		So(err, ShouldBeNil)
+
+		Convey("When an artifact is resolved", func() {
+			uri, err := reg.Resolve("mnist", "3")
+
+			Convey("Then the URI should be returned", func() {
+				So(err, ShouldBeNil)
+				So(uri, ShouldEqual, "file:///models/mnist/3.state")
+			})
+		})
+
+		Convey("When an unknown version is resolved", func() {
+			_, err := reg.Resolve("mnist", "4")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "404")
+			})
+		})
+
+		Convey("When a deployment is reported", func() {
+			err := reg.ReportDeployment("mnist", "3", "ml_mnist")
+
+			Convey("Then the server should receive the state name", func() {
+				So(err, ShouldBeNil)
+				So(deployed["state"], ShouldEqual, "ml_mnist")
+				So(deployed["deployed_at"], ShouldNotBeEmpty)
+			})
+		})
+	})
+}
+
+type testRegistry struct{}
+
+func (testRegistry) Resolve(name, version string) (string, error) { return "", nil }
+
+func (testRegistry) ReportDeployment(name, version, stateName string) error { return nil }
+
+func TestRegisterRegistry(t *testing.T) {
+	Convey("Given a registered registry", t, func() {
+		So(RegisterRegistry("pymlstate_test_registry", testRegistry{}), ShouldBeNil)
+		Reset(func() {
+			registriesMutex.Lock()
+			delete(registries, "pymlstate_test_registry")
+			registriesMutex.Unlock()
+		})
+
+		Convey("When it's looked up", func() {
+			r, err := lookupRegistry("pymlstate_test_registry")
+
+			Convey("Then it should be returned", func() {
+				So(err, ShouldBeNil)
+				So(r, ShouldResemble, testRegistry{})
+			})
+		})
+
+		Convey("When another registry is registered with the same name", func() {
+			err := RegisterRegistry("pymlstate_test_registry", testRegistry{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When an unknown registry is looked up", func() {
+			_, err := lookupRegistry("pymlstate_unknown_registry")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestOpenURI(t *testing.T) {
+	Convey("Given a file", t, func() {
+		f, err := ioutil.TempFile("", "pymlstate_artifact")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.Remove(f.Name())
+		})
+		f.WriteString("model")
+		f.Close()
+
+		Convey("When it's opened by a file URI", func() {
+			r, err := openURI("file://"+f.Name(), http.DefaultClient)
+			So(err, ShouldBeNil)
+			defer r.Close()
+
+			Convey("Then the content should be read", func() {
+				b, err := ioutil.ReadAll(r)
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "model")
+			})
+		})
+
+		Convey("When it's opened by an unsupported scheme", func() {
+			_, err := openURI("s3://bucket/model", http.DefaultClient)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package pymlstate
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"regexp"
+)
+
+var pythonModuleNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// ReloadModule re-imports the Python module of the state and reconstructs
+// the instance from an in-memory snapshot of the current model, so that
+// changes of the model class are picked up without losing the trained model.
+// The current instance is kept when the reload fails or the new instance
+// doesn't pass the canary validation.
+func (s *State) ReloadModule(ctx *core.Context) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return err
+	}
+	if s.baseParams == nil {
+		return fmt.Errorf("the module of the state is unknown because it was saved by an old version")
+	}
+	prev := s.readiness.get()
+	s.readiness.set(PhaseLoading)
+	defer s.readiness.set(prev)
+
+	snapshot := bytes.NewBuffer(nil)
+	if err := s.base.Save(ctx, snapshot, data.Map{}); err != nil {
+		return fmt.Errorf("cannot take a snapshot of the model: %v", err)
+	}
+	if err := evictPythonModule(s.baseParams.ModuleName); err != nil {
+		return err
+	}
+
+	b, err := loadBackend(ctx, snapshot, &s.params, data.Map{})
+	if err != nil {
+		return fmt.Errorf("cannot reconstruct the instance: %v", err)
+	}
+	// The new instance shares preprocessors with the current one.
+	cand := &State{base: b}
+	cand.redactor = s.redactor
+	cand.preprocessors = s.preprocessors
+	if err := s.validateCanary(ctx, cand); err != nil {
+		if err := b.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Warn("cannot terminate the refused instance of pymlstate")
+		}
+		return err
+	}
+	s.compileModel(ctx, b)
+	s.warmUp(ctx, b)
+
+	old := s.base
+	s.base = b
+	s.predictCache.invalidate()
+	if err := old.Terminate(ctx); err != nil {
+		ctx.ErrLog(err).Warn("cannot terminate the old instance of pymlstate")
+	}
+	s.hooks.emit(Event{Type: EventModelLoaded, Details: data.Map{"reloaded": data.Bool(true)}})
+	return nil
+}
+
+// evictPythonModule removes the module from sys.modules so that the next
+// import executes the module again.
+func evictPythonModule(name string) error {
+	if !pythonModuleNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid Python module name: %v", name)
+	}
+
+	expr := fmt.Sprintf("__import__('sys').modules.pop('%v', None) is not None", name)
+	if _, err := evalPython(expr); err != nil {
+		return fmt.Errorf("cannot evict module '%v': %v", name, err)
+	}
+	return nil
+}
+
+// ReloadModule reloads the Python module of the state. A return value is
+// always nil.
+func ReloadModule(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupAuthorizedState(ctx, stateName, ActionLoad)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.ReloadModule(ctx)
+}
@@ -0,0 +1,34 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEvictPythonModule(t *testing.T) {
+	Convey("Given invalid module names", t, func() {
+		names := []string{"", "1mod", "mod-name", "mod.", "mod'); import os; ('"}
+
+		Convey("When they are evicted", func() {
+			Convey("Then it should fail without running Python", func() {
+				for _, n := range names {
+					err := evictPythonModule(n)
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "invalid Python module name")
+				}
+			})
+		})
+	})
+
+	Convey("Given valid module names", t, func() {
+		names := []string{"mod", "_test_pymlstate", "pkg.sub_mod"}
+
+		Convey("When they are validated", func() {
+			Convey("Then they should match", func() {
+				for _, n := range names {
+					So(pythonModuleNameRegexp.MatchString(n), ShouldBeTrue)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,167 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// replayBuffer keeps a uniform sample of records written by WriteReplay by
+// reservoir sampling. Sampled records are mixed into training batches.
+type replayBuffer struct {
+	size  int
+	ratio float64
+
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	records []data.Value
+	seen    int64
+}
+
+func newReplayBuffer(size int, ratio float64) *replayBuffer {
+	return &replayBuffer{
+		size:  size,
+		ratio: ratio,
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// add adds the preprocessed record to the buffer.
+func (r *replayBuffer) add(rec data.Value) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen++
+	if len(r.records) < r.size {
+		r.records = append(r.records, rec)
+		return
+	}
+	if i := r.rnd.Int63n(r.seen); i < int64(r.size) {
+		r.records[i] = rec
+	}
+}
+
+// mix returns the batch followed by records randomly chosen from the buffer.
+// The number of chosen records is ratio of the size of the batch.
+func (r *replayBuffer) mix(batch []data.Value) []data.Value {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := int(math.Ceil(r.ratio * float64(len(batch))))
+	if n > len(r.records) {
+		n = len(r.records)
+	}
+	if n == 0 {
+		return batch
+	}
+	res := make([]data.Value, 0, len(batch)+n)
+	res = append(res, batch...)
+	for _, i := range r.rnd.Perm(len(r.records))[:n] {
+		res = append(res, r.records[i])
+	}
+	return res
+}
+
+// all returns a copy of records in the buffer.
+func (r *replayBuffer) all() []data.Value {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]data.Value(nil), r.records...)
+}
+
+func (r *replayBuffer) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.records)
+}
+
+// snapshot returns records in the buffer encoded in msgpack.
+func (r *replayBuffer) snapshot() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return data.MarshalMsgpack(data.Map{
+		"seen":    data.Int(r.seen),
+		"records": data.Array(r.records),
+	})
+}
+
+// restore restores records encoded by snapshot. Records exceeding the size
+// of the buffer are discarded.
+func (r *replayBuffer) restore(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	m, err := data.UnmarshalMsgpack(b)
+	if err != nil {
+		return fmt.Errorf("cannot decode the replay buffer: %v", err)
+	}
+	seen, _ := data.AsInt(m["seen"])
+	recs, _ := data.AsArray(m["records"])
+	if len(recs) > r.size {
+		recs = recs[:r.size]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = recs
+	r.seen = seen
+	return nil
+}
+
+// WriteReplay adds records of the tuple to the replay buffer, which is
+// configured by replay_buffer_size. Records are redacted and preprocessed
+// in the same way as Write, but they aren't trained until they're mixed into
+// training batches.
+func (s *State) WriteReplay(ctx *core.Context, t *core.Tuple) error {
+	dt, err := t.Data.Get(datPath)
+	if err != nil {
+		return err
+	}
+	return s.writeReplay(ctx, dt)
+}
+
+func (s *State) writeReplay(ctx *core.Context, dt data.Value) error {
+	if err := s.authorize(ctx, ActionTrain); err != nil {
+		return err
+	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return err
+	}
+	if s.replay == nil {
+		return fmt.Errorf("the state doesn't have a replay buffer")
+	}
+	dt, err := s.redact(dt)
+	if err != nil {
+		return err
+	}
+	if dt, err = s.preprocess(dt, preprocessTrain, nil); err != nil {
+		return err
+	}
+	if dt == nil {
+		return nil // dropped by preprocessors
+	}
+
+	if dt.Type() != data.TypeArray {
+		s.replay.add(dt)
+		return nil
+	}
+	arr, _ := data.AsArray(dt)
+	for _, rec := range arr {
+		s.replay.add(rec)
+	}
+	return nil
+}
+
+// WriteReplay adds the data to the replay buffer of the state. The data is
+// a map or an array of maps. A return value is always nil.
+func WriteReplay(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.writeReplay(ctx, dt)
+}
@@ -0,0 +1,55 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestReplayBuffer(t *testing.T) {
+	Convey("Given a replay buffer of size 3 with ratio 0.5", t, func() {
+		r := newReplayBuffer(3, 0.5)
+
+		Convey("When more records than its size are added", func() {
+			for i := 0; i < 10; i++ {
+				r.add(data.Map{"x": data.Int(i)})
+			}
+
+			Convey("Then it should keep 3 records", func() {
+				So(r.len(), ShouldEqual, 3)
+			})
+
+			Convey("Then records should be mixed into a batch by the ratio", func() {
+				batch := []data.Value{data.Int(0), data.Int(1), data.Int(2), data.Int(3)}
+				b := r.mix(batch)
+				So(len(b), ShouldEqual, 6)
+				So(b[:4], ShouldResemble, batch)
+			})
+
+			Convey("Then it should be restored from its snapshot", func() {
+				b, err := r.snapshot()
+				So(err, ShouldBeNil)
+				r2 := newReplayBuffer(2, 0.5)
+				So(r2.restore(b), ShouldBeNil)
+				So(r2.len(), ShouldEqual, 2)
+				So(r2.seen, ShouldEqual, 10)
+			})
+		})
+
+		Convey("When it's empty", func() {
+			batch := []data.Value{data.Int(0)}
+
+			Convey("Then a batch should be returned as it is", func() {
+				So(r.mix(batch), ShouldResemble, batch)
+			})
+		})
+
+		Convey("When it's restored from a broken snapshot", func() {
+			err := r.restore([]byte{0xc1})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
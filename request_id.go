@@ -0,0 +1,58 @@
+package pymlstate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// requestIDOf returns the request ID of the record at request_id_path. It
+// returns an empty string when the record doesn't have it.
+func (s *State) requestIDOf(dt data.Value) string {
+	if s.requestIDPath == nil {
+		return ""
+	}
+	m, err := data.AsMap(dt)
+	if err != nil {
+		return ""
+	}
+	v, err := m.Get(s.requestIDPath)
+	if err != nil || v.Type() == data.TypeNull {
+		return ""
+	}
+	if str, err := data.AsString(v); err == nil {
+		return str
+	}
+	return v.String()
+}
+
+// newRandomID returns a random ID such as an ID of a decision.
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot generate an ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// withRequestID adds the request ID to the error of a prediction.
+func withRequestID(err error, requestID string) error {
+	if requestID == "" || err == errDropRecord {
+		return err
+	}
+	return fmt.Errorf("prediction of request '%v' failed: %v", requestID, err)
+}
+
+// PredictWithRequestID applies the model to the given data in the same way
+// as Predict with the ID of the request. See State.PredictWithRequestID for
+// details.
+func PredictWithRequestID(ctx *core.Context, stateName string, dt data.Value, requestID string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.PredictWithRequestID(ctx, dt, requestID)
+}
@@ -0,0 +1,78 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPredictWithRequestID(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a state passing request IDs to Python", t, func() {
+		var args []data.Value
+		fail := false
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				args = dt
+				if fail {
+					return nil, errors.New("bad input")
+				}
+				return data.String("ok"), nil
+			},
+		}
+		dir, err := ioutil.TempDir("", "pymlstate_request_id")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "audit.log")
+		s := &State{base: b, params: MLParams{
+			RequestIDPath:   "id",
+			PassRequestID:   true,
+			AuditLog:        path,
+			AuditSampleRate: 1,
+		}}
+		So(s.setUpParams(), ShouldBeNil)
+		Reset(func() {
+			s.audit.close()
+		})
+
+		Convey("When a prediction is made with a request ID", func() {
+			_, err := s.PredictWithRequestID(ctx, data.Map{"x": data.Int(1)}, "req-1")
+
+			Convey("Then the ID should be passed and recorded", func() {
+				So(err, ShouldBeNil)
+				So(args[1], ShouldEqual, data.String("req-1"))
+				es := readAuditEntries(path)
+				So(len(es), ShouldEqual, 1)
+				So(es[0]["request_id"], ShouldEqual, "req-1")
+			})
+		})
+
+		Convey("When a prediction is made with a record having the ID", func() {
+			_, err := s.Predict(ctx, data.Map{"id": data.String("req-2"), "x": data.Int(1)})
+
+			Convey("Then the ID should be taken from the record", func() {
+				So(err, ShouldBeNil)
+				So(args[1], ShouldEqual, data.String("req-2"))
+			})
+		})
+
+		Convey("When a prediction fails", func() {
+			fail = true
+			_, err := s.PredictWithRequestID(ctx, data.Map{"x": data.Int(1)}, "req-3")
+
+			Convey("Then the error should have the ID", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "req-3")
+				So(err.Error(), ShouldContainSubstring, "bad input")
+			})
+		})
+	})
+}
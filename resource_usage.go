@@ -0,0 +1,143 @@
+package pymlstate
+
+import (
+	"bufio"
+	"fmt"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interpreterSampleInterval is the minimum interval between samples of
+// interpreterUsage reported by Status.
+const interpreterSampleInterval = 10 * time.Second
+
+// interpreterStatsExpr returns a Python expression evaluated to GC
+// statistics, the number of Python threads, and thread limits of the
+// interpreter. gc_generations is None on Python 2, which doesn't have
+// gc.get_stats.
+func interpreterStatsExpr() string {
+	return "{'gc_counts': list(__import__('gc').get_count()), " +
+		"'gc_generations': getattr(__import__('gc'), 'get_stats', lambda: None)(), " +
+		"'python_threads': __import__('threading').active_count(), " +
+		"'thread_limits': " + threadLimitsExpr() + "}"
+}
+
+// procStatus reads the resident set size in bytes and the number of threads
+// of the process from /proc/<pid>/status. pid is "self" for this process.
+func procStatus(pid string) (rss, threads int64, err error) {
+	f, err := os.Open("/proc/" + pid + "/status")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "VmRSS:":
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid VmRSS: %v", err)
+			}
+			rss = kb * 1024
+		case "Threads:":
+			if threads, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+				return 0, 0, fmt.Errorf("invalid Threads: %v", err)
+			}
+		}
+	}
+	return rss, threads, sc.Err()
+}
+
+// interpreterUsage returns resource usage of the Python interpreter running
+// the instance. The embedded interpreter shares the process with SensorBee,
+// so its memory and threads include those of SensorBee and "shared_process"
+// is true. Memory and threads are read from /proc and omitted where it's not
+// available. It returns nil when the backend doesn't run an interpreter.
+func interpreterUsage(b Backend) (data.Map, error) {
+	var (
+		pid   string
+		stats data.Value
+		err   error
+	)
+	switch b := b.(type) {
+	case *processBackend:
+		pid = strconv.Itoa(b.cmd.Process.Pid)
+		stats, err = b.eval(interpreterStatsExpr())
+	case *pystate.Base:
+		pid = "self"
+		stats, err = evalPython(interpreterStatsExpr())
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get statistics of the interpreter: %v", err)
+	}
+	m, err := data.AsMap(stats)
+	if err != nil {
+		return nil, fmt.Errorf("statistics of the interpreter must be a map: %v", err)
+	}
+	m["shared_process"] = data.Bool(pid == "self")
+	if rss, threads, err := procStatus(pid); err == nil {
+		m["rss_bytes"] = data.Int(rss)
+		m["os_threads"] = data.Int(threads)
+	}
+	return m, nil
+}
+
+// interpreterSampler caches interpreterUsage of the instance. Getting the
+// usage evaluates Python, which waits for calls to the instance such as fit,
+// so it's sampled in the background and Status never waits for it.
+type interpreterSampler struct {
+	mu        sync.Mutex
+	b         Backend
+	usage     data.Map
+	sampledAt time.Time
+	sampling  bool
+}
+
+// get returns the latest usage of the instance b and starts sampling it when
+// the usage is older than interpreterSampleInterval. It returns nil until the
+// first sample of b is taken.
+func (s *interpreterSampler) get(b Backend) data.Map {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.b != b {
+		s.b = b
+		s.usage = nil
+		s.sampledAt = time.Time{}
+	}
+	if !s.sampling && time.Now().Sub(s.sampledAt) >= interpreterSampleInterval {
+		s.sampling = true
+		go s.sample(b)
+	}
+	return s.usage
+}
+
+func (s *interpreterSampler) sample(b Backend) {
+	m, err := interpreterUsage(b)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sampling = false
+	if s.b != b {
+		return
+	}
+	s.sampledAt = now
+	if err != nil || m == nil {
+		s.usage = nil
+		return
+	}
+	m["sampled_at"] = data.Timestamp(now)
+	s.usage = m
+}
@@ -0,0 +1,120 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProcStatus(t *testing.T) {
+	if _, err := os.Stat("/proc/self/status"); err != nil {
+		t.Skip("/proc isn't available")
+	}
+
+	Convey("Given this process", t, func() {
+		Convey("When its status is read", func() {
+			rss, threads, err := procStatus("self")
+
+			Convey("Then it should have memory and threads", func() {
+				So(err, ShouldBeNil)
+				So(rss, ShouldBeGreaterThan, 0)
+				So(threads, ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When the status of a missing process is read", func() {
+			_, _, err := procStatus("0")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestInterpreterUsage(t *testing.T) {
+	Convey("Given a backend not running an interpreter", t, func() {
+		Convey("When its usage is requested", func() {
+			m, err := interpreterUsage(&fakeBackend{})
+
+			Convey("Then it should be empty", func() {
+				So(err, ShouldBeNil)
+				So(m, ShouldBeNil)
+			})
+		})
+	})
+
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 isn't available")
+	}
+	dir, err := ioutil.TempDir("", "pymlstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "usage_test_model.py"), []byte(preflightTestModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bp := &pystate.BaseParams{ModulePath: dir, ModuleName: "usage_test_model", ClassName: "Model"}
+
+	Convey("Given a model running in a process", t, func() {
+		b, err := newBackend(bp, &MLParams{Isolation: "process", PythonCommand: "python3"}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			b.Terminate(nil)
+		})
+
+		Convey("When its usage is requested", func() {
+			m, err := interpreterUsage(b)
+
+			Convey("Then it should have statistics of the process", func() {
+				So(err, ShouldBeNil)
+				So(m["shared_process"], ShouldEqual, data.Bool(false))
+				So(m["python_threads"], ShouldEqual, data.Int(1))
+				So(m, ShouldContainKey, "gc_counts")
+				So(m, ShouldContainKey, "gc_generations")
+				if _, err := os.Stat("/proc/self/status"); err == nil {
+					So(m["rss_bytes"], ShouldBeGreaterThan, data.Int(0))
+					So(m["os_threads"], ShouldBeGreaterThan, data.Int(0))
+				}
+			})
+		})
+
+		Convey("When its usage is sampled while the process is busy", func() {
+			var s interpreterSampler
+			pb := b.(*processBackend)
+			pb.mu.Lock()
+			first := s.get(b)
+			pb.mu.Unlock()
+
+			Convey("Then it shouldn't wait for the process", func() {
+				So(first, ShouldBeNil)
+			})
+
+			Convey("Then the sample should be returned later", func() {
+				var m data.Map
+				for i := 0; i < 100 && m == nil; i++ {
+					time.Sleep(50 * time.Millisecond)
+					m = s.get(b)
+				}
+				So(m, ShouldContainKey, "gc_counts")
+				So(m, ShouldContainKey, "sampled_at")
+			})
+		})
+
+		Convey("When the process is terminated", func() {
+			So(b.Terminate(nil), ShouldBeNil)
+			_, err := interpreterUsage(b)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,193 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"net/http"
+	"time"
+)
+
+// retrainFrom trains the model with all records of the dataset at the URI in
+// batches of BatchSize. It stops between batches when stop is closed. It
+// returns the number of records passed to Fit.
+func (s *State) retrainFrom(ctx *core.Context, uri string, stop <-chan struct{}) (int, error) {
+	dr, f, err := openDataset(uri)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	s.rwm.RLock()
+	batchSize := s.params.BatchSize
+	s.rwm.RUnlock()
+	n, err := s.fitDataset(ctx, dr, batchSize, stop)
+	if err != nil {
+		return n, fmt.Errorf("cannot retrain with '%v': %v", uri, err)
+	}
+	return n, nil
+}
+
+// openDataset opens the dataset at the URI. The returned closer must be
+// closed after records are read.
+func openDataset(uri string) (datasetReader, io.Closer, error) {
+	format, err := datasetFormatOf(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := openURI(uri, &http.Client{Timeout: time.Hour})
+	if err != nil {
+		return nil, nil, err
+	}
+	dr, err := newDatasetReader(f, format)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return dr, f, nil
+}
+
+// fitProgressInterval is the interval of progress logs written by fitDataset.
+const fitProgressInterval = 10 * time.Second
+
+// fitDataset passes all records read from dr to Fit in batches. It stops
+// between batches when stop is closed. It logs its progress periodically and
+// returns the number of records passed to Fit.
+func (s *State) fitDataset(ctx *core.Context, dr datasetReader, batchSize int,
+	stop <-chan struct{}) (int, error) {
+	return fitBatches(ctx, dr, batchSize, stop, func(batch []data.Value) error {
+		_, err := s.Fit(ctx, batch)
+		return err
+	})
+}
+
+// fitBatches is fitDataset passing batches to fit.
+func fitBatches(ctx *core.Context, dr datasetReader, batchSize int,
+	stop <-chan struct{}, fit func(batch []data.Value) error) (int, error) {
+	start := time.Now()
+	lastLog := start
+	n := 0
+	batch := make([]data.Value, 0, batchSize)
+	for {
+		m, err := dr.read()
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if m != nil {
+			batch = append(batch, m)
+		}
+		if len(batch) > 0 && (len(batch) == batchSize || err == io.EOF) {
+			select {
+			case <-stop:
+				return n, fmt.Errorf("training is stopped")
+			default:
+			}
+			if err := fit(batch); err != nil {
+				return n, err
+			}
+			n += len(batch)
+			batch = batch[:0]
+
+			if now := time.Now(); now.Sub(lastLog) >= fitProgressInterval {
+				lastLog = now
+				ctx.Log().WithField("records", n).
+					WithField("elapsed", now.Sub(start).String()).
+					Info("pymlstate is training with a dataset")
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+	}
+}
+
+// retrainer retrains the model of a state periodically until stop is closed.
+type retrainer struct {
+	stop chan struct{}
+}
+
+// scheduleRetraining stops the current retrainer and starts a new one when
+// the state has retrain_from and retrain_interval. It must be called while
+// the write lock is acquired.
+func (s *State) scheduleRetraining(ctx *core.Context) {
+	if s.retrainer != nil {
+		close(s.retrainer.stop)
+		s.retrainer = nil
+	}
+	if s.readOnly || s.params.RetrainFrom == "" || s.params.RetrainInterval <= 0 {
+		return
+	}
+
+	r := &retrainer{stop: make(chan struct{})}
+	s.retrainer = r
+	uri := s.params.RetrainFrom
+	interval := s.params.RetrainInterval
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-t.C:
+			}
+
+			start := time.Now()
+			n, err := s.retrainFrom(ctx, uri, r.stop)
+			l := ctx.Log().WithField("uri", uri).WithField("records", n).
+				WithField("elapsed", time.Now().Sub(start).String())
+			if err != nil {
+				l.WithField("err", err).Error("pymlstate's scheduled retraining failed")
+				continue
+			}
+			l.Info("pymlstate's scheduled retraining finished")
+		}
+	}()
+}
+
+// RetrainFrom trains the model with all records of the dataset at the URI.
+// The URI is a file path, a file URI, or an HTTP(S) URL. The format of the
+// dataset is detected by its extension: .jsonl, .json, .ndjson (JSON lines),
+// .csv, .msgpack, or .mpk. It returns the number of trained records.
+func RetrainFrom(ctx *core.Context, stateName, uri string) (data.Value, error) {
+	s, err := lookupAuthorizedState(ctx, stateName, ActionTrain)
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.retrainFrom(ctx, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	return data.Int(n), nil
+}
+
+// FitFromReader trains the model of the state with records read from r in
+// batches of batchSize. format is one of DatasetJSONLines, DatasetCSV, and
+// DatasetMsgpack. The progress is logged periodically. It returns the number
+// of trained records, which is also valid when an error occurs.
+func FitFromReader(ctx *core.Context, stateName string, r io.Reader, format string,
+	batchSize int) (int, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batch size must be greater than 0")
+	}
+	s, err := lookupAuthorizedState(ctx, stateName, ActionTrain)
+	if err != nil {
+		return 0, err
+	}
+	dr, err := newDatasetReader(r, format)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	n, err := s.fitDataset(ctx, dr, batchSize, nil)
+	l := ctx.Log().WithField("state", stateName).WithField("records", n).
+		WithField("elapsed", time.Now().Sub(start).String())
+	if err != nil {
+		l.WithField("err", err).Error("pymlstate failed to train with a dataset")
+		return n, err
+	}
+	l.Info("pymlstate finished training with a dataset")
+	return n, nil
+}
@@ -0,0 +1,189 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+// metricDropPolicy decides when the model is retrained from scratch because
+// its metric in the scheduled evaluation has stayed below threshold for a
+// period.
+type metricDropPolicy struct {
+	threshold float64
+	period    time.Duration
+
+	// belowSince is when the metric dropped below the threshold. It's zero
+	// while the metric is above the threshold.
+	belowSince time.Time
+}
+
+// observe records the metric evaluated at now and returns true when the
+// model must be retrained. It's only used by the goroutine of an evaluator.
+func (p *metricDropPolicy) observe(now time.Time, m float64) bool {
+	if p.threshold <= 0 || m >= p.threshold {
+		p.belowSince = time.Time{}
+		return false
+	}
+	if p.belowSince.IsZero() {
+		p.belowSince = now
+	}
+	if now.Sub(p.belowSince) < p.period {
+		return false
+	}
+	p.belowSince = time.Time{}
+	return true
+}
+
+// resetAndRetrain creates a new instance of the model and trains it from
+// scratch with the dataset at retrain_from, or with records in the replay
+// buffer when retrain_from isn't set. The current model keeps serving
+// predictions while the new one is trained, and it's replaced once training
+// succeeds. Records written to the state during the retraining aren't
+// trained by the new model. The new instance is created with the parameters
+// given to the constructor by New. It returns the number of trained records.
+func (s *State) resetAndRetrain(ctx *core.Context, stop <-chan struct{}) (int, error) {
+	s.rwm.RLock()
+	if err := s.base.CheckTermination(); err != nil {
+		s.rwm.RUnlock()
+		return 0, err
+	}
+	bp := s.baseParams
+	params := s.params
+	createParams := s.createParams.Copy()
+	var replay []data.Value
+	if params.RetrainFrom == "" && s.replay != nil {
+		replay = s.replay.all()
+	}
+	s.rwm.RUnlock()
+	if s.readOnly {
+		return 0, errReadOnly
+	}
+	if bp == nil {
+		return 0, fmt.Errorf("the state doesn't have parameters to create a new instance of the model")
+	}
+	if params.RetrainFrom == "" && len(replay) == 0 {
+		return 0, fmt.Errorf("the state doesn't have retrain_from or records in the replay buffer")
+	}
+
+	b, err := newBackend(bp, &params, createParams)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create a new instance of the model: %v", err)
+	}
+	n, err := s.fitNewInstance(ctx, b, &params, replay, stop)
+	if err == nil {
+		err = s.replaceWithRetrained(ctx, b)
+	}
+	if err != nil {
+		if err := b.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Warn("cannot terminate the new instance of pymlstate")
+		}
+		return n, err
+	}
+	return n, nil
+}
+
+// fitNewInstance trains b with records of the replay buffer, which have
+// already been preprocessed, or records of the dataset at retrain_from,
+// which are redacted and preprocessed in the same way as Predict. Statistics
+// of preprocessors aren't updated because they're shared with the current
+// model, whose inputs mustn't change even when retraining fails.
+func (s *State) fitNewInstance(ctx *core.Context, b Backend, params *MLParams,
+	replay []data.Value, stop <-chan struct{}) (int, error) {
+	fit := func(batch []data.Value, preprocessed bool) error {
+		s.rwm.RLock()
+		defer s.rwm.RUnlock()
+		if err := s.base.CheckTermination(); err != nil {
+			return err
+		}
+		v := data.Value(data.Array(batch))
+		if !preprocessed {
+			var err error
+			if v, err = s.redact(v); err != nil {
+				return err
+			}
+			if v, err = s.preprocess(v, preprocessInspect, nil); err != nil {
+				return err
+			}
+		}
+		_, err := s.callBackend(b, callTrain, "fit", v)
+		return err
+	}
+
+	if params.RetrainFrom == "" {
+		n := 0
+		for len(replay) > 0 {
+			select {
+			case <-stop:
+				return n, fmt.Errorf("training is stopped")
+			default:
+			}
+			size := params.BatchSize
+			if size > len(replay) {
+				size = len(replay)
+			}
+			if err := fit(replay[:size], true); err != nil {
+				return n, err
+			}
+			n += size
+			replay = replay[size:]
+		}
+		return n, nil
+	}
+
+	dr, f, err := openDataset(params.RetrainFrom)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, err := fitBatches(ctx, dr, params.BatchSize, stop, func(batch []data.Value) error {
+		return fit(batch, false)
+	})
+	if err != nil {
+		return n, fmt.Errorf("cannot retrain with '%v': %v", params.RetrainFrom, err)
+	}
+	return n, nil
+}
+
+// replaceWithRetrained replaces the current model with the retrained
+// instance b.
+func (s *State) replaceWithRetrained(ctx *core.Context, b Backend) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return err
+	}
+	s.compileModel(ctx, b)
+	s.warmUp(ctx, b)
+
+	old := s.base
+	prevVersion := s.modelVersion
+	s.base = b
+	s.modelVersion = "retrained@" + time.Now().UTC().Format(time.RFC3339)
+	s.modelFingerprint = ""
+	s.predictCache.invalidate()
+	if err := old.Terminate(ctx); err != nil {
+		ctx.ErrLog(err).Warn("cannot terminate the old instance of pymlstate")
+	}
+	s.hooks.emit(Event{Type: EventModelRetrained, Details: data.Map{
+		"model_version":          data.String(s.modelVersion),
+		"previous_model_version": data.String(prevVersion),
+	}})
+	return nil
+}
+
+// retrainOnMetricDrop retrains the model from scratch after its metric has
+// stayed below retrain_below_metric.
+func (s *State) retrainOnMetricDrop(ctx *core.Context, m, threshold float64, stop <-chan struct{}) {
+	ctx.Log().WithField("metric", m).WithField("threshold", threshold).
+		Warn("pymlstate is retraining the model from scratch because its metric dropped")
+	start := time.Now()
+	n, err := s.resetAndRetrain(ctx, stop)
+	l := ctx.Log().WithField("records", n).WithField("elapsed", time.Now().Sub(start).String())
+	if err != nil {
+		l.WithField("err", err).Error("pymlstate cannot retrain the model after its metric dropped")
+		return
+	}
+	l.Info("pymlstate retrained the model after its metric dropped")
+}
@@ -0,0 +1,237 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMetricDropPolicy(t *testing.T) {
+	Convey("Given a metric drop policy", t, func() {
+		p := &metricDropPolicy{threshold: 0.8, period: time.Minute}
+		now := time.Now()
+
+		Convey("When the metric stays below the threshold for the period", func() {
+			first := p.observe(now, 0.7)
+			second := p.observe(now.Add(30*time.Second), 0.6)
+			third := p.observe(now.Add(time.Minute), 0.7)
+
+			Convey("Then the model should be retrained at the end of the period", func() {
+				So(first, ShouldBeFalse)
+				So(second, ShouldBeFalse)
+				So(third, ShouldBeTrue)
+			})
+
+			Convey("And the period should start again", func() {
+				So(p.observe(now.Add(2*time.Minute), 0.7), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the metric recovers during the period", func() {
+			p.observe(now, 0.7)
+			p.observe(now.Add(30*time.Second), 0.9)
+
+			Convey("Then the period should be reset", func() {
+				So(p.observe(now.Add(time.Minute), 0.7), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the policy is disabled", func() {
+			p.threshold = 0
+
+			Convey("Then the model shouldn't be retrained", func() {
+				So(p.observe(now, 0), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestResetAndRetrain(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a state with a replay buffer", t, func() {
+		old := &fakeBackend{}
+		s := &State{
+			base:         old,
+			params:       MLParams{BatchSize: 2, ReplayBufferSize: 10, ReplayRatio: 1},
+			modelVersion: "v1",
+		}
+		So(s.setUpParams(), ShouldBeNil)
+		for i := 0; i < 3; i++ {
+			s.replay.add(data.Map{"x": data.Int(i)})
+		}
+		batches := [][]data.Value{}
+		b := &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+			arr, _ := data.AsArray(dt[0])
+			batches = append(batches, arr)
+			return data.Null{}, nil
+		}}
+		events := []Event{}
+		s.OnEvent(func(e Event) {
+			events = append(events, e)
+		})
+
+		Convey("When a new instance is trained and replaces the model", func() {
+			n, err := s.fitNewInstance(ctx, b, &s.params, s.replay.all(), nil)
+			So(err, ShouldBeNil)
+			So(s.replaceWithRetrained(ctx, b), ShouldBeNil)
+
+			Convey("Then it should be trained with records in the replay buffer", func() {
+				So(n, ShouldEqual, 3)
+				So(len(batches), ShouldEqual, 2)
+				So(len(batches[0]), ShouldEqual, 2)
+				So(len(batches[1]), ShouldEqual, 1)
+			})
+
+			Convey("Then the current model should be replaced", func() {
+				So(s.base, ShouldEqual, b)
+				So(old.terminated, ShouldBeTrue)
+				So(s.modelVersion, ShouldStartWith, "retrained@")
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Type, ShouldEqual, EventModelRetrained)
+				So(events[0].Details["previous_model_version"], ShouldEqual, data.String("v1"))
+			})
+		})
+
+		Convey("When training is stopped", func() {
+			stop := make(chan struct{})
+			close(stop)
+			_, err := s.fitNewInstance(ctx, b, &s.params, s.replay.all(), stop)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(batches, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a state with retrain_from", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_retrain")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "train.jsonl")
+		So(ioutil.WriteFile(path, []byte("{\"x\":1}\n{\"x\":3}\n"), 0644), ShouldBeNil)
+		s := &State{
+			base:   &fakeBackend{},
+			params: MLParams{BatchSize: 10, RetrainFrom: path, NormalizePaths: []string{"x"}},
+		}
+		So(s.setUpParams(), ShouldBeNil)
+		stats := map[string]runningStats{"x": {Count: 2, Mean: 2, M2: 2}}
+		s.normalizer.restore(stats)
+		var trained data.Value
+		b := &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+			trained = dt[0]
+			return data.Null{}, nil
+		}}
+
+		Convey("When a new instance is trained", func() {
+			n, err := s.fitNewInstance(ctx, b, &s.params, nil, nil)
+
+			Convey("Then it should be trained with preprocessed records of the dataset", func() {
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+				So(trained, ShouldResemble, data.Array{
+					data.Map{"x": data.Float(-1)}, data.Map{"x": data.Float(1)},
+				})
+			})
+
+			Convey("Then statistics of the current model shouldn't be updated", func() {
+				So(s.normalizer.snapshot(), ShouldResemble, stats)
+			})
+		})
+	})
+
+	Convey("Given a state without a source of retraining", t, func() {
+		s := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1}}
+
+		Convey("When it's reset and retrained", func() {
+			_, err := s.resetAndRetrain(ctx, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+const retrainTestModule = `
+class Model(object):
+    @classmethod
+    def create(cls, **params):
+        m = cls()
+        m.params = params
+        return m
+
+    def fit(self, xs):
+        return None
+
+    def get_params(self):
+        return self.params
+`
+
+func TestResetAndRetrainWithCreateParams(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 isn't available")
+	}
+	ctx := core.NewContext(nil)
+	dir, err := ioutil.TempDir("", "pymlstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "retrain_test_model.py"), []byte(retrainTestModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bp := &pystate.BaseParams{ModulePath: dir, ModuleName: "retrain_test_model", ClassName: "Model"}
+	createParams := data.Map{"alpha": data.Float(0.5), "random_seed": data.Int(42)}
+
+	Convey("Given a state created with parameters of the constructor", t, func() {
+		s, err := New(bp, &MLParams{
+			BatchSize:        1,
+			Isolation:        "process",
+			PythonCommand:    "python3",
+			ReplayBufferSize: 10,
+			ReplayRatio:      1,
+		}, createParams)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+		s.replay.add(data.Map{"x": data.Int(1)})
+
+		Convey("When it's reset and retrained", func() {
+			n, err := s.resetAndRetrain(ctx, nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then the new instance should receive the original parameters", func() {
+				So(n, ShouldEqual, 1)
+				res, err := s.base.Call("get_params")
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, createParams)
+			})
+		})
+
+		Convey("When the parameters are saved", func() {
+			buf := bytes.NewBuffer(nil)
+			So(s.saveState(buf), ShouldBeNil)
+			_, sd, _, err := readStateHeader(buf)
+			So(err, ShouldBeNil)
+
+			Convey("Then they should be restored", func() {
+				m, err := sd.createParams()
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, createParams)
+			})
+		})
+	})
+}
@@ -0,0 +1,62 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleRetraining(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a state without retrain_from", t, func() {
+		s := &State{params: MLParams{RetrainInterval: time.Hour}}
+
+		Convey("When retraining is scheduled", func() {
+			s.scheduleRetraining(ctx)
+
+			Convey("Then it shouldn't have a retrainer", func() {
+				So(s.retrainer, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state with retrain_from and retrain_interval", t, func() {
+		s := &State{params: MLParams{
+			RetrainFrom:     "/data/train.jsonl",
+			RetrainInterval: time.Hour,
+		}}
+		s.scheduleRetraining(ctx)
+		So(s.retrainer, ShouldNotBeNil)
+		r := s.retrainer
+
+		Convey("When retraining is disabled and rescheduled", func() {
+			s.params.RetrainInterval = 0
+			s.scheduleRetraining(ctx)
+
+			Convey("Then the previous retrainer should be stopped", func() {
+				So(s.retrainer, ShouldBeNil)
+				_, ok := <-r.stop
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestFitFromReader(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a JSON lines dataset", t, func() {
+		r := strings.NewReader("{\"x\": 1}\n")
+
+		Convey("When it's trained with an invalid batch size", func() {
+			_, err := FitFromReader(ctx, "pymlstate_test", r, DatasetJSONLines, 0)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
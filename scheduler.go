@@ -0,0 +1,85 @@
+package pymlstate
+
+import (
+	"fmt"
+	"sync"
+)
+
+// callClass is a class of Python calls scheduled by callScheduler.
+type callClass int
+
+const (
+	callPredict callClass = iota
+	callTrain
+	numCallClasses
+)
+
+// callScheduler runs Python calls one at a time. When calls of both classes
+// are waiting, calls of the preferred class run first. Calls of the same
+// class run in arrival order.
+type callScheduler struct {
+	prefer callClass
+
+	mu     sync.Mutex
+	busy   bool
+	queues [numCallClasses][]chan struct{}
+}
+
+// newCallScheduler creates a scheduler preferring the class named by
+// priority, which is "predict" or "train".
+func newCallScheduler(priority string) (*callScheduler, error) {
+	switch priority {
+	case "predict":
+		return &callScheduler{prefer: callPredict}, nil
+	case "train":
+		return &callScheduler{prefer: callTrain}, nil
+	default:
+		return nil, fmt.Errorf("call_priority must be 'predict' or 'train': %v", priority)
+	}
+}
+
+// do runs f after all calls preceding it are done. It runs f immediately
+// when c is nil.
+func (c *callScheduler) do(class callClass, f func() error) error {
+	if c == nil {
+		return f()
+	}
+	c.acquire(class)
+	defer c.release()
+	return f()
+}
+
+func (c *callScheduler) acquire(class callClass) {
+	c.mu.Lock()
+	if !c.busy {
+		c.busy = true
+		c.mu.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	c.queues[class] = append(c.queues[class], ch)
+	c.mu.Unlock()
+	<-ch
+}
+
+// release passes the slot to the next call, which is the first call of the
+// preferred class if any.
+func (c *callScheduler) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, class := range []callClass{c.prefer, 1 - c.prefer} {
+		if q := c.queues[class]; len(q) > 0 {
+			c.queues[class] = q[1:]
+			close(q[0]) // the slot is kept busy for the next call
+			return
+		}
+	}
+	c.busy = false
+}
+
+// queueLengths returns the number of waiting calls of each class.
+func (c *callScheduler) queueLengths() (predict, train int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queues[callPredict]), len(c.queues[callTrain])
+}
@@ -0,0 +1,97 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCallScheduler(t *testing.T) {
+	Convey("Given a scheduler preferring predictions", t, func() {
+		c, err := newCallScheduler("predict")
+		So(err, ShouldBeNil)
+
+		Convey("When calls of both classes wait for a running call", func() {
+			var (
+				mu    sync.Mutex
+				order []string
+				wg    sync.WaitGroup
+			)
+			record := func(name string) func() error {
+				return func() error {
+					mu.Lock()
+					order = append(order, name)
+					mu.Unlock()
+					return nil
+				}
+			}
+			waitQueue := func(predict, train int) {
+				for {
+					p, t := c.queueLengths()
+					if p == predict && t == train {
+						return
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			c.acquire(callTrain)
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				c.do(callTrain, record("train1"))
+			}()
+			waitQueue(0, 1)
+			go func() {
+				defer wg.Done()
+				c.do(callTrain, record("train2"))
+			}()
+			waitQueue(0, 2)
+			go func() {
+				defer wg.Done()
+				c.do(callPredict, record("predict"))
+			}()
+			waitQueue(1, 2)
+			c.release()
+			wg.Wait()
+
+			Convey("Then the prediction should run first", func() {
+				So(order, ShouldResemble, []string{"predict", "train1", "train2"})
+			})
+
+			Convey("Then the queues should be empty", func() {
+				p, t := c.queueLengths()
+				So(p, ShouldEqual, 0)
+				So(t, ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given an invalid priority", t, func() {
+		Convey("When a scheduler is created", func() {
+			_, err := newCallScheduler("batch")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a nil scheduler", t, func() {
+		var c *callScheduler
+
+		Convey("When a call is done", func() {
+			called := false
+			err := c.do(callPredict, func() error {
+				called = true
+				return nil
+			})
+
+			Convey("Then it should run immediately", func() {
+				So(err, ShouldBeNil)
+				So(called, ShouldBeTrue)
+			})
+		})
+	})
+}
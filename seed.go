@@ -0,0 +1,20 @@
+package pymlstate
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// newRand returns a random number generator of the component such as
+// "replay". When random_seed is set, the generator is seeded by the seed
+// and the name of the component, so that each component has its own
+// reproducible sequence. Otherwise, it's seeded by the current time.
+func newRand(p *MLParams, component string) *rand.Rand {
+	if p.RandomSeed == nil {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(component))
+	return rand.New(rand.NewSource(*p.RandomSeed ^ int64(h.Sum64())))
+}
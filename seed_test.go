@@ -0,0 +1,43 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestRandomSeed(t *testing.T) {
+	Convey("Given parameters having random_seed", t, func() {
+		seed := int64(42)
+		p := &MLParams{RandomSeed: &seed}
+
+		Convey("When generators are created", func() {
+			a, b, c := newRand(p, "replay"), newRand(p, "replay"), newRand(p, "clip")
+
+			Convey("Then generators of the same component should be the same", func() {
+				x := a.Int63()
+				So(b.Int63(), ShouldEqual, x)
+				So(c.Int63(), ShouldNotEqual, x)
+			})
+		})
+
+		Convey("When two states with the seed mix replayed records", func() {
+			mix := func() []data.Value {
+				s := &State{base: &fakeBackend{}, params: MLParams{
+					RandomSeed:       &seed,
+					ReplayBufferSize: 100,
+					ReplayRatio:      0.1,
+				}}
+				So(s.setUpParams(), ShouldBeNil)
+				for i := 0; i < 1000; i++ {
+					s.replay.add(data.Int(i))
+				}
+				return s.replay.mix(make([]data.Value, 50))
+			}
+
+			Convey("Then they should choose the same records", func() {
+				So(mix(), ShouldResemble, mix())
+			})
+		})
+	})
+}
@@ -0,0 +1,110 @@
+package pymlstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"net/http"
+	"time"
+)
+
+// loadShadow loads the model saved by Save at the URI as the shadow model,
+// which is a challenger of the current model. The shadow model is only
+// evaluated by the scheduled evaluation with preprocessors of the state, and
+// it can be promoted to the current model.
+func (s *State) loadShadow(ctx *core.Context, uri string) error {
+	f, err := openURI(uri, &http.Client{Timeout: 10 * time.Minute})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	r := io.TeeReader(f, h)
+	saved, _, r, err := readStateHeader(r)
+	if err != nil {
+		return err
+	}
+	b, err := loadBackend(ctx, r, saved, data.Map{})
+	if err != nil {
+		return fmt.Errorf("cannot load the shadow model: %v", err)
+	}
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.base.CheckTermination(); err != nil {
+		b.Terminate(ctx)
+		return err
+	}
+	old := s.shadow
+	s.shadow = b
+	s.shadowVersion = uri
+	s.shadowFingerprint = hex.EncodeToString(h.Sum(nil))
+	s.shadowHistory = newMetricHistory(s.params.EvalHistorySize)
+	if old != nil {
+		if err := old.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Warn("cannot terminate the old shadow model of pymlstate")
+		}
+	}
+	return nil
+}
+
+// promoteShadow replaces the current model with the shadow model. When
+// expected isn't nil, the shadow model is promoted only if it's still
+// expected.
+func (s *State) promoteShadow(ctx *core.Context, expected Backend) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.base.CheckTermination(); err != nil {
+		return err
+	}
+	if s.shadow == nil || (expected != nil && s.shadow != expected) {
+		return fmt.Errorf("the state doesn't have the shadow model")
+	}
+	s.compileModel(ctx, s.shadow)
+	s.warmUp(ctx, s.shadow)
+
+	old := s.base
+	prevVersion := s.modelVersion
+	s.base = s.shadow
+	s.modelVersion = s.shadowVersion
+	s.modelFingerprint = s.shadowFingerprint
+	s.shadow = nil
+	s.shadowVersion = ""
+	s.shadowFingerprint = ""
+	s.shadowHistory = nil
+	s.predictCache.invalidate()
+	if err := old.Terminate(ctx); err != nil {
+		ctx.ErrLog(err).Warn("cannot terminate the old instance of pymlstate")
+	}
+	ctx.Log().WithField("model_version", s.modelVersion).
+		WithField("previous_model_version", prevVersion).
+		Info("pymlstate promoted the shadow model")
+	s.hooks.emit(Event{Type: EventModelPromoted, Details: data.Map{
+		"model_version":          data.String(s.modelVersion),
+		"previous_model_version": data.String(prevVersion),
+	}})
+	return nil
+}
+
+// LoadShadow loads the model saved at the URI as the shadow model of the
+// state. A return value is always nil.
+func LoadShadow(ctx *core.Context, stateName, uri string) (data.Value, error) {
+	s, err := lookupAuthorizedState(ctx, stateName, ActionLoad)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.loadShadow(ctx, uri)
+}
+
+// PromoteShadow promotes the shadow model of the state to the current model.
+// A return value is always nil.
+func PromoteShadow(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupAuthorizedState(ctx, stateName, ActionLoad)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.promoteShadow(ctx, nil)
+}
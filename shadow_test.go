@@ -0,0 +1,54 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestExtractPromotionParams(t *testing.T) {
+	Convey("Given parameters with promotion options", t, func() {
+		params := data.Map{
+			"promote_after":  data.String("1h"),
+			"promote_margin": data.Float(0.01),
+		}
+
+		Convey("When evaluation parameters are extracted", func() {
+			mp := &MLParams{}
+			So(extractEvalParams(params, mp), ShouldBeNil)
+
+			Convey("Then the promotion policy should be set", func() {
+				So(mp.PromoteAfter, ShouldEqual, time.Hour)
+				So(mp.PromoteMargin, ShouldEqual, 0.01)
+				So(params, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given parameters without promotion options", t, func() {
+		params := data.Map{}
+
+		Convey("When evaluation parameters are extracted", func() {
+			mp := &MLParams{}
+			So(extractEvalParams(params, mp), ShouldBeNil)
+
+			Convey("Then the automatic promotion should be disabled", func() {
+				So(mp.PromoteAfter, ShouldEqual, 0)
+				So(mp.PromoteMargin, ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given an invalid promote_margin", t, func() {
+		params := data.Map{"promote_margin": data.String("a lot")}
+
+		Convey("When evaluation parameters are extracted", func() {
+			err := extractEvalParams(params, &MLParams{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
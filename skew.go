@@ -0,0 +1,165 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sync"
+)
+
+// skewTracker records statistics of numeric features in training records
+// and in records predicted in windows of window records. At the end of each
+// window, the skew of a feature is computed as the difference between the
+// mean in the window and the mean in training divided by the standard
+// deviation in training. The difference itself is the skew of a feature
+// whose values in training are constant.
+type skewTracker struct {
+	names     []string
+	paths     []data.Path
+	window    int
+	threshold float64
+
+	// onSkew is called with the feature and its skew when the skew exceeds
+	// the threshold at the end of a window.
+	onSkew func(feature string, skew float64)
+
+	// mu protects statistics because records can be processed concurrently
+	// by Fit and Predict, which only acquire the read lock of State.
+	mu      sync.Mutex
+	train   []runningStats
+	serving []runningStats
+	n       int
+	skews   map[string]float64
+}
+
+var _ preprocessor = &skewTracker{}
+
+func newSkewTracker(p *MLParams) (*skewTracker, error) {
+	ps, err := compilePaths(p.SkewPaths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid skew_paths: %v", err)
+	}
+	return &skewTracker{
+		names:     p.SkewPaths,
+		paths:     ps,
+		window:    p.SkewWindow,
+		threshold: p.SkewThreshold,
+		train:     make([]runningStats, len(ps)),
+		serving:   make([]runningStats, len(ps)),
+	}, nil
+}
+
+func (t *skewTracker) process(rec data.Map, training bool, rep *qualityReport) error {
+	type skewed struct {
+		name string
+		skew float64
+	}
+	var alerts []skewed
+
+	t.mu.Lock()
+	for i, p := range t.paths {
+		v, err := rec.Get(p)
+		if err != nil || v.Type() == data.TypeNull {
+			continue
+		}
+		x, err := asNumber(v)
+		if err != nil {
+			// The record is passed as it is because the tracker only
+			// observes features.
+			continue
+		}
+		if training {
+			t.train[i].add(x)
+		} else {
+			t.serving[i].add(x)
+		}
+	}
+	if !training {
+		t.n++
+		if t.n >= t.window {
+			t.skews = make(map[string]float64, len(t.names))
+			for i, name := range t.names {
+				if t.train[i].Count == 0 || t.serving[i].Count == 0 {
+					continue
+				}
+				s := skewOf(&t.train[i], &t.serving[i])
+				t.skews[name] = s
+				if t.threshold > 0 && s > t.threshold {
+					alerts = append(alerts, skewed{name, s})
+				}
+			}
+			t.n = 0
+			for i := range t.serving {
+				t.serving[i] = runningStats{}
+			}
+		}
+	}
+	onSkew := t.onSkew
+	t.mu.Unlock()
+
+	if onSkew != nil {
+		for _, a := range alerts {
+			onSkew(a.name, a.skew)
+		}
+	}
+	return nil
+}
+
+// reportSkew emits EventDriftDetected for the skew of a feature.
+func (s *State) reportSkew(feature string, skew float64) {
+	s.hooks.emit(Event{Type: EventDriftDetected, Details: data.Map{
+		"kind":      data.String("train_serve_skew"),
+		"feature":   data.String(feature),
+		"drift":     data.Float(skew),
+		"threshold": data.Float(s.params.SkewThreshold),
+	}})
+}
+
+func skewOf(train, serving *runningStats) float64 {
+	d := math.Abs(serving.Mean - train.Mean)
+	sd := math.Sqrt(train.variance())
+	if sd == 0 {
+		return d
+	}
+	return d / sd
+}
+
+// snapshot returns a copy of statistics of training records keyed by paths.
+// Statistics of predicted records aren't saved because they're compared to
+// the model in use.
+func (t *skewTracker) snapshot() map[string]runningStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := make(map[string]runningStats, len(t.names))
+	for i, name := range t.names {
+		res[name] = t.train[i]
+	}
+	return res
+}
+
+// restore sets statistics saved by snapshot. Statistics of paths which are
+// no longer tracked are ignored.
+func (t *skewTracker) restore(stats map[string]runningStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, name := range t.names {
+		if st, ok := stats[name]; ok {
+			t.train[i] = st
+		}
+	}
+}
+
+// toMap returns skews of features computed at the end of the last window,
+// or nil when no window has been completed.
+func (t *skewTracker) toMap() data.Map {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.skews == nil {
+		return nil
+	}
+	m := make(data.Map, len(t.skews))
+	for name, s := range t.skews {
+		m[name] = data.Float(s)
+	}
+	return m
+}
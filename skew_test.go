@@ -0,0 +1,123 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestSkewTracker(t *testing.T) {
+	Convey("Given a skew tracker trained by records", t, func() {
+		tr, err := newSkewTracker(&MLParams{
+			SkewPaths:     []string{"x", "c"},
+			SkewWindow:    2,
+			SkewThreshold: 1,
+		})
+		So(err, ShouldBeNil)
+		skews := map[string]float64{}
+		tr.onSkew = func(feature string, skew float64) {
+			skews[feature] = skew
+		}
+		for _, x := range []float64{1, 3} {
+			So(tr.process(data.Map{"x": data.Float(x), "c": data.Int(5)}, true, nil), ShouldBeNil)
+		}
+
+		Convey("When predicted records don't fill a window", func() {
+			rec := data.Map{"x": data.Int(10)}
+			So(tr.process(rec, false, nil), ShouldBeNil)
+
+			Convey("Then no skew should be computed", func() {
+				So(tr.toMap(), ShouldBeNil)
+				So(skews, ShouldBeEmpty)
+				So(rec["x"], ShouldEqual, data.Int(10))
+			})
+		})
+
+		Convey("When predicted records similar to training records fill a window", func() {
+			So(tr.process(data.Map{"x": data.Int(2), "c": data.Int(5)}, false, nil), ShouldBeNil)
+			So(tr.process(data.Map{"x": data.Int(3), "c": data.Int(5)}, false, nil), ShouldBeNil)
+
+			Convey("Then skews should be computed without alerts", func() {
+				So(tr.toMap(), ShouldResemble, data.Map{"x": data.Float(0.5), "c": data.Float(0)})
+				So(skews, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When skewed records fill a window", func() {
+			So(tr.process(data.Map{"x": data.Int(6), "c": data.Int(6)}, false, nil), ShouldBeNil)
+			So(tr.process(data.Map{"x": data.String("a"), "c": data.Int(8)}, false, nil), ShouldBeNil)
+
+			Convey("Then skewed features should be alerted", func() {
+				So(skews, ShouldResemble, map[string]float64{"x": 4, "c": 2})
+			})
+
+			Convey("And when the next window isn't skewed", func() {
+				skews = map[string]float64{}
+				So(tr.process(data.Map{"x": data.Int(2), "c": data.Int(5)}, false, nil), ShouldBeNil)
+				So(tr.process(data.Map{"x": data.Int(2), "c": data.Int(5)}, false, nil), ShouldBeNil)
+
+				Convey("Then skews should only be computed from the window", func() {
+					So(skews, ShouldBeEmpty)
+					So(tr.toMap(), ShouldResemble, data.Map{"x": data.Float(0), "c": data.Float(0)})
+				})
+			})
+		})
+
+		Convey("When statistics are restored to another tracker", func() {
+			tr2, err := newSkewTracker(&MLParams{SkewPaths: []string{"x"}, SkewWindow: 1})
+			So(err, ShouldBeNil)
+			tr2.restore(tr.snapshot())
+
+			Convey("Then it should compare predicted records with them", func() {
+				So(tr2.process(data.Map{"x": data.Int(4)}, false, nil), ShouldBeNil)
+				So(tr2.toMap(), ShouldResemble, data.Map{"x": data.Float(2)})
+			})
+		})
+	})
+}
+
+func TestStateSkew(t *testing.T) {
+	Convey("Given a state tracking skew", t, func() {
+		s := &State{
+			base: &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.Int(1), nil
+			}},
+			params: MLParams{
+				BatchSize:  1,
+				SkewPaths:  []string{"x"},
+				SkewWindow: 1,
+				// The threshold is low enough for any difference.
+				SkewThreshold: 0.01,
+			},
+		}
+		So(s.setUpParams(), ShouldBeNil)
+		events := []Event{}
+		s.OnEvent(func(e Event) {
+			events = append(events, e)
+		})
+		s.skew.restore(map[string]runningStats{"x": {Count: 2, Mean: 2, M2: 2}})
+
+		Convey("When a skewed record is preprocessed for prediction", func() {
+			_, err := s.preprocess(data.Map{"x": data.Int(5)}, preprocessServe, nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then a drift should be detected", func() {
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Type, ShouldEqual, EventDriftDetected)
+				So(events[0].Details["kind"], ShouldEqual, data.String("train_serve_skew"))
+				So(events[0].Details["feature"], ShouldEqual, data.String("x"))
+				So(events[0].Details["drift"], ShouldEqual, data.Float(3))
+			})
+		})
+
+		Convey("When a skewed record is preprocessed to evaluate the model", func() {
+			_, err := s.preprocess(data.Map{"x": data.Int(5)}, preprocessInspect, nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then it shouldn't be observed as serving traffic", func() {
+				So(events, ShouldBeEmpty)
+				So(s.skew.serving[0].Count, ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"time"
+)
+
+// slowCallLog logs Python calls taking longer than slow_call_threshold with
+// their durations and summaries of their arguments. Logs of each method are
+// limited by warn_log_interval, and the number of slow calls is reported as
+// a warning category "slow_<method>" by Status.
+type slowCallLog struct {
+	ctx       *core.Context
+	threshold time.Duration
+}
+
+// setUpSlowCallLog sets up the slow call log with the context used to log
+// calls. It must be called while the write lock is acquired.
+func (s *State) setUpSlowCallLog(ctx *core.Context) {
+	s.slowCalls = nil
+	if s.params.SlowCallThreshold > 0 {
+		s.slowCalls = &slowCallLog{
+			ctx:       ctx,
+			threshold: s.params.SlowCallThreshold,
+		}
+	}
+}
+
+// logSlowCall logs the call when it took longer than the threshold. It does
+// nothing when slow_call_threshold isn't set.
+func (s *State) logSlowCall(method string, args []data.Value, d time.Duration, err error) {
+	l := s.slowCalls
+	if l == nil || d < l.threshold {
+		return
+	}
+	s.warnings.warn("slow_"+method, func(suppressed int64) {
+		e := l.ctx.Log().WithField("method", method).
+			WithField("duration", d.String()).
+			WithField("threshold", l.threshold.String()).
+			WithField("suppressed", suppressed)
+		if args != nil {
+			e = e.WithField("args", summarizeArgs(args))
+		}
+		if err != nil {
+			e = e.WithField("err", err)
+		}
+		e.Warn("pymlstate's Python call is slow")
+	})
+}
+
+// summarizeArgs returns types, lengths, and approximate sizes of arguments
+// such as "array(32) 4096B, string 12B".
+func summarizeArgs(args []data.Value) string {
+	res := make([]string, len(args))
+	for i, a := range args {
+		t := a.Type().String()
+		switch a.Type() {
+		case data.TypeArray:
+			arr, _ := data.AsArray(a)
+			t = fmt.Sprintf("%v(%v)", t, len(arr))
+		case data.TypeMap:
+			m, _ := data.AsMap(a)
+			t = fmt.Sprintf("%v(%v)", t, len(m))
+		}
+		res[i] = fmt.Sprintf("%v %vB", t, approxSize(a))
+	}
+	return strings.Join(res, ", ")
+}
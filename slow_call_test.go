@@ -0,0 +1,52 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestSlowCallLog(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a state with slow_call_threshold", t, func() {
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				if funcName == "fit" {
+					time.Sleep(20 * time.Millisecond)
+				}
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{SlowCallThreshold: 10 * time.Millisecond}}
+		So(s.setUpParams(), ShouldBeNil)
+		s.setUpSlowCallLog(ctx)
+
+		Convey("When a slow call and a fast call are made", func() {
+			_, err := s.Fit(ctx, []data.Value{data.Map{"x": data.Int(1)}})
+			So(err, ShouldBeNil)
+			_, err = s.Predict(ctx, data.Map{"x": data.Int(1)})
+			So(err, ShouldBeNil)
+
+			Convey("Then only the slow call should be logged", func() {
+				counts := s.warnings.counts()
+				So(counts["slow_fit"], ShouldEqual, data.Int(1))
+				So(counts, ShouldNotContainKey, "slow_predict")
+			})
+		})
+	})
+
+	Convey("Given arguments of a call", t, func() {
+		args := []data.Value{data.Array{data.Int(1), data.Int(2)}, data.Map{"a": data.String("b")}, data.String("key")}
+
+		Convey("When they're summarized", func() {
+			s := summarizeArgs(args)
+
+			Convey("Then it should have their types and sizes", func() {
+				So(s, ShouldEqual, "array(2) 23B, map(1) 17B, string 8B")
+			})
+		})
+	})
+}
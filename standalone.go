@@ -0,0 +1,95 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+	"sort"
+	"strings"
+)
+
+// NewStandaloneContext returns a context for using states as a plain Go
+// library in programs which don't run a SensorBee topology. States added to
+// the context by NewStandaloneState or LoadStandaloneState can be used by
+// functions taking a state name such as Predict, and they're terminated by
+// CloseStandaloneContext.
+func NewStandaloneContext() *core.Context {
+	return core.NewContext(&core.ContextConfig{})
+}
+
+// NewStandaloneState creates a state from parameters given in the same way
+// as a WITH clause of a CREATE STATE statement, e.g.
+//
+//	NewStandaloneState(ctx, "model", data.Map{
+//		"module_path": data.String("/path/to/module"),
+//		"module_name": data.String("model"),
+//		"class_name":  data.String("Model"),
+//	})
+//
+// and adds it to the context with the name.
+func NewStandaloneState(ctx *core.Context, name string, params data.Map) (*State, error) {
+	st, err := (&StateCreator{}).CreateState(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return addStandaloneState(ctx, name, st.(*State))
+}
+
+// LoadStandaloneState creates a state from the file written by Save or
+// SaveAll and adds it to the context with the name. Use OpenReadOnly for a
+// state which only serves predictions.
+func LoadStandaloneState(ctx *core.Context, name, path string) (*State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := (&StateCreator{}).LoadState(ctx, f, data.Map{})
+	if err != nil {
+		return nil, err
+	}
+	return addStandaloneState(ctx, name, st.(*State))
+}
+
+func addStandaloneState(ctx *core.Context, name string, s *State) (*State, error) {
+	if err := ctx.SharedStates.Add(name, "pymlstate", s); err != nil {
+		if err := s.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Warn("cannot terminate the instance of pymlstate")
+		}
+		return nil, err
+	}
+	s.setName(name)
+	return s, nil
+}
+
+// CloseStandaloneContext removes all pymlstate states from the context and
+// terminates them, which SensorBee does when a topology stops.
+func CloseStandaloneContext(ctx *core.Context) error {
+	states, err := ctx.SharedStates.List()
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for name, st := range states {
+		if _, ok := st.(*State); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	msgs := []string{}
+	for _, name := range names {
+		st, err := ctx.SharedStates.Remove(name)
+		if err == nil {
+			err = st.Terminate(ctx)
+		}
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%v: %v", name, err))
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("cannot close %v states: %v", len(msgs), strings.Join(msgs, "; "))
+	}
+	return nil
+}
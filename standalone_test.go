@@ -0,0 +1,51 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestStandalone(t *testing.T) {
+	Convey("Given a standalone context having a state", t, func() {
+		ctx := NewStandaloneContext()
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.String("label"), nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1}}
+		So(s.setUpParams(), ShouldBeNil)
+		_, err := addStandaloneState(ctx, "model", s)
+		So(err, ShouldBeNil)
+
+		Convey("When the data is predicted by the name of the state", func() {
+			res, err := Predict(ctx, "model", data.Map{"x": data.Int(1)})
+
+			Convey("Then the model should be applied", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.String("label"))
+			})
+		})
+
+		Convey("When another state is added with the same name", func() {
+			b2 := &fakeBackend{}
+			_, err := addStandaloneState(ctx, "model", &State{base: b2})
+
+			Convey("Then it should fail and terminate the state", func() {
+				So(err, ShouldNotBeNil)
+				So(b2.terminated, ShouldBeTrue)
+			})
+		})
+
+		Convey("When the context is closed", func() {
+			So(CloseStandaloneContext(ctx), ShouldBeNil)
+
+			Convey("Then the state should be removed and terminated", func() {
+				So(b.terminated, ShouldBeTrue)
+				_, err := ctx.SharedStates.Get("model")
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,81 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// standby is an instance of the model loaded from the latest checkpoint. It
+// serves predictions while the primary instance is terminated, for example
+// when its Python process has crashed. It doesn't serve while the primary
+// instance is being loaded because Predict waits for the lock of the load.
+type standby struct {
+	mu        sync.Mutex
+	base      Backend
+	failovers int64
+}
+
+// refresh replaces the standby instance with one loaded from the model
+// written by Backend.Save. The old instance is kept when the model cannot be
+// loaded.
+func (sb *standby) refresh(ctx *core.Context, r io.Reader, p *MLParams) {
+	if sb == nil {
+		return
+	}
+	b, err := loadBackend(ctx, r, p, data.Map{})
+	if err != nil {
+		ctx.ErrLog(err).Warn("pymlstate cannot load the checkpoint into the standby instance")
+		return
+	}
+	sb.mu.Lock()
+	old := sb.base
+	sb.base = b
+	sb.mu.Unlock()
+	if old != nil {
+		if err := old.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Warn("cannot terminate the old standby instance of pymlstate")
+		}
+	}
+}
+
+// failover calls "predict" of the standby instance when the primary instance
+// of s is terminated. It returns err of the primary call otherwise.
+func (sb *standby) failover(s *State, dt data.Value, err error) (data.Value, error) {
+	if sb == nil || s.base.CheckTermination() == nil {
+		return nil, err
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.base == nil {
+		return nil, err
+	}
+	atomic.AddInt64(&sb.failovers, 1)
+	return s.callBackend(sb.base, callPredict, "predict", dt)
+}
+
+func (sb *standby) terminate(ctx *core.Context) {
+	if sb == nil {
+		return
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.base == nil {
+		return
+	}
+	if err := sb.base.Terminate(ctx); err != nil {
+		ctx.ErrLog(err).Warn("cannot terminate the standby instance of pymlstate")
+	}
+	sb.base = nil
+}
+
+func (sb *standby) status() data.Map {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return data.Map{
+		"loaded":    data.Bool(sb.base != nil && sb.base.CheckTermination() == nil),
+		"failovers": data.Int(atomic.LoadInt64(&sb.failovers)),
+	}
+}
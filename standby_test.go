@@ -0,0 +1,97 @@
+package pymlstate
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestStandby(t *testing.T) {
+	Convey("Given a state with a standby instance", t, func() {
+		primary := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return nil, fmt.Errorf("predict failed")
+			},
+		}
+		secondary := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.String("standby"), nil
+			},
+		}
+		s := &State{base: primary, standby: &standby{base: secondary}}
+
+		Convey("When the primary instance fails while it's running", func() {
+			_, err := s.predict(data.Int(1), "")
+
+			Convey("Then the error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(secondary.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the primary instance is terminated", func() {
+			primary.terminated = true
+			res, err := s.predict(data.Int(1), "")
+
+			Convey("Then the standby instance should predict", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.String("standby"))
+				So(s.standby.status(), ShouldResemble, data.Map{
+					"loaded":    data.Bool(true),
+					"failovers": data.Int(1),
+				})
+			})
+		})
+
+		Convey("When the standby instance is terminated", func() {
+			s.standby.terminate(nil)
+			primary.terminated = true
+			_, err := s.predict(data.Int(1), "")
+
+			Convey("Then the prediction should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(secondary.terminated, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestLoadStandby(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a state with a standby instance", t, func() {
+		secondary := &fakeBackend{}
+		s := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1, Standby: true},
+			standby: &standby{base: secondary}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When a model saved with invalid params is loaded", func() {
+			buf := bytes.NewBuffer(nil)
+			invalid := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1, FallbackValue: []byte{0xc1}}}
+			So(invalid.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			So(s.Load(ctx, buf, data.Map{}), ShouldNotBeNil)
+
+			Convey("Then the standby instance should be kept", func() {
+				So(s.params.Standby, ShouldBeTrue)
+				So(s.standby, ShouldNotBeNil)
+				So(secondary.terminated, ShouldBeFalse)
+			})
+		})
+
+		Convey("When a model saved without standby is loaded", func() {
+			buf := bytes.NewBuffer(nil)
+			saved := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1}}
+			So(saved.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			So(s.Load(ctx, buf, data.Map{}), ShouldBeNil)
+
+			Convey("Then the standby instance should be terminated", func() {
+				So(s.params.Standby, ShouldBeFalse)
+				So(s.standby, ShouldBeNil)
+				So(secondary.terminated, ShouldBeTrue)
+			})
+		})
+	})
+}
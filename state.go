@@ -1,7 +1,10 @@
 package pymlstate
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/ugorji/go/codec"
@@ -10,6 +13,8 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -20,66 +25,1188 @@ var (
 // The python instance and this struct must not be coppied directly by assignment
 // statement because it doesn't increase reference count of instance.
 type State struct {
-	base   *pystate.Base
+	base   Backend
 	params MLParams
-	bucket []data.Value
-	rwm    sync.RWMutex
+	// baseParams is nil when the state is loaded from data saved by an old
+	// version, which didn't save them.
+	baseParams *pystate.BaseParams
+	// createParams are parameters passed to the constructor of the model by
+	// New. They're empty when the state is loaded from data saved by an old
+	// version, which didn't save them.
+	createParams data.Map
+	bucket       []data.Value
+	rwm          sync.RWMutex
+	// trainMu serializes "fit" and saving the state, which can run
+	// concurrently under the read lock, so that a checkpoint is always taken
+	// between batches and never captures a half-updated model. Keys of
+	// trained records are committed with the batch while it's acquired.
+	trainMu sync.Mutex
+
+	// components are built from params by newComponents.
+	components
+
+	batchReport *qualityReport
+	retrainer   *retrainer
+	evaluator   *evaluator
+	evalHistory *metricHistory
+
+	hooks eventHooks
+
+	readiness readiness
+
+	// saveProgress and loadProgress are progresses of the latest Save and
+	// Load.
+	saveProgress transferProgress
+	loadProgress transferProgress
+
+	// wal is nil when wal_path isn't set.
+	wal *writeAheadLog
+
+	// standby is nil when standby isn't set.
+	standby *standby
+
+	// shadow is a challenger model loaded by LoadShadow. It's nil when the
+	// state doesn't have it.
+	shadow            Backend
+	shadowVersion     string
+	shadowFingerprint string
+	shadowHistory     *metricHistory
+
+	// batcher is nil when predict_batch_window isn't set.
+	batcher *predictBatcher
+
+	// bucketBytes is the approximate size of records in the bucket. It's
+	// only computed when max_bucket_bytes is set.
+	bucketBytes int64
+
+	// bucketDrops is the number of records dropped by max_bucket_bytes.
+	bucketDrops int64
+
+	// bucketTimes has timestamps of records in the bucket. It's only
+	// maintained when bucket_ttl is set.
+	bucketTimes []time.Time
+
+	// experiences has transitions buffered by Observe.
+	experiences data.Array
+
+	// expiredRecords is the number of records expired by bucket_ttl.
+	expiredRecords int64
+
+	// name is the name of the state set by setName.
+	name atomic.Value
+
+	// transfer has bytes transferred to and from Python.
+	transfer transferStats
+
+	// metrics has rolling aggregates of results of fit and predict.
+	metrics rollingMetrics
+
+	// waits has histograms of time spent waiting for locks and queues.
+	waits waitStats
+
+	// interpreter has the latest resource usage of the interpreter running
+	// the instance.
+	interpreter interpreterSampler
+
+	// slowCalls is nil when slow_call_threshold isn't set.
+	slowCalls *slowCallLog
+
+	fallback predictFallback
+
+	failures failureBudget
+
+	// predictions is never replaced so that metrics can read it without
+	// the lock.
+	predictions predictionHistogram
+	dataStats   dataStats
+	compiled    compileResult
+
+	// modelVersion identifies the deployed model such as "name:version" of
+	// a model registry. It's empty when it's unknown.
+	modelVersion string
+
+	// modelFingerprint is the SHA-256 of the data the model was loaded from.
+	// It's empty when the model hasn't been loaded.
+	modelFingerprint string
+
+	// readOnly is true when the state is opened by OpenReadOnly. It doesn't
+	// change after the state is created.
+	readOnly bool
 }
 
 // MLParams is parameters pymlstate defines in addition to those pystate does.
 // These parameters come from a WITH clause of a CREATE STATE statement.
 type MLParams struct {
+	// Description is a free-form description of the state returned by
+	// Status. This is an optional parameter.
+	Description string `codec:"description"`
+
+	// Tags is a list of free-form tags of the state returned by Status. This
+	// is an optional parameter.
+	Tags []string `codec:"tags"`
+
 	// BatchSize is number of tuples in a single batch training. Write method,
 	// which is usually called by an INSERT INTOT statement via uds Sink, stores
 	// tuples without training until it has tuples as many as batch_train_size.
 	// This is an optional parameter and its default value is 10.
 	BatchSize int `codec:"batch_train_size"`
+
+	// JoinIDPath is a path to the ID which associates a feature tuple with a
+	// label tuple. When it's set, Write buffers the "data" field of feature
+	// tuples until label tuples having the same ID arrive, and then a record
+	// joined with the label is stored to the bucket. This is an optional
+	// parameter and the join is disabled by default.
+	JoinIDPath string `codec:"join_id_path"`
+
+	// JoinLabelPath is a path to the label in a label tuple. A tuple having
+	// a value at this path is considered as a label tuple. The label is set
+	// to the joined record at the same path. The default value is "label".
+	JoinLabelPath string `codec:"join_label_path"`
+
+	// JoinTTL is how long a feature record waits for its label. It's
+	// measured by timestamps of tuples. A feature record whose label doesn't
+	// arrive in time is discarded. The default value is 1 hour and 0 means
+	// feature records never expire.
+	JoinTTL time.Duration `codec:"join_ttl"`
+
+	// PythonEnv is a root directory of a virtualenv or conda environment.
+	// Its site-packages directory is added to sys.path before the Python
+	// instance is created or loaded. All states share one interpreter, so a
+	// package which has already been imported by another state is reused
+	// regardless of this parameter, and directories are appended to the end
+	// of sys.path. This is an optional parameter.
+	PythonEnv string `codec:"python_env"`
+
+	// SitePackages is a list of extra directories added to sys.path in the
+	// same way as PythonEnv. This is an optional parameter.
+	SitePackages []string `codec:"site_packages"`
+
+	// RequiredModules is a list of Python modules, such as "numpy" or
+	// "sklearn.linear_model", which must be importable before the instance
+	// of the class is created or loaded. The state fails to be created or
+	// loaded with an error listing missing modules instead of failing on the
+	// first call to the model. This is an optional parameter.
+	RequiredModules []string `codec:"required_modules"`
+
+	// CheckDependencies enables a call to "check_dependencies" of the model
+	// after its instance is created or loaded. The method returns a list of
+	// missing packages, and the state fails when it isn't empty. This is an
+	// optional parameter and the default value is false.
+	CheckDependencies bool `codec:"check_dependencies"`
+
+	// QualityReport enables a data quality report of each batch. The report
+	// has null counts, type mismatches, and out of range values detected by
+	// preprocessors such as Impute and Clip, and it's written to the log when
+	// the batch is trained. This is an optional parameter and the default
+	// value is false.
+	QualityReport bool `codec:"quality_report"`
+
+	// TrainingSampleSize is the number of records randomly sampled from each
+	// batch passed to the model, which are written to the log with their
+	// features and labels after preprocessing and emitted as
+	// EventTrainingSampled. Since sampled records are logged as they are,
+	// they should be redacted in advance when they have sensitive values.
+	// This is an optional parameter and records aren't sampled by default.
+	TrainingSampleSize int `codec:"training_sample_size"`
+
+	// PredictOutputFields splits a multi-output result of "predict" into
+	// named fields of a map. In a WITH clause, it's given as an array of
+	// field names assigned by position in an array result, or a map from
+	// field names to indexes or paths of the result. This is an optional
+	// parameter and the result is returned as it is by default.
+	PredictOutputFields []PredictOutputField `codec:"predict_output_fields"`
+
+	// ReferenceData is the URI of a static reference table, such as a
+	// dimension table, in the same format as EvalData. A row having the
+	// same value at ReferenceKey as the value at ReferenceKeyPath of a
+	// record is merged into the record before any other preprocessing. The
+	// table is read when the state is created and it's read again by the
+	// pymlstate_reload_reference UDF. This is an optional parameter.
+	ReferenceData string `codec:"reference_data"`
+
+	// ReferenceKey is the field of rows of ReferenceData having their keys.
+	// It's required when ReferenceData is given.
+	ReferenceKey string `codec:"reference_key"`
+
+	// ReferenceKeyPath is the path to the key of a record. The default value
+	// is ReferenceKey.
+	ReferenceKeyPath string `codec:"reference_key_path"`
+
+	// ReferenceOutputPath is the path at which the matching row is set.
+	// Fields of the row are merged into the record without overwriting
+	// existing fields by default.
+	ReferenceOutputPath string `codec:"reference_output_path"`
+
+	// BinaryPaths is a list of paths to binary features such as images. Values
+	// at these paths are converted to data.Blob, which Python receives as raw
+	// bytes, before they're passed to fit or predict. A string is decoded as
+	// base64 and an array of integers is packed into bytes. This is an
+	// optional parameter.
+	BinaryPaths []string `codec:"binary_paths"`
+
+	// ImagePaths is a list of paths to JPEG or PNG images given in the same
+	// way as BinaryPaths. Images are decoded, resized, and normalized into
+	// float32 tensors by ImageWorkers goroutines before they're passed to fit
+	// or predict so that Python doesn't decode them while holding the GIL.
+	// A tensor is a map having "shape" ([height, width, channels]), "dtype"
+	// ("float32"), and "data" (a blob of little-endian values). This is an
+	// optional parameter.
+	ImagePaths []string `codec:"image_paths"`
+
+	// ImageWidth and ImageHeight are the size to which images are resized by
+	// bilinear interpolation. Images keep their sizes by default.
+	ImageWidth  int `codec:"image_width"`
+	ImageHeight int `codec:"image_height"`
+
+	// ImageGrayscale converts images to tensors having one channel when it's
+	// true. Tensors have RGB channels by default.
+	ImageGrayscale bool `codec:"image_grayscale"`
+
+	// ImageMean and ImageStd normalize each channel, which is scaled to
+	// [0, 1], to (v - mean) / std. They have one value for all channels or a
+	// value for each channel. The default mean is 0 and std is 1.
+	ImageMean []float64 `codec:"image_mean"`
+	ImageStd  []float64 `codec:"image_std"`
+
+	// ImageWorkers is the number of goroutines decoding images of records.
+	// The default value is the number of CPUs.
+	ImageWorkers int `codec:"image_workers"`
+
+	// TimestampEncoding is how data.Timestamp values in records are presented
+	// to Python. "rfc3339" converts them to RFC3339 strings, "unix_seconds"
+	// to floating point seconds, and "unix_millis" to integer milliseconds
+	// since the Unix epoch. This is an optional parameter and timestamps are
+	// passed as they are by default.
+	TimestampEncoding string `codec:"timestamp_encoding"`
+
+	// MetadataKey is a reserved key at which metadata of a tuple (event
+	// timestamp, processing timestamp, and trace events) is set to records
+	// given by Write. Records passed to Fit or Predict UDFs don't have the
+	// metadata because they don't come with tuples. This is an optional
+	// parameter and metadata isn't attached by default.
+	MetadataKey string `codec:"metadata_key"`
+
+	// WindowFeatures is a list of features aggregated over sliding windows
+	// of recent training records having the same key at WindowKeyPath. In a
+	// WITH clause, it's given as a map from output paths to maps having
+	// "aggregate" ("count", "mean", or "last"), "path" to the aggregated
+	// value, and "size" (the max number of records) and/or "range" (a
+	// duration) of the window. Aggregated values are set to records before
+	// they're passed to fit or predict. Windows are kept in memory and they
+	// aren't saved with the model. This is an optional parameter.
+	WindowFeatures []WindowFeature `codec:"window_features"`
+
+	// WindowKeyPath is the path to the key of windows of WindowFeatures. All
+	// records share the same windows when it isn't given.
+	WindowKeyPath string `codec:"window_key_path"`
+
+	// WindowMaxKeys is the max number of keys having windows. Windows of the
+	// least recently used key are removed when there're more keys. The
+	// default value is 10000.
+	WindowMaxKeys int `codec:"window_max_keys"`
+
+	// Clip is a list of ranges to which numeric features are clipped before
+	// they're passed to fit or predict. In a WITH clause, it's given as a map
+	// from paths to maps having "min" and "max" for fixed bounds, or
+	// "lower_percentile" and "upper_percentile" for bounds learned from
+	// training records. Samples for percentiles are saved with the model.
+	// This is an optional parameter.
+	Clip []ClipPolicy `codec:"clip"`
+
+	// Impute is a list of policies for null or absent features. In a WITH
+	// clause, it's given as a map from paths to strategies: "mean" replaces
+	// missing values with the mean of values in training records so far,
+	// "drop" drops the record, and a map like {"constant": 0} replaces them
+	// with the constant. A record isn't trained nor predicted when it's
+	// dropped, and "mean" also drops records until any value is observed.
+	// This is an optional parameter.
+	Impute []ImputePolicy `codec:"impute"`
+
+	// NormalizePaths is a list of paths to numeric features to which z-score
+	// normalization is applied before they're passed to fit or predict. The
+	// running mean and variance of each feature are updated by training
+	// records and saved with the model. This is an optional parameter.
+	NormalizePaths []string `codec:"normalize_paths"`
+
+	// VocabularyPaths is a list of paths to categorical features which are
+	// encoded to integer indexes before they're passed to fit or predict.
+	// Indexes start from 1 and are assigned to new values in training
+	// records. Values not in the vocabulary are encoded to 0. Vocabularies
+	// are saved with the model. This is an optional parameter.
+	VocabularyPaths []string `codec:"vocabulary_paths"`
+
+	// VocabularyMaxSize is the maximum number of values in the vocabulary of
+	// each path. Values appearing after the vocabulary is full are encoded
+	// to 0. This is an optional parameter and the default value is 0, which
+	// means vocabularies have no limit.
+	VocabularyMaxSize int `codec:"vocabulary_max_size"`
+
+	// TokenizePaths is a list of paths to texts which are split into tokens
+	// by Tokenizer in Go and encoded to arrays of integer IDs before they're
+	// passed to fit or predict, so that Python doesn't have to tokenize
+	// them. IDs are assigned in the same way as VocabularyPaths, and
+	// vocabularies of tokens are saved with the model. This is an optional
+	// parameter.
+	TokenizePaths []string `codec:"tokenize_paths"`
+
+	// Tokenizer is the name of the tokenizer: "whitespace", which splits
+	// texts by white spaces, "regex", which extracts substrings matching
+	// TokenizePattern, or a name registered by RegisterTokenizer. The default
+	// value is "whitespace".
+	Tokenizer string `codec:"tokenizer"`
+
+	// TokenizePattern is the regular expression of tokens of the "regex"
+	// tokenizer. The default value is "\w+".
+	TokenizePattern string `codec:"tokenize_pattern"`
+
+	// TokenizeLowercase converts texts to lower case before they're
+	// tokenized when it's true. The default value is false.
+	TokenizeLowercase bool `codec:"tokenize_lowercase"`
+
+	// TokenVocabularyMaxSize is the maximum number of tokens in the
+	// vocabulary of each path in the same way as VocabularyMaxSize.
+	TokenVocabularyMaxSize int `codec:"token_vocabulary_max_size"`
+
+	// HashFeatures is a list of paths to high-cardinality features to which
+	// the hashing trick is applied. Values of these fields (or elements of
+	// arrays) are hashed with their paths into a vector having
+	// HashFeaturesDim elements, which is set at HashFeaturesKey, and the
+	// original fields are removed. Each path must end with a key of a map.
+	// This is an optional parameter.
+	HashFeatures []string `codec:"hash_features"`
+
+	// HashFeaturesDim is the dimensionality of hashed feature vectors. The
+	// default value is 1024.
+	HashFeaturesDim int `codec:"hash_features_dim"`
+
+	// HashFeaturesKey is the key at which a hashed feature vector is set.
+	// The default value is "hashed_features".
+	HashFeaturesKey string `codec:"hash_features_key"`
+
+	// CanaryData is a path to a JSON lines file of holdout records. When
+	// it's set, a model loaded by LOAD STATE or pymlstate_reload_module is
+	// evaluated with the records before it replaces the current model, and
+	// the new model is refused when its metric regresses more than
+	// CanaryMaxRegression. This is an optional parameter.
+	CanaryData string `codec:"canary_data"`
+
+	// CanaryMethod is the name of the Python method computing the metric of
+	// a model. It receives an array of records of CanaryData and returns a
+	// number which is greater when the model is better. The default value is
+	// "evaluate".
+	CanaryMethod string `codec:"canary_method"`
+
+	// CanaryMaxRegression is how much the metric of a new model can be lower
+	// than the one of the current model. The default value is 0.
+	CanaryMaxRegression float64 `codec:"canary_max_regression"`
+
+	// Registry is the name of a model registry registered by
+	// RegisterRegistry or the base URL of an HTTP registry server. It's used
+	// by pymlstate_deploy_from_registry. This is an optional parameter.
+	Registry string `codec:"registry"`
+
+	// RetrainFrom is the URI of a dataset with which the model is retrained
+	// every RetrainInterval. See RetrainFrom function for the supported URIs
+	// and formats. This is an optional parameter.
+	RetrainFrom string `codec:"retrain_from"`
+
+	// RetrainInterval is the interval of the scheduled retraining. The
+	// retraining is disabled when it's 0, which is the default value.
+	RetrainInterval time.Duration `codec:"retrain_interval"`
+
+	// AuditLog is a path to a file to which predictions are recorded in JSON
+	// lines. "stdout" and "stderr" write them to the streams. Each line has
+	// the timestamp, the model version, the input (or its SHA-256 hash), and
+	// the output. The input is recorded after redaction. This is an optional
+	// parameter and the audit log is disabled by default.
+	AuditLog string `codec:"audit_log"`
+
+	// AuditLogMaxBytes is the size at which the audit log file is rotated.
+	// The default value is 100MiB. The file isn't rotated when it's 0.
+	AuditLogMaxBytes int64 `codec:"audit_log_max_bytes"`
+
+	// AuditLogMaxBackups is the number of rotated audit log files to keep.
+	// The default value is 5.
+	AuditLogMaxBackups int `codec:"audit_log_max_backups"`
+
+	// AuditFullInput records the full input instead of its hash when it's
+	// true. The default value is false.
+	AuditFullInput bool `codec:"audit_full_input"`
+
+	// AuditSampleRate is the ratio of predictions recorded to the audit log.
+	// It must be in (0, 1] and the default value is 1.
+	AuditSampleRate float64 `codec:"audit_sample_rate"`
+
+	// MaxWritesPerSec is the max number of tuples per second written to the
+	// state. Write returns an error for tuples exceeding it. The quota is
+	// disabled when it's 0, which is the default value.
+	MaxWritesPerSec float64 `codec:"max_writes_per_sec"`
+
+	// MaxPredictsPerSec is the max number of predictions per second. Predict
+	// returns an error for calls exceeding it. The quota is disabled when
+	// it's 0, which is the default value.
+	MaxPredictsPerSec float64 `codec:"max_predicts_per_sec"`
+
+	// MaxModelBytes is the max size of the Python model saved or loaded
+	// by the state. The quota is disabled when it's 0, which is the default
+	// value.
+	MaxModelBytes int64 `codec:"max_model_bytes"`
+
+	// EvalData is the URI of a reference dataset with which the model is
+	// evaluated every EvalInterval. URIs and formats are the same as
+	// RetrainFrom. Metrics are kept in the evaluation history returned by
+	// Status. This is an optional parameter.
+	EvalData string `codec:"eval_data"`
+
+	// EvalInterval is the interval of the scheduled evaluation. The
+	// evaluation is disabled when it's 0, which is the default value.
+	EvalInterval time.Duration `codec:"eval_interval"`
+
+	// EvalMethod is the name of the Python method computing the metric of
+	// the model in the same way as CanaryMethod. The default value is
+	// "evaluate".
+	EvalMethod string `codec:"eval_method"`
+
+	// EvalHistorySize is the number of metrics kept in the evaluation
+	// history. The default value is 100.
+	EvalHistorySize int `codec:"eval_history_size"`
+
+	// ValidationFraction is the fraction of records written to the state
+	// which are held out of training and kept in the validation set. Records
+	// are held out by label so that each label has the same fraction. When
+	// it's set and EvalData isn't, the scheduled evaluation uses the
+	// validation set every EvalInterval. The validation set is saved with the
+	// model. It's disabled when it's 0, which is the default value.
+	ValidationFraction float64 `codec:"validation_fraction"`
+
+	// ValidationSize is the max number of records in the validation set.
+	// Records are reservoir sampled and the size is divided among labels by
+	// the number of their held out records. The default value is 1000.
+	ValidationSize int `codec:"validation_size"`
+
+	// ValidationLabelPath is the path of the label of records by which the
+	// validation set is stratified. The default value is "label".
+	ValidationLabelPath string `codec:"validation_label_path"`
+
+	// PromoteAfter is how long the metric of the shadow model must be better
+	// than the one of the current model by PromoteMargin in the scheduled
+	// evaluation before the shadow model is promoted automatically. The
+	// automatic promotion is disabled when it's 0, which is the default
+	// value.
+	PromoteAfter time.Duration `codec:"promote_after"`
+
+	// PromoteMargin is the margin by which the metric of the shadow model
+	// must be greater than the one of the current model. The default value is
+	// 0.
+	PromoteMargin float64 `codec:"promote_margin"`
+
+	// Objective is the composite objective by which the current model is
+	// compared with a new model by the canary validation and with the shadow
+	// model by the scheduled evaluation. When it's set, CanaryMethod and
+	// EvalMethod must return a map of metrics, and the metric of a model is
+	// the score of the objective. A model violating constraints of the
+	// objective is never promoted, and its metric in the evaluation history
+	// is null. This is an optional parameter and the methods return the
+	// metric by default.
+	Objective *Objective `codec:"objective"`
+
+	// RetrainBelowMetric is the metric of the scheduled evaluation below
+	// which the model is reset and retrained. When the metric stays below it
+	// for RetrainBelowFor, a new instance of the model is trained from
+	// scratch with RetrainFrom, or with the replay buffer when RetrainFrom
+	// isn't set, and it replaces the current model. The policy is disabled
+	// when it's 0, which is the default value.
+	RetrainBelowMetric float64 `codec:"retrain_below_metric"`
+
+	// RetrainBelowFor is how long the metric must stay below
+	// RetrainBelowMetric before the model is retrained. The model is
+	// retrained by the first evaluation below the threshold when it's 0,
+	// which is the default value.
+	RetrainBelowFor time.Duration `codec:"retrain_below_for"`
+
+	// PredictCacheSize is the max number of prediction results cached by
+	// preprocessed inputs. The cache is invalidated whenever the model
+	// changes by training, loading, reloading, or promotion. The cache is
+	// disabled when it's 0, which is the default value.
+	PredictCacheSize int `codec:"predict_cache_size"`
+
+	// PredictCacheTTL is how long a cached prediction result is valid. Results
+	// don't expire when it's 0, which is the default value.
+	PredictCacheTTL time.Duration `codec:"predict_cache_ttl"`
+
+	// PredictBatchWindow is how long Predict waits for other concurrent calls
+	// so that their inputs are passed to PredictBatchMethod at once. The
+	// batching is disabled when it's 0, which is the default value.
+	PredictBatchWindow time.Duration `codec:"predict_batch_window"`
+
+	// PredictBatchMaxSize is the max number of inputs in a batch. A batch is
+	// sent without waiting for PredictBatchWindow when it's full. The default
+	// value is 64.
+	PredictBatchMaxSize int `codec:"predict_batch_max_size"`
+
+	// PredictBatchMethod is the name of the Python method receiving an array
+	// of preprocessed inputs and returning an array of their results in the
+	// same order. The default value is "predict_batch".
+	PredictBatchMethod string `codec:"predict_batch_method"`
+
+	// CallPriority is the class of Python calls which run first when
+	// predictions and training wait for the model at the same time. It's
+	// "predict" or "train". Python calls of the state run one at a time when
+	// it's set. Calls run in arrival order by default.
+	CallPriority string `codec:"call_priority"`
+
+	// MaxBucketBytes is the max approximate size of records buffered in the
+	// bucket when BatchSize is greater than 1. The limit is disabled when
+	// it's 0, which is the default value.
+	MaxBucketBytes int64 `codec:"max_bucket_bytes"`
+
+	// BucketOverflow is what Write does when the bucket exceeds
+	// MaxBucketBytes. "fit" trains the model with the bucket before it's
+	// full and "drop" drops the record with a warning. The default value is
+	// "fit".
+	BucketOverflow string `codec:"bucket_overflow"`
+
+	// FitResultPolicy is what happens when the value returned by "fit" is
+	// malformed, that is, it's neither a number nor a map or it lacks
+	// FitResultFields. "ignore" does nothing, "warn" writes a warning log, and
+	// "error" makes Write and Fit fail although the model has been trained.
+	// The default value is "ignore".
+	FitResultPolicy string `codec:"fit_result_policy"`
+
+	// FitResultFields is a list of numeric fields which the value returned by
+	// "fit" must have. When it's empty, the value must have at least one
+	// numeric field. This is an optional parameter.
+	FitResultFields []string `codec:"fit_result_fields"`
+
+	// HardExampleCount is the number of records having the highest
+	// per-sample losses which are kept and trained again with subsequent
+	// batches. "fit" must return a map having an array of per-sample losses
+	// at SampleLossesKey, and the array must include losses of the records
+	// trained again. Hard examples are disabled when it's 0, which is the
+	// default value.
+	HardExampleCount int `codec:"hard_example_count"`
+
+	// SampleLossesKey is the key of per-sample losses in the value returned
+	// by "fit". The default value is "sample_losses".
+	SampleLossesKey string `codec:"sample_losses_key"`
+
+	// Curriculum filters training records and sorts records in each batch by
+	// a numeric field. See CurriculumPolicy for details. This is an optional
+	// parameter.
+	Curriculum *CurriculumPolicy `codec:"curriculum"`
+
+	// BucketByPath is a path to a key by which records are buffered into
+	// separate buckets. Each bucket is trained when it has BatchSize records,
+	// and the key is passed to "fit" as the second argument, which can be
+	// declared as `def fit(self, bucket, key=None)`. The key is taken from
+	// the record after preprocessing. This is an optional parameter.
+	BucketByPath string `codec:"bucket_by_path"`
+
+	// ChannelPath is a path to the name of the channel of a record. Records
+	// having names of Channels are buffered into buckets of the channels
+	// instead of the bucket of the state, and records without names are
+	// written as usual. Writing a record of an unknown channel fails. The
+	// name is taken from the record after preprocessing. This is an optional
+	// parameter.
+	ChannelPath string `codec:"channel_path"`
+
+	// Channels are configurations of channels by their names, such as
+	// {"unlabeled": {"method": "fit_unsupervised", "batch_size": 1000}}.
+	// Buckets of channels aren't keyed by BucketByPath, and the replay
+	// buffer, hard examples, and the curriculum are only applied to buckets
+	// passed to "fit".
+	Channels map[string]ChannelConfig `codec:"channels"`
+
+	// BucketTTL is how long records are kept in buckets before they expire.
+	// Ages of records are computed from timestamps of tuples when a new tuple
+	// is written. It's only applied when BatchSize is greater than 1. Records
+	// don't expire when it's 0, which is the default value.
+	BucketTTL time.Duration `codec:"bucket_ttl"`
+
+	// BucketExpiry is what happens to expired records. "drop" drops them
+	// with a warning and "fit" trains them in an undersized batch. The
+	// default value is "drop".
+	BucketExpiry string `codec:"bucket_expiry"`
+
+	// ReplayBufferSize is the max number of records kept in the replay
+	// buffer, to which records are added by WriteReplay. The buffer keeps a
+	// uniform sample of the records and it's saved with the state. The
+	// buffer is disabled when it's 0, which is the default value.
+	ReplayBufferSize int `codec:"replay_buffer_size"`
+
+	// ReplayRatio is the number of records from the replay buffer mixed into
+	// each training batch relative to the size of the batch. The default
+	// value is 0.2.
+	ReplayRatio float64 `codec:"replay_ratio"`
+
+	// Authorizer is the name of the authorizer registered by
+	// RegisterAuthorizer. It's consulted by Write, Predict, Save, Load, and
+	// UDFs operating the state. All operations are allowed when it's empty,
+	// which is the default value.
+	Authorizer string `codec:"authorizer"`
+
+	// WarnLogInterval is the min interval of warning logs of the same
+	// category such as dropped records and malformed fit results. Numbers of
+	// warnings of each category are reported by Status. The default value is
+	// 1 minute.
+	WarnLogInterval time.Duration `codec:"warn_log_interval"`
+
+	// TraceCalls is the number of the latest Python calls of "fit" and
+	// "predict" whose arguments and return values are kept for debugging.
+	// They're returned by the pymlstate_trace UDF. Calls aren't traced when
+	// it's 0, which is the default value.
+	TraceCalls int `codec:"trace_calls"`
+
+	// WireFormat is how values are passed to and returned from "fit" and
+	// "predict". "native" converts them to Python objects. "json" passes
+	// JSON strings, which can be captured and replayed easily for debugging
+	// at the cost of speed, and decodes a string returned by Python as JSON.
+	// "arrow" passes the bucket given to "fit" as a bytes object of an Arrow
+	// IPC stream, which pyarrow.ipc.open_stream reads as a table of float64
+	// columns without converting each value. Records must be maps of numbers
+	// with this format. Other values are passed natively. The default value
+	// is "native".
+	WireFormat string `codec:"wire_format"`
+
+	// Isolation is how the Python instance is isolated from other states.
+	// "shared" runs it in the interpreter embedded in the process, which is
+	// shared by all states. "process" runs it in a dedicated Python process
+	// started by PythonCommand, so that module-level globals and
+	// monkeypatches of a model don't affect other states. Values are passed
+	// to the process as JSON with "process". The default value is "shared".
+	Isolation string `codec:"isolation"`
+
+	// PythonCommand is the Python command run when isolation is "process".
+	// The default value is "python3".
+	PythonCommand string `codec:"python_command"`
+
+	// ThreadLimit is the maximum number of threads of native libraries such
+	// as OpenMP, MKL, and OpenBLAS used by the model. It's set to their
+	// environment variables of the Python process when isolation is
+	// "process". The embedded interpreter is shared by all states, so the
+	// limit is only passed to the constructor by ThreadLimitParam with
+	// "shared". The default value is 0, which doesn't limit threads.
+	ThreadLimit int `codec:"thread_limit"`
+
+	// ThreadLimitParam is the parameter of the constructor and "load" of the
+	// model to which ThreadLimit is passed, e.g. "n_jobs".
+	ThreadLimitParam string `codec:"thread_limit_param"`
+
+	// Standby keeps a standby instance of the model loaded from the latest
+	// checkpoint written by Save or read by Load. Predict fails over to it
+	// while the primary instance is terminated, for example when its Python
+	// process has crashed, at the cost of the memory of another instance.
+	// It doesn't serve while the model is being loaded or reloaded because
+	// predictions wait for the lock held by the load; fallback_state or
+	// fallback_value answers them instead. The default value is false.
+	Standby bool `codec:"standby"`
+
+	// WALPath is the path to the write-ahead log of training records. When
+	// it's set, records accepted by Write are appended to the file and synced
+	// before they're buffered, and the file is truncated to records which
+	// haven't been trained when the state is saved by SAVE STATE, but not
+	// when it's exported by SaveAll or ExportBundle. Records in the file are
+	// trained again when the state is created or loaded, so that records
+	// trained after the latest checkpoint aren't lost by a crash. Records
+	// waiting for their labels in join_id_path aren't logged. This is an
+	// optional parameter.
+	WALPath string `codec:"wal_path"`
+
+	// IdempotencyKeyPath is the path to the key of a training record, such
+	// as an ID or an offset given by the upstream, which must be unique for
+	// each record. A record written by Write is dropped when a record having
+	// the same key is buffered or has been trained, so that records replayed
+	// after a failover aren't trained twice. Keys of trained records are
+	// saved with the state. This is an optional parameter.
+	IdempotencyKeyPath string `codec:"idempotency_key_path"`
+
+	// IdempotencyKeys is the max number of keys kept for
+	// IdempotencyKeyPath. The oldest keys are forgotten when it's exceeded.
+	// The default value is 100000.
+	IdempotencyKeys int `codec:"idempotency_keys"`
+
+	// DPBudget is the total privacy budget (epsilon) of differentially
+	// private training. Training fails once the budget is spent. The spent
+	// budget is saved with the state and reported by Status. Training isn't
+	// differentially private when it's 0, which is the default value.
+	DPBudget float64 `codec:"dp_budget"`
+
+	// DPEpsilon is the privacy cost (epsilon) of training a batch before the
+	// amplification by DPSampleRate. It's required when DPBudget is set.
+	DPEpsilon float64 `codec:"dp_epsilon"`
+
+	// DPSampleRate is the probability that each record of a batch is used
+	// for training. Subsampling amplifies the privacy of a batch, which then
+	// costs ln(1 + DPSampleRate*(e^DPEpsilon - 1)). The default value is 1.
+	DPSampleRate float64 `codec:"dp_sample_rate"`
+
+	// DPHook is true when "apply_dp" of the model is called with a map
+	// having "epsilon" and "sample_rate" after each batch is trained, so
+	// that the model clips and adds calibrated noise to its gradients or
+	// weights.
+	DPHook bool `codec:"dp_hook"`
+
+	// AlertLoss is the threshold of the loss returned by "fit". EventAlert is
+	// emitted when the loss stays above it for AlertLossFor. It's disabled
+	// when it's 0, which is the default value.
+	AlertLoss float64 `codec:"alert_loss"`
+
+	// AlertLossFor is the duration for which the loss must stay above
+	// AlertLoss. The default value is 5 minutes.
+	AlertLossFor time.Duration `codec:"alert_loss_for"`
+
+	// AlertErrorRate is the threshold of the error rate of fit and predict
+	// calls in the last minute. EventAlert is emitted when it's exceeded
+	// with at least 10 calls. It's disabled when it's 0, which is the
+	// default value.
+	AlertErrorRate float64 `codec:"alert_error_rate"`
+
+	// SlowCallThreshold is the min duration of calls of Python methods such
+	// as "fit", "predict", "save", and "load" which are logged with their
+	// durations and summaries of their arguments. Calls aren't logged when
+	// it's 0, which is the default value.
+	SlowCallThreshold time.Duration `codec:"slow_call_threshold"`
+
+	// RequestIDPath is the path of the request ID in a record given to
+	// Predict, which is used when the caller doesn't pass the ID. The ID is
+	// included in the audit log and error messages of the prediction. This
+	// is an optional parameter.
+	RequestIDPath string `codec:"request_id_path"`
+
+	// PassRequestID is true when the request ID is passed to "predict" as
+	// the second argument, which can be received as a keyword argument by
+	// "def predict(self, data, request_id=None)". An empty string is passed
+	// when the prediction has no ID. The ID isn't passed when
+	// predict_batch_window is set.
+	PassRequestID bool `codec:"pass_request_id"`
+
+	// VersionedPredictions is true when Predict returns a map having
+	// "result", which is the prediction, "model_version", "state", which is
+	// the name of the state, and "fingerprint", which is the SHA-256 of the
+	// data the model was loaded from, so that each prediction can be
+	// attributed to the exact model. The fingerprint doesn't change when the
+	// model is trained after it's loaded. A constant fallback_value isn't
+	// wrapped. This is an optional parameter and predictions are returned as
+	// they are by default.
+	VersionedPredictions bool `codec:"versioned_predictions"`
+
+	// RandomSeed is the seed of random numbers used to sample and shuffle
+	// records in Go, such as the replay buffer, clipping, differential
+	// privacy, and the audit log. It's also passed to the constructor of the
+	// Python class as "random_seed" so that training can be reproduced
+	// exactly. The seed is saved with the model. Random numbers are seeded by
+	// the current time when it's nil, which is the default value.
+	RandomSeed *int64 `codec:"random_seed"`
+
+	// TeacherState is the name of another pymlstate state whose model
+	// teaches the model of the state. Before a bucket is trained, it's
+	// passed to Predict of the teacher as an array, and each element of the
+	// array returned by the teacher is attached to the corresponding record
+	// at TeacherOutputKey, so that the model can be trained with soft labels.
+	// Records are passed after they're preprocessed by the state. This is an
+	// optional parameter.
+	TeacherState string `codec:"teacher_state"`
+
+	// TeacherOutputKey is the key of the output of the teacher in each
+	// record. The default value is "teacher_output".
+	TeacherOutputKey string `codec:"teacher_output_key"`
+
+	// Postprocess is a list of steps applied to results of Predict in order
+	// so that trivial fixups of outputs don't need changes of the model. In a
+	// WITH clause, it's given as an array of maps having "type" ("clamp",
+	// "labels", or the name of a postprocessor registered by
+	// RegisterPostprocessor), "path" to the value in a map result, "min" and
+	// "max" for "clamp", and "labels" for "labels". This is an optional
+	// parameter.
+	Postprocess []PostprocessStep `codec:"postprocess"`
+
+	// FailureBudget is the number of consecutive failures of calls to the
+	// model after which the state is disabled instead of retrying against a
+	// broken model. A disabled state fails without calling the model until
+	// it's enabled by the pymlstate_enable UDF or a model is loaded. This is
+	// an optional parameter and the state isn't disabled by default.
+	FailureBudget int `codec:"failure_budget"`
+
+	// FallbackState is the name of another state which answers predictions
+	// while the model of this state is loading, its Python instance has
+	// failed, or its circuit breaker is open. The fallback state doesn't
+	// fall back further. This is an optional parameter.
+	FallbackState string `codec:"fallback_state"`
+
+	// FallbackValue is the constant value returned by Predict in the same
+	// situations as FallbackState when it isn't given, encoded in the same
+	// way as BreakerFallback. It's set by the fallback_value parameter.
+	FallbackValue []byte `codec:"fallback_value"`
+
+	// BreakerErrorRate is the rate of failed calls of "predict" in the
+	// latest BreakerWindow calls at which the circuit breaker opens. While
+	// it's open, Predict fails fast with CircuitOpenError, or returns
+	// BreakerFallback if it's given, without calling Python. After
+	// BreakerOpenDuration, one call is let through and the breaker closes
+	// when it succeeds. This is an optional parameter and the breaker is
+	// disabled by default.
+	BreakerErrorRate float64 `codec:"breaker_error_rate"`
+
+	// BreakerWindow is the number of latest calls whose failure rate is
+	// compared with BreakerErrorRate. The default value is 20.
+	BreakerWindow int `codec:"breaker_window"`
+
+	// BreakerCallTimeout is the duration after which a call of "predict" is
+	// counted as a failure even when it succeeds. Only errors are failures
+	// by default.
+	BreakerCallTimeout time.Duration `codec:"breaker_call_timeout"`
+
+	// BreakerOpenDuration is the duration for which the breaker stays open
+	// before it half-opens. The default value is 30 seconds.
+	BreakerOpenDuration time.Duration `codec:"breaker_open_duration"`
+
+	// BreakerFallback is the fallback value returned by Predict while the
+	// breaker is open, encoded in msgpack as a map having "value". It's set
+	// by the breaker_fallback parameter, which is any value.
+	BreakerFallback []byte `codec:"breaker_fallback"`
+
+	// AsyncPredictConcurrency is the max number of predictions started by
+	// PredictAsync which run at a time. The default value is 1.
+	AsyncPredictConcurrency int `codec:"async_predict_concurrency"`
+
+	// AsyncResultTTL is the duration for which a result of PredictAsync is
+	// kept after the prediction finishes. The result is removed when it
+	// isn't retrieved by PredictResult within the duration. The default
+	// value is 10 minutes.
+	AsyncResultTTL time.Duration `codec:"async_result_ttl"`
+
+	// AsyncMaxPending is the max number of predictions started by
+	// PredictAsync which haven't finished. PredictAsync fails when there're
+	// more. The default value is 1000.
+	AsyncMaxPending int `codec:"async_max_pending"`
+
+	// CorrectionWindow is the number of latest predictions whose redacted
+	// inputs are kept by their request IDs so that Correct can add them to
+	// the replay buffer with corrected labels. Only predictions of a record
+	// with a request ID are kept. Correct calls "correct" of the model when
+	// it's 0, which is the default value, or the state doesn't have the
+	// replay buffer.
+	CorrectionWindow int `codec:"correction_window"`
+
+	// CorrectionWeight is the number of times a corrected record is added to
+	// the replay buffer so that it's replayed more often than other records.
+	// The default value is 5.
+	CorrectionWeight int `codec:"correction_weight"`
+
+	// CorrectionLabelPath is the path at which Correct sets the corrected
+	// label of a record. The default value is "label".
+	CorrectionLabelPath string `codec:"correction_label_path"`
+
+	// BanditDecisionWindow is the number of latest decisions made by Choose
+	// which are kept until Reward is called with their IDs. The default
+	// value is 10000.
+	BanditDecisionWindow int `codec:"bandit_decision_window"`
+
+	// ExperienceBatchSize is the number of transitions which Observe buffers
+	// before it passes them to "observe" of the model. The default value is
+	// BatchSize.
+	ExperienceBatchSize int `codec:"experience_batch_size"`
+
+	// ClusterDriftWindow is the number of clusters assigned by AssignCluster
+	// in a window. The drift of cluster sizes is computed as the total
+	// variation distance between proportions of clusters in the last two
+	// windows. The default value is 1000.
+	ClusterDriftWindow int `codec:"cluster_drift_window"`
+
+	// ClusterDriftThreshold is the drift of cluster sizes above which
+	// EventDriftDetected is emitted. No event is emitted when it's 0, which
+	// is the default value.
+	ClusterDriftThreshold float64 `codec:"cluster_drift_threshold"`
+
+	// SkewPaths is a list of paths to numeric features whose statistics in
+	// training records are compared with ones in predicted records to detect
+	// the train/serve skew. Statistics of training records are saved with
+	// the model. This is an optional parameter.
+	SkewPaths []string `codec:"skew_paths"`
+
+	// SkewWindow is the number of predicted records in a window. The skew of
+	// each feature is computed at the end of a window as the difference of
+	// its means in the window and in training divided by its standard
+	// deviation in training. The default value is 1000.
+	SkewWindow int `codec:"skew_window"`
+
+	// SkewThreshold is the skew of a feature above which EventDriftDetected
+	// is emitted. No event is emitted when it's 0, which is the default
+	// value.
+	SkewThreshold float64 `codec:"skew_threshold"`
+
+	// PredictionHistogramWindow is the number of predictions returned by
+	// Predict in a window. Proportions of classes and quantiles of numeric
+	// predictions in the last window are exposed by Status and metrics, and
+	// the shift of the distribution is computed as the total variation
+	// distance between the last two windows. Predictions aren't tracked when
+	// it's 0, which is the default value.
+	PredictionHistogramWindow int `codec:"prediction_histogram_window"`
+
+	// PredictionShiftThreshold is the shift of the distribution of
+	// predictions above which EventDriftDetected is emitted. No event is
+	// emitted when it's 0, which is the default value.
+	PredictionShiftThreshold float64 `codec:"prediction_shift_threshold"`
+
+	// EmbeddingIndexSize is the max number of embeddings computed by Embed
+	// which are kept in the approximate nearest neighbor index searched by
+	// NearestNeighbors. The oldest embedding is removed when the index is
+	// full. The index is disabled when it's 0, which is the default value.
+	EmbeddingIndexSize int `codec:"embedding_index_size"`
+
+	// EmbeddingIndexTables is the number of hash tables of the index. More
+	// tables find more neighbors at the cost of memory. The default value
+	// is 8.
+	EmbeddingIndexTables int `codec:"embedding_index_tables"`
+
+	// EmbeddingIndexBits is the number of bits of a hash of the index, which
+	// is from 1 to 64. More bits make candidates of a query fewer and more
+	// similar. The default value is 12.
+	EmbeddingIndexBits int `codec:"embedding_index_bits"`
+
+	// EmbeddingKeyPath is the path of the key of a record returned by
+	// NearestNeighbors, such as an ID of an item. The redacted record is
+	// returned when it's empty, which is the default value.
+	EmbeddingKeyPath string `codec:"embedding_key_path"`
+
+	// WarmupSamples is the URI of a dataset of records passed to "predict"
+	// after the model is created or loaded and before it serves, so that
+	// initialization costs of the model aren't paid by the first prediction.
+	// The formats of the dataset are the same as those of RetrainFrom. This
+	// is an optional parameter.
+	WarmupSamples string `codec:"warmup_samples"`
+
+	// CompileMethod is the method of the model called without arguments
+	// after the model is created or loaded and before it's warmed up and
+	// serves, so that graphs of the model are compiled before traffic
+	// arrives. The state stays in PhaseInitializing while it's called. This
+	// is an optional parameter.
+	CompileMethod string `codec:"compile_method"`
+
+	// DropPaths is a list of paths to fields which are removed from records
+	// before they're buffered or passed to Python. Each path must end with a
+	// key of a map. This is an optional parameter.
+	DropPaths []string `codec:"drop_paths"`
+
+	// HashPaths is a list of paths to fields whose values are replaced with
+	// hex-encoded SHA-256 hashes before they're buffered or passed to Python.
+	// This is an optional parameter.
+	HashPaths []string `codec:"hash_paths"`
+
+	// HashSalt is a salt prepended to values hashed by HashPaths. This is an
+	// optional parameter.
+	HashSalt string `codec:"hash_salt"`
 }
 
 // New creates `core.SharedState` for multiple layer classification.
 func New(baseParams *pystate.BaseParams, mlParams *MLParams, params data.Map) (*State, error) {
-	b, err := pystate.NewBase(baseParams, params)
-	if err != nil {
+	bp := *baseParams
+	s := &State{
+		params:       *mlParams,
+		baseParams:   &bp,
+		createParams: params.Copy(),
+		bucket:       make([]data.Value, 0, mlParams.BatchSize),
+	}
+	if err := s.setUpParams(); err != nil {
+		return nil, err
+	}
+	if err := setUpPythonEnv(mlParams); err != nil {
 		return nil, err
 	}
 
-	s := &State{
-		base:   b,
-		params: *mlParams,
-		bucket: make([]data.Value, 0, mlParams.BatchSize),
+	b, err := newBackend(baseParams, mlParams, params)
+	if err != nil {
+		return nil, err
 	}
+	s.base = b
 	return s, nil
 }
 
+// setUpParams initializes fields of State which depend on s.params.
+func (s *State) setUpParams() error {
+	c, err := newComponents(&s.params)
+	if err != nil {
+		return err
+	}
+	if err := c.keep(&s.components, &s.params); err != nil {
+		return err
+	}
+	if err := s.installComponents(c, &s.params); err != nil {
+		return err
+	}
+
+	// The standby instance is kept until it's refreshed by the next
+	// checkpoint.
+	if !s.params.Standby {
+		s.standby = nil
+	} else if s.standby == nil {
+		s.standby = &standby{}
+	}
+	return nil
+}
+
+// setUpPredictBatcher creates the batcher of predictions. It's separated from
+// newComponents because the batcher calls the model of s.
+func (s *State) setUpPredictBatcher() {
+	s.batcher = nil
+	if s.params.PredictBatchWindow <= 0 {
+		return
+	}
+	method := s.params.PredictBatchMethod
+	s.batcher = newPredictBatcher(s.params.PredictBatchWindow, s.params.PredictBatchMaxSize,
+		func(in []data.Value) ([]data.Value, error) {
+			// Callers of Predict waiting for the result hold the read lock.
+			res, err := s.callPython(callPredict, method, data.Array(in))
+			if err != nil {
+				return nil, err
+			}
+			arr, err := data.AsArray(res)
+			if err != nil {
+				return nil, fmt.Errorf("%v must return an array: %v", method, err)
+			}
+			return arr, nil
+		})
+}
+
 // Terminate terminates this state.
 func (s *State) Terminate(ctx *core.Context) error {
 	s.rwm.Lock()
 	defer s.rwm.Unlock()
+	s.readiness.set(PhaseDraining)
 	if err := s.base.Terminate(ctx); err != nil {
 		return err
 	}
+	if s.retrainer != nil {
+		close(s.retrainer.stop)
+		s.retrainer = nil
+	}
+	if s.evaluator != nil {
+		close(s.evaluator.stop)
+		s.evaluator = nil
+	}
+	if s.audit != nil {
+		s.audit.close()
+	}
+	if s.shadow != nil {
+		if err := s.shadow.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Warn("cannot terminate the shadow model of pymlstate")
+		}
+		s.shadow = nil
+	}
+	s.standby.terminate(ctx)
+	if err := s.wal.close(); err != nil {
+		ctx.ErrLog(err).Warn("cannot close the write-ahead log of pymlstate")
+	}
+	s.wal = nil
 	// Don't set s.base = nil because it's used for the termination detection.
 	s.bucket = nil
+	s.join = nil
 	return nil
 }
 
 // Write stores a tuple to its bucket and calls "fit" function every
 // "batch_train_size" times.
 func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
-	s.rwm.Lock()
+	called := time.Now()
+	if err := s.authorize(ctx, ActionTrain); err != nil {
+		return err
+	}
+	s.lockForWrite(called)
 	defer s.rwm.Unlock()
 	if err := s.base.CheckTermination(); err != nil {
 		return err
 	}
+	if err := s.writeLimiter.checkRate("writes"); err != nil {
+		return err
+	}
+	if err := s.expireBuckets(ctx, t.Timestamp); err != nil {
+		return err
+	}
 
-	dataSet, err := t.Data.Get(datPath)
+	t, err := allowTupleFeatures(t)
 	if err != nil {
 		return err
 	}
+	if s.redactor != nil {
+		rt, err := s.redactor.redactTuple(t)
+		if err != nil {
+			return err
+		}
+		t = rt
+	}
+
+	var dataSet data.Value
+	if s.join != nil {
+		rec, joined, err := s.join.add(t)
+		if err != nil {
+			return err
+		}
+		if !joined {
+			return nil
+		}
+		dataSet = rec
+	} else {
+		dt, err := t.Data.Get(datPath)
+		if err != nil {
+			return err
+		}
+		dataSet = dt
+	}
+	if s.params.MetadataKey != "" {
+		dataSet = attachMetadata(dataSet, s.params.MetadataKey, tupleMetadata(t))
+	}
+	if dataSet = s.validation.split(dataSet); dataSet == nil {
+		return nil // held out for validation
+	}
+	if s.params.QualityReport && s.batchReport == nil {
+		s.batchReport = newQualityReport()
+	}
+	dataSet, err = s.preprocess(dataSet, preprocessTrain, s.batchReport)
+	if err != nil {
+		return err
+	}
+	if dataSet == nil {
+		return nil // dropped by preprocessors
+	}
+	if s.wal != nil {
+		if err := s.wal.append(walEntry{rec: dataSet, ts: t.Timestamp}); err != nil {
+			return err
+		}
+	}
+	return s.writeRecord(ctx, dataSet, t.Timestamp)
+}
+
+// writeRecord buffers the preprocessed record and trains the bucket when
+// it's full. ts is the timestamp of the tuple. It must be called while the
+// write lock is acquired.
+func (s *State) writeRecord(ctx *core.Context, dataSet data.Value, ts time.Time) error {
+	if dataSet = s.idempotency.filter(dataSet); dataSet == nil {
+		return nil // already buffered or trained
+	}
+	if s.channels != nil {
+		rest, err := s.writeChannels(ctx, dataSet, ts)
+		if err != nil || rest == nil {
+			return err
+		}
+		dataSet = rest
+	}
+	if s.keyedBuckets != nil {
+		return s.writeKeyed(ctx, dataSet, ts)
+	}
 
 	if s.params.BatchSize > 1 {
+		if !s.curriculum.accept(dataSet) {
+			return nil // filtered by the curriculum
+		}
+		overflow, drop := s.overflowBucket(ctx, &s.bucketBytes, len(s.bucket), dataSet)
+		if drop {
+			return nil
+		}
 		s.bucket = append(s.bucket, dataSet)
-		if len(s.bucket) < s.params.BatchSize {
+		if s.params.BucketTTL > 0 {
+			s.bucketTimes = append(s.bucketTimes, ts)
+		}
+		if !overflow && len(s.bucket) < s.params.BatchSize {
 			return nil
 		}
 	} else {
@@ -89,26 +1216,98 @@ func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
 		} else {
 			s.bucket = []data.Value{dataSet}
 		}
+		s.bucket = s.curriculum.filter(s.bucket)
+		if len(s.bucket) == 0 {
+			return nil // all records are dropped by preprocessors
+		}
 	}
 
-	_, err = s.fit(ctx, s.bucket)
+	res, err := s.fit(ctx, s.bucket)
 	prevBucketSize := len(s.bucket)
 	s.bucket = s.bucket[:0] // clear slice but keep capacity
+	s.bucketBytes = 0
+	s.bucketTimes = s.bucketTimes[:0]
+	return s.finishWriteFit(ctx, res, err, prevBucketSize)
+}
+
+// overflowBucket adds the size of the record to *bucketBytes when
+// max_bucket_bytes is set. It returns true as overflow when the bucket must
+// be trained before it's full, and true as drop when the record must be
+// dropped.
+func (s *State) overflowBucket(ctx *core.Context, bucketBytes *int64, bucketSize int,
+	rec data.Value) (overflow, drop bool) {
+	if s.params.MaxBucketBytes <= 0 {
+		return false, false
+	}
+	n := approxSize(rec)
+	if *bucketBytes+n > s.params.MaxBucketBytes {
+		if s.params.BucketOverflow == "drop" {
+			s.bucketDrops++
+			s.warnings.warn("bucket_overflow", func(suppressed int64) {
+				ctx.Log().WithField("bucket_size", bucketSize).
+					WithField("bucket_bytes", *bucketBytes).WithField("record_bytes", n).
+					WithField("suppressed", suppressed).
+					Warn("pymlstate dropped a record because the bucket exceeds max_bucket_bytes")
+			})
+			return false, true
+		}
+		overflow = true
+	}
+	*bucketBytes += n
+	return overflow, false
+}
+
+// finishWriteFit handles the result of fit called by Write. bucketSize is
+// the number of records passed to fit.
+func (s *State) finishWriteFit(ctx *core.Context, res data.Value, err error, bucketSize int) error {
+	s.batchReport.log(ctx, bucketSize)
+	s.batchReport = nil
+	if err == nil {
+		s.predictCache.invalidate()
+		err = s.validateFitResult(ctx, res)
+	}
 	if err != nil {
-		ctx.ErrLog(err).WithField("bucket_size", prevBucketSize).
+		s.emitFit(nil, err)
+		ctx.ErrLog(err).WithField("bucket_size", bucketSize).
 			Error("pymlstate's training via Write (INSERT INTO) failed")
 		return err
 	}
-
+	s.emitFit(ParseFitResult(res, bucketSize), nil)
 	return nil
 }
 
 // Fit receives `data.Array` type but it assumes `[]data.Map` type
-// for passing arguments to `fit` method.
-func (s *State) Fit(ctx *core.Context, bucket []data.Value) (data.Value, error) {
+// for passing arguments to `fit` method. It returns the result parsed by
+// ParseFitResult.
+func (s *State) Fit(ctx *core.Context, bucket []data.Value) (*FitResult, error) {
 	s.rwm.RLock()
 	defer s.rwm.RUnlock()
-	return s.fit(ctx, bucket)
+	b, err := s.redact(data.Array(bucket))
+	if err != nil {
+		return nil, err
+	}
+	var rep *qualityReport
+	if s.params.QualityReport {
+		rep = newQualityReport()
+	}
+	if b, err = s.preprocess(b, preprocessTrain, rep); err != nil {
+		return nil, err
+	}
+	arr, _ := data.AsArray(b)
+	arr = s.curriculum.filter(arr)
+	res, err := s.fit(ctx, arr)
+	rep.log(ctx, len(arr))
+	if err == nil {
+		s.predictCache.invalidate()
+		err = s.validateFitResult(ctx, res)
+	}
+	if err != nil {
+		s.emitFit(nil, err)
+		return nil, err
+	}
+	fr := ParseFitResult(res, len(arr))
+	s.emitFit(fr, nil)
+	return fr, nil
 }
 
 // fit is the internal implementation of Fit. fit doesn't acquire the lock nor
@@ -116,65 +1315,458 @@ func (s *State) Fit(ctx *core.Context, bucket []data.Value) (data.Value, error)
 // this method itself doesn't change any field of State. Although the model
 // will be updated by the data, the model is protected by Python's GIL. So,
 // this method doesn't require a write lock.
-func (s *State) fit(ctx *core.Context, bucket []data.Value) (data.Value, error) {
-	return s.base.Call("fit", data.Array(bucket))
+//
+// args are passed to "fit" after the bucket.
+func (s *State) fit(ctx *core.Context, bucket []data.Value, args ...data.Value) (data.Value, error) {
+	return s.fitWith(ctx, "fit", bucket, args...)
+}
+
+// fitWith is fit calling the method of the model. The curriculum, the
+// replay buffer, and hard examples are only applied when the method is
+// "fit".
+func (s *State) fitWith(ctx *core.Context, method string, bucket []data.Value, args ...data.Value) (data.Value, error) {
+	if s.readOnly {
+		return nil, errReadOnly
+	}
+	written := bucket
+	if method == "fit" {
+		bucket = s.curriculum.order(bucket)
+		written = bucket
+		if s.replay != nil {
+			bucket = s.replay.mix(bucket)
+		}
+		if s.hardExamples != nil {
+			bucket = s.hardExamples.withReplay(bucket)
+		}
+	}
+	bucket, err := s.distill(ctx, bucket)
+	if err == nil {
+		err = s.privacy.check()
+	}
+	if err != nil {
+		s.idempotency.finish(written, false)
+		return nil, err
+	}
+	s.logTrainingSample(ctx, method, bucket)
+	s.trainMu.Lock()
+	res, err := s.fitPrivately(method, bucket, args)
+	s.idempotency.finish(written, err == nil)
+	s.trainMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if s.hardExamples == nil || method != "fit" {
+		return res, nil
+	}
+	if err := s.hardExamples.update(bucket, res); err != nil {
+		s.warnings.warn("hard_examples", func(suppressed int64) {
+			ctx.ErrLog(err).WithField("suppressed", suppressed).
+				Warn("pymlstate cannot update hard examples")
+		})
+	}
+	return res, nil
+}
+
+// fitPrivately calls the training method of the model. When dp_budget is
+// set, the bucket is subsampled, "apply_dp" is called when dp_hook is set,
+// and the budget is spent once the method is called even if it fails,
+// because the model may have used the records.
+func (s *State) fitPrivately(method string, bucket []data.Value, args []data.Value) (data.Value, error) {
+	if s.privacy == nil {
+		return s.callPython(callTrain, method, append([]data.Value{data.Array(bucket)}, args...)...)
+	}
+	bucket = s.privacy.subsample(bucket)
+	defer s.privacy.spend()
+	res, err := s.callPython(callTrain, method, append([]data.Value{data.Array(bucket)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	if s.params.DPHook {
+		if _, err := s.callPython(callTrain, "apply_dp", s.privacy.hookArgs()); err != nil {
+			return nil, fmt.Errorf("apply_dp failed: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// callPython calls the method of the model through the scheduler. The call
+// is recorded when trace_calls is set, and bytes of its arguments and result
+// are counted.
+func (s *State) callPython(class callClass, method string, args ...data.Value) (data.Value, error) {
+	if s.readiness.get() == PhaseDisabled {
+		return nil, errDisabled
+	}
+	res, err := s.callBackend(s.base, class, method, args...)
+	s.observeCall(err)
+	return res, err
+}
+
+// callBackend calls the method of the instance b in the same way as
+// callPython.
+func (s *State) callBackend(b Backend, class callClass, method string, args ...data.Value) (data.Value, error) {
+	args, err := s.encodeWire(class, args)
+	if err != nil {
+		return nil, err
+	}
+	var res data.Value
+	queued := time.Now()
+	err = s.scheduler.do(class, func() error {
+		start := time.Now()
+		if class == callTrain {
+			s.waits.observe(waitFitQueue, start.Sub(queued))
+		} else {
+			s.waits.observe(waitPredictQueue, start.Sub(queued))
+		}
+		var err error
+		s.withProfileLabels(method, func() {
+			res, err = b.Call(method, args...)
+		})
+		d := time.Now().Sub(start)
+		s.transfer.add(class, args, res)
+		s.logSlowCall(method, args, d, err)
+		if s.tracer != nil {
+			s.tracer.add(callTrace{
+				Time:     start,
+				Method:   method,
+				Args:     args,
+				Result:   res,
+				Err:      err,
+				Duration: d,
+			})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.decodeWire(res)
 }
 
 // Predict applies the model to the data. It returns a result returned from
-// Python script.
+// Python script. When predict_output_fields is set, the result is split into
+// a map having the named fields.
 func (s *State) Predict(ctx *core.Context, dt data.Value) (data.Value, error) {
-	s.rwm.RLock()
+	return s.PredictWithRequestID(ctx, dt, "")
+}
+
+// PredictWithRequestID is Predict with the ID of the request, which is
+// included in the audit log and error messages and passed to "predict" when
+// pass_request_id is set. When requestID is empty, it's taken from the
+// record at request_id_path if any. The prediction is answered by
+// fallback_state or fallback_value while the model is loading, has failed,
+// or its circuit breaker is open. Results of the model are fixed up by
+// postprocess steps.
+func (s *State) PredictWithRequestID(ctx *core.Context, dt data.Value, requestID string) (data.Value, error) {
+	return s.predictWithFallback(ctx, dt, requestID, true, true)
+}
+
+// predictWithFallback predicts the data. The prediction falls back to
+// fallback_state or fallback_value when fallback is true, and it's wrapped
+// with the version of the model when versioned is true and
+// versioned_predictions is set.
+func (s *State) predictWithFallback(ctx *core.Context, dt data.Value, requestID string, fallback, versioned bool) (data.Value, error) {
+	called := time.Now()
+	orig := dt
+	fallback = fallback && s.fallback.enabled()
+	if p := s.readiness.get(); fallback && (p == PhaseLoading || p == PhaseDraining) {
+		// Don't wait for the lock held while the model is loaded, which
+		// authorize also needs.
+		if err := s.fallback.authorize(ctx); err != nil {
+			return nil, err
+		}
+		return s.fallback.predict(ctx, s, dt, requestID, fmt.Errorf("the state is %v", p))
+	}
+	if err := s.authorize(ctx, ActionPredict); err != nil {
+		return nil, err
+	}
+	s.lockForPredict(called)
 	defer s.rwm.RUnlock()
-	return s.base.Call("predict", dt)
+	if err := s.predictLimiter.checkRate("predicts"); err != nil {
+		return nil, err
+	}
+	if requestID == "" {
+		requestID = s.requestIDOf(dt)
+	}
+	in, err := s.redact(dt)
+	if err != nil {
+		return nil, withRequestID(err, requestID)
+	}
+	if dt, err = s.preprocess(in, preprocessServe, nil); err != nil {
+		return nil, withRequestID(err, requestID)
+	}
+	if dt == nil {
+		return nil, errDropRecord
+	}
+	start := time.Now()
+	res, err := s.predict(dt, requestID)
+	end := time.Now()
+	s.metrics.observePredict(end, end.Sub(start), err)
+	s.checkAlerts(end, nil)
+	if err != nil {
+		if fallback && s.unavailable(err) {
+			return s.fallback.predict(ctx, s, orig, requestID, err)
+		}
+		return nil, withRequestID(err, requestID)
+	}
+	if s.postprocessor != nil {
+		if res, err = s.postprocessor.process(res); err != nil {
+			return nil, withRequestID(err, requestID)
+		}
+	}
+	if shift, shifted := s.predictions.observe(res); shifted {
+		ctx.Log().WithField("shift", shift).WithField("threshold", s.params.PredictionShiftThreshold).
+			Warn("pymlstate detected a shift of the distribution of predictions")
+		s.hooks.emit(Event{Type: EventDriftDetected, Details: data.Map{
+			"kind":      data.String("prediction_distribution"),
+			"drift":     data.Float(shift),
+			"threshold": data.Float(s.params.PredictionShiftThreshold),
+		}})
+	}
+	s.predictionInputs.remember(requestID, in)
+	if s.audit != nil {
+		if err := s.audit.record(s.modelVersion, requestID, in, res); err != nil {
+			s.warnings.warn("audit_log", func(suppressed int64) {
+				ctx.ErrLog(err).WithField("suppressed", suppressed).
+					Error("pymlstate cannot record a prediction to the audit log")
+			})
+		}
+	}
+	if versioned && s.params.VersionedPredictions {
+		name, _ := s.name.Load().(string)
+		res = data.Map{
+			"result":        res,
+			"model_version": data.String(s.modelVersion),
+			"state":         data.String(name),
+			"fingerprint":   data.String(s.modelFingerprint),
+		}
+	}
+	return res, nil
+}
+
+// predict calls "predict" with the preprocessed data and splits the result.
+// The data is batched with other calls when predict_batch_window is set. The
+// result is cached when predict_cache_size is set. A call is rejected while
+// the circuit breaker is open. requestID is passed to
+// "predict" when pass_request_id is set and the data isn't batched.
+func (s *State) predict(dt data.Value, requestID string) (data.Value, error) {
+	var (
+		key string
+		gen uint64
+	)
+	if s.predictCache != nil {
+		key = predictCacheKey(dt)
+		res, g, ok := s.predictCache.get(key, time.Now())
+		if ok {
+			return res, nil
+		}
+		gen = g
+	}
+
+	start := time.Now()
+	if fallback, err := s.breaker.allow(start); err != nil {
+		return nil, err
+	} else if fallback != nil {
+		return fallback, nil
+	}
+	var (
+		res data.Value
+		err error
+	)
+	if s.batcher != nil {
+		res, err = s.batcher.predict(dt)
+	} else if s.params.PassRequestID {
+		res, err = s.callPython(callPredict, "predict", dt, data.String(requestID))
+	} else {
+		res, err = s.callPython(callPredict, "predict", dt)
+	}
+	end := time.Now()
+	s.observeBreaker(end, end.Sub(start), err)
+	if err != nil {
+		if res, err = s.standby.failover(s, dt, err); err != nil {
+			return nil, err
+		}
+	}
+	if s.output != nil {
+		if res, err = s.output.split(res); err != nil {
+			return nil, err
+		}
+	}
+	if s.predictCache != nil {
+		s.predictCache.put(key, res, gen, time.Now())
+	}
+	return res, nil
 }
 
 // Save saves the model of the state. pystate calls `save` method and
 // use its return value as dumped model.
 func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	return s.save(ctx, w, params, true)
+}
+
+// save saves the model of the state. The write-ahead log is truncated only
+// when recovery is true, that is, when the state is recovered from the saved
+// data after a crash. Exports such as SaveAll don't truncate it.
+func (s *State) save(ctx *core.Context, w io.Writer, params data.Map, recovery bool) error {
+	if err := s.authorize(ctx, ActionSave); err != nil {
+		return err
+	}
 	s.rwm.RLock()
 	defer s.rwm.RUnlock()
 	if err := s.base.CheckTermination(); err != nil {
 		return err
 	}
 
-	if err := s.saveState(w); err != nil {
+	s.saveProgress.begin(ctx, "saving", 0)
+	defer s.saveProgress.finish()
+	w = &progressWriter{w: w, p: &s.saveProgress}
+	var (
+		err        error
+		checkpoint *bytes.Buffer
+	)
+	// The standby instance only loads the model.
+	mw := w
+	if s.standby != nil {
+		checkpoint = bytes.NewBuffer(nil)
+		mw = io.MultiWriter(w, checkpoint)
+	}
+	// The state data and the model are written at the same batch boundary
+	// so that keys and statistics of the checkpoint match the model.
+	s.trainMu.Lock()
+	if err = s.saveState(w); err == nil {
+		start := time.Now()
+		s.withProfileLabels("save", func() {
+			err = s.base.Save(ctx, &quotaWriter{w: mw, limit: s.params.MaxModelBytes}, params)
+		})
+		s.logSlowCall("save", nil, time.Now().Sub(start), err)
+	}
+	s.trainMu.Unlock()
+	if err != nil {
 		return err
 	}
-	return s.base.Save(ctx, w, params)
+	if recovery && s.wal != nil {
+		if err := s.wal.rewrite(s.bufferedEntries()); err != nil {
+			ctx.ErrLog(err).Error("pymlstate cannot truncate the write-ahead log")
+		}
+	}
+	if checkpoint != nil {
+		s.standby.refresh(ctx, checkpoint, &s.params)
+	}
+	s.hooks.emit(Event{Type: EventCheckpointWritten})
+	return nil
 }
 
 const (
-	pyMLStateFormatVersion uint8 = 1
+	pyMLStateFormatVersion uint8 = 3
 )
 
+// stateData is data of State other than MLParams and the Python model. It's
+// saved since the format version 2, and its fields are saved as sections of
+// the envelope since the format version 3.
+type stateData struct {
+	Base         *pystate.BaseParams         `codec:"base"`
+	CreateParams []byte                      `codec:"create_params"`
+	ModelVersion string                      `codec:"model_version"`
+	Clipper      map[string]reservoir        `codec:"clipper"`
+	Imputer      map[string]runningStats     `codec:"imputer"`
+	Normalizer   map[string]runningStats     `codec:"normalizer"`
+	Skew         map[string]runningStats     `codec:"skew"`
+	Vocabulary   map[string]map[string]int64 `codec:"vocabulary"`
+	Tokens       map[string]map[string]int64 `codec:"tokens"`
+	Replay       []byte                      `codec:"replay"`
+	Validation   []byte                      `codec:"validation"`
+	TrainedKeys  []string                    `codec:"trained_keys"`
+	PrivacySpent float64                     `codec:"privacy_spent"`
+}
+
+// createParams decodes parameters of the constructor of the model.
+func (sd *stateData) createParams() (data.Map, error) {
+	if len(sd.CreateParams) == 0 {
+		return data.Map{}, nil
+	}
+	m, err := data.UnmarshalMsgpack(sd.CreateParams)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode parameters of the constructor: %v", err)
+	}
+	return m, nil
+}
+
+// saveState writes the envelope of the state, which is followed by the
+// Python model.
 func (s *State) saveState(w io.Writer) error {
-	if _, err := w.Write([]byte{pyMLStateFormatVersion}); err != nil {
-		return err
+	sd := &stateData{
+		Base:         s.baseParams,
+		ModelVersion: s.modelVersion,
+		PrivacySpent: s.privacy.spentBudget(),
+	}
+	if len(s.createParams) > 0 {
+		b, err := data.MarshalMsgpack(s.createParams)
+		if err != nil {
+			return err
+		}
+		sd.CreateParams = b
+	}
+	if s.clipper != nil {
+		sd.Clipper = s.clipper.snapshot()
+	}
+	if s.imputer != nil {
+		sd.Imputer = s.imputer.snapshot()
+	}
+	if s.normalizer != nil {
+		sd.Normalizer = s.normalizer.snapshot()
 	}
+	if s.skew != nil {
+		sd.Skew = s.skew.snapshot()
+	}
+	if s.vocabulary != nil {
+		sd.Vocabulary = s.vocabulary.snapshot()
+	}
+	if s.tokens != nil {
+		sd.Tokens = s.tokens.vocab.snapshot()
+	}
+	if s.replay != nil {
+		b, err := s.replay.snapshot()
+		if err != nil {
+			return err
+		}
+		sd.Replay = b
+	}
+	if s.validation != nil {
+		b, err := s.validation.snapshot()
+		if err != nil {
+			return err
+		}
+		sd.Validation = b
+	}
+	if s.idempotency != nil {
+		sd.TrainedKeys = s.idempotency.snapshot()
+	}
+	return writeEnvelope(w, &s.params, sd)
+}
 
-	// Save parameter of State before save python's model
+// writeMsgpackSection writes v in msgpack with its size.
+func writeMsgpackSection(w io.Writer, v interface{}) error {
 	msgpackHandle := &codec.MsgpackHandle{}
 	var out []byte
 	enc := codec.NewEncoderBytes(&out, msgpackHandle)
-	if err := enc.Encode(&s.params); err != nil {
+	if err := enc.Encode(v); err != nil {
 		return err
 	}
 
-	// Write size of MLParams
+	// Write size of the data
 	dataSize := uint32(len(out))
 	err := binary.Write(w, binary.LittleEndian, dataSize)
 	if err != nil {
 		return err
 	}
 
-	// Write MLParams in msgpack
+	// Write the data in msgpack
 	n, err := w.Write(out)
 	if err != nil {
 		return err
 	}
 
 	if n < len(out) {
-		return errors.New("cannot save the MLParams data")
+		return errors.New("cannot save the data of State")
 	}
 
 	return nil
@@ -183,69 +1775,241 @@ func (s *State) saveState(w io.Writer) error {
 // Load loads the model of the state. pystate calls `load` method and
 // pass to the model data by using method parameter.
 func (s *State) Load(ctx *core.Context, r io.Reader, params data.Map) error {
+	return s.loadVersion(ctx, r, params, "")
+}
+
+// loadVersion is Load setting the version of the loaded model to version
+// unless it's empty. The version is set while the state is locked so that
+// predictions aren't versioned by the previous one.
+func (s *State) loadVersion(ctx *core.Context, r io.Reader, params data.Map, version string) error {
+	if err := s.authorize(ctx, ActionLoad); err != nil {
+		return err
+	}
 	s.rwm.Lock()
 	defer s.rwm.Unlock()
 	if err := s.base.CheckTermination(); err != nil {
 		return err
 	}
-	return s.load(ctx, r, params)
+	return s.load(ctx, r, params, version)
 }
 
-func (s *State) load(ctx *core.Context, r io.Reader, params data.Map) error {
-	var formatVersion uint8
-	if err := binary.Read(r, binary.LittleEndian, &formatVersion); err != nil {
+// load loads the model. The version of the model is set to version unless
+// it's empty.
+func (s *State) load(ctx *core.Context, r io.Reader, params data.Map, version string) error {
+	// TODO: remove MLParams specific parameters from params
+
+	prev := s.readiness.get()
+	s.readiness.set(PhaseLoading)
+	s.loadProgress.begin(ctx, "loading", readerSize(r))
+	defer s.loadProgress.finish()
+	h := sha256.New()
+	r = io.TeeReader(&progressReader{r: r, p: &s.loadProgress}, h)
+	start := time.Now()
+	saved, sd, r, err := readStateHeader(r)
+	if err == nil {
+		s.withProfileLabels("load", func() {
+			err = s.loadBaseAndParams(ctx, r, params, saved, sd)
+		})
+	}
+	if err != nil {
+		if prev == PhaseInitializing {
+			prev = PhaseFailed
+		}
+		s.readiness.set(prev)
 		return err
 	}
+	if version != "" {
+		s.modelVersion = version
+	}
+	s.modelFingerprint = hex.EncodeToString(h.Sum(nil))
+	s.setUpSlowCallLog(ctx)
+	s.logSlowCall("load", nil, time.Now().Sub(start), nil)
+	if s.params.CompileMethod != "" {
+		s.readiness.set(PhaseInitializing)
+		s.compileModel(ctx, s.base)
+	}
+	s.warmUp(ctx, s.base)
+	s.predictCache.invalidate()
+	s.scheduleRetraining(ctx)
+	s.scheduleEvaluation(ctx)
+	s.failures.reset()
+	s.readiness.set(PhaseServing)
+	s.hooks.emit(Event{Type: EventModelLoaded})
+	return nil
+}
 
-	// TODO: remove MLParams specific parameters from params
-
-	switch formatVersion {
-	case 1:
-		return s.loadMLParamsAndDataV1(ctx, r, params)
-	default:
-		return fmt.Errorf("unsupported format version of State container: %v", formatVersion)
+// readStateHeader reads the format version, MLParams, and stateData written
+// before the Python model. A state saved in an older format version is
+// migrated to the current one. The returned reader has the Python model.
+func readStateHeader(r io.Reader) (*MLParams, *stateData, io.Reader, error) {
+	var formatVersion uint8
+	if err := binary.Read(r, binary.LittleEndian, &formatVersion); err != nil {
+		return nil, nil, nil, err
+	}
+	if formatVersion != pyMLStateFormatVersion {
+		var err error
+		if r, err = migrateHeader(r, formatVersion); err != nil {
+			return nil, nil, nil, err
+		}
 	}
+	saved, sd, err := readEnvelope(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return saved, sd, r, nil
 }
 
-func (s *State) loadMLParamsAndDataV1(ctx *core.Context, r io.Reader, params data.Map) error {
+// readMsgpackSection reads data written by writeMsgpackSection into v. name
+// is used in error messages.
+func readMsgpackSection(r io.Reader, v interface{}, name string) error {
 	var dataSize uint32
 	if err := binary.Read(r, binary.LittleEndian, &dataSize); err != nil {
 		return err
 	}
 	if dataSize == 0 {
-		return errors.New("size of MLParams must be greater than 0")
+		return fmt.Errorf("size of %v must be greater than 0", name)
 	}
 
-	// Read MLParams from reader
+	// Read the data from reader
 	buf := make([]byte, dataSize)
-	n, err := r.Read(buf)
-	if err != nil {
-		return err
-	}
-	if n != int(dataSize) {
-		return errors.New("read size is different from the size of MLParams")
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return fmt.Errorf("cannot read %v: %v", name, err)
 	}
 
-	// Desirialize MLParams
-	var saved MLParams
+	// Desirialize the data
 	msgpackHandle := &codec.MsgpackHandle{}
 	dec := codec.NewDecoderBytes(buf, msgpackHandle)
-	if err := dec.Decode(&saved); err != nil {
+	return dec.Decode(v)
+}
+
+func (s *State) loadBaseAndParams(ctx *core.Context, r io.Reader, params data.Map,
+	saved *MLParams, sd *stateData) error {
+	if err := setUpPythonEnv(saved); err != nil {
 		return err
 	}
+	limit := saved.MaxModelBytes
+	if s.base != nil { // the quota of the running state is applied
+		limit = s.params.MaxModelBytes
+	}
+	r = &quotaReader{r: r, limit: limit}
+	var checkpoint *bytes.Buffer
+	if saved.Standby {
+		checkpoint = bytes.NewBuffer(nil)
+		r = io.TeeReader(r, checkpoint)
+	}
 
+	if s.base != nil && (s.params.CanaryData != "" ||
+		(saved.Isolation == "process") != (s.params.Isolation == "process")) {
+		// A new instance is created when the backend changes.
+		if err := s.loadWithCanary(ctx, r, params, saved, sd); err != nil {
+			return err
+		}
+		s.updateStandby(ctx, checkpoint)
+		return nil
+	}
+
+	// Params are set up before the model is loaded so that the state doesn't
+	// serve the new model with the old params when they're invalid.
+	cand, err := newLoadCandidate(nil, saved, sd)
+	if err != nil {
+		return err
+	}
 	if s.base == nil { // loading for the first time
-		s.base, err = pystate.LoadBase(ctx, r, params)
+		b, err := loadBackend(ctx, r, saved, params)
 		if err != nil {
 			return err
 		}
+		s.base = b
+	} else if err := s.base.Load(ctx, r, params); err != nil {
+		return err
+	}
+	if err := s.installCandidate(cand); err != nil {
+		return err
+	}
+	s.updateStandby(ctx, checkpoint)
+	return nil
+}
 
-	} else {
-		if err := s.base.Load(ctx, r, params); err != nil {
-			return err
+// updateStandby applies standby of the loaded params after the loaded model
+// has been swapped in. The standby instance is terminated when it's
+// disabled, and it's refreshed with the checkpoint of the model otherwise.
+func (s *State) updateStandby(ctx *core.Context, checkpoint *bytes.Buffer) {
+	if !s.params.Standby {
+		s.standby.terminate(ctx)
+		s.standby = nil
+		return
+	}
+	if s.standby == nil {
+		s.standby = &standby{}
+	}
+	s.standby.refresh(ctx, checkpoint, &s.params)
+}
+
+// newLoadCandidate returns a State having the instance b, which can be nil,
+// and components built from params and state data of a loaded model. It's
+// installed to the state by installCandidate.
+func newLoadCandidate(b Backend, saved *MLParams, sd *stateData) (*State, error) {
+	cand := &State{
+		base:         b,
+		params:       *saved,
+		baseParams:   sd.Base,
+		modelVersion: sd.ModelVersion,
+	}
+	var err error
+	if cand.createParams, err = sd.createParams(); err != nil {
+		return nil, err
+	}
+	c, err := newComponents(saved)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.restore(sd); err != nil {
+		return nil, err
+	}
+	cand.components = *c
+	return cand, nil
+}
+
+// installCandidate installs components, params, and metadata of the loaded
+// model of cand. Predictions of the previous model are discarded.
+func (s *State) installCandidate(cand *State) error {
+	if err := s.installComponents(&cand.components, &cand.params); err != nil {
+		return err
+	}
+	s.predictions.reset()
+	s.baseParams = cand.baseParams
+	s.createParams = cand.createParams
+	s.modelVersion = cand.modelVersion
+	return nil
+}
+
+// loadWithCanary loads the model as a new instance and swaps it in only when
+// it passes the canary validation. The current model is kept otherwise.
+func (s *State) loadWithCanary(ctx *core.Context, r io.Reader, params data.Map,
+	saved *MLParams, sd *stateData) error {
+	b, err := loadBackend(ctx, r, saved, params)
+	if err != nil {
+		return err
+	}
+	cand, err := newLoadCandidate(b, saved, sd)
+	if err == nil {
+		err = s.validateCanary(ctx, cand)
+	}
+	if err == nil {
+		err = s.installCandidate(cand)
+	}
+	if err != nil {
+		if err := b.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Warn("cannot terminate the refused instance of pymlstate")
 		}
+		return err
+	}
+
+	old := s.base
+	s.base = b
+	if err := old.Terminate(ctx); err != nil {
+		ctx.ErrLog(err).Warn("cannot terminate the old instance of pymlstate")
 	}
-	s.params = saved
 	return nil
 }
 
@@ -253,12 +2017,16 @@ func (s *State) loadMLParamsAndDataV1(ctx *core.Context, r io.Reader, params dat
 // The return value of this function depends on the implementation of Python
 // UDS.
 func Fit(ctx *core.Context, stateName string, bucket []data.Value) (data.Value, error) {
-	s, err := lookupState(ctx, stateName)
+	s, err := lookupAuthorizedState(ctx, stateName, ActionTrain)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.Fit(ctx, bucket)
+	res, err := s.Fit(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return res.Raw, nil
 }
 
 // Predict applies the model to the given data and returns estimated values.
@@ -274,11 +2042,18 @@ func Predict(ctx *core.Context, stateName string, dt data.Value) (data.Value, er
 
 // Flush pymlstate bucket. A return value is always nil.
 func Flush(ctx *core.Context, stateName string) (data.Value, error) {
-	s, err := lookupState(ctx, stateName)
+	s, err := lookupAuthorizedState(ctx, stateName, ActionTrain)
 	if err != nil {
 		return nil, err
 	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
 	s.bucket = s.bucket[:0]
+	s.bucketBytes = 0
+	s.bucketTimes = s.bucketTimes[:0]
+	s.keyedBuckets.clear()
+	s.channels.clear()
+	s.experiences = nil
 	return nil, nil
 }
 
@@ -289,8 +2064,21 @@ func lookupState(ctx *core.Context, stateName string) (*State, error) {
 	}
 
 	if s, ok := st.(*State); ok {
+		s.setName(stateName)
 		return s, nil
 	}
 
 	return nil, fmt.Errorf("state '%v' isn't a State", stateName)
 }
+
+// lookupAuthorizedState returns the state when the action is authorized.
+func lookupAuthorizedState(ctx *core.Context, stateName string, action Action) (*State, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, action); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
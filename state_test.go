@@ -1,11 +1,13 @@
 package pymlstate
 
 import (
+	"bytes"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/sensorbee/py.v0/pystate"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"testing"
+	"time"
 )
 
 func TestPyMLStateFitAndPredict(t *testing.T) {
@@ -125,3 +127,169 @@ func TestPyMLStateFlush(t *testing.T) {
 		})
 	})
 }
+
+func TestSaveDuringFit(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a state training a batch", t, func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				close(started)
+				<-release
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: b}
+		fitDone := make(chan struct{})
+		go func() {
+			s.Fit(ctx, []data.Value{data.Map{"x": data.Int(1)}})
+			close(fitDone)
+		}()
+		<-started
+
+		Convey("When it's saved", func() {
+			saved := make(chan error, 1)
+			go func() {
+				saved <- s.Save(ctx, bytes.NewBuffer(nil), data.Map{})
+			}()
+
+			Convey("Then the model should be saved after the batch is trained", func() {
+				time.Sleep(50 * time.Millisecond)
+				So(len(saved), ShouldEqual, 0)
+				close(release)
+				<-fitDone
+				So(<-saved, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state training a batch of records having idempotency keys", t, func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				close(started)
+				<-release
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1, IdempotencyKeyPath: "id", IdempotencyKeys: 10}}
+		So(s.setUpParams(), ShouldBeNil)
+		rec := data.Map{"id": data.String("a")}
+		So(s.idempotency.filter(rec), ShouldNotBeNil)
+		fitDone := make(chan struct{})
+		go func() {
+			s.fitWith(ctx, "fit", []data.Value{rec})
+			close(fitDone)
+		}()
+		<-started
+
+		Convey("When it's saved", func() {
+			buf := bytes.NewBuffer(nil)
+			saved := make(chan error, 1)
+			go func() {
+				saved <- s.Save(ctx, buf, data.Map{})
+			}()
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			<-fitDone
+			So(<-saved, ShouldBeNil)
+
+			Convey("Then the checkpoint should have keys of the batch", func() {
+				_, sd, _, err := readStateHeader(buf)
+				So(err, ShouldBeNil)
+				So(sd.TrainedKeys, ShouldResemble, []string{"a"})
+			})
+		})
+	})
+}
+
+func TestVersionedPredictions(t *testing.T) {
+	Convey("Given a state returning versioned predictions", t, func() {
+		ctx := core.NewContext(&core.ContextConfig{})
+		s := &State{base: &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.String("label"), nil
+			},
+		}, params: MLParams{BatchSize: 1, VersionedPredictions: true},
+			modelVersion: "model:3", modelFingerprint: "abc"}
+		So(s.setUpParams(), ShouldBeNil)
+		So(ctx.SharedStates.Add("versioned", "pymlstate", s), ShouldBeNil)
+
+		Convey("When the data is predicted by the UDF", func() {
+			res, err := Predict(ctx, "versioned", data.Map{"x": data.Int(1)})
+
+			Convey("Then the prediction should be wrapped with the model", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{
+					"result":        data.String("label"),
+					"model_version": data.String("model:3"),
+					"state":         data.String("versioned"),
+					"fingerprint":   data.String("abc"),
+				})
+			})
+		})
+
+		Convey("When clusters are assigned", func() {
+			res, err := s.AssignCluster(ctx, data.Map{"x": data.Int(1)})
+
+			Convey("Then the prediction shouldn't be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.String("label"))
+			})
+		})
+	})
+}
+
+func TestLoadInvalidParams(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a running state", t, func() {
+		b := &fakeBackend{}
+		s := &State{base: b, params: MLParams{BatchSize: 1}, modelVersion: "v1"}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When a model saved with invalid params is loaded", func() {
+			buf := bytes.NewBuffer(nil)
+			invalid := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1, FallbackValue: []byte{0xc1}}}
+			So(invalid.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			err := s.Load(ctx, buf, data.Map{})
+
+			Convey("Then it should fail without loading the model", func() {
+				So(err, ShouldNotBeNil)
+				So(b.loaded, ShouldBeFalse)
+				So(s.params.FallbackValue, ShouldBeEmpty)
+				So(s.modelVersion, ShouldEqual, "v1")
+			})
+		})
+	})
+}
+
+func TestLoadVersion(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a running state", t, func() {
+		s := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1}, modelVersion: "v1"}
+		So(s.setUpParams(), ShouldBeNil)
+		versions := []string{}
+		s.OnEvent(func(e Event) {
+			if e.Type == EventModelLoaded {
+				versions = append(versions, s.modelVersion)
+			}
+		})
+
+		Convey("When a model is loaded with its version", func() {
+			buf := bytes.NewBuffer(nil)
+			saved := &State{base: &fakeBackend{}, params: MLParams{BatchSize: 1}, modelVersion: "v2"}
+			So(saved.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			So(s.loadVersion(ctx, buf, data.Map{}, "mnist:3"), ShouldBeNil)
+
+			Convey("Then the version should be set before the model serves", func() {
+				So(versions, ShouldResemble, []string{"mnist:3"})
+				So(s.modelVersion, ShouldEqual, "mnist:3")
+			})
+		})
+	})
+}
@@ -0,0 +1,233 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"time"
+)
+
+// Status returns the status of the state.
+func (s *State) Status() data.Map {
+	// The state is locked while a model is being loaded.
+	if s.loadProgress.isActive() {
+		return data.Map{
+			"phase":         data.String(s.readiness.get()),
+			"ready":         data.Bool(false),
+			"load_progress": s.loadProgress.toMap(),
+		}
+	}
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+
+	tags := make(data.Array, len(s.params.Tags))
+	for i, t := range s.params.Tags {
+		tags[i] = data.String(t)
+	}
+	phase := s.phase()
+	st := data.Map{
+		"terminated":       data.Bool(s.base.CheckTermination() != nil),
+		"phase":            data.String(phase),
+		"ready":            data.Bool(phase == PhaseServing),
+		"description":      data.String(s.params.Description),
+		"tags":             tags,
+		"model_version":    data.String(s.modelVersion),
+		"batch_train_size": data.Int(s.params.BatchSize),
+		"buffered_records": data.Int(len(s.bucket)),
+	}
+	if s.params.FailureBudget > 0 {
+		st["consecutive_failures"] = data.Int(s.failures.count())
+	}
+	if s.readOnly {
+		st["read_only"] = data.Bool(true)
+	}
+	if s.modelFingerprint != "" {
+		st["model_fingerprint"] = data.String(s.modelFingerprint)
+	}
+	if s.params.BucketTTL > 0 {
+		st["expired_records"] = data.Int(s.expiredRecords)
+	}
+	if s.keyedBuckets != nil {
+		keys, n := s.keyedBuckets.stats()
+		st["bucket_keys"] = data.Int(keys)
+		st["buffered_records"] = data.Int(len(s.bucket) + n)
+	}
+	if len(s.experiences) > 0 {
+		st["buffered_experiences"] = data.Int(len(s.experiences))
+	}
+	if s.channels != nil {
+		st["channel_records"] = s.channels.stats()
+	}
+	if s.params.MaxBucketBytes > 0 {
+		st["buffered_bytes"] = data.Int(s.bucketBytes)
+		st["dropped_records"] = data.Int(s.bucketDrops)
+	}
+	if s.warnings != nil {
+		st["warnings"] = s.warnings.counts()
+	}
+	if s.replay != nil {
+		st["replay_records"] = data.Int(s.replay.len())
+	}
+	if s.validation != nil {
+		st["validation_records"] = s.validation.counts()
+	}
+	if s.references != nil {
+		st["reference_rows"] = data.Int(s.references.len())
+	}
+	if s.windows != nil {
+		st["window_keys"] = data.Int(s.windows.len())
+	}
+	if s.embeddingIndex != nil {
+		st["indexed_embeddings"] = data.Int(s.embeddingIndex.len())
+	}
+	if s.fallback.enabled() {
+		st["fallbacks"] = data.Int(s.fallback.count())
+	}
+	if s.breaker != nil {
+		st["circuit_breaker"] = s.breaker.toMap()
+	}
+	if s.asyncPredictions != nil {
+		st["async_predictions"] = s.asyncPredictions.toMap()
+	}
+	if s.decisions != nil {
+		st["decisions"] = s.decisions.toMap()
+	}
+	if s.clusters != nil {
+		if m := s.clusters.toMap(); m != nil {
+			st["clusters"] = m
+		}
+	}
+	if m := s.predictions.toMap(); m != nil {
+		st["predictions"] = m
+	}
+	if s.skew != nil {
+		if m := s.skew.toMap(); m != nil {
+			st["skew"] = m
+		}
+	}
+	if s.predictionInputs != nil {
+		st["correctable_predictions"] = data.Int(s.predictionInputs.len())
+	}
+	if s.hardExamples != nil {
+		st["hard_examples"] = data.Int(s.hardExamples.len())
+	}
+	if s.writeLimiter != nil {
+		st["rejected_writes"] = data.Int(s.writeLimiter.rejectedCount())
+	}
+	if s.predictLimiter != nil {
+		st["rejected_predicts"] = data.Int(s.predictLimiter.rejectedCount())
+	}
+	st["python_bytes"] = s.transfer.toMap()
+	if s.params.ThreadLimit > 0 {
+		st["thread_limit"] = data.Int(s.params.ThreadLimit)
+	}
+	if m := s.interpreter.get(s.base); m != nil {
+		st["interpreter"] = m
+	}
+	st["metrics"] = s.metrics.toMap(time.Now())
+	st["wait_seconds"] = s.waits.toMap()
+	if s.predictCache != nil {
+		hits, misses, n := s.predictCache.stats()
+		st["predict_cache_hits"] = data.Int(hits)
+		st["predict_cache_misses"] = data.Int(misses)
+		st["predict_cache_entries"] = data.Int(n)
+	}
+	if s.scheduler != nil {
+		p, t := s.scheduler.queueLengths()
+		st["python_call_queue"] = data.Map{
+			"predict": data.Int(p),
+			"train":   data.Int(t),
+		}
+	}
+	if currentFeatureAllowlist() != nil {
+		st["feature_allowlist"] = data.Bool(true)
+	}
+	if s.params.RandomSeed != nil {
+		st["random_seed"] = data.Int(*s.params.RandomSeed)
+	}
+	if s.alerter != nil {
+		st["alerts"] = s.alerter.status()
+	}
+	if s.privacy != nil {
+		st["privacy_budget"] = s.privacy.status()
+	}
+	if s.idempotency != nil {
+		st["idempotency_keys"] = data.Int(s.idempotency.len())
+	}
+	if s.wal != nil {
+		st["wal_records"] = data.Int(s.wal.len())
+	}
+	if m := s.compiled.toMap(); m != nil {
+		st["compile"] = m
+	}
+	if p := s.saveProgress.toMap(); p != nil {
+		st["save_progress"] = p
+	}
+	if p := s.loadProgress.toMap(); p != nil {
+		st["load_progress"] = p
+	}
+	if s.standby != nil {
+		st["standby"] = s.standby.status()
+	}
+	if s.evalHistory != nil {
+		st["evaluation_history"] = s.evalHistory.toArray()
+	}
+	if s.shadow != nil {
+		st["shadow_model_version"] = data.String(s.shadowVersion)
+		st["shadow_evaluation_history"] = s.shadowHistory.toArray()
+	}
+	if s.baseParams != nil {
+		st["module_name"] = data.String(s.baseParams.ModuleName)
+		st["class_name"] = data.String(s.baseParams.ClassName)
+	}
+	return st
+}
+
+// Status returns the status of the state.
+func Status(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupAuthorizedState(ctx, stateName, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+	return s.Status(), nil
+}
+
+// ListStates returns statuses of all pymlstate states sorted by their names.
+// Each status has the name of the state at "name" key.
+func ListStates(ctx *core.Context) (data.Value, error) {
+	return listStates(ctx, func(name string) (data.Map, bool) {
+		return nil, true
+	})
+}
+
+// listStates returns statuses of pymlstate states accepted by filter. filter
+// also returns fields added to the status.
+func listStates(ctx *core.Context, filter func(name string) (data.Map, bool)) (data.Value, error) {
+	states, err := ctx.SharedStates.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(states))
+	extra := map[string]data.Map{}
+	for name, st := range states {
+		if _, ok := st.(*State); !ok {
+			continue
+		}
+		if m, ok := filter(name); ok {
+			names = append(names, name)
+			extra[name] = m
+		}
+	}
+	sort.Strings(names)
+
+	res := make(data.Array, 0, len(names))
+	for _, name := range names {
+		st := states[name].(*State).Status()
+		for k, v := range extra[name] {
+			st[k] = v
+		}
+		st["name"] = data.String(name)
+		res = append(res, st)
+	}
+	return res, nil
+}
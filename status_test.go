@@ -0,0 +1,75 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	Convey("Given a pymlstate with tags and description", t, func() {
+		sc := StateCreator{}
+		params := data.Map{
+			"module_path": data.String("./"),
+			"module_name": data.String("_test_pymlstate"),
+			"class_name":  data.String("TestClass"),
+			"description": data.String("test model"),
+			"tags":        data.Array{data.String("team-a"), data.String("prod")},
+		}
+		s, err := sc.CreateState(ctx, params)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+		So(ctx.SharedStates.Add("test_pymlstate_status", "pymlstate", s), ShouldBeNil)
+		Reset(func() {
+			ctx.SharedStates.Remove("test_pymlstate_status")
+		})
+
+		Convey("When its status is retrieved", func() {
+			v, err := Status(ctx, "test_pymlstate_status")
+			So(err, ShouldBeNil)
+			st, err := data.AsMap(v)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have tags and description", func() {
+				So(st["description"], ShouldEqual, data.String("test model"))
+				So(st["tags"], ShouldResemble, data.Array{data.String("team-a"), data.String("prod")})
+				So(st["class_name"], ShouldEqual, data.String("TestClass"))
+				So(st["terminated"], ShouldEqual, data.Bool(false))
+			})
+		})
+
+		Convey("When states are listed", func() {
+			v, err := ListStates(ctx)
+			So(err, ShouldBeNil)
+			arr, err := data.AsArray(v)
+			So(err, ShouldBeNil)
+
+			Convey("Then the state should be listed with its name", func() {
+				So(len(arr), ShouldEqual, 1)
+				st, _ := data.AsMap(arr[0])
+				So(st["name"], ShouldEqual, data.String("test_pymlstate_status"))
+			})
+		})
+
+		Convey("When the state is saved and loaded", func() {
+			buf := bytes.NewBuffer(nil)
+			So(s.(*State).Save(ctx, buf, data.Map{}), ShouldBeNil)
+			s2, err := sc.LoadState(ctx, buf, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s2.Terminate(ctx)
+			})
+
+			Convey("Then tags and description should be loaded", func() {
+				st := s2.(*State).Status()
+				So(st["description"], ShouldEqual, data.String("test model"))
+				So(st["tags"], ShouldResemble, data.Array{data.String("team-a"), data.String("prod")})
+			})
+		})
+	})
+}
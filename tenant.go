@@ -0,0 +1,112 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"sync"
+)
+
+// TenantSeparator separates a tenant and a model in a tenant-scoped state
+// name. A tenant-scoped name such as "tenant/model" is registered as
+// "tenant__model" because SensorBee only accepts symbols as state names.
+const TenantSeparator = "__"
+
+var (
+	tenantDefaultsMutex sync.RWMutex
+	tenantDefaults      = map[string]data.Map{}
+)
+
+// TenantStateName returns the state name of the model of the tenant.
+func TenantStateName(tenant, model string) (string, error) {
+	if tenant == "" || model == "" {
+		return "", fmt.Errorf("tenant and model must not be empty")
+	}
+	if strings.Contains(tenant, TenantSeparator) {
+		return "", fmt.Errorf("tenant '%v' must not contain '%v'", tenant, TenantSeparator)
+	}
+	return tenant + TenantSeparator + model, nil
+}
+
+// SplitTenantStateName returns the tenant and the model of a tenant-scoped
+// state name. ok is false when the name isn't tenant-scoped.
+func SplitTenantStateName(name string) (tenant, model string, ok bool) {
+	i := strings.Index(name, TenantSeparator)
+	if i <= 0 || i+len(TenantSeparator) == len(name) {
+		return "", "", false
+	}
+	return name[:i], name[i+len(TenantSeparator):], true
+}
+
+// SetTenantDefaults sets default parameters of states created by
+// CreateTenantState for the tenant. Parameters are the same as those of
+// CREATE STATE. Defaults are removed when params is nil.
+func SetTenantDefaults(tenant string, params data.Map) {
+	tenantDefaultsMutex.Lock()
+	defer tenantDefaultsMutex.Unlock()
+	if params == nil {
+		delete(tenantDefaults, tenant)
+		return
+	}
+	tenantDefaults[tenant] = params.Copy()
+}
+
+// tenantParams returns params merged with defaults of the tenant. params
+// take precedence.
+func tenantParams(tenant string, params data.Map) data.Map {
+	tenantDefaultsMutex.RLock()
+	defer tenantDefaultsMutex.RUnlock()
+	res := tenantDefaults[tenant].Copy()
+	if res == nil {
+		res = data.Map{}
+	}
+	for k, v := range params {
+		res[k] = v
+	}
+	return res
+}
+
+// CreateTenantState creates a state of the model of the tenant and registers
+// it to the context. params are merged with defaults set by
+// SetTenantDefaults.
+func CreateTenantState(ctx *core.Context, tenant, model string, params data.Map) (*State, error) {
+	name, err := TenantStateName(tenant, model)
+	if err != nil {
+		return nil, err
+	}
+	st, err := (&StateCreator{}).CreateState(ctx, tenantParams(tenant, params))
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.SharedStates.Add(name, "pymlstate", st); err != nil {
+		st.Terminate(ctx)
+		return nil, err
+	}
+	st.(*State).setName(name)
+	return st.(*State), nil
+}
+
+// LookupTenantState returns the state of the model of the tenant.
+func LookupTenantState(ctx *core.Context, tenant, model string) (*State, error) {
+	name, err := TenantStateName(tenant, model)
+	if err != nil {
+		return nil, err
+	}
+	return lookupState(ctx, name)
+}
+
+// ListTenantStates returns statuses of pymlstate states of the tenant sorted
+// by their names. Each status has "name", "tenant", and "model" keys.
+func ListTenantStates(ctx *core.Context, tenant string) (data.Value, error) {
+	return listStates(ctx, func(name string) (data.Map, bool) {
+		t, m, ok := SplitTenantStateName(name)
+		if !ok || t != tenant {
+			return nil, false
+		}
+		return data.Map{
+			"tenant": data.String(t),
+			"model":  data.String(m),
+		}, true
+	})
+}
@@ -0,0 +1,72 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestTenantStateName(t *testing.T) {
+	Convey("Given a tenant and a model", t, func() {
+		Convey("When a tenant-scoped state name is created", func() {
+			name, err := TenantStateName("team_a", "mnist")
+			So(err, ShouldBeNil)
+
+			Convey("Then it should be split into the tenant and the model", func() {
+				So(name, ShouldEqual, "team_a__mnist")
+				tenant, model, ok := SplitTenantStateName(name)
+				So(ok, ShouldBeTrue)
+				So(tenant, ShouldEqual, "team_a")
+				So(model, ShouldEqual, "mnist")
+			})
+		})
+
+		Convey("When the tenant contains the separator", func() {
+			_, err := TenantStateName("team__a", "mnist")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given names which aren't tenant-scoped", t, func() {
+		Convey("Then they shouldn't be split", func() {
+			for _, name := range []string{"mnist", "__mnist", "team_a__"} {
+				_, _, ok := SplitTenantStateName(name)
+				So(ok, ShouldBeFalse)
+			}
+		})
+	})
+}
+
+func TestTenantParams(t *testing.T) {
+	Convey("Given defaults of a tenant", t, func() {
+		SetTenantDefaults("team_a", data.Map{
+			"batch_train_size": data.Int(10),
+			"quality_report":   data.Bool(true),
+		})
+		Reset(func() {
+			SetTenantDefaults("team_a", nil)
+		})
+
+		Convey("When parameters are merged with the defaults", func() {
+			p := tenantParams("team_a", data.Map{"batch_train_size": data.Int(20)})
+
+			Convey("Then given parameters should take precedence", func() {
+				So(p, ShouldResemble, data.Map{
+					"batch_train_size": data.Int(20),
+					"quality_report":   data.Bool(true),
+				})
+			})
+		})
+
+		Convey("When parameters of another tenant are merged", func() {
+			p := tenantParams("team_b", data.Map{"batch_train_size": data.Int(20)})
+
+			Convey("Then the defaults shouldn't be applied", func() {
+				So(p, ShouldResemble, data.Map{"batch_train_size": data.Int(20)})
+			})
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// threadLimitEnvVars are environment variables limiting threads of native
+// libraries used by numpy and others, which create as many threads as CPU
+// cores by default.
+var threadLimitEnvVars = []string{
+	"OMP_NUM_THREADS",
+	"MKL_NUM_THREADS",
+	"OPENBLAS_NUM_THREADS",
+	"BLIS_NUM_THREADS",
+	"VECLIB_MAXIMUM_THREADS",
+	"NUMEXPR_NUM_THREADS",
+}
+
+// threadLimitsExpr returns a Python expression evaluated to the effective
+// thread limits of the interpreter: the environment variables and thread
+// pools of native libraries reported by threadpoolctl when it's installed.
+func threadLimitsExpr() string {
+	quoted := make([]string, len(threadLimitEnvVars))
+	for i, k := range threadLimitEnvVars {
+		quoted[i] = strconv.Quote(k)
+	}
+	return fmt.Sprintf("{'env': {k: __import__('os').environ.get(k) for k in [%v]}, "+
+		"'pools': [{'api': i.get('internal_api'), 'num_threads': i.get('num_threads')} for i in "+
+		"(__import__('threadpoolctl').threadpool_info() if %v('threadpoolctl') else [])]}",
+		strings.Join(quoted, ", "), moduleFoundExpr)
+}
+
+// threadLimitEnv returns the environment of the Python process limiting
+// threads by thread_limit. Limits set by the environment of SensorBee are
+// overridden.
+func threadLimitEnv(p *MLParams) []string {
+	env := os.Environ()
+	if p.ThreadLimit <= 0 {
+		return env
+	}
+	for _, k := range threadLimitEnvVars {
+		env = append(env, fmt.Sprintf("%v=%v", k, p.ThreadLimit))
+	}
+	return env
+}
+
+// withThreadLimitParam returns a copy of params with thread_limit at the key
+// of thread_limit_param, which is passed to the constructor of the model.
+func withThreadLimitParam(p *MLParams, params data.Map) data.Map {
+	if p.ThreadLimit <= 0 || p.ThreadLimitParam == "" {
+		return params
+	}
+	res := make(data.Map, len(params)+1)
+	for k, v := range params {
+		res[k] = v
+	}
+	res[p.ThreadLimitParam] = data.Int(p.ThreadLimit)
+	return res
+}
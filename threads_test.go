@@ -0,0 +1,112 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const threadsTestModule = `
+class Model(object):
+    @classmethod
+    def create(cls, **params):
+        m = cls()
+        m.params = params
+        return m
+
+    def get_params(self):
+        return self.params
+`
+
+func TestThreadLimit(t *testing.T) {
+	Convey("Given a thread limit", t, func() {
+		p := &MLParams{ThreadLimit: 2}
+
+		Convey("When the environment of the process is built", func() {
+			env := threadLimitEnv(p)
+
+			Convey("Then it should limit threads of native libraries", func() {
+				So(env, ShouldContain, "OMP_NUM_THREADS=2")
+				So(env, ShouldContain, "MKL_NUM_THREADS=2")
+				So(env, ShouldContain, "OPENBLAS_NUM_THREADS=2")
+			})
+		})
+
+		Convey("When it's passed to the constructor", func() {
+			p.ThreadLimitParam = "n_jobs"
+			params := data.Map{"a": data.Int(1)}
+			res := withThreadLimitParam(p, params)
+
+			Convey("Then it should be added to a copy of parameters", func() {
+				So(res, ShouldResemble, data.Map{"a": data.Int(1), "n_jobs": data.Int(2)})
+				So(params, ShouldResemble, data.Map{"a": data.Int(1)})
+			})
+		})
+
+		Convey("When thread_limit_param isn't set", func() {
+			params := data.Map{"a": data.Int(1)}
+
+			Convey("Then parameters shouldn't be changed", func() {
+				So(withThreadLimitParam(p, params), ShouldResemble, params)
+			})
+		})
+	})
+
+	Convey("Given no thread limit", t, func() {
+		Convey("When the environment of the process is built", func() {
+			env := threadLimitEnv(&MLParams{})
+
+			Convey("Then it should be the environment of this process", func() {
+				So(env, ShouldResemble, os.Environ())
+			})
+		})
+	})
+
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 isn't available")
+	}
+	dir, err := ioutil.TempDir("", "pymlstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "threads_test_model.py"), []byte(threadsTestModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bp := &pystate.BaseParams{ModulePath: dir, ModuleName: "threads_test_model", ClassName: "Model"}
+
+	Convey("Given a model running in a process with a thread limit", t, func() {
+		p := &MLParams{Isolation: "process", PythonCommand: "python3", ThreadLimit: 3, ThreadLimitParam: "n_jobs"}
+		b, err := newBackend(bp, p, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			b.Terminate(nil)
+		})
+
+		Convey("When its effective limits are requested", func() {
+			m, err := interpreterUsage(b)
+			So(err, ShouldBeNil)
+
+			Convey("Then the environment of the process should have the limit", func() {
+				env := m["thread_limits"].(data.Map)["env"].(data.Map)
+				for _, k := range threadLimitEnvVars {
+					So(env[k], ShouldEqual, data.String("3"))
+				}
+			})
+		})
+
+		Convey("When parameters of the constructor are requested", func() {
+			res, err := b.Call("get_params")
+
+			Convey("Then they should have the limit", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{"n_jobs": data.Int(3)})
+			})
+		})
+	})
+}
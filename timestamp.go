@@ -0,0 +1,66 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+// timestampEncoder converts all data.Timestamp values in a record to the
+// representation given by timestamp_encoding.
+type timestampEncoder struct {
+	encode func(t time.Time) data.Value
+}
+
+var _ preprocessor = &timestampEncoder{}
+
+func newTimestampEncoder(encoding string) (*timestampEncoder, error) {
+	e := &timestampEncoder{}
+	switch encoding {
+	case "rfc3339":
+		e.encode = func(t time.Time) data.Value {
+			return data.String(t.Format(time.RFC3339Nano))
+		}
+	case "unix_seconds":
+		e.encode = func(t time.Time) data.Value {
+			return data.Float(float64(t.UnixNano()) / float64(time.Second))
+		}
+	case "unix_millis":
+		e.encode = func(t time.Time) data.Value {
+			return data.Int(t.UnixNano() / int64(time.Millisecond))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported timestamp_encoding: %v", encoding)
+	}
+	return e, nil
+}
+
+func (e *timestampEncoder) process(rec data.Map, training bool, rep *qualityReport) error {
+	for k, v := range rec {
+		rec[k] = e.encodeValue(v)
+	}
+	return nil
+}
+
+func (e *timestampEncoder) encodeValue(v data.Value) data.Value {
+	switch v.Type() {
+	case data.TypeTimestamp:
+		t, _ := data.AsTimestamp(v)
+		return e.encode(t)
+
+	case data.TypeArray:
+		arr, _ := data.AsArray(v)
+		for i, x := range arr {
+			arr[i] = e.encodeValue(x)
+		}
+		return arr
+
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		for k, x := range m {
+			m[k] = e.encodeValue(x)
+		}
+		return m
+	}
+	return v
+}
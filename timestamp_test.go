@@ -0,0 +1,60 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestTimestampEncoder(t *testing.T) {
+	ts := time.Date(2016, 5, 1, 12, 0, 0, 500*int(time.Millisecond), time.UTC)
+	newRecord := func() data.Map {
+		return data.Map{
+			"time": data.Timestamp(ts),
+			"events": data.Array{
+				data.Map{"time": data.Timestamp(ts)},
+			},
+			"value": data.Int(1),
+		}
+	}
+
+	Convey("Given timestamp encoders", t, func() {
+		cases := []struct {
+			encoding string
+			expected data.Value
+		}{
+			{"rfc3339", data.String("2016-05-01T12:00:00.5Z")},
+			{"unix_seconds", data.Float(1462104000.5)},
+			{"unix_millis", data.Int(1462104000500)},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey("When a record is processed with "+c.encoding, func() {
+				e, err := newTimestampEncoder(c.encoding)
+				So(err, ShouldBeNil)
+				rec := newRecord()
+				So(e.process(rec, true, nil), ShouldBeNil)
+
+				Convey("Then all timestamps should be encoded", func() {
+					So(rec, ShouldResemble, data.Map{
+						"time": c.expected,
+						"events": data.Array{
+							data.Map{"time": c.expected},
+						},
+						"value": data.Int(1),
+					})
+				})
+			})
+		}
+
+		Convey("When an unsupported encoding is given", func() {
+			_, err := newTimestampEncoder("iso8601")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Tokenizer splits a text into tokens. A state uses the tokenizer
+// registered with the name given by the tokenizer parameter.
+type Tokenizer interface {
+	// Tokenize returns tokens of the text. It must be safe for concurrent
+	// use.
+	Tokenize(text string) []string
+}
+
+// TokenizerFunc is a function used as a Tokenizer.
+type TokenizerFunc func(text string) []string
+
+// Tokenize calls f(text).
+func (f TokenizerFunc) Tokenize(text string) []string {
+	return f(text)
+}
+
+var (
+	tokenizersMutex sync.RWMutex
+	tokenizers      = map[string]Tokenizer{
+		"whitespace": TokenizerFunc(strings.Fields),
+	}
+)
+
+// RegisterTokenizer registers a tokenizer with a name so that states can use
+// it by the tokenizer parameter. "whitespace" and "regex" are built in.
+func RegisterTokenizer(name string, t Tokenizer) error {
+	tokenizersMutex.Lock()
+	defer tokenizersMutex.Unlock()
+	if _, ok := tokenizers[name]; ok || name == "regex" {
+		return fmt.Errorf("tokenizer '%v' is already registered", name)
+	}
+	tokenizers[name] = t
+	return nil
+}
+
+// lookupTokenizer returns the tokenizer of the parameters. "regex" returns
+// substrings matching tokenize_pattern.
+func lookupTokenizer(p *MLParams) (Tokenizer, error) {
+	if p.Tokenizer == "regex" {
+		re, err := regexp.Compile(p.TokenizePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tokenize_pattern '%v': %v", p.TokenizePattern, err)
+		}
+		return TokenizerFunc(func(text string) []string {
+			return re.FindAllString(text, -1)
+		}), nil
+	}
+	tokenizersMutex.RLock()
+	defer tokenizersMutex.RUnlock()
+	t, ok := tokenizers[p.Tokenizer]
+	if !ok {
+		return nil, fmt.Errorf("tokenizer '%v' isn't registered", p.Tokenizer)
+	}
+	return t, nil
+}
+
+// tokenEncoder tokenizes texts and encodes tokens to arrays of integer IDs
+// by a vocabulary of tokens of each path, which is built in the same way as
+// vocabulary_paths.
+type tokenEncoder struct {
+	tokenizer Tokenizer
+	lowercase bool
+	vocab     *vocabulary
+}
+
+var _ preprocessor = &tokenEncoder{}
+
+func newTokenEncoder(p *MLParams) (*tokenEncoder, error) {
+	t, err := lookupTokenizer(p)
+	if err != nil {
+		return nil, err
+	}
+	v, err := newVocabulary(p.TokenizePaths, p.TokenVocabularyMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tokenize_paths: %v", err)
+	}
+	return &tokenEncoder{
+		tokenizer: t,
+		lowercase: p.TokenizeLowercase,
+		vocab:     v,
+	}, nil
+}
+
+func (e *tokenEncoder) process(rec data.Map, training bool, rep *qualityReport) error {
+	for i, p := range e.vocab.paths {
+		x, err := rec.Get(p)
+		if err != nil || x.Type() == data.TypeNull {
+			continue
+		}
+		text, err := data.AsString(x)
+		if err != nil {
+			rep.typeMismatch(e.vocab.names[i])
+			return fmt.Errorf("'%v' must be a string to be tokenized: %v", e.vocab.names[i], x.Type())
+		}
+		if e.lowercase {
+			text = strings.ToLower(text)
+		}
+
+		tokens := e.tokenizer.Tokenize(text)
+		ids := make(data.Array, len(tokens))
+		e.vocab.mu.Lock()
+		for j, t := range tokens {
+			ids[j] = data.Int(e.vocab.index(i, t, training))
+		}
+		e.vocab.mu.Unlock()
+		if err := rec.Set(p, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"testing"
+)
+
+func TestTokenEncoder(t *testing.T) {
+	Convey("Given a whitespace token encoder", t, func() {
+		e, err := newTokenEncoder(&MLParams{TokenizePaths: []string{"text"}, Tokenizer: "whitespace",
+			TokenizeLowercase: true})
+		So(err, ShouldBeNil)
+
+		encode := func(x data.Value, training bool) data.Value {
+			rec := data.Map{"text": x}
+			So(e.process(rec, training, nil), ShouldBeNil)
+			return rec["text"]
+		}
+
+		Convey("When a training text is processed", func() {
+			ids := encode(data.String("the Cat  the dog"), true)
+
+			Convey("Then it should be encoded to token IDs", func() {
+				So(ids, ShouldResemble, data.Array{data.Int(1), data.Int(2), data.Int(1), data.Int(3)})
+			})
+
+			Convey("Then unknown tokens should be out of vocabulary in prediction", func() {
+				So(encode(data.String("a dog"), false), ShouldResemble, data.Array{data.Int(oovIndex), data.Int(3)})
+			})
+
+			Convey("Then its vocabulary should be restored", func() {
+				e2, err := newTokenEncoder(&MLParams{TokenizePaths: []string{"text"}, Tokenizer: "whitespace"})
+				So(err, ShouldBeNil)
+				e2.vocab.restore(e.vocab.snapshot())
+				So(e2.vocab.snapshot(), ShouldResemble, e.vocab.snapshot())
+			})
+		})
+
+		Convey("When a non-string value is processed", func() {
+			err := e.process(data.Map{"text": data.Int(1)}, true, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a regex token encoder", t, func() {
+		e, err := newTokenEncoder(&MLParams{TokenizePaths: []string{"text"}, Tokenizer: "regex",
+			TokenizePattern: `[a-z]+`})
+		So(err, ShouldBeNil)
+
+		Convey("When a text is processed", func() {
+			rec := data.Map{"text": data.String("foo,bar;foo")}
+			So(e.process(rec, true, nil), ShouldBeNil)
+
+			Convey("Then substrings matching the pattern should be tokens", func() {
+				So(rec["text"], ShouldResemble, data.Array{data.Int(1), data.Int(2), data.Int(1)})
+			})
+		})
+	})
+
+	Convey("Given an invalid pattern", t, func() {
+		_, err := newTokenEncoder(&MLParams{TokenizePaths: []string{"text"}, Tokenizer: "regex",
+			TokenizePattern: `(`})
+
+		Convey("Then the encoder shouldn't be created", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRegisterTokenizer(t *testing.T) {
+	err := RegisterTokenizer("test_comma", TokenizerFunc(func(text string) []string {
+		return strings.Split(text, ",")
+	}))
+
+	Convey("Given a registered tokenizer", t, func() {
+		So(err, ShouldBeNil)
+
+		Convey("When it's looked up", func() {
+			tk, err := lookupTokenizer(&MLParams{Tokenizer: "test_comma"})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should tokenize texts", func() {
+				So(tk.Tokenize("a,b"), ShouldResemble, []string{"a", "b"})
+			})
+		})
+
+		Convey("When it's registered again", func() {
+			err := RegisterTokenizer("test_comma", TokenizerFunc(strings.Fields))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When built-in names are registered", func() {
+			Convey("Then it should fail", func() {
+				So(RegisterTokenizer("whitespace", TokenizerFunc(strings.Fields)), ShouldNotBeNil)
+				So(RegisterTokenizer("regex", TokenizerFunc(strings.Fields)), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an unknown tokenizer", t, func() {
+		_, err := lookupTokenizer(&MLParams{Tokenizer: "no_such_tokenizer"})
+
+		Convey("Then it shouldn't be found", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// callTrace is a Python call recorded by callTracer.
+type callTrace struct {
+	Time     time.Time
+	Method   string
+	Args     []data.Value
+	Result   data.Value
+	Err      error
+	Duration time.Duration
+}
+
+// callTracer keeps the latest size Python calls in a ring buffer.
+type callTracer struct {
+	size int
+
+	mu     sync.Mutex
+	traces []callTrace
+	next   int
+}
+
+func newCallTracer(size int) *callTracer {
+	return &callTracer{
+		size:   size,
+		traces: make([]callTrace, 0, size),
+	}
+}
+
+func (t *callTracer) add(c callTrace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.traces) < t.size {
+		t.traces = append(t.traces, c)
+		return
+	}
+	t.traces[t.next] = c
+	t.next = (t.next + 1) % t.size
+}
+
+// toArray returns traces from the oldest one.
+func (t *callTracer) toArray() data.Array {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := make(data.Array, 0, len(t.traces))
+	for i := range t.traces {
+		c := t.traces[(t.next+i)%len(t.traces)]
+		m := data.Map{
+			"time":     data.Timestamp(c.Time),
+			"method":   data.String(c.Method),
+			"args":     data.Array(c.Args),
+			"duration": data.Float(c.Duration.Seconds()),
+		}
+		if c.Result != nil {
+			m["result"] = c.Result
+		}
+		if c.Err != nil {
+			m["error"] = data.String(c.Err.Error())
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+// Trace returns the latest Python calls of the state recorded when
+// trace_calls is set. Each call has "time", "method", "args", "duration" in
+// seconds, and "result" or "error".
+func Trace(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupAuthorizedState(ctx, stateName, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if s.tracer == nil {
+		return data.Array{}, nil
+	}
+	return s.tracer.toArray(), nil
+}
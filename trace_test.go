@@ -0,0 +1,48 @@
+package pymlstate
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestCallTracer(t *testing.T) {
+	Convey("Given a call tracer of size 2", t, func() {
+		tr := newCallTracer(2)
+		now := time.Now()
+
+		Convey("When 3 calls are added", func() {
+			for i := 0; i < 3; i++ {
+				tr.add(callTrace{
+					Time:   now,
+					Method: "predict",
+					Args:   []data.Value{data.Int(i)},
+					Result: data.Int(i * 2),
+				})
+			}
+
+			Convey("Then the latest 2 calls should be returned from the oldest one", func() {
+				arr := tr.toArray()
+				So(len(arr), ShouldEqual, 2)
+				m0, _ := data.AsMap(arr[0])
+				m1, _ := data.AsMap(arr[1])
+				So(m0["args"], ShouldResemble, data.Array{data.Int(1)})
+				So(m1["args"], ShouldResemble, data.Array{data.Int(2)})
+				So(m1["result"], ShouldEqual, data.Int(4))
+			})
+		})
+
+		Convey("When a failed call is added", func() {
+			tr.add(callTrace{Time: now, Method: "fit", Err: fmt.Errorf("failure")})
+
+			Convey("Then it should have the error", func() {
+				m, _ := data.AsMap(tr.toArray()[0])
+				So(m["error"], ShouldEqual, data.String("failure"))
+				_, ok := m["result"]
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
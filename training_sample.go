@@ -0,0 +1,69 @@
+package pymlstate
+
+import (
+	"encoding/json"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// trainingSampler chooses records of each batch to be logged so that
+// records which the model is actually trained on can be audited.
+type trainingSampler struct {
+	size int
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newTrainingSampler(p *MLParams) *trainingSampler {
+	return &trainingSampler{
+		size: p.TrainingSampleSize,
+		rnd:  newRand(p, "training_sample"),
+	}
+}
+
+// sample returns at most size records chosen uniformly from the batch in
+// their order in the batch.
+func (t *trainingSampler) sample(batch []data.Value) []data.Value {
+	if len(batch) <= t.size {
+		return batch
+	}
+	t.mu.Lock()
+	idx := t.rnd.Perm(len(batch))[:t.size]
+	t.mu.Unlock()
+	sort.Ints(idx)
+	res := make([]data.Value, len(idx))
+	for i, j := range idx {
+		res[i] = batch[j]
+	}
+	return res
+}
+
+// logTrainingSample writes records sampled from the batch passed to the
+// method of the model to the log and emits EventTrainingSampled. It does
+// nothing when training_sample_size isn't set.
+func (s *State) logTrainingSample(ctx *core.Context, method string, batch []data.Value) {
+	if s.trainingSampler == nil || len(batch) == 0 {
+		return
+	}
+	sample := s.trainingSampler.sample(batch)
+	name, _ := s.name.Load().(string)
+	for _, rec := range sample {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			ctx.ErrLog(err).Warn("pymlstate cannot encode a sampled training record")
+			continue
+		}
+		ctx.Log().WithField("state", name).WithField("method", method).
+			WithField("batch_size", len(batch)).WithField("record", string(b)).
+			Info("pymlstate sampled a training record")
+	}
+	s.hooks.emit(Event{Type: EventTrainingSampled, Details: data.Map{
+		"method":     data.String(method),
+		"batch_size": data.Int(len(batch)),
+		"records":    data.Array(sample),
+	}})
+}
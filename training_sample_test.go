@@ -0,0 +1,81 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestTrainingSampler(t *testing.T) {
+	Convey("Given a training sampler", t, func() {
+		ts := newTrainingSampler(&MLParams{TrainingSampleSize: 3})
+		batch := []data.Value{data.Int(0), data.Int(1), data.Int(2), data.Int(3), data.Int(4)}
+
+		Convey("When a batch is sampled", func() {
+			sample := ts.sample(batch)
+
+			Convey("Then records should be sampled in their order", func() {
+				So(len(sample), ShouldEqual, 3)
+				prev := int64(-1)
+				for _, v := range sample {
+					n, _ := data.AsInt(v)
+					So(n, ShouldBeGreaterThan, prev)
+					prev = n
+				}
+			})
+		})
+
+		Convey("When a small batch is sampled", func() {
+			sample := ts.sample(batch[:2])
+
+			Convey("Then all records should be sampled", func() {
+				So(sample, ShouldResemble, batch[:2])
+			})
+		})
+	})
+
+	Convey("Given a state sampling training records", t, func() {
+		s := &State{
+			base: &fakeBackend{call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				return data.Float(0.5), nil
+			}},
+			params: MLParams{
+				BatchSize:          1,
+				TrainingSampleSize: 2,
+				NormalizePaths:     []string{"x"},
+			},
+		}
+		So(s.setUpParams(), ShouldBeNil)
+		events := []Event{}
+		s.OnEvent(func(e Event) {
+			if e.Type == EventTrainingSampled {
+				events = append(events, e)
+			}
+		})
+		ctx := core.NewContext(nil)
+
+		Convey("When a batch is trained", func() {
+			_, err := s.Fit(ctx, []data.Value{
+				data.Map{"x": data.Int(1), "label": data.Int(0)},
+				data.Map{"x": data.Int(3), "label": data.Int(1)},
+				data.Map{"x": data.Int(5), "label": data.Int(1)},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then preprocessed records should be sampled", func() {
+				So(len(events), ShouldEqual, 1)
+				d := events[0].Details
+				So(d["method"], ShouldEqual, data.String("fit"))
+				So(d["batch_size"], ShouldEqual, data.Int(3))
+				recs, _ := data.AsArray(d["records"])
+				So(len(recs), ShouldEqual, 2)
+				for _, r := range recs {
+					m, _ := data.AsMap(r)
+					So(m["x"].Type(), ShouldEqual, data.TypeFloat)
+					So(m, ShouldContainKey, "label")
+				}
+			})
+		})
+	})
+}
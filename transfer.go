@@ -0,0 +1,34 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync/atomic"
+)
+
+// transferStats counts approximate serialized bytes of values passed to and
+// returned from Python by each class of calls.
+type transferStats struct {
+	sent     [numCallClasses]int64
+	received [numCallClasses]int64
+}
+
+func (t *transferStats) add(class callClass, args []data.Value, res data.Value) {
+	var n int64
+	for _, a := range args {
+		n += approxSize(a)
+	}
+	atomic.AddInt64(&t.sent[class], n)
+	if res != nil {
+		atomic.AddInt64(&t.received[class], approxSize(res))
+	}
+}
+
+// toMap returns the numbers of bytes by "fit" and "predict" calls.
+func (t *transferStats) toMap() data.Map {
+	return data.Map{
+		"fit_sent":         data.Int(atomic.LoadInt64(&t.sent[callTrain])),
+		"fit_received":     data.Int(atomic.LoadInt64(&t.received[callTrain])),
+		"predict_sent":     data.Int(atomic.LoadInt64(&t.sent[callPredict])),
+		"predict_received": data.Int(atomic.LoadInt64(&t.received[callPredict])),
+	}
+}
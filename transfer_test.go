@@ -0,0 +1,27 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestTransferStats(t *testing.T) {
+	Convey("Given transfer stats", t, func() {
+		var ts transferStats
+
+		Convey("When fit and predict calls are counted", func() {
+			ts.add(callTrain, []data.Value{data.Array{data.String("abc")}}, data.Int(1))
+			ts.add(callPredict, []data.Value{data.String("abc")}, nil)
+
+			Convey("Then bytes should be split by the class", func() {
+				So(ts.toMap(), ShouldResemble, data.Map{
+					"fit_sent":         data.Int(5 + 8),
+					"fit_received":     data.Int(9),
+					"predict_sent":     data.Int(8),
+					"predict_received": data.Int(0),
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,249 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// validationSet holds out a fraction of records written to the state for
+// each label and keeps a bounded sample of them, so that the scheduled
+// evaluation compares models with the same stable set of records. Records
+// are kept before preprocessing because the evaluation preprocesses them.
+type validationSet struct {
+	labelPath string
+	path      data.Path
+	fraction  float64
+	size      int
+
+	mu     sync.Mutex
+	rnd    *rand.Rand
+	strata map[string]*validationStratum
+	// routed is the number of records held out for all labels.
+	routed int64
+	n      int
+}
+
+// validationStratum is the sample of records having a label. seen is the
+// number of records having the label and routed is the number of them held
+// out of training.
+type validationStratum struct {
+	label   data.Value
+	seen    int64
+	routed  int64
+	records []data.Value
+}
+
+func newValidationSet(p *MLParams) (*validationSet, error) {
+	path, err := data.CompilePath(p.ValidationLabelPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validation_label_path '%v': %v", p.ValidationLabelPath, err)
+	}
+	return &validationSet{
+		labelPath: p.ValidationLabelPath,
+		path:      path,
+		fraction:  p.ValidationFraction,
+		size:      p.ValidationSize,
+		rnd:       newRand(p, "validation"),
+		strata:    map[string]*validationStratum{},
+	}, nil
+}
+
+// labelOf returns the label of the record. It's null when the record doesn't
+// have the label.
+func (v *validationSet) labelOf(rec data.Value) data.Value {
+	m, err := data.AsMap(rec)
+	if err != nil {
+		return data.Null{}
+	}
+	l, err := m.Get(v.path)
+	if err != nil {
+		return data.Null{}
+	}
+	return l
+}
+
+// split holds out records of dataSet, which is a record or an array of
+// records, and returns the rest to be trained. It returns nil when all
+// records are held out. It returns dataSet as it is when v is nil.
+func (v *validationSet) split(dataSet data.Value) data.Value {
+	if v == nil {
+		return dataSet
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if dataSet.Type() != data.TypeArray {
+		if v.holdOut(dataSet) {
+			return nil
+		}
+		return dataSet
+	}
+
+	arr, _ := data.AsArray(dataSet)
+	res := make(data.Array, 0, len(arr))
+	for _, r := range arr {
+		if !v.holdOut(r) {
+			res = append(res, r)
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// holdOut returns true when the record is held out. A record is held out
+// when the fraction of held out records of its label would be fraction or
+// less, so every label keeps the same fraction.
+func (v *validationSet) holdOut(rec data.Value) bool {
+	label := v.labelOf(rec)
+	key := valueKey(label)
+	st, ok := v.strata[key]
+	if !ok {
+		st = &validationStratum{label: label}
+		v.strata[key] = st
+	}
+	st.seen++
+	if float64(st.routed+1) > v.fraction*float64(st.seen) {
+		return false
+	}
+	st.routed++
+	v.routed++
+	v.add(st, rec)
+	return true
+}
+
+// capacity returns the number of records which the stratum can keep. The
+// size is divided among labels by the number of their held out records.
+func (v *validationSet) capacity(st *validationStratum) int {
+	if v.routed == 0 {
+		return v.size
+	}
+	return int(math.Ceil(float64(v.size) * float64(st.routed) / float64(v.routed)))
+}
+
+// add adds the record to the stratum by reservoir sampling.
+func (v *validationSet) add(st *validationStratum, rec data.Value) {
+	if len(st.records) < v.capacity(st) {
+		st.records = append(st.records, rec)
+		v.n++
+	} else if i := v.rnd.Int63n(st.routed); i < int64(len(st.records)) {
+		st.records[i] = rec
+	}
+
+	v.shrink()
+}
+
+// shrink removes records from strata exceeding their capacities most while
+// the set is larger than its size.
+func (v *validationSet) shrink() {
+	for v.n > v.size {
+		var (
+			largest *validationStratum
+			excess  = math.Inf(-1)
+		)
+		for _, s := range v.strata {
+			if len(s.records) == 0 {
+				continue
+			}
+			if e := float64(len(s.records)) / float64(v.capacity(s)); e > excess {
+				largest, excess = s, e
+			}
+		}
+		i := v.rnd.Intn(len(largest.records))
+		last := len(largest.records) - 1
+		largest.records[i] = largest.records[last]
+		largest.records = largest.records[:last]
+		v.n--
+	}
+}
+
+// records returns all records in the set.
+func (v *validationSet) records() data.Array {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	res := make(data.Array, 0, v.n)
+	for _, key := range v.keys() {
+		res = append(res, v.strata[key].records...)
+	}
+	return res
+}
+
+// keys returns keys of strata in ascending order.
+func (v *validationSet) keys() []string {
+	keys := make([]string, 0, len(v.strata))
+	for k := range v.strata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// counts returns the number of records in the set for each label.
+func (v *validationSet) counts() data.Map {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	res := data.Map{}
+	for k, st := range v.strata {
+		res[k] = data.Int(len(st.records))
+	}
+	return res
+}
+
+// snapshot returns records in the set encoded in msgpack.
+func (v *validationSet) snapshot() ([]byte, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	strata := make(data.Array, 0, len(v.strata))
+	for _, key := range v.keys() {
+		st := v.strata[key]
+		strata = append(strata, data.Map{
+			"label":   st.label,
+			"seen":    data.Int(st.seen),
+			"routed":  data.Int(st.routed),
+			"records": data.Array(st.records),
+		})
+	}
+	return data.MarshalMsgpack(data.Map{"strata": strata})
+}
+
+// restore restores records encoded by snapshot. Records exceeding the size
+// of the set are discarded.
+func (v *validationSet) restore(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	m, err := data.UnmarshalMsgpack(b)
+	if err != nil {
+		return fmt.Errorf("cannot decode the validation set: %v", err)
+	}
+	strata, _ := data.AsArray(m["strata"])
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.strata = map[string]*validationStratum{}
+	v.routed = 0
+	v.n = 0
+	for _, e := range strata {
+		sm, err := data.AsMap(e)
+		if err != nil {
+			return fmt.Errorf("cannot decode the validation set: %v", err)
+		}
+		st := &validationStratum{label: sm["label"]}
+		if st.label == nil {
+			st.label = data.Null{}
+		}
+		st.seen, _ = data.AsInt(sm["seen"])
+		st.routed, _ = data.AsInt(sm["routed"])
+		recs, _ := data.AsArray(sm["records"])
+		st.records = recs
+		v.strata[valueKey(st.label)] = st
+		v.routed += st.routed
+		v.n += len(recs)
+	}
+	v.shrink()
+	return nil
+}
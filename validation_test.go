@@ -0,0 +1,132 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestValidationSet(t *testing.T) {
+	labeled := func(label string, x int) data.Value {
+		return data.Map{"label": data.String(label), "x": data.Int(x)}
+	}
+
+	Convey("Given a validation set holding out a quarter of records", t, func() {
+		seed := int64(1)
+		p := &MLParams{ValidationFraction: 0.25, ValidationSize: 10, ValidationLabelPath: "label", RandomSeed: &seed}
+		v, err := newValidationSet(p)
+		So(err, ShouldBeNil)
+
+		Convey("When records of two labels are split", func() {
+			trained := 0
+			for i := 0; i < 40; i++ {
+				label := "a"
+				if i%4 == 0 {
+					label = "b"
+				}
+				if v.split(labeled(label, i)) != nil {
+					trained++
+				}
+			}
+
+			Convey("Then a quarter of records of each label should be held out", func() {
+				So(trained, ShouldEqual, 31)
+				So(v.strata["a"].routed, ShouldEqual, 7)
+				So(v.strata["b"].routed, ShouldEqual, 2)
+			})
+
+			Convey("Then it should keep all held out records", func() {
+				So(v.counts(), ShouldResemble, data.Map{"a": data.Int(7), "b": data.Int(2)})
+				So(len(v.records()), ShouldEqual, 9)
+			})
+		})
+
+		Convey("When more records than its size are held out", func() {
+			for i := 0; i < 400; i++ {
+				label := "a"
+				if i%4 == 0 {
+					label = "b"
+				}
+				v.split(labeled(label, i))
+			}
+
+			Convey("Then it should keep its size divided among labels", func() {
+				So(len(v.records()), ShouldEqual, 10)
+				c := v.counts()
+				So(c["a"], ShouldBeBetweenOrEqual, data.Int(7), data.Int(8))
+				So(c["b"], ShouldBeBetweenOrEqual, data.Int(2), data.Int(3))
+			})
+
+			Convey("Then it should be restored from its snapshot", func() {
+				b, err := v.snapshot()
+				So(err, ShouldBeNil)
+				p.ValidationSize = 4
+				v2, err := newValidationSet(p)
+				So(err, ShouldBeNil)
+				So(v2.restore(b), ShouldBeNil)
+				So(len(v2.records()), ShouldEqual, 4)
+				So(v2.strata["a"].seen, ShouldEqual, 300)
+				So(v2.routed, ShouldEqual, v.routed)
+			})
+		})
+
+		Convey("When an array of records is split", func() {
+			arr := data.Array{labeled("a", 0), labeled("a", 1), labeled("a", 2), labeled("a", 3)}
+			res := v.split(arr)
+
+			Convey("Then the held out record should be removed from the array", func() {
+				So(res, ShouldResemble, data.Array{labeled("a", 0), labeled("a", 1), labeled("a", 2)})
+			})
+		})
+	})
+
+	Convey("Given a state with validation_fraction", t, func() {
+		ctx := core.NewContext(nil)
+		var evaluated data.Value
+		b := &fakeBackend{
+			call: func(funcName string, dt ...data.Value) (data.Value, error) {
+				if funcName == "evaluate" {
+					evaluated = dt[0]
+					return data.Float(0.5), nil
+				}
+				return data.Null{}, nil
+			},
+		}
+		s := &State{base: b, params: MLParams{BatchSize: 1, EvalMethod: "evaluate", EvalHistorySize: 10,
+			ValidationFraction: 0.5, ValidationSize: 10, ValidationLabelPath: "label"}}
+		So(s.setUpParams(), ShouldBeNil)
+
+		Convey("When tuples are written", func() {
+			for i := 0; i < 4; i++ {
+				So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": labeled("a", i)}}), ShouldBeNil)
+			}
+
+			Convey("Then held out records shouldn't be trained", func() {
+				So(b.calls, ShouldResemble, []string{"fit", "fit"})
+				So(s.Status()["validation_records"], ShouldResemble, data.Map{"a": data.Int(2)})
+			})
+
+			Convey("Then the evaluation should use the validation set", func() {
+				m, _, _, err := s.evaluateWith("", "evaluate")
+				So(err, ShouldBeNil)
+				So(m, ShouldEqual, 0.5)
+				So(evaluated, ShouldResemble, data.Array{labeled("a", 1), labeled("a", 3)})
+			})
+
+			Convey("Then the validation set should be kept when parameters are updated", func() {
+				s.params.ValidationSize = 5
+				So(s.setUpParams(), ShouldBeNil)
+				So(len(s.validation.records()), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the validation set is empty", func() {
+			_, _, _, err := s.evaluateWith("", "evaluate")
+
+			Convey("Then the evaluation should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
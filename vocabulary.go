@@ -0,0 +1,109 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// oovIndex is the index of values not in a vocabulary.
+const oovIndex = 0
+
+// vocabulary encodes categorical features to integer indexes. Indexes of
+// new values are assigned by records used for training while the
+// vocabulary has room. Indexes start from 1 and values not in the
+// vocabulary are encoded to oovIndex.
+type vocabulary struct {
+	names   []string
+	paths   []data.Path
+	maxSize int
+
+	// mu protects indexes because records can be processed concurrently by
+	// Fit and Predict, which only acquire the read lock of State.
+	mu      sync.Mutex
+	indexes []map[string]int64
+}
+
+var _ preprocessor = &vocabulary{}
+
+func newVocabulary(paths []string, maxSize int) (*vocabulary, error) {
+	ps, err := compilePaths(paths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vocabulary_paths: %v", err)
+	}
+	if maxSize < 0 {
+		return nil, fmt.Errorf("vocabulary_max_size must not be negative")
+	}
+	v := &vocabulary{
+		names:   paths,
+		paths:   ps,
+		maxSize: maxSize,
+		indexes: make([]map[string]int64, len(paths)),
+	}
+	for i := range v.indexes {
+		v.indexes[i] = map[string]int64{}
+	}
+	return v, nil
+}
+
+func (v *vocabulary) process(rec data.Map, training bool, rep *qualityReport) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i, p := range v.paths {
+		x, err := rec.Get(p)
+		if err != nil || x.Type() == data.TypeNull {
+			continue
+		}
+		switch x.Type() {
+		case data.TypeArray, data.TypeMap, data.TypeBlob:
+			rep.typeMismatch(v.names[i])
+			return fmt.Errorf("'%v' must be a categorical value: %v", v.names[i], x.Type())
+		}
+
+		idx := v.index(i, valueKey(x), training)
+		if err := rec.Set(p, data.Int(idx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *vocabulary) index(i int, key string, training bool) int64 {
+	voc := v.indexes[i]
+	if idx, ok := voc[key]; ok {
+		return idx
+	}
+	if !training || (v.maxSize > 0 && len(voc) >= v.maxSize) {
+		return oovIndex
+	}
+	idx := int64(len(voc) + 1)
+	voc[key] = idx
+	return idx
+}
+
+// snapshot returns a copy of vocabularies keyed by paths.
+func (v *vocabulary) snapshot() map[string]map[string]int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	res := make(map[string]map[string]int64, len(v.names))
+	for i, name := range v.names {
+		voc := make(map[string]int64, len(v.indexes[i]))
+		for k, idx := range v.indexes[i] {
+			voc[k] = idx
+		}
+		res[name] = voc
+	}
+	return res
+}
+
+// restore sets vocabularies saved by snapshot. Vocabularies of paths which
+// are no longer encoded are ignored.
+func (v *vocabulary) restore(vocs map[string]map[string]int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i, name := range v.names {
+		if voc, ok := vocs[name]; ok && voc != nil {
+			v.indexes[i] = voc
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestVocabulary(t *testing.T) {
+	Convey("Given a vocabulary having room for two values", t, func() {
+		v, err := newVocabulary([]string{"color"}, 2)
+		So(err, ShouldBeNil)
+
+		encode := func(x data.Value, training bool) data.Value {
+			rec := data.Map{"color": x}
+			So(v.process(rec, training, nil), ShouldBeNil)
+			return rec["color"]
+		}
+
+		Convey("When training records are processed", func() {
+			r := encode(data.String("red"), true)
+			b := encode(data.String("blue"), true)
+			g := encode(data.String("green"), true)
+
+			Convey("Then indexes should be assigned until it becomes full", func() {
+				So(r, ShouldEqual, data.Int(1))
+				So(b, ShouldEqual, data.Int(2))
+				So(g, ShouldEqual, data.Int(oovIndex))
+			})
+
+			Convey("Then known values should have the same indexes", func() {
+				So(encode(data.String("red"), true), ShouldEqual, data.Int(1))
+				So(encode(data.String("blue"), false), ShouldEqual, data.Int(2))
+			})
+
+			Convey("And when it's restored to another vocabulary", func() {
+				v2, err := newVocabulary([]string{"color"}, 0)
+				So(err, ShouldBeNil)
+				v2.restore(v.snapshot())
+
+				Convey("Then it should have the same indexes", func() {
+					So(v2.snapshot(), ShouldResemble, v.snapshot())
+				})
+			})
+		})
+
+		Convey("When an unknown value is processed for prediction", func() {
+			x := encode(data.String("red"), false)
+
+			Convey("Then it should be out of vocabulary", func() {
+				So(x, ShouldEqual, data.Int(oovIndex))
+				So(len(v.snapshot()["color"]), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a record having a map is processed", func() {
+			err := v.process(data.Map{"color": data.Map{}}, true, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,132 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// waitKind is a kind of waiting on the Go side.
+type waitKind int
+
+const (
+	// waitWriteLock is waiting for the lock of the state in Write.
+	waitWriteLock waitKind = iota
+
+	// waitPredictLock is waiting for the lock of the state in Predict.
+	waitPredictLock
+
+	// waitFitQueue is waiting in the queue of call_priority before "fit" and
+	// other calls of training are made.
+	waitFitQueue
+
+	// waitPredictQueue is waiting in the queue of call_priority before
+	// "predict" is called.
+	waitPredictQueue
+
+	numWaitKinds
+)
+
+var waitKindNames = [numWaitKinds]string{"write_lock", "predict_lock", "fit_queue", "predict_queue"}
+
+// waitBuckets are upper bounds of buckets of wait histograms in seconds.
+var waitBuckets = [...]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// waitHistogram is a histogram of durations of waiting. counts has a bucket
+// for each of waitBuckets and one for longer durations.
+type waitHistogram struct {
+	counts [len(waitBuckets) + 1]int64
+	sum    int64 // in nanoseconds
+}
+
+// waitStats has histograms of time spent waiting for locks and queues, which
+// tells whether slowness comes from Python or contention in Go.
+type waitStats struct {
+	hists [numWaitKinds]waitHistogram
+}
+
+func (w *waitStats) observe(kind waitKind, d time.Duration) {
+	h := &w.hists[kind]
+	i := len(waitBuckets)
+	for j, b := range waitBuckets {
+		if d.Seconds() <= b {
+			i = j
+			break
+		}
+	}
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// cumulative returns the number of observations less than or equal to each
+// of waitBuckets, the total count, and the sum in seconds.
+func (w *waitStats) cumulative(kind waitKind) ([]int64, int64, float64) {
+	h := &w.hists[kind]
+	res := make([]int64, len(waitBuckets))
+	var n int64
+	for i := range h.counts {
+		n += atomic.LoadInt64(&h.counts[i])
+		if i < len(res) {
+			res[i] = n
+		}
+	}
+	return res, n, time.Duration(atomic.LoadInt64(&h.sum)).Seconds()
+}
+
+// toMap returns histograms having "count", "sum" in seconds, and cumulative
+// "buckets" keyed by their upper bounds.
+func (w *waitStats) toMap() data.Map {
+	res := data.Map{}
+	for k := waitKind(0); k < numWaitKinds; k++ {
+		cum, n, sum := w.cumulative(k)
+		buckets := data.Map{}
+		for i, b := range waitBuckets {
+			buckets[formatBucket(b)] = data.Int(cum[i])
+		}
+		res[waitKindNames[k]] = data.Map{
+			"count":   data.Int(n),
+			"sum":     data.Float(sum),
+			"buckets": buckets,
+		}
+	}
+	return res
+}
+
+func formatBucket(b float64) string {
+	return strconv.FormatFloat(b, 'g', -1, 64)
+}
+
+// prometheusLines returns samples of the histograms in the Prometheus text
+// format labeled with the state.
+func (w *waitStats) prometheusLines(state string) []string {
+	var res []string
+	for k := waitKind(0); k < numWaitKinds; k++ {
+		cum, n, sum := w.cumulative(k)
+		labels := fmt.Sprintf("state=%q,wait=%q", state, waitKindNames[k])
+		for i, b := range waitBuckets {
+			res = append(res, fmt.Sprintf("pymlstate_wait_seconds_bucket{%v,le=%q} %v\n", labels, formatBucket(b), cum[i]))
+		}
+		res = append(res,
+			fmt.Sprintf("pymlstate_wait_seconds_bucket{%v,le=\"+Inf\"} %v\n", labels, n),
+			fmt.Sprintf("pymlstate_wait_seconds_sum{%v} %v\n", labels, sum),
+			fmt.Sprintf("pymlstate_wait_seconds_count{%v} %v\n", labels, n))
+	}
+	return res
+}
+
+// lockForWrite acquires the write lock of the state and records the time
+// since start, which is when Write is called, so that the wait for the lock
+// in authorization is included.
+func (s *State) lockForWrite(start time.Time) {
+	s.rwm.Lock()
+	s.waits.observe(waitWriteLock, time.Now().Sub(start))
+}
+
+// lockForPredict acquires the read lock of the state and records the time
+// since start in the same way as lockForWrite.
+func (s *State) lockForPredict(start time.Time) {
+	s.rwm.RLock()
+	s.waits.observe(waitPredictLock, time.Now().Sub(start))
+}
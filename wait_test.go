@@ -0,0 +1,61 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestWaitStats(t *testing.T) {
+	Convey("Given wait stats", t, func() {
+		var w waitStats
+
+		Convey("When durations are observed", func() {
+			w.observe(waitWriteLock, 50*time.Microsecond)
+			w.observe(waitWriteLock, 3*time.Millisecond)
+			w.observe(waitWriteLock, 10*time.Second)
+
+			Convey("Then buckets should be cumulative", func() {
+				h := w.toMap()["write_lock"].(data.Map)
+				So(h["count"], ShouldEqual, data.Int(3))
+				So(h["sum"], ShouldAlmostEqual, 10.00305)
+				b := h["buckets"].(data.Map)
+				So(b["0.0001"], ShouldEqual, data.Int(1))
+				So(b["0.001"], ShouldEqual, data.Int(1))
+				So(b["0.005"], ShouldEqual, data.Int(2))
+				So(b["5"], ShouldEqual, data.Int(2))
+			})
+		})
+	})
+
+	Convey("Given a state waiting for its lock in Predict", t, func() {
+		ctx := core.NewContext(&core.ContextConfig{})
+		s := &State{base: &fakeBackend{}}
+		So(ctx.SharedStates.Add("model1", "pymlstate", s), ShouldBeNil)
+		s.rwm.Lock()
+		done := make(chan struct{})
+		go func() {
+			s.Predict(ctx, data.Map{"x": data.Int(1)})
+			close(done)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		s.rwm.Unlock()
+		<-done
+
+		Convey("When metrics are written in the Prometheus format", func() {
+			w := &bytes.Buffer{}
+			So(WritePrometheusMetrics(ctx, w), ShouldBeNil)
+
+			Convey("Then the wait should be in the histogram", func() {
+				out := w.String()
+				So(out, ShouldContainSubstring, "# TYPE pymlstate_wait_seconds histogram\n")
+				So(out, ShouldContainSubstring, `pymlstate_wait_seconds_bucket{state="model1",wait="predict_lock",le="0.01"} 0`+"\n")
+				So(out, ShouldContainSubstring, `pymlstate_wait_seconds_count{state="model1",wait="predict_lock"} 1`+"\n")
+				So(out, ShouldContainSubstring, `pymlstate_wait_seconds_count{state="model1",wait="predict_queue"} 1`+"\n")
+			})
+		})
+	})
+}
@@ -0,0 +1,233 @@
+package pymlstate
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// walEntry is a preprocessed training record accepted by Write and the
+// timestamp of its tuple.
+type walEntry struct {
+	rec data.Value
+	ts  time.Time
+}
+
+// writeAheadLog appends training records to a file before they're buffered
+// so that records of buckets which haven't been checkpointed can be trained
+// again after a crash. Each entry is a msgpack map prefixed by its size in
+// 4 bytes. The file is synced for every entry.
+type writeAheadLog struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+	n  int
+}
+
+// openWAL opens the log at the path and returns its entries. A broken entry
+// at the end, which is written partially when the process crashed, is
+// ignored.
+func openWAL(path string) (*writeAheadLog, []walEntry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open the write-ahead log: %v", err)
+	}
+	entries, size, err := readWALEntries(f)
+	if err == nil {
+		// Removes the broken entry so that new entries are readable.
+		if err = f.Truncate(size); err == nil {
+			_, err = f.Seek(size, io.SeekStart)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("cannot read the write-ahead log: %v", err)
+	}
+	return &writeAheadLog{path: path, f: f, n: len(entries)}, entries, nil
+}
+
+// readWALEntries reads entries until the end of r or a broken entry. It
+// returns the size of valid entries.
+func readWALEntries(r io.Reader) ([]walEntry, int64, error) {
+	br := bufio.NewReader(r)
+	var (
+		entries []walEntry
+		size    int64
+	)
+	for {
+		var n uint32
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return entries, size, nil
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return entries, size, nil
+		}
+		m, err := data.UnmarshalMsgpack(b)
+		if err != nil {
+			return entries, size, nil
+		}
+		e := walEntry{rec: m["data"]}
+		if ts, err := data.AsTimestamp(m["ts"]); err == nil {
+			e.ts = ts
+		}
+		entries = append(entries, e)
+		size += 4 + int64(n)
+	}
+}
+
+func encodeWALEntry(e walEntry) ([]byte, error) {
+	b, err := data.MarshalMsgpack(data.Map{
+		"data": e.rec,
+		"ts":   data.Timestamp(e.ts),
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]byte, 4, 4+len(b))
+	binary.LittleEndian.PutUint32(res, uint32(len(b)))
+	return append(res, b...), nil
+}
+
+// append writes the entry and syncs the file.
+func (w *writeAheadLog) append(e walEntry) error {
+	b, err := encodeWALEntry(e)
+	if err != nil {
+		return fmt.Errorf("cannot encode a record for the write-ahead log: %v", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.f.Write(b); err != nil {
+		return fmt.Errorf("cannot write to the write-ahead log: %v", err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("cannot sync the write-ahead log: %v", err)
+	}
+	w.n++
+	return nil
+}
+
+// rewrite replaces the log with the entries. It's called after a checkpoint
+// is written so that only records which haven't been trained remain.
+func (w *writeAheadLog) rewrite(entries []walEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	for _, e := range entries {
+		b, err := encodeWALEntry(e)
+		if err == nil {
+			_, err = bw.Write(b)
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := bw.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	f.Close()
+
+	nf, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	w.f.Close()
+	w.f = nf
+	w.n = len(entries)
+	return nil
+}
+
+func (w *writeAheadLog) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// close closes the log. It does nothing when w is nil.
+func (w *writeAheadLog) close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// openWAL opens the write-ahead log of wal_path and trains records in it
+// again. It must be called once the state is created or loaded.
+func (s *State) openWAL(ctx *core.Context) error {
+	if s.params.WALPath == "" {
+		return nil
+	}
+	w, entries, err := openWAL(s.params.WALPath)
+	if err != nil {
+		return err
+	}
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	for _, e := range entries {
+		if err := s.writeRecord(ctx, e.rec, e.ts); err != nil {
+			ctx.ErrLog(err).Warn("pymlstate cannot train a record of the write-ahead log")
+		}
+	}
+	s.wal = w
+	if len(entries) > 0 {
+		ctx.Log().WithField("records", len(entries)).WithField("path", s.params.WALPath).
+			Info("pymlstate recovered records from the write-ahead log")
+	}
+	return nil
+}
+
+// bufferedEntries returns records which are buffered and not trained yet.
+func (s *State) bufferedEntries() []walEntry {
+	entries := make([]walEntry, 0, len(s.bucket))
+	add := func(recs []data.Value, times []time.Time) {
+		for i, r := range recs {
+			e := walEntry{rec: r}
+			if i < len(times) {
+				e.ts = times[i]
+			}
+			entries = append(entries, e)
+		}
+	}
+	if s.params.BatchSize > 1 {
+		add(s.bucket, s.bucketTimes)
+	}
+	if s.channels != nil {
+		for _, name := range s.channels.names() {
+			b := s.channels.buckets[name]
+			add(b.records, b.times)
+		}
+	}
+	if s.keyedBuckets != nil {
+		for _, b := range s.keyedBuckets.buckets {
+			add(b.records, b.times)
+		}
+	}
+	return entries
+}
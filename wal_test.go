@@ -0,0 +1,118 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteAheadLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pymlstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	Convey("Given a write-ahead log having records", t, func() {
+		path := filepath.Join(dir, "train.wal")
+		w, entries, err := openWAL(path)
+		So(err, ShouldBeNil)
+		So(entries, ShouldBeEmpty)
+		So(w.append(walEntry{rec: data.Map{"x": data.Int(1)}, ts: ts}), ShouldBeNil)
+		So(w.append(walEntry{rec: data.Map{"x": data.Int(2)}, ts: ts}), ShouldBeNil)
+		So(w.close(), ShouldBeNil)
+		Reset(func() {
+			os.Remove(path)
+		})
+
+		Convey("When it's opened again", func() {
+			w, entries, err := openWAL(path)
+			So(err, ShouldBeNil)
+			defer w.close()
+
+			Convey("Then it should return the records", func() {
+				So(entries, ShouldHaveLength, 2)
+				So(entries[1].rec, ShouldResemble, data.Map{"x": data.Int(2)})
+				So(entries[1].ts.Equal(ts), ShouldBeTrue)
+				So(w.len(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When its last record is broken", func() {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+			So(err, ShouldBeNil)
+			f.Write([]byte{10, 0, 0, 0, 1})
+			f.Close()
+			w, entries, err := openWAL(path)
+			So(err, ShouldBeNil)
+			So(w.append(walEntry{rec: data.Map{"x": data.Int(3)}, ts: ts}), ShouldBeNil)
+			w.close()
+
+			Convey("Then the broken record should be removed", func() {
+				So(entries, ShouldHaveLength, 2)
+				_, entries, err := openWAL(path)
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 3)
+				So(entries[2].rec, ShouldResemble, data.Map{"x": data.Int(3)})
+			})
+		})
+
+		Convey("When it's rewritten", func() {
+			w, _, err := openWAL(path)
+			So(err, ShouldBeNil)
+			So(w.rewrite([]walEntry{{rec: data.Map{"x": data.Int(9)}, ts: ts}}), ShouldBeNil)
+			So(w.append(walEntry{rec: data.Map{"x": data.Int(10)}, ts: ts}), ShouldBeNil)
+			w.close()
+
+			Convey("Then it should only have the new records", func() {
+				_, entries, err := openWAL(path)
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 2)
+				So(entries[0].rec, ShouldResemble, data.Map{"x": data.Int(9)})
+				So(entries[1].rec, ShouldResemble, data.Map{"x": data.Int(10)})
+			})
+		})
+
+		Convey("When a state is created with the log", func() {
+			b := &fakeBackend{}
+			s := &State{base: b, params: MLParams{BatchSize: 3, WALPath: path}}
+			So(s.openWAL(core.NewContext(nil)), ShouldBeNil)
+			defer s.wal.close()
+
+			Convey("Then the records should be buffered again", func() {
+				So(s.bucket, ShouldResemble, []data.Value{
+					data.Map{"x": data.Int(1)},
+					data.Map{"x": data.Int(2)},
+				})
+				So(s.bufferedEntries(), ShouldHaveLength, 2)
+				So(b.calls, ShouldBeEmpty)
+			})
+
+			Convey("And the records are trained", func() {
+				So(s.setUpParams(), ShouldBeNil)
+				s.bucket = nil
+				ctx := core.NewContext(nil)
+
+				Convey("Then exporting the state shouldn't truncate the log", func() {
+					So(s.save(ctx, ioutil.Discard, data.Map{}, false), ShouldBeNil)
+					_, entries, err := openWAL(path)
+					So(err, ShouldBeNil)
+					So(entries, ShouldHaveLength, 2)
+				})
+
+				Convey("Then saving the state should truncate the log", func() {
+					So(s.Save(ctx, ioutil.Discard, data.Map{}), ShouldBeNil)
+					_, entries, err := openWAL(path)
+					So(err, ShouldBeNil)
+					So(entries, ShouldBeEmpty)
+				})
+			})
+		})
+	})
+}
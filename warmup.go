@@ -0,0 +1,45 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"time"
+)
+
+// warmUp calls "predict" of the instance b with each record of
+// warmup_samples, so that initialization costs of the model such as JIT
+// compilation aren't paid by the first real prediction. Records are
+// preprocessed in the same way as Predict without updating statistics.
+// Results are discarded and failures are only logged.
+func (s *State) warmUp(ctx *core.Context, b Backend) {
+	if s.params.WarmupSamples == "" {
+		return
+	}
+	l := ctx.Log().WithField("uri", s.params.WarmupSamples)
+	recs, err := readDataset(s.params.WarmupSamples)
+	if err != nil {
+		l.WithField("err", err).Error("pymlstate cannot read warm-up samples")
+		return
+	}
+
+	start := time.Now()
+	failures := 0
+	for _, r := range recs {
+		dt, err := s.redact(r)
+		if err == nil {
+			dt, err = s.preprocess(dt, preprocessInspect, nil)
+		}
+		if err == nil && dt != nil {
+			_, err = s.callBackend(b, callPredict, "predict", dt)
+		}
+		if err != nil {
+			failures++
+		}
+	}
+	l = l.WithField("samples", len(recs)).WithField("failures", failures).
+		WithField("elapsed", time.Now().Sub(start).String())
+	if failures > 0 {
+		l.Warn("pymlstate's warm-up predictions failed")
+		return
+	}
+	l.Info("pymlstate warmed up the model")
+}
@@ -0,0 +1,49 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWarmUp(t *testing.T) {
+	ctx := core.NewContext(nil)
+	dir, err := ioutil.TempDir("", "pymlstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "warmup.jsonl")
+	if err := ioutil.WriteFile(path, []byte("{\"x\": 1}\n{\"x\": 2}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Given a state with warmup_samples", t, func() {
+		b := &fakeBackend{}
+		s := &State{base: b, params: MLParams{WarmupSamples: path}}
+
+		Convey("When the model is warmed up", func() {
+			s.warmUp(ctx, b)
+
+			Convey("Then predict should be called with each sample", func() {
+				So(b.calls, ShouldResemble, []string{"predict", "predict"})
+			})
+		})
+	})
+
+	Convey("Given a state without warmup_samples", t, func() {
+		b := &fakeBackend{}
+		s := &State{base: b}
+
+		Convey("When the model is warmed up", func() {
+			s.warmUp(ctx, b)
+
+			Convey("Then predict shouldn't be called", func() {
+				So(b.calls, ShouldBeEmpty)
+			})
+		})
+	})
+}
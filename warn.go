@@ -0,0 +1,74 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// warnLimiter limits warning logs to one per category in each interval. It
+// counts all warnings including suppressed ones. A nil warnLimiter doesn't
+// limit logs.
+type warnLimiter struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	categories map[string]*warnCategory
+}
+
+type warnCategory struct {
+	count      int64
+	suppressed int64
+	last       time.Time
+}
+
+func newWarnLimiter(interval time.Duration) *warnLimiter {
+	return &warnLimiter{
+		interval:   interval,
+		categories: map[string]*warnCategory{},
+	}
+}
+
+func (w *warnLimiter) setInterval(interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.interval = interval
+}
+
+// warn counts a warning of the category and calls log when the category
+// hasn't been logged in the interval. suppressed is the number of warnings
+// of the category suppressed since the last log.
+func (w *warnLimiter) warn(category string, log func(suppressed int64)) {
+	if w == nil {
+		log(0)
+		return
+	}
+	now := time.Now()
+	w.mu.Lock()
+	c, ok := w.categories[category]
+	if !ok {
+		c = &warnCategory{}
+		w.categories[category] = c
+	}
+	c.count++
+	if ok && now.Sub(c.last) < w.interval {
+		c.suppressed++
+		w.mu.Unlock()
+		return
+	}
+	suppressed := c.suppressed
+	c.suppressed = 0
+	c.last = now
+	w.mu.Unlock()
+	log(suppressed)
+}
+
+// counts returns the number of warnings of each category.
+func (w *warnLimiter) counts() data.Map {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	m := data.Map{}
+	for k, c := range w.categories {
+		m[k] = data.Int(c.count)
+	}
+	return m
+}
@@ -0,0 +1,60 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestWarnLimiter(t *testing.T) {
+	Convey("Given a warn limiter with a long interval", t, func() {
+		w := newWarnLimiter(time.Hour)
+
+		Convey("When the same warning is repeated", func() {
+			var logs []int64
+			for i := 0; i < 5; i++ {
+				w.warn("dropped", func(suppressed int64) {
+					logs = append(logs, suppressed)
+				})
+			}
+			w.warn("malformed", func(suppressed int64) {
+				logs = append(logs, suppressed)
+			})
+
+			Convey("Then only the first warning of each category should be logged", func() {
+				So(logs, ShouldResemble, []int64{0, 0})
+			})
+
+			Convey("Then all warnings should be counted", func() {
+				So(w.counts(), ShouldResemble, data.Map{
+					"dropped":   data.Int(5),
+					"malformed": data.Int(1),
+				})
+			})
+
+			Convey("Then the next log should report suppressed warnings", func() {
+				w.setInterval(0)
+				w.warn("dropped", func(suppressed int64) {
+					logs = append(logs, suppressed)
+				})
+				So(logs, ShouldResemble, []int64{0, 0, 4})
+			})
+		})
+	})
+
+	Convey("Given a nil warn limiter", t, func() {
+		var w *warnLimiter
+
+		Convey("When a warning is given", func() {
+			logged := false
+			w.warn("dropped", func(int64) {
+				logged = true
+			})
+
+			Convey("Then it should be logged", func() {
+				So(logged, ShouldBeTrue)
+			})
+		})
+	})
+}
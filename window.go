@@ -0,0 +1,277 @@
+package pymlstate
+
+import (
+	"container/list"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WindowFeature is a feature aggregated over a sliding window of recent
+// training records having the same key. The aggregated value is set at
+// Output of each record. Aggregate is "count", which is the number of
+// records (having a value at Path if it's given), "mean", which is the mean
+// of numbers at Path, or "last", which is an array of values at Path from
+// the oldest. The window has at most Size records and only has records
+// observed within Range. At least one of them must be given.
+type WindowFeature struct {
+	Output    string        `codec:"output"`
+	Path      string        `codec:"path"`
+	Aggregate string        `codec:"aggregate"`
+	Size      int           `codec:"size"`
+	Range     time.Duration `codec:"range"`
+}
+
+// windowAggregator maintains windows of features for each key and appends
+// aggregated values to records. Only training records are added to windows,
+// but a record is aggregated together with its window so that training and
+// prediction see the same features. Windows are kept in memory in
+// processing time and they aren't saved with the model.
+type windowAggregator struct {
+	keyPath  data.Path
+	features []windowFeature
+	maxKeys  int
+	now      func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*list.Element
+	lru  *list.List
+}
+
+type windowFeature struct {
+	WindowFeature
+	output data.Path
+	path   data.Path
+}
+
+type windowKey struct {
+	key     string
+	windows [][]windowEntry
+}
+
+type windowEntry struct {
+	time  time.Time
+	value data.Value
+}
+
+var _ preprocessor = &windowAggregator{}
+
+func newWindowAggregator(p *MLParams) (*windowAggregator, error) {
+	w := &windowAggregator{
+		maxKeys: p.WindowMaxKeys,
+		now:     time.Now,
+		keys:    map[string]*list.Element{},
+		lru:     list.New(),
+	}
+	if p.WindowKeyPath != "" {
+		kp, err := data.CompilePath(p.WindowKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window_key_path '%v': %v", p.WindowKeyPath, err)
+		}
+		w.keyPath = kp
+	}
+	for _, f := range p.WindowFeatures {
+		wf := windowFeature{WindowFeature: f}
+		var err error
+		if wf.output, err = data.CompilePath(f.Output); err != nil {
+			return nil, fmt.Errorf("invalid output of the window feature '%v': %v", f.Output, err)
+		}
+		if f.Path != "" {
+			if wf.path, err = data.CompilePath(f.Path); err != nil {
+				return nil, fmt.Errorf("invalid path of the window feature '%v': %v", f.Output, err)
+			}
+		}
+		switch f.Aggregate {
+		case "count":
+		case "mean", "last":
+			if f.Path == "" {
+				return nil, fmt.Errorf("the window feature '%v' must have path", f.Output)
+			}
+		default:
+			return nil, fmt.Errorf("unknown aggregate of the window feature '%v': %v", f.Output, f.Aggregate)
+		}
+		if f.Size <= 0 && f.Range <= 0 {
+			return nil, fmt.Errorf("the window feature '%v' must have size or range", f.Output)
+		}
+		w.features = append(w.features, wf)
+	}
+	return w, nil
+}
+
+// keyOf returns the key of the record. All records have the same key when
+// window_key_path isn't given.
+func (w *windowAggregator) keyOf(rec data.Map) string {
+	if w.keyPath == nil {
+		return ""
+	}
+	v, err := rec.Get(w.keyPath)
+	if err != nil {
+		return ""
+	}
+	return valueKey(v)
+}
+
+func (w *windowAggregator) process(rec data.Map, training bool, rep *qualityReport) error {
+	now := w.now()
+	values := make([]data.Value, len(w.features))
+	for i, f := range w.features {
+		if f.path == nil {
+			values[i] = data.Null{}
+			continue
+		}
+		v, err := rec.Get(f.path)
+		if err != nil || v.Type() == data.TypeNull {
+			continue
+		}
+		if f.Aggregate == "mean" {
+			if _, err := asNumber(v); err != nil {
+				rep.typeMismatch(f.Path)
+				return fmt.Errorf("'%v' must be a number to compute its mean: %v", f.Path, v.Type())
+			}
+		}
+		values[i] = v
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k := w.window(w.keyOf(rec), training)
+	for i, f := range w.features {
+		var entries []windowEntry
+		if k != nil {
+			k.windows[i] = f.expire(k.windows[i], now)
+			entries = k.windows[i]
+		}
+		if values[i] != nil {
+			entries = append(entries, windowEntry{now, values[i]})
+			entries = f.expire(entries, now)
+			if training {
+				k.windows[i] = entries
+			}
+		}
+		if err := rec.Set(f.output, f.aggregate(entries)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// window returns windows of the key. When create is true, windows are
+// created if the key doesn't have them and the least recently used key is
+// removed when there're more than maxKeys keys. It returns nil when the key
+// doesn't have windows and create is false.
+func (w *windowAggregator) window(key string, create bool) *windowKey {
+	if e, ok := w.keys[key]; ok {
+		w.lru.MoveToFront(e)
+		return e.Value.(*windowKey)
+	}
+	if !create {
+		return nil
+	}
+	k := &windowKey{key: key, windows: make([][]windowEntry, len(w.features))}
+	w.keys[key] = w.lru.PushFront(k)
+	for w.maxKeys > 0 && w.lru.Len() > w.maxKeys {
+		e := w.lru.Back()
+		w.lru.Remove(e)
+		delete(w.keys, e.Value.(*windowKey).key)
+	}
+	return k
+}
+
+// expire removes entries out of the window.
+func (f *windowFeature) expire(entries []windowEntry, now time.Time) []windowEntry {
+	if f.Size > 0 && len(entries) > f.Size {
+		entries = entries[len(entries)-f.Size:]
+	}
+	if f.Range > 0 {
+		i := sort.Search(len(entries), func(i int) bool {
+			return now.Sub(entries[i].time) <= f.Range
+		})
+		entries = entries[i:]
+	}
+	return entries
+}
+
+func (f *windowFeature) aggregate(entries []windowEntry) data.Value {
+	switch f.Aggregate {
+	case "count":
+		return data.Int(len(entries))
+	case "mean":
+		if len(entries) == 0 {
+			return data.Null{}
+		}
+		sum := 0.0
+		for _, e := range entries {
+			x, _ := asNumber(e.value)
+			sum += x
+		}
+		return data.Float(sum / float64(len(entries)))
+	default: // last
+		res := make(data.Array, len(entries))
+		for i, e := range entries {
+			res[i] = e.value
+		}
+		return res
+	}
+}
+
+// len returns the number of keys having windows.
+func (w *windowAggregator) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.keys)
+}
+
+func parseWindowFeatures(v data.Value) ([]WindowFeature, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("window_features must be a map: %v", err)
+	}
+	outputs := make([]string, 0, len(m))
+	for o := range m {
+		outputs = append(outputs, o)
+	}
+	sort.Strings(outputs)
+
+	features := make([]WindowFeature, 0, len(m))
+	for _, o := range outputs {
+		fm, err := data.AsMap(m[o])
+		if err != nil {
+			return nil, fmt.Errorf("window feature '%v' must be a map: %v", o, err)
+		}
+		f := WindowFeature{Output: o}
+		for k, x := range fm {
+			switch k {
+			case "path":
+				if f.Path, err = data.AsString(x); err != nil {
+					return nil, fmt.Errorf("path of window feature '%v' must be a string: %v", o, err)
+				}
+			case "aggregate":
+				if f.Aggregate, err = data.AsString(x); err != nil {
+					return nil, fmt.Errorf("aggregate of window feature '%v' must be a string: %v", o, err)
+				}
+			case "size":
+				n, err := data.AsInt(x)
+				if err != nil {
+					return nil, fmt.Errorf("size of window feature '%v' must be an integer: %v", o, err)
+				}
+				if n <= 0 {
+					return nil, fmt.Errorf("size of window feature '%v' must be greater than 0", o)
+				}
+				f.Size = int(n)
+			case "range":
+				if f.Range, err = asDuration(x); err != nil {
+					return nil, fmt.Errorf("range of window feature '%v' must be a duration: %v", o, err)
+				}
+				if f.Range <= 0 {
+					return nil, fmt.Errorf("range of window feature '%v' must be greater than 0", o)
+				}
+			default:
+				return nil, fmt.Errorf("unknown parameter of window feature '%v': %v", o, k)
+			}
+		}
+		features = append(features, f)
+	}
+	return features, nil
+}
@@ -0,0 +1,93 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestWindowAggregator(t *testing.T) {
+	Convey("Given a window aggregator keyed by users", t, func() {
+		v, err := parseWindowFeatures(data.Map{
+			"count":  data.Map{"aggregate": data.String("count"), "range": data.String("1m")},
+			"mean":   data.Map{"aggregate": data.String("mean"), "path": data.String("x"), "size": data.Int(2)},
+			"recent": data.Map{"aggregate": data.String("last"), "path": data.String("x"), "size": data.Int(3)},
+		})
+		So(err, ShouldBeNil)
+		w, err := newWindowAggregator(&MLParams{WindowFeatures: v, WindowKeyPath: "user", WindowMaxKeys: 2})
+		So(err, ShouldBeNil)
+		now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+		w.now = func() time.Time { return now }
+
+		process := func(user string, x int, training bool) data.Map {
+			rec := data.Map{"user": data.String(user), "x": data.Int(x)}
+			So(w.process(rec, training, nil), ShouldBeNil)
+			return rec
+		}
+
+		Convey("When training records are processed", func() {
+			process("a", 1, true)
+			process("a", 2, true)
+			now = now.Add(30 * time.Second)
+			rec := process("a", 6, true)
+
+			Convey("Then aggregates of their windows should be set", func() {
+				So(rec["count"], ShouldEqual, data.Int(3))
+				So(rec["mean"], ShouldEqual, data.Float(4))
+				So(rec["recent"], ShouldResemble, data.Array{data.Int(1), data.Int(2), data.Int(6)})
+			})
+
+			Convey("Then records of other keys should have their own windows", func() {
+				rec := process("b", 10, true)
+				So(rec["count"], ShouldEqual, data.Int(1))
+				So(rec["recent"], ShouldResemble, data.Array{data.Int(10)})
+			})
+
+			Convey("Then records out of the range should expire", func() {
+				now = now.Add(45 * time.Second)
+				rec := process("a", 0, true)
+				So(rec["count"], ShouldEqual, data.Int(2))
+			})
+
+			Convey("Then prediction records should be aggregated without updating windows", func() {
+				rec := process("a", 10, false)
+				So(rec["recent"], ShouldResemble, data.Array{data.Int(2), data.Int(6), data.Int(10)})
+				rec = process("a", 4, false)
+				So(rec["recent"], ShouldResemble, data.Array{data.Int(2), data.Int(6), data.Int(4)})
+			})
+
+			Convey("Then the least recently used key should be removed", func() {
+				process("b", 1, true)
+				process("c", 1, true)
+				So(w.len(), ShouldEqual, 2)
+				rec := process("a", 3, false)
+				So(rec["count"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When a record having a non-numeric value is processed", func() {
+			err := w.process(data.Map{"user": data.String("a"), "x": data.String("x")}, true, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given window features without bounds", t, func() {
+		_, err := newWindowAggregator(&MLParams{WindowFeatures: []WindowFeature{{Output: "c", Aggregate: "count"}}})
+
+		Convey("Then the aggregator shouldn't be created", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given window features having an unknown aggregate", t, func() {
+		_, err := newWindowAggregator(&MLParams{WindowFeatures: []WindowFeature{{Output: "c", Aggregate: "median", Size: 1}}})
+
+		Convey("Then the aggregator shouldn't be created", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,54 @@
+package pymlstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// encodeWire converts arguments of a Python call into JSON strings when
+// wire_format is "json". When it's "arrow", the bucket passed to "fit" is
+// encoded as an Arrow IPC stream.
+func (s *State) encodeWire(class callClass, args []data.Value) ([]data.Value, error) {
+	switch s.params.WireFormat {
+	case "json":
+	case "arrow":
+		if class != callTrain || len(args) == 0 || args[0].Type() != data.TypeArray {
+			return args, nil
+		}
+		bucket, _ := data.AsArray(args[0])
+		b, err := encodeArrow(bucket)
+		if err != nil {
+			return nil, err
+		}
+		res := make([]data.Value, len(args))
+		copy(res, args)
+		res[0] = data.Blob(b)
+		return res, nil
+	default:
+		return args, nil
+	}
+	res := make([]data.Value, len(args))
+	for i, a := range args {
+		b, err := json.Marshal(a)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode an argument in JSON: %v", err)
+		}
+		res[i] = data.String(b)
+	}
+	return res, nil
+}
+
+// decodeWire decodes the result of a Python call when wire_format is "json"
+// and the result is a string. Other results are returned as they are.
+func (s *State) decodeWire(res data.Value) (data.Value, error) {
+	if s.params.WireFormat != "json" || res == nil || res.Type() != data.TypeString {
+		return res, nil
+	}
+	str, _ := data.AsString(res)
+	var v interface{}
+	if err := json.Unmarshal([]byte(str), &v); err != nil {
+		return nil, fmt.Errorf("cannot decode the result in JSON: %v", err)
+	}
+	return data.NewValue(v)
+}
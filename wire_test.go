@@ -0,0 +1,56 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestWireFormat(t *testing.T) {
+	Convey("Given a state with the JSON wire format", t, func() {
+		s := &State{params: MLParams{WireFormat: "json"}}
+
+		Convey("When arguments are encoded", func() {
+			args, err := s.encodeWire(callTrain, []data.Value{data.Array{data.Map{"x": data.Int(1)}}})
+
+			Convey("Then they should be JSON strings", func() {
+				So(err, ShouldBeNil)
+				So(args, ShouldResemble, []data.Value{data.String(`[{"x":1}]`)})
+			})
+		})
+
+		Convey("When a JSON result is decoded", func() {
+			res, err := s.decodeWire(data.String(`{"label":"a","score":0.5}`))
+
+			Convey("Then it should be converted to a value", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{
+					"label": data.String("a"),
+					"score": data.Float(0.5),
+				})
+			})
+		})
+
+		Convey("When a broken result is decoded", func() {
+			_, err := s.decodeWire(data.String("fit called"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a state with the native wire format", t, func() {
+		s := &State{params: MLParams{WireFormat: "native"}}
+
+		Convey("When values are encoded and decoded", func() {
+			args, _ := s.encodeWire(callTrain, []data.Value{data.Int(1)})
+			res, _ := s.decodeWire(data.String("fit called"))
+
+			Convey("Then they should be returned as they are", func() {
+				So(args, ShouldResemble, []data.Value{data.Int(1)})
+				So(res, ShouldEqual, data.String("fit called"))
+			})
+		})
+	})
+}